@@ -0,0 +1,99 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ErrMaxAckPendingReached - the consumer group holds MaxAckPending unacked messages, the broker delivers no
+// more messages until some of them are acked or their MaxAckTime passes.
+var ErrMaxAckPendingReached = errors.New("max ack pending reached")
+
+// MaxAckPending - the maximum number of messages delivered to the consumer group and not acked yet, so slow
+// handlers don't accumulate an unbounded number of unacked messages. The limit is set on the consumer group
+// and applies to all of its consumers. When it throttles delivery ErrMaxAckPendingReached is passed to the
+// error handler.
+func MaxAckPending(maxAckPending int) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if maxAckPending < 1 {
+			return errors.New("max ack pending has to be at least 1")
+		}
+		opts.MaxAckPending = maxAckPending
+		return nil
+	}
+}
+
+// ackPendingCheckInterval - how often an empty fetch may ask the broker for the consumer's unacked messages.
+const ackPendingCheckInterval = 5 * time.Second
+
+// applyMaxAckPending - brings the consumer group's JetStream consumers in jsConsumers in line with the consumer's MaxAckPending.
+func (c *Consumer) applyMaxAckPending(jsConsumers map[int]jetstream.Consumer, options ...RequestOpt) error {
+	if c.maxAckPending == 0 {
+		return nil
+	}
+	return c.updateJetstreamConsumers(jsConsumers, func(cfg *jetstream.ConsumerConfig) bool {
+		if cfg.MaxAckPending == c.maxAckPending {
+			return false
+		}
+		cfg.MaxAckPending = c.maxAckPending
+		return true
+	}, options...)
+}
+
+// checkAckPending - reports ErrMaxAckPendingReached once when a fetch comes back empty because of the limit,
+// the report is rearmed as soon as messages are delivered again. Empty fetches which don't carry the broker's
+// max ack pending error look the unacked messages up at most once per ackPendingCheckInterval.
+func (c *Consumer) checkAckPending(jsCons jetstream.Consumer, received int, fetchErr error) {
+	if c.maxAckPending == 0 {
+		return
+	}
+	if received > 0 {
+		atomic.StoreInt32(&c.ackPendingThrottled, 0)
+		c.ackPendingMu.Lock()
+		c.ackPendingCheckedAt = time.Time{}
+		c.ackPendingMu.Unlock()
+		return
+	}
+	if atomic.LoadInt32(&c.ackPendingThrottled) == 1 {
+		return
+	}
+	throttled := fetchErr != nil && strings.Contains(strings.ToLower(fetchErr.Error()), "maxackpending")
+	if !throttled && fetchErr == nil && c.shouldCheckAckPending() {
+		ctx, cancel := c.conn.jetstreamContext(getDefaultRequestOptions())
+		info, err := jsCons.Info(ctx)
+		cancel()
+		throttled = err == nil && info.NumAckPending >= c.maxAckPending
+	}
+	if throttled && atomic.CompareAndSwapInt32(&c.ackPendingThrottled, 0, 1) {
+		c.callErrHandler(ErrMaxAckPendingReached)
+	}
+}
+
+// shouldCheckAckPending - whether ackPendingCheckInterval passed since the last unacked messages lookup.
+func (c *Consumer) shouldCheckAckPending() bool {
+	c.ackPendingMu.Lock()
+	defer c.ackPendingMu.Unlock()
+	now := c.clock().Now()
+	if !c.ackPendingCheckedAt.IsZero() && now.Sub(c.ackPendingCheckedAt) < ackPendingCheckInterval {
+		return false
+	}
+	c.ackPendingCheckedAt = now
+	return true
+}
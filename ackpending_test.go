@@ -0,0 +1,124 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ackPendingJsConsumer - delivers the queued batches and reports the given number of unacked messages.
+type ackPendingJsConsumer struct {
+	jetstream.Consumer
+	batches       []int
+	numAckPending int
+	infoCalls     int
+}
+
+func (f *ackPendingJsConsumer) Fetch(int, ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	n := 0
+	if len(f.batches) > 0 {
+		n, f.batches = f.batches[0], f.batches[1:]
+	}
+	msgs := make(chan jetstream.Msg, n)
+	for i := 0; i < n; i++ {
+		msgs <- &ackRecordingMsg{data: []byte("msg")}
+	}
+	close(msgs)
+	return fakeBatch{msgs: msgs}, nil
+}
+
+func (f *ackPendingJsConsumer) Info(context.Context) (*jetstream.ConsumerInfo, error) {
+	f.infoCalls++
+	return &jetstream.ConsumerInfo{NumAckPending: f.numAckPending}, nil
+}
+
+func TestMaxAckPendingReached(t *testing.T) {
+	js := &ackPendingJsConsumer{batches: []int{2, 0, 0, 1, 0}, numAckPending: 2}
+	var mu sync.Mutex
+	var reported []error
+	c := &Consumer{
+		BatchMaxTimeToWait: time.Second,
+		subscriptionActive: true,
+		maxAckPending:      2,
+		jsConsumers:        map[int]jetstream.Consumer{1: js},
+		conn:               &Conn{},
+		errHandler: func(_ *Consumer, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+	}
+
+	expected := []int{0, 1, 1, 1, 2}
+	for i, want := range expected {
+		if _, err := c.fetchSubscription(2, "", -1, fetchLimits{}); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		got := len(reported)
+		mu.Unlock()
+		if got != want {
+			t.Fatalf("fetch %d: %d reports, want %d", i, got, want)
+		}
+	}
+	for _, err := range reported {
+		if !errors.Is(err, ErrMaxAckPendingReached) {
+			t.Fatalf("reported %v, want ErrMaxAckPendingReached", err)
+		}
+	}
+
+	// below the limit an empty fetch just means the station is empty
+	js.batches, js.numAckPending = []int{0}, 1
+	atomic.StoreInt32(&c.ackPendingThrottled, 0)
+	if _, err := c.fetchSubscription(2, "", -1, fetchLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 2 {
+		t.Fatalf("an empty station should not be reported as throttled")
+	}
+
+	if err := MaxAckPending(0)(&ConsumerOpts{}); err == nil {
+		t.Fatalf("a max ack pending below 1 should be rejected")
+	}
+}
+
+func TestCheckAckPendingRateLimited(t *testing.T) {
+	js := &ackPendingJsConsumer{numAckPending: 1}
+	clock := &manualClock{now: time.Now()}
+	c := &Consumer{maxAckPending: 2, conn: &Conn{opts: Options{Clock: clock}}}
+
+	for i := 0; i < 10; i++ {
+		c.checkAckPending(js, 0, nil)
+	}
+	if js.infoCalls != 1 {
+		t.Fatalf("%d info calls within the check interval, want 1", js.infoCalls)
+	}
+	clock.advance(ackPendingCheckInterval)
+	c.checkAckPending(js, 0, nil)
+	if js.infoCalls != 2 {
+		t.Fatalf("%d info calls after the check interval, want 2", js.infoCalls)
+	}
+	c.checkAckPending(js, 1, nil)
+	c.checkAckPending(js, 0, nil)
+	if js.infoCalls != 3 {
+		t.Fatalf("%d info calls after a delivery, want 3", js.infoCalls)
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"gopkg.in/yaml.v3"
+)
+
+// ApplyAction - what Apply did with a resource of the manifest.
+type ApplyAction string
+
+const (
+	ApplyCreated   ApplyAction = "created"
+	ApplyUpdated   ApplyAction = "updated"
+	ApplyUnchanged ApplyAction = "unchanged"
+	ApplySkipped   ApplyAction = "skipped"
+)
+
+// ApplyResult - the outcome of reconciling a single resource of the manifest.
+type ApplyResult struct {
+	Kind   string // schema, station, attachment or user
+	Name   string
+	Action ApplyAction
+	Detail string // the drift of an existing station, or why the resource was skipped
+}
+
+// ApplyReport - the outcome of Apply, in the order the resources were reconciled.
+type ApplyReport struct {
+	Results []ApplyResult
+}
+
+// ApplyReport.Count - the number of resources Apply handled with action.
+func (r *ApplyReport) Count(action ApplyAction) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *ApplyReport) add(kind, name string, action ApplyAction, detail string) {
+	r.Results = append(r.Results, ApplyResult{Kind: kind, Name: name, Action: action, Detail: detail})
+}
+
+// Manifest - the desired topology of a broker, see Apply.
+type Manifest struct {
+	Templates   map[string]StationTemplate
+	Schemas     []ManifestSchema
+	Stations    []ManifestStation
+	Attachments []ManifestAttachment
+	Users       []ManifestUser
+}
+
+// ManifestSchema - a schema and its content, a changed content is uploaded as a new version.
+type ManifestSchema struct {
+	Name    string
+	Type    string // protobuf, json, graphql or avro
+	Content string
+}
+
+// ManifestStation - a station configured by Template, a template of the manifest or one registered on the
+// connection, or by Config. The default station options are used when neither is set.
+type ManifestStation struct {
+	Name     string
+	Template string
+	Config   *StationTemplate
+	Schema   string // enforced on the station, like an attachment
+}
+
+// ManifestAttachment - a schema enforced on a station.
+type ManifestAttachment struct {
+	Schema  string `yaml:"schema"`
+	Station string `yaml:"station"`
+}
+
+// ManifestUser - a broker user. Apply reports users as skipped, provision them with Conn.CreateUser.
+type ManifestUser struct {
+	Username string `yaml:"username"`
+	Type     string `yaml:"type"`
+}
+
+type manifestDoc struct {
+	Templates map[string]stationTemplateDoc `yaml:"templates"`
+	Schemas   []struct {
+		Name    string `yaml:"name"`
+		Type    string `yaml:"type"`
+		File    string `yaml:"file"`
+		Content string `yaml:"content"`
+	} `yaml:"schemas"`
+	Stations []struct {
+		Name     string              `yaml:"name"`
+		Template string              `yaml:"template"`
+		Config   *stationTemplateDoc `yaml:"config"`
+		Schema   string              `yaml:"schema"`
+	} `yaml:"stations"`
+	Attachments []ManifestAttachment `yaml:"attachments"`
+	Users       []ManifestUser       `yaml:"users"`
+}
+
+// ParseManifest - decodes a YAML or JSON manifest, schema files are read relative to the working directory.
+func ParseManifest(data []byte) (*Manifest, error) {
+	return parseManifest(data, "")
+}
+
+// LoadManifest - reads a YAML or JSON manifest, schema files are read relative to the manifest's directory.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return parseManifest(data, filepath.Dir(path))
+}
+
+func parseManifest(data []byte, dir string) (*Manifest, error) {
+	var doc manifestDoc
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil {
+		return nil, memphisError(fmt.Errorf("manifest: %w", err))
+	}
+
+	m := &Manifest{Templates: make(map[string]StationTemplate, len(doc.Templates)), Attachments: doc.Attachments, Users: doc.Users}
+	for name, templateDoc := range doc.Templates {
+		template, err := templateDoc.template()
+		if err != nil {
+			return nil, memphisError(fmt.Errorf("manifest template %s: %w", name, err))
+		}
+		m.Templates[name] = template
+	}
+	for _, s := range doc.Schemas {
+		content := s.Content
+		if s.File != "" {
+			if content != "" {
+				return nil, memphisError(fmt.Errorf("manifest schema %s: set either file or content", s.Name))
+			}
+			path := s.File
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, memphisError(fmt.Errorf("manifest schema %s: %w", s.Name, err))
+			}
+			content = string(data)
+		}
+		m.Schemas = append(m.Schemas, ManifestSchema{Name: s.Name, Type: s.Type, Content: content})
+	}
+	for _, s := range doc.Stations {
+		station := ManifestStation{Name: s.Name, Template: s.Template, Schema: s.Schema}
+		if s.Config != nil {
+			config, err := s.Config.template()
+			if err != nil {
+				return nil, memphisError(fmt.Errorf("manifest station %s: %w", s.Name, err))
+			}
+			station.Config = &config
+		}
+		m.Stations = append(m.Stations, station)
+	}
+	return m, nil
+}
+
+// applyTarget - the broker operations Apply reconciles with.
+type applyTarget interface {
+	// createSchema - uploads the schema, reports whether the broker already had this content
+	createSchema(ctx context.Context, schema ManifestSchema) (bool, error)
+	// createStation - creates the station, reports whether it already existed and how it differs from opts
+	createStation(ctx context.Context, opts StationOpts) (bool, []string, error)
+	// stationSchema - the schema enforced on the station, when known
+	stationSchema(station string) (string, bool)
+	enforceSchema(ctx context.Context, schema, station string) error
+	stationTemplate(name string) (StationTemplate, bool)
+}
+
+// Apply - reconciles the broker with the manifest: schemas are created, a changed content is uploaded as a new
+// version which the broker doesn't tell apart from a new schema so both are reported as created. Stations are
+// created and schemas are enforced on stations, an enforcement is reported as updated unless the connection
+// already knows the station's schema. Memphis can't change the configuration of an existing station, its drift
+// from the manifest is reported in the result's Detail. The manifest is validated before anything is applied,
+// Apply stops at the first failure and returns the report of the resources reconciled so far.
+func Apply(ctx context.Context, conn *Conn, manifest *Manifest) (*ApplyReport, error) {
+	return apply(ctx, connApplyTarget{conn}, manifest)
+}
+
+func apply(ctx context.Context, target applyTarget, m *Manifest) (*ApplyReport, error) {
+	stations, err := m.stationOpts(target)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	for _, s := range m.Schemas {
+		if err := validateSchemaName(s.Name); err != nil {
+			return nil, memphisError(fmt.Errorf("schema %s: %w", s.Name, err))
+		}
+		if err := validateSchemaType(s.Type); err != nil {
+			return nil, memphisError(fmt.Errorf("schema %s: %w", s.Name, err))
+		}
+	}
+	attachments := append([]ManifestAttachment(nil), m.Attachments...)
+	for _, s := range m.Stations {
+		if s.Schema != "" {
+			attachments = append(attachments, ManifestAttachment{Schema: s.Schema, Station: s.Name})
+		}
+	}
+	for _, a := range attachments {
+		if a.Schema == "" || a.Station == "" {
+			return nil, memphisError(errors.New("an attachment needs a schema and a station"))
+		}
+	}
+
+	report := &ApplyReport{}
+	for _, s := range m.Schemas {
+		if err := ctx.Err(); err != nil {
+			return report, memphisError(err)
+		}
+		existed, err := target.createSchema(ctx, s)
+		if err != nil {
+			return report, memphisError(fmt.Errorf("schema %s: %w", s.Name, err))
+		}
+		report.add("schema", s.Name, actionOf(existed), "")
+	}
+	for _, opts := range stations {
+		if err := ctx.Err(); err != nil {
+			return report, memphisError(err)
+		}
+		existed, drift, err := target.createStation(ctx, opts)
+		if err != nil {
+			return report, memphisError(fmt.Errorf("station %s: %w", opts.Name, err))
+		}
+		report.add("station", opts.Name, actionOf(existed), strings.Join(drift, ", "))
+	}
+	for _, a := range attachments {
+		if err := ctx.Err(); err != nil {
+			return report, memphisError(err)
+		}
+		name := a.Schema + " -> " + a.Station
+		if current, ok := target.stationSchema(a.Station); ok && current == a.Schema {
+			report.add("attachment", name, ApplyUnchanged, "")
+			continue
+		}
+		if err := target.enforceSchema(ctx, a.Schema, a.Station); err != nil {
+			return report, memphisError(fmt.Errorf("attachment %s: %w", name, err))
+		}
+		report.add("attachment", name, ApplyUpdated, "")
+	}
+	for _, u := range m.Users {
+		report.add("user", u.Username, ApplySkipped, "users are provisioned with Conn.CreateUser, which returns their password")
+	}
+	return report, nil
+}
+
+func actionOf(existed bool) ApplyAction {
+	if existed {
+		return ApplyUnchanged
+	}
+	return ApplyCreated
+}
+
+// Manifest.stationOpts - the options of every station of the manifest.
+func (m *Manifest) stationOpts(target applyTarget) ([]StationOpts, error) {
+	stations := make([]StationOpts, 0, len(m.Stations))
+	for _, s := range m.Stations {
+		if s.Name == "" {
+			return nil, errors.New("a station needs a name")
+		}
+		template := DefaultStationTemplate()
+		switch {
+		case s.Template != "" && s.Config != nil:
+			return nil, fmt.Errorf("station %s: set either a template or a config", s.Name)
+		case s.Config != nil:
+			template = *s.Config
+		case s.Template != "":
+			var ok bool
+			if template, ok = m.Templates[s.Template]; !ok {
+				if template, ok = target.stationTemplate(s.Template); !ok {
+					return nil, fmt.Errorf("station %s: station template %s is not defined", s.Name, s.Template)
+				}
+			}
+		}
+		if err := template.validate(); err != nil {
+			return nil, fmt.Errorf("station %s: %w", s.Name, err)
+		}
+		opts := GetStationDefaultOptions()
+		opts.Name = s.Name
+		for _, opt := range template.Opts() {
+			if err := opt(&opts); err != nil {
+				return nil, fmt.Errorf("station %s: %w", s.Name, err)
+			}
+		}
+		stations = append(stations, opts)
+	}
+	return stations, nil
+}
+
+type connApplyTarget struct {
+	c *Conn
+}
+
+func (t connApplyTarget) createSchema(ctx context.Context, schema ManifestSchema) (bool, error) {
+	return t.c.createSchema(schema.Name, schema.Type, schema.Content, RequestContext(ctx))
+}
+
+func (t connApplyTarget) createStation(ctx context.Context, opts StationOpts) (bool, []string, error) {
+	opts.RequestOpts = append(opts.RequestOpts, RequestContext(ctx))
+	s, err := opts.createStation(t.c)
+	if err == nil {
+		s.setPartitions(partitionsOf(getInternalName(s.Name), partitionNumbers(s.PartitionsNumber)))
+		return false, nil, nil
+	}
+	if !strings.Contains(err.Error(), "already exist") {
+		return false, nil, err
+	}
+	return true, t.c.stationDrift(ctx, opts), nil
+}
+
+func (t connApplyTarget) stationSchema(station string) (string, bool) {
+	sd, err := t.c.getSchemaDetails(station)
+	if err != nil {
+		return "", false
+	}
+	return sd.name, true
+}
+
+func (t connApplyTarget) enforceSchema(ctx context.Context, schema, station string) error {
+	return t.c.EnforceSchema(schema, station, RequestContext(ctx))
+}
+
+func (t connApplyTarget) stationTemplate(name string) (StationTemplate, bool) {
+	return t.c.GetStationTemplate(name)
+}
+
+// stationDrift - how an existing station differs from opts, in the settings its streams expose.
+func (c *Conn) stationDrift(ctx context.Context, opts StationOpts) []string {
+	partitions, err := c.GetStationPartitions(opts.Name, RequestContext(ctx))
+	if err != nil {
+		return []string{fmt.Sprintf("unknown: %v", err)}
+	}
+	var drift []string
+	if len(partitions) != opts.PartitionsNumber {
+		drift = append(drift, fmt.Sprintf("partitions %d, want %d", len(partitions), opts.PartitionsNumber))
+	}
+	jsCtx, cancel := c.jetstreamContext(RequestOpts{Context: ctx})
+	defer cancel()
+	stream, err := c.js.Stream(jsCtx, partitions[0].StreamName)
+	if err != nil {
+		return append(drift, fmt.Sprintf("unknown: %v", err))
+	}
+	config := stream.CachedInfo().Config
+	storage := Disk
+	if config.Storage == jetstream.MemoryStorage {
+		storage = Memory
+	}
+	if storage != opts.StorageType {
+		drift = append(drift, fmt.Sprintf("storage %s, want %s", storage, opts.StorageType))
+	}
+	if config.Replicas != opts.Replicas {
+		drift = append(drift, fmt.Sprintf("replicas %d, want %d", config.Replicas, opts.Replicas))
+	}
+	return drift
+}
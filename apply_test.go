@@ -0,0 +1,211 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type fakeApplyTarget struct {
+	schemas   map[string]string
+	stations  map[string]StationOpts
+	attached  map[string]string
+	templates map[string]StationTemplate
+	fail      string
+}
+
+func (f *fakeApplyTarget) createSchema(_ context.Context, schema ManifestSchema) (bool, error) {
+	if schema.Name == f.fail {
+		return false, errors.New("broker failure")
+	}
+	existed := f.schemas[schema.Name] == schema.Content
+	f.schemas[schema.Name] = schema.Content
+	return existed, nil
+}
+
+func (f *fakeApplyTarget) createStation(_ context.Context, opts StationOpts) (bool, []string, error) {
+	existing, ok := f.stations[opts.Name]
+	if !ok {
+		f.stations[opts.Name] = opts
+		return false, nil, nil
+	}
+	var drift []string
+	if existing.Replicas != opts.Replicas {
+		drift = append(drift, "replicas")
+	}
+	return true, drift, nil
+}
+
+func (f *fakeApplyTarget) stationSchema(station string) (string, bool) {
+	schema, ok := f.attached[station]
+	return schema, ok
+}
+
+func (f *fakeApplyTarget) enforceSchema(_ context.Context, schema, station string) error {
+	f.attached[station] = schema
+	return nil
+}
+
+func (f *fakeApplyTarget) stationTemplate(name string) (StationTemplate, bool) {
+	template, ok := f.templates[name]
+	return template, ok
+}
+
+func newFakeApplyTarget() *fakeApplyTarget {
+	return &fakeApplyTarget{
+		schemas:   map[string]string{},
+		stations:  map[string]StationOpts{},
+		attached:  map[string]string{},
+		templates: map[string]StationTemplate{},
+	}
+}
+
+const testManifest = `
+templates:
+  events:
+    retention_type: messages
+    retention_value: 1000
+    partitions_number: 3
+schemas:
+  - name: order
+    type: json
+    file: order.json
+stations:
+  - name: orders
+    template: events
+    schema: order
+  - name: audit
+    config:
+      storage_type: memory
+      replicas: 3
+attachments:
+  - schema: order
+    station: audit
+users:
+  - username: ci
+    type: application
+`
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "order.json"), []byte(`{"type": "object"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "memphis.yaml")
+	if err := os.WriteFile(path, []byte(testManifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := DefaultStationTemplate()
+	events.RetentionType = Messages
+	events.RetentionVal = 1000
+	events.PartitionsNumber = 3
+	audit := DefaultStationTemplate()
+	audit.StorageType = Memory
+	audit.Replicas = 3
+	want := &Manifest{
+		Templates:   map[string]StationTemplate{"events": events},
+		Schemas:     []ManifestSchema{{Name: "order", Type: "json", Content: `{"type": "object"}`}},
+		Stations:    []ManifestStation{{Name: "orders", Template: "events", Schema: "order"}, {Name: "audit", Config: &audit}},
+		Attachments: []ManifestAttachment{{Schema: "order", Station: "audit"}},
+		Users:       []ManifestUser{{Username: "ci", Type: "application"}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("loaded %+v, want %+v", m, want)
+	}
+
+	if _, err := ParseManifest([]byte(`{"stations": [{"name": "a", "retention": 1}]}`)); err == nil {
+		t.Fatalf("an unknown field was accepted")
+	}
+}
+
+func TestApply(t *testing.T) {
+	audit := DefaultStationTemplate()
+	audit.Replicas = 3
+	m := &Manifest{
+		Schemas:     []ManifestSchema{{Name: "order", Type: "json", Content: "{}"}},
+		Stations:    []ManifestStation{{Name: "orders", Template: "registered", Schema: "order"}, {Name: "audit", Config: &audit}},
+		Attachments: []ManifestAttachment{{Schema: "order", Station: "audit"}},
+		Users:       []ManifestUser{{Username: "ci"}},
+	}
+	target := newFakeApplyTarget()
+	target.templates["registered"] = DefaultStationTemplate()
+
+	report, err := apply(context.Background(), target, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ApplyResult{
+		{Kind: "schema", Name: "order", Action: ApplyCreated},
+		{Kind: "station", Name: "orders", Action: ApplyCreated},
+		{Kind: "station", Name: "audit", Action: ApplyCreated},
+		{Kind: "attachment", Name: "order -> audit", Action: ApplyUpdated},
+		{Kind: "attachment", Name: "order -> orders", Action: ApplyUpdated},
+		{Kind: "user", Name: "ci", Action: ApplySkipped, Detail: "users are provisioned with Conn.CreateUser, which returns their password"},
+	}
+	if !reflect.DeepEqual(report.Results, want) {
+		t.Fatalf("results %+v, want %+v", report.Results, want)
+	}
+	if target.stations["audit"].Replicas != 3 {
+		t.Fatalf("the station config was not applied: %+v", target.stations["audit"])
+	}
+
+	// applying again changes nothing, the drift of an existing station is reported
+	audit.Replicas = 1
+	report, err = apply(context.Background(), target, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Count(ApplyUnchanged) != 5 || report.Results[2].Detail != "replicas" {
+		t.Fatalf("second apply %+v", report.Results)
+	}
+}
+
+func TestApplyValidation(t *testing.T) {
+	tests := map[string]*Manifest{
+		"missing template": {Stations: []ManifestStation{{Name: "a", Template: "missing"}}},
+		"template and config": {Stations: []ManifestStation{{Name: "a", Template: "t", Config: &StationTemplate{}}},
+			Templates: map[string]StationTemplate{"t": DefaultStationTemplate()}},
+		"invalid config":       {Stations: []ManifestStation{{Name: "a", Config: &StationTemplate{}}}},
+		"schema type":          {Schemas: []ManifestSchema{{Name: "s", Type: "xml"}}},
+		"attachment":           {Attachments: []ManifestAttachment{{Schema: "s"}}},
+		"station without name": {Stations: []ManifestStation{{}}},
+	}
+	for name, m := range tests {
+		target := newFakeApplyTarget()
+		if _, err := apply(context.Background(), target, m); err == nil {
+			t.Errorf("%s: the manifest was applied", name)
+		}
+		if len(target.schemas) != 0 || len(target.stations) != 0 {
+			t.Errorf("%s: resources were created before validation failed", name)
+		}
+	}
+
+	target := newFakeApplyTarget()
+	target.fail = "b"
+	m := &Manifest{Schemas: []ManifestSchema{{Name: "a", Type: "json"}, {Name: "b", Type: "json"}, {Name: "c", Type: "json"}}}
+	report, err := apply(context.Background(), target, m)
+	if err == nil || len(report.Results) != 1 {
+		t.Fatalf("err = %v, report = %+v", err, report)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// partitionsReqVersion - the first producer and consumer creation request version of brokers with partitions
+	partitionsReqVersion = 3
+	// functionsReqVersion - the first producer creation request version of brokers with functions
+	functionsReqVersion = 4
+)
+
+// BrokerInfo - what the SDK knows about the broker the connection talks to.
+type BrokerInfo struct {
+	// Version - the broker's version as set with BrokerVersion, empty if unknown.
+	Version string
+	// ServerVersion - the version of the NATS server embedded in the broker, reported in the server info on connect.
+	ServerVersion string
+	// ProducerRequestVersion and ConsumerRequestVersion - the versions of the creation requests the broker accepts,
+	// the latest ones until the broker rejects them.
+	ProducerRequestVersion int
+	ConsumerRequestVersion int
+	Capabilities           BrokerCapabilities
+}
+
+// BrokerCapabilities - the broker's features, according to the broker's version and the request versions it accepts.
+type BrokerCapabilities struct {
+	Partitions    bool
+	Functions     bool
+	TieredStorage bool
+}
+
+// requestVersions - the creation request versions negotiated with the broker, zero until a request is downgraded.
+type requestVersions struct {
+	producer  int32
+	consumer  int32
+	functions int32
+}
+
+// BrokerInfo - the broker's version, the request versions it accepts and its capabilities, to feature-detect
+// before relying on partitions, functions or tiered storage. Producer and consumer creation requests are
+// downgraded automatically when the broker rejects their version, which is reflected here.
+func (c *Conn) BrokerInfo() BrokerInfo {
+	info := BrokerInfo{
+		ProducerRequestVersion: c.producerRequestVersion(),
+		ConsumerRequestVersion: c.consumerRequestVersion(),
+	}
+	if c.brokerConn != nil {
+		info.ServerVersion = c.brokerConn.ConnectedServerVersion()
+	}
+	if v, ok := c.brokerVersion(); ok {
+		info.Version = v.String()
+	}
+	info.Capabilities = BrokerCapabilities{
+		Partitions:    info.ProducerRequestVersion >= partitionsReqVersion && info.ConsumerRequestVersion >= partitionsReqVersion,
+		Functions:     info.ProducerRequestVersion >= functionsReqVersion || atomic.LoadInt32(&c.requestVersions.functions) == 1,
+		TieredStorage: c.supportsVersion(tieredStorageBrokerVersion),
+	}
+	return info
+}
+
+// producerRequestVersion - the version of the producer creation requests sent to the broker.
+func (c *Conn) producerRequestVersion() int {
+	if v := atomic.LoadInt32(&c.requestVersions.producer); v > 0 {
+		return int(v)
+	}
+	return lastProducerCreationReqVersion
+}
+
+// consumerRequestVersion - the version of the consumer creation requests sent to the broker.
+func (c *Conn) consumerRequestVersion() int {
+	if v := atomic.LoadInt32(&c.requestVersions.consumer); v > 0 {
+		return int(v)
+	}
+	return lastConsumerCreationReqVersion
+}
+
+// observeFunctions - records that the broker reported a station with functions.
+func (c *Conn) observeFunctions() {
+	atomic.StoreInt32(&c.requestVersions.functions, 1)
+}
+
+// isRequestVersionRejection - whether the broker failed a creation request because of its version.
+func isRequestVersionRejection(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "version") && (strings.Contains(msg, "unsupported") || strings.Contains(msg, "not supported") ||
+		strings.Contains(msg, "unknown") || strings.Contains(msg, "invalid") || strings.Contains(msg, "upgrade"))
+}
+
+// downgradeRequest - lowers the version of the rejected creation request of do, false when it can't be retried
+// with a lower version.
+func (c *Conn) downgradeRequest(do directObj, err error) bool {
+	if !isRequestVersionRejection(err) {
+		return false
+	}
+	var version *int32
+	latest := 0
+	switch do.(type) {
+	case *Producer:
+		version, latest = &c.requestVersions.producer, lastProducerCreationReqVersion
+	case *Consumer:
+		version, latest = &c.requestVersions.consumer, lastConsumerCreationReqVersion
+	default:
+		return false
+	}
+	old := atomic.LoadInt32(version)
+	current := int(old)
+	if old == 0 {
+		current = latest
+	}
+	if current <= 1 {
+		return false
+	}
+	// a concurrent creation may have downgraded it already, the retry uses whatever is the lowest
+	atomic.CompareAndSwapInt32(version, old, int32(current-1))
+	return true
+}
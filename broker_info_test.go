@@ -0,0 +1,50 @@
+package memphis
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequestVersionDowngrade(t *testing.T) {
+	c := &Conn{opts: Options{BrokerVersion: "1.4.0"}}
+	info := c.BrokerInfo()
+	if info.Version != "1.4.0" || info.ProducerRequestVersion != lastProducerCreationReqVersion || info.ConsumerRequestVersion != lastConsumerCreationReqVersion {
+		t.Fatalf("unexpected broker info %+v", info)
+	}
+	if caps := info.Capabilities; !caps.Partitions || !caps.Functions || !caps.TieredStorage {
+		t.Errorf("expected every capability of a recent broker, got %+v", caps)
+	}
+
+	p := &Producer{Name: "p", stationName: "orders", conn: c}
+	if c.downgradeRequest(p, errors.New("station orders does not exist")) {
+		t.Error("only version rejections should be retried")
+	}
+	if !c.downgradeRequest(p, errors.New("unsupported request version 4, please upgrade the broker")) {
+		t.Fatal("expected the producer request to be downgraded")
+	}
+	if v := p.getCreationReq().(createProducerReq).RequestVersion; v != lastProducerCreationReqVersion-1 {
+		t.Errorf("expected the downgraded version in the creation request, got %v", v)
+	}
+	info = c.BrokerInfo()
+	if info.Capabilities.Functions || !info.Capabilities.Partitions || info.ConsumerRequestVersion != lastConsumerCreationReqVersion {
+		t.Errorf("unexpected broker info after the producer request was downgraded %+v", info)
+	}
+	c.observeFunctions()
+	if !c.BrokerInfo().Capabilities.Functions {
+		t.Error("expected functions reported by the broker to be detected")
+	}
+
+	cons := &Consumer{Name: "c", stationName: "orders", conn: c}
+	for c.downgradeRequest(cons, errors.New("invalid req_version")) {
+	}
+	if v := c.consumerRequestVersion(); v != 1 {
+		t.Errorf("expected the consumer requests to stop being downgraded at version 1, got %v", v)
+	}
+	if c.BrokerInfo().Capabilities.Partitions {
+		t.Error("brokers rejecting the partitions request versions don't support partitions")
+	}
+
+	if caps := (&Conn{opts: Options{BrokerVersion: "0.3.6"}}).BrokerInfo().Capabilities; caps.TieredStorage {
+		t.Errorf("unexpected capabilities of a legacy broker %+v", caps)
+	}
+}
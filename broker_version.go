@@ -0,0 +1,94 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// brokerVersion - a broker's major.minor.patch version, pre-release and build suffixes are ignored.
+type brokerVersion struct {
+	Major, Minor, Patch int
+}
+
+// tieredStorageBrokerVersion - the first broker version with tiered storage.
+var tieredStorageBrokerVersion = brokerVersion{Minor: 4}
+
+func parseBrokerVersion(version string) (brokerVersion, error) {
+	v := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if v == "" || len(parts) > 3 {
+		return brokerVersion{}, fmt.Errorf("invalid broker version %q", version)
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return brokerVersion{}, fmt.Errorf("invalid broker version %q", version)
+		}
+		numbers[i] = n
+	}
+	return brokerVersion{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+func (v brokerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// atLeast - whether v is the same as or newer than other.
+func (v brokerVersion) atLeast(other brokerVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+// BrokerVersion - the version of the broker the connection talks to, e.g. "1.4.2", used for feature detection.
+// The broker doesn't report its own version, the server info it sends on connect carries the version of the
+// NATS server it embeds, so without this option the version is unknown.
+func BrokerVersion(version string) Option {
+	return func(o *Options) error {
+		if _, err := parseBrokerVersion(version); err != nil {
+			return err
+		}
+		o.BrokerVersion = version
+		return nil
+	}
+}
+
+// Conn.brokerVersion - the broker's version according to the BrokerVersion option, false when it isn't set.
+func (c *Conn) brokerVersion() (brokerVersion, bool) {
+	if c.opts.BrokerVersion == "" {
+		return brokerVersion{}, false
+	}
+	v, err := parseBrokerVersion(c.opts.BrokerVersion)
+	if err != nil {
+		return brokerVersion{}, false
+	}
+	return v, true
+}
+
+// Conn.supportsVersion - whether the broker is at least of version minimum, brokers of unknown version are assumed to.
+func (c *Conn) supportsVersion(minimum brokerVersion) bool {
+	v, ok := c.brokerVersion()
+	return !ok || v.atLeast(minimum)
+}
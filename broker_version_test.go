@@ -0,0 +1,28 @@
+package memphis
+
+import (
+	"testing"
+)
+
+func TestParseBrokerVersion(t *testing.T) {
+	cases := map[string]brokerVersion{
+		"1.4.2":        {1, 4, 2},
+		"v0.4.5":       {0, 4, 5},
+		"2.10":         {2, 10, 0},
+		"1.0.0-beta.1": {1, 0, 0},
+	}
+	for version, expected := range cases {
+		v, err := parseBrokerVersion(version)
+		if err != nil || v != expected {
+			t.Errorf("%v: expected %v, got %v %v", version, expected, v, err)
+		}
+	}
+	for _, version := range []string{"", "latest", "1.2.3.4", "1.-2"} {
+		if _, err := parseBrokerVersion(version); err == nil {
+			t.Errorf("expected %q to be rejected", version)
+		}
+	}
+	if !(brokerVersion{1, 0, 0}).atLeast(tieredStorageBrokerVersion) || (brokerVersion{0, 3, 9}).atLeast(tieredStorageBrokerVersion) {
+		t.Error("unexpected version comparison")
+	}
+}
@@ -0,0 +1,443 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	// ErrBufferFull - the reason a buffered message is dropped to make room for newer ones.
+	ErrBufferFull = errors.New("producer buffer is full")
+	// ErrBufferExpired - the reason a buffered message older than BufferMaxAge is dropped.
+	ErrBufferExpired = errors.New("buffered message expired")
+)
+
+const bufferReplayBatch = 100
+
+// BufferedMessage - a message held in a producer buffer while the broker is unavailable. Data is the
+// validated payload and Headers the message's own headers, the producer's headers are added on replay.
+type BufferedMessage struct {
+	Seq             uint64              `json:"seq"`
+	Data            []byte              `json:"data"`
+	Headers         map[string][]string `json:"headers,omitempty"`
+	PartitionKey    string              `json:"partition_key,omitempty"`
+	PartitionNumber int                 `json:"partition_number,omitempty"`
+	BufferedAt      time.Time           `json:"buffered_at"`
+}
+
+// BufferStore - the storage of a producer buffer, NewFileBuffer is the on-disk implementation. Messages are
+// replayed in the order they were appended and are only truncated from the oldest end.
+type BufferStore interface {
+	// Append - stores msg after the stored messages and returns the sequence assigned to it, higher than
+	// the sequence of any message stored before.
+	Append(msg BufferedMessage) (uint64, error)
+	// Oldest - returns up to limit of the oldest stored messages, oldest first.
+	Oldest(limit int) ([]BufferedMessage, error)
+	// Truncate - removes the messages with a sequence up to and including seq.
+	Truncate(seq uint64) error
+	// Size - the number of stored messages and the sum of the length of their Data.
+	Size() (messages int, bytes int64, err error)
+}
+
+// BufferOpts - configuration options for a producer buffer.
+type BufferOpts struct {
+	MaxMessages   int
+	MaxBytes      int64
+	MaxAge        time.Duration
+	RetryInterval time.Duration
+	DropHandler   func(msg BufferedMessage, reason error)
+}
+
+// BufferOpt - a function on the options for a producer buffer.
+type BufferOpt func(*BufferOpts) error
+
+func getDefaultBufferOpts() BufferOpts {
+	return BufferOpts{
+		MaxBytes:      64 * 1024 * 1024,
+		RetryInterval: time.Second,
+		DropHandler: func(msg BufferedMessage, reason error) {
+			log.Printf("Producer buffer: dropped message %v: %v", msg.Seq, reason)
+		},
+	}
+}
+
+// BufferMaxMessages - max number of buffered messages, the oldest ones are dropped beyond it, unlimited by default.
+func BufferMaxMessages(maxMessages int) BufferOpt {
+	return func(opts *BufferOpts) error {
+		if maxMessages < 1 {
+			return errors.New("buffer max messages has to be at least 1")
+		}
+		opts.MaxMessages = maxMessages
+		return nil
+	}
+}
+
+// BufferMaxBytes - max total size of the buffered payloads, the oldest messages are dropped beyond it, defaults to 64MB.
+func BufferMaxBytes(maxBytes int64) BufferOpt {
+	return func(opts *BufferOpts) error {
+		if maxBytes < 1 {
+			return errors.New("buffer max bytes has to be positive")
+		}
+		opts.MaxBytes = maxBytes
+		return nil
+	}
+}
+
+// BufferMaxAge - buffered messages older than maxAge are dropped instead of being replayed, unlimited by default.
+func BufferMaxAge(maxAge time.Duration) BufferOpt {
+	return func(opts *BufferOpts) error {
+		if maxAge <= 0 {
+			return errors.New("buffer max age has to be positive")
+		}
+		opts.MaxAge = maxAge
+		return nil
+	}
+}
+
+// BufferRetryInterval - how often the replay is retried while the broker is unavailable, defaults to 1 second.
+// The replay also starts as soon as the connection is reestablished.
+func BufferRetryInterval(interval time.Duration) BufferOpt {
+	return func(opts *BufferOpts) error {
+		if interval <= 0 {
+			return errors.New("buffer retry interval has to be positive")
+		}
+		opts.RetryInterval = interval
+		return nil
+	}
+}
+
+// BufferDropHandler - called with every message dropped from the buffer and the reason, ErrBufferFull,
+// ErrBufferExpired or the error the broker rejected it with, by default drops are logged.
+func BufferDropHandler(handler func(msg BufferedMessage, reason error)) BufferOpt {
+	return func(opts *BufferOpts) error {
+		opts.DropHandler = handler
+		return nil
+	}
+}
+
+// ProducerBuffer - queues the messages produced while the broker is unavailable in store and replays them in
+// order once it is reachable again, e.g. for edge devices with flaky links. While messages are buffered, newer
+// ones are buffered behind them so the order is kept. Only Produce is buffered, ProduceWithAck and ProduceBatch
+// need the broker's acknowledgement and fail instead. A message can be replayed twice if the process stops
+// between its replay and its removal from the store, use MsgId to deduplicate it. Not supported for multi
+// station producers.
+func ProducerBuffer(store BufferStore, opts ...BufferOpt) ProducerOpt {
+	return func(producerOpts *ProducerOpts) error {
+		if store == nil {
+			return errors.New("buffer store is required")
+		}
+		bufferOpts := getDefaultBufferOpts()
+		for _, opt := range opts {
+			if opt != nil {
+				if err := opt(&bufferOpts); err != nil {
+					return err
+				}
+			}
+		}
+		producerOpts.BufferStore = store
+		producerOpts.BufferOpts = bufferOpts
+		return nil
+	}
+}
+
+// producerBuffer - the buffer of a producer and the goroutine replaying it.
+type producerBuffer struct {
+	store     BufferStore
+	opts      BufferOpts
+	clock     Clock
+	connected func() bool
+	closed    func() bool
+	// mu - held for reading by produces going to the broker and for writing while the buffer changes state,
+	// so a message is never produced ahead of buffered ones
+	mu        sync.RWMutex
+	buffering bool
+	kickCh    chan struct{}
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+func newProducerBuffer(c *Conn, store BufferStore, opts BufferOpts) (*producerBuffer, error) {
+	messages, _, err := store.Size()
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return &producerBuffer{
+		store: store,
+		opts:  opts,
+		clock: c.clock(),
+		connected: func() bool {
+			return c.brokerConn != nil && c.brokerConn.IsConnected()
+		},
+		closed: func() bool {
+			return c.brokerConn == nil || c.brokerConn.IsClosed()
+		},
+		buffering: messages > 0,
+		kickCh:    make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// producerBuffer.start - replays the buffer until stop is called or the connection is closed, messages
+// stored by a previous run are replayed right away.
+func (b *producerBuffer) start(p *Producer) {
+	go func() {
+		defer close(b.done)
+		ticker := b.clock.NewTicker(b.opts.RetryInterval)
+		defer ticker.Stop()
+		for {
+			b.replay(p)
+			select {
+			case <-b.stopCh:
+				return
+			case <-b.kickCh:
+			case <-ticker.C():
+				if b.closed() {
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (b *producerBuffer) stop() {
+	b.stopOnce.Do(func() { close(b.stopCh) })
+	<-b.done
+}
+
+// producerBuffer.kick - starts a replay, e.g. once the connection is reestablished.
+func (b *producerBuffer) kick() {
+	select {
+	case b.kickCh <- struct{}{}:
+	default:
+	}
+}
+
+// producerBuffer.produce - produces the message, or buffers it while the broker is unavailable or older
+// messages are still buffered.
+func (b *producerBuffer) produce(p *Producer, opts *ProduceOpts) error {
+	b.mu.RLock()
+	if !b.buffering && b.connected() {
+		err := opts.produce(p)
+		b.mu.RUnlock()
+		if err == nil || !isUnavailable(err) {
+			return err
+		}
+	} else {
+		b.mu.RUnlock()
+	}
+	return b.append(p, opts)
+}
+
+// producerBuffer.append - validates the message and stores it, dropping the oldest messages beyond the limits.
+func (b *producerBuffer) append(p *Producer, opts *ProduceOpts) error {
+	headers := make(map[string][]string, len(opts.MsgHeaders.MsgHeaders))
+	for key, values := range opts.MsgHeaders.MsgHeaders {
+		if key == "$memphis_connectionId" || key == "$memphis_producedBy" || key == publishedAtHeader {
+			// set by a produce which failed, they are set again on replay
+			continue
+		}
+		headers[key] = values
+	}
+	if opts.FillSchemaDefaults {
+		var err error
+		if opts.Message, err = p.fillSchemaDefaults(opts.Message); err != nil {
+			return err
+		}
+	}
+	data, err := p.validateMsg(opts.Message, headers, opts.SkipSchemaValidation)
+	if err != nil {
+		return memphisError(err)
+	}
+	msg := BufferedMessage{
+		Data:         data,
+		Headers:      headers,
+		PartitionKey: opts.ProducerPartitionKey,
+		BufferedAt:   b.clock.Now(),
+	}
+	if opts.ProducerPartitionNumber > 0 {
+		msg.PartitionNumber = opts.ProducerPartitionNumber
+	}
+	if b.opts.MaxBytes > 0 && int64(len(data)) > b.opts.MaxBytes {
+		return memphisError(ErrBufferFull)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.makeRoom(int64(len(data))); err != nil {
+		return memphisError(err)
+	}
+	if _, err := b.store.Append(msg); err != nil {
+		return memphisError(err)
+	}
+	b.buffering = true
+	b.kick()
+	return nil
+}
+
+// producerBuffer.makeRoom - drops the oldest messages until a message of size bytes fits within the limits.
+func (b *producerBuffer) makeRoom(size int64) error {
+	for {
+		messages, bytes, err := b.store.Size()
+		if err != nil {
+			return err
+		}
+		if messages == 0 || ((b.opts.MaxMessages <= 0 || messages < b.opts.MaxMessages) && (b.opts.MaxBytes <= 0 || bytes+size <= b.opts.MaxBytes)) {
+			return nil
+		}
+		oldest, err := b.store.Oldest(1)
+		if err != nil {
+			return err
+		}
+		if len(oldest) == 0 {
+			return nil
+		}
+		if err := b.drop(oldest[0], ErrBufferFull); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *producerBuffer) drop(msg BufferedMessage, reason error) error {
+	if err := b.store.Truncate(msg.Seq); err != nil {
+		return err
+	}
+	if b.opts.DropHandler != nil {
+		b.opts.DropHandler(msg, reason)
+	}
+	return nil
+}
+
+func (b *producerBuffer) expired(msg BufferedMessage) bool {
+	return b.opts.MaxAge > 0 && b.clock.Now().Sub(msg.BufferedAt) > b.opts.MaxAge
+}
+
+// producerBuffer.replay - produces the buffered messages in order while the broker is available, each one
+// is removed once acknowledged. A message the broker rejects is dropped, a failure to reach it stops the
+// replay until the next retry.
+func (b *producerBuffer) replay(p *Producer) {
+	for b.connected() {
+		msgs, err := b.store.Oldest(bufferReplayBatch)
+		if err != nil {
+			log.Printf("Producer buffer: %v", err)
+			return
+		}
+		if len(msgs) == 0 {
+			b.mu.Lock()
+			// a message could have been appended since the read
+			messages, _, err := b.store.Size()
+			if err == nil && messages == 0 {
+				b.buffering = false
+			}
+			b.mu.Unlock()
+			if err != nil {
+				log.Printf("Producer buffer: %v", err)
+			}
+			if err != nil || messages == 0 {
+				return
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			if b.expired(msg) {
+				b.dropLocked(msg, ErrBufferExpired)
+				continue
+			}
+			opts := msg.produceOpts()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.AckWaitSec)*time.Second)
+			opts.Context = ctx
+			_, err = opts.publish(p)
+			cancel()
+			if err != nil {
+				if isUnavailable(err) {
+					return
+				}
+				b.dropLocked(msg, err)
+				continue
+			}
+			b.mu.Lock()
+			err := b.store.Truncate(msg.Seq)
+			b.mu.Unlock()
+			if err != nil {
+				log.Printf("Producer buffer: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func (b *producerBuffer) dropLocked(msg BufferedMessage, reason error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.drop(msg, reason); err != nil {
+		log.Printf("Producer buffer: %v", err)
+	}
+}
+
+// BufferedMessage.produceOpts - the options replaying the message, synchronously since it is removed from
+// the buffer once acknowledged.
+func (msg BufferedMessage) produceOpts() ProduceOpts {
+	opts := getDefaultProduceOpts()
+	opts.Message = msg.Data
+	opts.AsyncProduce = false
+	opts.SkipSchemaValidation = true
+	for key, values := range msg.Headers {
+		opts.MsgHeaders.MsgHeaders[key] = values
+	}
+	opts.ProducerPartitionKey = msg.PartitionKey
+	if msg.PartitionNumber > 0 {
+		opts.ProducerPartitionNumber = msg.PartitionNumber
+	}
+	return opts
+}
+
+// isUnavailable - whether the produce failed because the broker couldn't be reached.
+func isUnavailable(err error) bool {
+	for _, target := range []error{
+		nats.ErrConnectionClosed,
+		nats.ErrConnectionReconnecting,
+		nats.ErrConnectionDraining,
+		nats.ErrDisconnected,
+		nats.ErrTimeout,
+		nats.ErrNoResponders,
+		jetstream.ErrNoStreamResponse,
+		jetstream.ErrTooManyStalledMsgs,
+		context.DeadlineExceeded,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn.kickProducerBuffers - starts the replay of the producer buffers.
+func (c *Conn) kickProducerBuffers() {
+	lockProducersMap.Lock()
+	defer lockProducersMap.Unlock()
+	for _, p := range c.producersMap {
+		if p.buffer != nil {
+			p.buffer.kick()
+		}
+	}
+}
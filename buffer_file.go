@@ -0,0 +1,284 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	fileBufferLog       = "buffer.log"
+	fileBufferTruncated = "buffer.truncated"
+	// fileBufferRecordHeader - the length and the crc32 of a record's json
+	fileBufferRecordHeader = 8
+	// fileBufferCompactSize - the size of the removed head of the log above which it is rewritten
+	fileBufferCompactSize = 4 * 1024 * 1024
+)
+
+// FileBuffer - a BufferStore keeping the messages in a write-ahead log in a directory, so they survive restarts.
+// Every append is synced to disk, a record torn by a crash is discarded when the log is opened. A directory
+// is used by a single FileBuffer at a time.
+type FileBuffer struct {
+	mu        sync.Mutex
+	dir       string
+	log       *os.File
+	size      int64
+	entries   []fileBufferEntry
+	bytes     int64
+	truncated uint64
+	nextSeq   uint64
+}
+
+type fileBufferEntry struct {
+	seq     uint64
+	offset  int64
+	length  int
+	dataLen int
+}
+
+// NewFileBuffer - opens the write-ahead log in dir, creating the directory if needed.
+func NewFileBuffer(dir string) (*FileBuffer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, memphisError(err)
+	}
+	b := &FileBuffer{dir: dir}
+	if err := b.readTruncated(); err != nil {
+		return nil, memphisError(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, fileBufferLog), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	b.log = f
+	if err := b.load(); err != nil {
+		f.Close()
+		return nil, memphisError(err)
+	}
+	return b, nil
+}
+
+func (b *FileBuffer) readTruncated() error {
+	content, err := os.ReadFile(filepath.Join(b.dir, fileBufferTruncated))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.truncated, err = strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %v: %w", fileBufferTruncated, err)
+	}
+	return nil
+}
+
+// FileBuffer.load - indexes the records of the log which were not truncated, the log is cut at the first
+// incomplete or corrupted record.
+func (b *FileBuffer) load() error {
+	b.nextSeq = b.truncated + 1
+	var offset int64
+	header := make([]byte, fileBufferRecordHeader)
+	for {
+		if _, err := b.log.ReadAt(header, offset); err != nil {
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+		length := int(binary.BigEndian.Uint32(header))
+		record := make([]byte, length)
+		if _, err := b.log.ReadAt(record, offset+fileBufferRecordHeader); err != nil {
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+		if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+		var msg BufferedMessage
+		if err := json.Unmarshal(record, &msg); err != nil {
+			break
+		}
+		if msg.Seq > b.truncated {
+			b.entries = append(b.entries, fileBufferEntry{seq: msg.Seq, offset: offset, length: length, dataLen: len(msg.Data)})
+			b.bytes += int64(len(msg.Data))
+		}
+		if msg.Seq >= b.nextSeq {
+			b.nextSeq = msg.Seq + 1
+		}
+		offset += fileBufferRecordHeader + int64(length)
+	}
+	b.size = offset
+	return b.log.Truncate(offset)
+}
+
+// FileBuffer.Append - writes msg at the end of the log and syncs it to disk.
+func (b *FileBuffer) Append(msg BufferedMessage) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.log == nil {
+		return 0, memphisError(errors.New("file buffer is closed"))
+	}
+	msg.Seq = b.nextSeq
+	record, err := json.Marshal(msg)
+	if err != nil {
+		return 0, memphisError(err)
+	}
+	buf := make([]byte, fileBufferRecordHeader+len(record))
+	binary.BigEndian.PutUint32(buf, uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(record))
+	copy(buf[fileBufferRecordHeader:], record)
+	if _, err := b.log.WriteAt(buf, b.size); err != nil {
+		return 0, memphisError(err)
+	}
+	if err := b.log.Sync(); err != nil {
+		return 0, memphisError(err)
+	}
+	b.entries = append(b.entries, fileBufferEntry{seq: msg.Seq, offset: b.size, length: len(record), dataLen: len(msg.Data)})
+	b.size += int64(len(buf))
+	b.bytes += int64(len(msg.Data))
+	b.nextSeq++
+	return msg.Seq, nil
+}
+
+// FileBuffer.Oldest - reads up to limit of the oldest messages from the log.
+func (b *FileBuffer) Oldest(limit int) ([]BufferedMessage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.log == nil {
+		return nil, memphisError(errors.New("file buffer is closed"))
+	}
+	if limit > len(b.entries) {
+		limit = len(b.entries)
+	}
+	msgs := make([]BufferedMessage, 0, limit)
+	for _, entry := range b.entries[:limit] {
+		record := make([]byte, entry.length)
+		if _, err := b.log.ReadAt(record, entry.offset+fileBufferRecordHeader); err != nil {
+			return nil, memphisError(err)
+		}
+		var msg BufferedMessage
+		if err := json.Unmarshal(record, &msg); err != nil {
+			return nil, memphisError(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// FileBuffer.Truncate - records seq as removed, the log is emptied once every message was removed and
+// rewritten when its removed head grows large.
+func (b *FileBuffer) Truncate(seq uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.log == nil {
+		return memphisError(errors.New("file buffer is closed"))
+	}
+	if seq <= b.truncated {
+		return nil
+	}
+	if err := b.writeTruncated(seq); err != nil {
+		return memphisError(err)
+	}
+	b.truncated = seq
+	removed := 0
+	for removed < len(b.entries) && b.entries[removed].seq <= seq {
+		b.bytes -= int64(b.entries[removed].dataLen)
+		removed++
+	}
+	b.entries = b.entries[removed:]
+
+	if len(b.entries) == 0 {
+		if err := b.log.Truncate(0); err != nil {
+			return memphisError(err)
+		}
+		b.size = 0
+		return nil
+	}
+	if head := b.entries[0].offset; head > fileBufferCompactSize && head > b.size/2 {
+		return memphisError(b.compact())
+	}
+	return nil
+}
+
+// FileBuffer.writeTruncated - persists the last removed sequence, replacing the file atomically.
+func (b *FileBuffer) writeTruncated(seq uint64) error {
+	path := filepath.Join(b.dir, fileBufferTruncated)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(seq, 10)), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// FileBuffer.compact - rewrites the log without its removed head.
+func (b *FileBuffer) compact() error {
+	head := b.entries[0].offset
+	path := filepath.Join(b.dir, fileBufferLog)
+	tmp, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(b.log, head, b.size-head)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		tmp.Close()
+		return err
+	}
+	b.log.Close()
+	b.log = tmp
+	b.size -= head
+	for i := range b.entries {
+		b.entries[i].offset -= head
+	}
+	return nil
+}
+
+// FileBuffer.Size - the number of messages in the log and the size of their payloads.
+func (b *FileBuffer) Size() (int, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries), b.bytes, nil
+}
+
+// FileBuffer.Close - closes the log, the messages stay on disk.
+func (b *FileBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.log == nil {
+		return nil
+	}
+	err := b.log.Close()
+	b.log = nil
+	return memphisError(err)
+}
+
+var _ BufferStore = (*FileBuffer)(nil)
@@ -0,0 +1,157 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileBuffer(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewFileBuffer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"a", "bb", "ccc"} {
+		if _, err := b.Append(BufferedMessage{Data: []byte(data), Headers: map[string][]string{"k": {data}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	// a record torn by a crash is discarded
+	f, _ := os.OpenFile(filepath.Join(dir, fileBufferLog), os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+
+	if b, err = NewFileBuffer(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if messages, bytes, _ := b.Size(); messages != 2 || bytes != 5 {
+		t.Fatalf("size = %d messages %d bytes, want 2 and 5", messages, bytes)
+	}
+	msgs, err := b.Oldest(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Seq != 2 || string(msgs[0].Data) != "bb" || msgs[1].Headers["k"][0] != "ccc" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if seq, _ := b.Append(BufferedMessage{Data: []byte("d")}); seq != 4 {
+		t.Fatalf("appended seq %d, want 4", seq)
+	}
+
+	if err := b.Truncate(4); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, fileBufferLog)); info.Size() != 0 {
+		t.Fatalf("log size %d after removing every message", info.Size())
+	}
+	b.Close()
+	if b, err = NewFileBuffer(dir); err != nil {
+		t.Fatal(err)
+	}
+	if seq, _ := b.Append(BufferedMessage{Data: []byte("e")}); seq != 5 {
+		t.Fatalf("sequence restarted at %d", seq)
+	}
+}
+
+func TestProducerBuffer(t *testing.T) {
+	released := make(chan struct{})
+	close(released)
+	js := &ackingJetStream{released: released}
+	c := &Conn{
+		js:                 js,
+		stationPartitions:  map[string]*PartitionsUpdate{},
+		stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {}},
+	}
+	p := &Producer{conn: c, Name: "sensor", stationName: "orders"}
+
+	store, err := NewFileBuffer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var mu sync.Mutex
+	var dropped []string
+	var producerOpts ProducerOpts
+	err = ProducerBuffer(store, BufferMaxMessages(2), BufferRetryInterval(time.Hour), BufferDropHandler(func(msg BufferedMessage, reason error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !errors.Is(reason, ErrBufferFull) {
+			t.Errorf("dropped for %v", reason)
+		}
+		dropped = append(dropped, string(msg.Data))
+	}))(&producerOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var connected int32
+	p.buffer, _ = newProducerBuffer(c, producerOpts.BufferStore, producerOpts.BufferOpts)
+	p.buffer.connected = func() bool { return atomic.LoadInt32(&connected) == 1 }
+	p.buffer.closed = func() bool { return false }
+	p.buffer.start(p)
+	defer p.buffer.stop()
+
+	hdrs := Headers{}
+	hdrs.New()
+	hdrs.Add("kind", "reading")
+	for _, msg := range []string{"1", "2", "3"} {
+		if err := p.Produce([]byte(msg), MsgHeaders(hdrs), ProducerPartitionKey("k")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	js.mu.Lock()
+	if len(js.msgs) != 0 {
+		t.Fatalf("published %d messages while disconnected", len(js.msgs))
+	}
+	js.mu.Unlock()
+	mu.Lock()
+	if len(dropped) != 1 || dropped[0] != "1" {
+		t.Fatalf("dropped %q, want the oldest message", dropped)
+	}
+	mu.Unlock()
+
+	atomic.StoreInt32(&connected, 1)
+	p.buffer.kick()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		p.buffer.mu.RLock()
+		buffering := p.buffer.buffering
+		p.buffer.mu.RUnlock()
+		if !buffering {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the buffer was not replayed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Produce([]byte("4")); err != nil {
+		t.Fatal(err)
+	}
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	var published []string
+	for _, msg := range js.msgs {
+		published = append(published, string(msg.Data))
+	}
+	if len(published) != 3 || published[0] != "2" || published[1] != "3" || published[2] != "4" {
+		t.Fatalf("published %q, want the buffered messages in order then the new one", published)
+	}
+	if got := js.msgs[0].Header.Get("kind"); got != "reading" {
+		t.Errorf("replayed message lost its headers, kind = %q", got)
+	}
+	if got := js.msgs[0].Header.Get("$memphis_producedBy"); got != "sensor" {
+		t.Errorf("replayed message producedBy = %q", got)
+	}
+}
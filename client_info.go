@@ -0,0 +1,71 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+)
+
+const sdkLang = "go"
+
+// AppId - the application id sent in producer and consumer creation requests, default is a random id generated
+// per process. Instances of one deployment can share an id so the Memphis UI groups them.
+func AppId(appId string) Option {
+	return func(o *Options) error {
+		if appId == "" {
+			return errors.New("app id can not be empty")
+		}
+		o.AppId = appId
+		return nil
+	}
+}
+
+// SdkLangSuffix - a suffix of the sdk language sent in producer and consumer creation requests, e.g. a wrapping
+// library's name, the language is sent as go-<suffix>.
+func SdkLangSuffix(suffix string) Option {
+	return func(o *Options) error {
+		o.SdkLangSuffix = suffix
+		return nil
+	}
+}
+
+// ClientMetadata - metadata about the client, e.g. its service name, version and git SHA, sent in producer and
+// consumer creation requests so operators can tell which deployment owns which producer or consumer.
+func ClientMetadata(metadata map[string]string) Option {
+	return func(o *Options) error {
+		if o.ClientMetadata == nil {
+			o.ClientMetadata = make(map[string]string, len(metadata))
+		}
+		for key, value := range metadata {
+			o.ClientMetadata[key] = value
+		}
+		return nil
+	}
+}
+
+// Conn.appId - the application id of the creation requests.
+func (c *Conn) appId() string {
+	if c.opts.AppId != "" {
+		return c.opts.AppId
+	}
+	return applicationId
+}
+
+// Conn.sdkLang - the sdk language of the creation requests.
+func (c *Conn) sdkLang() string {
+	if c.opts.SdkLangSuffix != "" {
+		return sdkLang + "-" + c.opts.SdkLangSuffix
+	}
+	return sdkLang
+}
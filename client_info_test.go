@@ -0,0 +1,54 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClientIdentification(t *testing.T) {
+	c := &Conn{}
+	req := (&Producer{Name: "p", stationName: "orders", conn: c}).getCreationReq().(createProducerReq)
+	if req.AppId != applicationId || req.SdkLang != "go" {
+		t.Fatalf("default identification %v, %v", req.AppId, req.SdkLang)
+	}
+	if data, _ := json.Marshal(req); containsKey(t, data, "client_metadata") {
+		t.Fatalf("empty client metadata was sent: %s", data)
+	}
+
+	var opts Options
+	for _, opt := range []Option{AppId("billing-prod"), SdkLangSuffix("acme-wrapper"), ClientMetadata(map[string]string{"service": "billing", "git_sha": "3f2a1c"})} {
+		if err := opt(&opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.opts = opts
+	creq := (&Consumer{Name: "c", stationName: "orders", conn: c}).getCreationReq().(createConsumerReq)
+	if creq.AppId != "billing-prod" || creq.SdkLang != "go-acme-wrapper" || creq.ClientMetadata["git_sha"] != "3f2a1c" {
+		t.Fatalf("identification %+v", creq)
+	}
+	if err := AppId("")(&opts); err == nil {
+		t.Fatal("an empty app id was accepted")
+	}
+}
+
+func containsKey(t *testing.T, data []byte, key string) bool {
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	_, ok := fields[key]
+	return ok
+}
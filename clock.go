@@ -0,0 +1,113 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"time"
+)
+
+// Clock - the time source used by the SDK for its pull intervals, timeouts, pings and timestamps.
+// The default is the system clock, tests can inject a fake one with WithClock to run time based
+// logic deterministically.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer - a single event timer created by a Clock, it follows the semantics of time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker - a periodic timer created by a Clock, it follows the semantics of time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// WithClock - sets the time source of the connection and everything created from it.
+func WithClock(clock Clock) Option {
+	return func(o *Options) error {
+		if clock == nil {
+			return errors.New("clock can not be nil")
+		}
+		o.Clock = clock
+		return nil
+	}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// clockOrSystem - returns clock, or the system clock when it is not set.
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
+
+// Conn.clock - returns the connection's time source.
+func (c *Conn) clock() Clock {
+	if c == nil {
+		return systemClock{}
+	}
+	return clockOrSystem(c.opts.Clock)
+}
+
+// Consumer.clock - returns the time source of the consumer's connection.
+func (c *Consumer) clock() Clock {
+	return c.conn.clock()
+}
+
+// after - like time.After but driven by clock.
+func after(clock Clock, d time.Duration) <-chan time.Time {
+	return clock.NewTimer(d).C()
+}
+
+// SystemClock - returns the clock backed by the time package, it is the default time source.
+func SystemClock() Clock {
+	return systemClock{}
+}
@@ -0,0 +1,134 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// manualClock - a clock whose timers only fire when the test fires them.
+type manualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers chan *manualTimer
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *manualClock) NewTimer(d time.Duration) Timer {
+	t := &manualTimer{c: make(chan time.Time, 1), resets: make(chan time.Duration, 10)}
+	c.timers <- t
+	return t
+}
+
+func (c *manualClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type manualTimer struct {
+	c      chan time.Time
+	resets chan time.Duration
+}
+
+func (t *manualTimer) C() <-chan time.Time        { return t.c }
+func (t *manualTimer) Stop() bool                 { return true }
+func (t *manualTimer) Reset(d time.Duration) bool { t.resets <- d; return true }
+
+// slowJsConsumer - a consumer whose fetches take a while on the manual clock.
+type slowJsConsumer struct {
+	countingJsConsumer
+	clock *manualClock
+	took  time.Duration
+}
+
+func (f *slowJsConsumer) Fetch(batch int, opts ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	f.clock.advance(f.took)
+	return f.countingJsConsumer.Fetch(batch, opts...)
+}
+
+func TestWithClock(t *testing.T) {
+	var opts Options
+	if err := WithClock(nil)(&opts); err == nil {
+		t.Fatalf("a nil clock was accepted")
+	}
+	if _, ok := (&Conn{opts: opts}).clock().(systemClock); !ok {
+		t.Fatalf("the system clock is not the default")
+	}
+	clock := &manualClock{}
+	if err := WithClock(clock)(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if (&Conn{opts: opts}).clock() != clock {
+		t.Fatalf("the injected clock is not used")
+	}
+}
+
+func TestConsumeWithClock(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &manualClock{now: start, timers: make(chan *manualTimer, 1)}
+	js := &slowJsConsumer{clock: clock, took: 2 * time.Second}
+	c := &Consumer{
+		stationName:        "station",
+		BatchSize:          2,
+		PullInterval:       time.Hour,
+		subscriptionActive: true,
+		jsConsumers:        map[int]jetstream.Consumer{1: js},
+		conn:               &Conn{opts: Options{Clock: clock}},
+	}
+
+	received := make(chan []*Msg, 1)
+	err := c.Consume(func(msgs []*Msg, err error, _ context.Context) {
+		received <- msgs
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopConsume()
+
+	timer := <-clock.timers
+	for i := 1; i <= 2; i++ {
+		timer.c <- clock.Now()
+		msgs := <-received
+		if len(msgs) != 2 || js.fetchCount() != i {
+			t.Fatalf("pull %d: got %d msgs after %d fetches", i, len(msgs), js.fetchCount())
+		}
+		if want := start.Add(time.Duration(i) * js.took); !msgs[0].receivedAt.Equal(want) {
+			t.Fatalf("pull %d: received at %v, want %v", i, msgs[0].receivedAt, want)
+		}
+		// the time the fetch took is deducted from the pull interval
+		if d := <-timer.resets; d != time.Hour-js.took {
+			t.Fatalf("pull %d: next pull in %v, want %v", i, d, time.Hour-js.took)
+		}
+	}
+	select {
+	case <-received:
+		t.Fatalf("pulled without the timer firing")
+	default:
+	}
+}
@@ -0,0 +1,503 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ColumnType - the type of the values of a ColumnBatch column.
+type ColumnType int
+
+const (
+	// ColumnBool - Column.Bools.
+	ColumnBool ColumnType = iota
+	// ColumnInt64 - Column.Ints.
+	ColumnInt64
+	// ColumnFloat64 - Column.Floats.
+	ColumnFloat64
+	// ColumnString - Column.Strings.
+	ColumnString
+	// ColumnBytes - Column.Bytes.
+	ColumnBytes
+	// ColumnTimestamp - Column.Times.
+	ColumnTimestamp
+	// ColumnJSON - nested objects, arrays, maps and unions, JSON encoded in Column.Strings.
+	ColumnJSON
+)
+
+func (t ColumnType) String() string {
+	switch t {
+	case ColumnBool:
+		return "bool"
+	case ColumnInt64:
+		return "int64"
+	case ColumnFloat64:
+		return "float64"
+	case ColumnString:
+		return "string"
+	case ColumnBytes:
+		return "bytes"
+	case ColumnTimestamp:
+		return "timestamp"
+	case ColumnJSON:
+		return "json"
+	}
+	return "unknown"
+}
+
+// ColumnField - a top level field of the station's schema.
+type ColumnField struct {
+	Name     string
+	Type     ColumnType
+	Nullable bool
+}
+
+// Column - the values of a field, one per message. Only the slice of the column's type is populated, Valid is
+// false for the messages in which the field is null or missing.
+type Column struct {
+	Field   ColumnField
+	Valid   []bool
+	Bools   []bool
+	Ints    []int64
+	Floats  []float64
+	Strings []string
+	Bytes   [][]byte
+	Times   []time.Time
+
+	// key - the key of the field in the deserialized message.
+	key string
+	// zeroIfMissing - a missing field has the zero value, proto3 fields without presence aren't serialized.
+	zeroIfMissing bool
+	// base64 - bytes are base64 encoded.
+	base64 bool
+	// timeUnit - the unit of numeric timestamps.
+	timeUnit time.Duration
+}
+
+// ColumnBatch - a batch of schema-backed messages in columnar form, the column types preserve the field types of
+// the station's schema. The columns are plain Go slices, not an Apache Arrow record.
+type ColumnBatch struct {
+	Schema     string
+	SchemaType string
+	NumRows    int
+	Columns    []*Column
+}
+
+// ColumnBatch.Column - the column of the field name, nil when the schema has no such field.
+func (b *ColumnBatch) Column(name string) *Column {
+	for _, c := range b.Columns {
+		if c.Field.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// MaterializeColumns - convert a fetched batch of messages of a station with a JSON, Avro or Protobuf schema into a
+// ColumnBatch with a column per top level field of the schema. Messages which don't match the schema fail the
+// whole batch. Building Arrow records or writing Parquet is left to the application.
+func MaterializeColumns(msgs []*Msg) (*ColumnBatch, error) {
+	if len(msgs) == 0 {
+		return nil, memphisError(errors.New("no messages to materialize"))
+	}
+	first := msgs[0]
+	if first.conn == nil || first.raw {
+		return nil, memphisError(errors.New("materializing requires messages of a schema-backed consumer"))
+	}
+	sd, err := first.schemaDetails()
+	if err != nil {
+		return nil, memphisError(err)
+	}
+
+	var columns []*Column
+	switch {
+	case sd.schemaType == "json" && sd.jsonSchema != nil:
+		columns = jsonColumns(sd.jsonSchema)
+	case sd.schemaType == "avro" && sd.avroSchema != nil:
+		columns, err = avroColumns(sd.avroSchema)
+	case sd.schemaType == "protobuf" && sd.msgDescriptor != nil:
+		columns = protoColumns(sd.msgDescriptor)
+	case sd.schemaType == "":
+		err = errors.New("the station has no schema attached")
+	default:
+		err = fmt.Errorf("%v schemas can't be materialized", sd.schemaType)
+	}
+	if err != nil {
+		return nil, memphisError(err)
+	}
+
+	batch := &ColumnBatch{Schema: sd.name, SchemaType: sd.schemaType, Columns: columns}
+	for i, m := range msgs {
+		if m.internalStationName != first.internalStationName {
+			return nil, memphisError(fmt.Errorf("message %v is of station %v, the batch is of station %v", i, m.internalStationName, first.internalStationName))
+		}
+		row, err := materializedRow(m, &sd)
+		if err != nil {
+			return nil, memphisError(fmt.Errorf("message %v: %v", i, err.Error()))
+		}
+		for _, c := range columns {
+			value, ok := row[c.key]
+			if err := c.append(value, ok); err != nil {
+				return nil, memphisError(fmt.Errorf("message %v: field %v: %v", i, c.Field.Name, err.Error()))
+			}
+		}
+		batch.NumRows++
+	}
+	return batch, nil
+}
+
+// materializedRow - the deserialized message, JSON and Avro numbers are kept as json.Number so 64 bit integers
+// don't lose precision.
+func materializedRow(m *Msg, sd *schemaDetails) (map[string]interface{}, error) {
+	var value any
+	if sd.schemaType == "protobuf" {
+		v, err := m.DataDeserialized()
+		if err != nil {
+			return nil, err
+		}
+		value = v
+	} else {
+		data := m.DataNoCopy()
+		if _, err := sd.validateMsg(data); err != nil {
+			return nil, errors.New("the message does not align with the currently attached schema: " + err.Error())
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, errors.New("Bad JSON format - " + err.Error())
+		}
+	}
+	row, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the message is not an object")
+	}
+	return row, nil
+}
+
+// jsonColumns - a column per property of sch, sorted by name.
+func jsonColumns(sch *jsonschema.Schema) []*Column {
+	for sch.Ref != nil && len(sch.Properties) == 0 {
+		sch = sch.Ref
+	}
+	required := make(map[string]bool, len(sch.Required))
+	for _, name := range sch.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(sch.Properties))
+	for name := range sch.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	columns := make([]*Column, 0, len(names))
+	for _, name := range names {
+		typ, nullable := jsonColumnType(sch.Properties[name])
+		columns = append(columns, &Column{
+			Field: ColumnField{Name: name, Type: typ, Nullable: nullable || !required[name]},
+			key:   name,
+		})
+	}
+	return columns
+}
+
+// jsonColumnType - the column type of the property sch, and whether it allows null.
+func jsonColumnType(sch *jsonschema.Schema) (ColumnType, bool) {
+	for sch.Ref != nil && len(sch.Types) == 0 {
+		sch = sch.Ref
+	}
+	var types []string
+	nullable := false
+	for _, t := range sch.Types {
+		if t == "null" {
+			nullable = true
+			continue
+		}
+		types = append(types, t)
+	}
+	if len(types) != 1 {
+		return ColumnJSON, nullable
+	}
+	switch types[0] {
+	case "boolean":
+		return ColumnBool, nullable
+	case "integer":
+		return ColumnInt64, nullable
+	case "number":
+		return ColumnFloat64, nullable
+	case "string":
+		if sch.Format == "date-time" {
+			return ColumnTimestamp, nullable
+		}
+		return ColumnString, nullable
+	}
+	return ColumnJSON, nullable
+}
+
+// avroColumns - a column per field of the record sch, in the order of the schema.
+func avroColumns(sch avro.Schema) ([]*Column, error) {
+	record := avroRecord(sch)
+	if record == nil {
+		return nil, errors.New("the avro schema is not a record")
+	}
+	columns := make([]*Column, 0, len(record.Fields()))
+	for _, field := range record.Fields() {
+		c := &Column{key: field.Name()}
+		c.Field.Name = field.Name()
+		c.Field.Type, c.Field.Nullable, c.timeUnit = avroColumnType(field.Type())
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// avroColumnType - the column type of sch, whether it allows null and the unit of timestamps.
+func avroColumnType(sch avro.Schema) (ColumnType, bool, time.Duration) {
+	switch s := sch.(type) {
+	case *avro.RefSchema:
+		return avroColumnType(s.Schema())
+	case *avro.UnionSchema:
+		if _, typ := s.Indices(); s.Nullable() {
+			t, _, unit := avroColumnType(s.Types()[typ])
+			return t, true, unit
+		}
+		return ColumnJSON, false, 0
+	case *avro.PrimitiveSchema:
+		if logical := s.Logical(); logical != nil {
+			switch logical.Type() {
+			case avro.TimestampMillis:
+				return ColumnTimestamp, false, time.Millisecond
+			case avro.TimestampMicros:
+				return ColumnTimestamp, false, time.Microsecond
+			}
+		}
+	}
+	switch sch.Type() {
+	case avro.Boolean:
+		return ColumnBool, false, 0
+	case avro.Int, avro.Long:
+		return ColumnInt64, false, 0
+	case avro.Float, avro.Double:
+		return ColumnFloat64, false, 0
+	case avro.String, avro.Enum:
+		return ColumnString, false, 0
+	case avro.Bytes, avro.Fixed:
+		return ColumnBytes, false, 0
+	case avro.Null:
+		return ColumnJSON, true, 0
+	}
+	return ColumnJSON, false, 0
+}
+
+// protoColumns - a column per field of the message md, in the order of the descriptor. Values are looked up by
+// the fields' JSON names, as in the messages deserialized with protojson.
+func protoColumns(md protoreflect.MessageDescriptor) []*Column {
+	fields := md.Fields()
+	columns := make([]*Column, 0, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		c := &Column{
+			Field:         ColumnField{Name: string(fd.Name()), Type: protoColumnType(fd), Nullable: fd.HasPresence()},
+			key:           fd.JSONName(),
+			zeroIfMissing: !fd.HasPresence(),
+		}
+		if c.Field.Type == ColumnBytes {
+			c.base64 = true
+		}
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+// protoColumnType - the column type of the field fd.
+func protoColumnType(fd protoreflect.FieldDescriptor) ColumnType {
+	if fd.IsList() || fd.IsMap() {
+		return ColumnJSON
+	}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return ColumnBool
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return ColumnInt64
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return ColumnFloat64
+	case protoreflect.StringKind, protoreflect.EnumKind:
+		return ColumnString
+	case protoreflect.BytesKind:
+		return ColumnBytes
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() == "google.protobuf.Timestamp" {
+			return ColumnTimestamp
+		}
+	}
+	return ColumnJSON
+}
+
+// Column.append - append the value of a message, present tells whether the message has the field.
+func (c *Column) append(value interface{}, present bool) error {
+	if value == nil {
+		if present || !c.zeroIfMissing {
+			c.appendNull()
+			return nil
+		}
+		c.appendZero()
+		return nil
+	}
+	switch c.Field.Type {
+	case ColumnBool:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %T", value)
+		}
+		c.Bools = append(c.Bools, v)
+	case ColumnInt64:
+		v, err := columnInt(value)
+		if err != nil {
+			return err
+		}
+		c.Ints = append(c.Ints, v)
+	case ColumnFloat64:
+		v, err := columnFloat(value)
+		if err != nil {
+			return err
+		}
+		c.Floats = append(c.Floats, v)
+	case ColumnString:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %T", value)
+		}
+		c.Strings = append(c.Strings, v)
+	case ColumnBytes:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected bytes, got %T", value)
+		}
+		b := []byte(v)
+		if c.base64 {
+			var err error
+			if b, err = base64.StdEncoding.DecodeString(v); err != nil {
+				return err
+			}
+		}
+		c.Bytes = append(c.Bytes, b)
+	case ColumnTimestamp:
+		v, err := c.columnTime(value)
+		if err != nil {
+			return err
+		}
+		c.Times = append(c.Times, v)
+	case ColumnJSON:
+		v, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		c.Strings = append(c.Strings, string(v))
+	}
+	c.Valid = append(c.Valid, true)
+	return nil
+}
+
+// Column.appendNull - append a null, with a zero value in the column's slice so all columns stay aligned.
+func (c *Column) appendNull() {
+	c.appendZero()
+	c.Valid[len(c.Valid)-1] = false
+}
+
+func (c *Column) appendZero() {
+	switch c.Field.Type {
+	case ColumnBool:
+		c.Bools = append(c.Bools, false)
+	case ColumnInt64:
+		c.Ints = append(c.Ints, 0)
+	case ColumnFloat64:
+		c.Floats = append(c.Floats, 0)
+	case ColumnString, ColumnJSON:
+		c.Strings = append(c.Strings, "")
+	case ColumnBytes:
+		c.Bytes = append(c.Bytes, nil)
+	case ColumnTimestamp:
+		c.Times = append(c.Times, time.Time{})
+	}
+	c.Valid = append(c.Valid, true)
+}
+
+// columnInt - an integer decoded as a json.Number, or as a string by protojson for 64 bit integers.
+func columnInt(value interface{}) (int64, error) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return 0, fmt.Errorf("expected an integer, got %T", value)
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		// uint64 values above the int64 range wrap, as in Go's int64 conversion
+		return int64(u), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, fmt.Errorf("expected an integer, got %v", s)
+	}
+	return int64(f), nil
+}
+
+// columnFloat - a number decoded as a json.Number, or as a string by protojson for NaN and infinities.
+func columnFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("expected a number, got %T", value)
+}
+
+// Column.columnTime - a timestamp encoded as an RFC 3339 string, or as a number of the column's time unit.
+func (c *Column) columnTime(value interface{}) (time.Time, error) {
+	if s, ok := value.(string); ok && c.timeUnit == 0 {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	n, err := columnInt(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if c.timeUnit == time.Microsecond {
+		return time.UnixMicro(n).UTC(), nil
+	}
+	return time.UnixMilli(n).UTC(), nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func materializeTestMsgs(t *testing.T, sd schemaDetails, protoSchema *ProtoSchema, data ...string) []*Msg {
+	t.Helper()
+	c := &Conn{stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {schemaDetails: sd}}}
+	msgs := make([]*Msg, len(data))
+	for i, d := range data {
+		msgs[i] = newTestMsg(d, nil)
+		msgs[i].conn, msgs[i].internalStationName, msgs[i].protoSchema = c, "orders", protoSchema
+	}
+	return msgs
+}
+
+func TestMaterializeColumnsJson(t *testing.T) {
+	sd := schemaDetails{name: "order", schemaType: "json", activeVersion: SchemaVersion{Content: `{
+		"type": "object",
+		"required": ["id", "amount"],
+		"properties": {
+			"id": {"type": "integer"},
+			"amount": {"type": "number"},
+			"region": {"type": ["string", "null"]},
+			"paid": {"type": "boolean"},
+			"created": {"type": "string", "format": "date-time"},
+			"items": {"type": "array"}
+		}
+	}`}}
+	if err := sd.compileJsonSchema(); err != nil {
+		t.Fatal(err)
+	}
+	msgs := materializeTestMsgs(t, sd, nil,
+		`{"id": 9007199254740993, "amount": 12.5, "region": "eu", "paid": true, "created": "2024-01-02T03:04:05Z", "items": [1, 2]}`,
+		`{"id": 2, "amount": 3, "region": null}`,
+	)
+	batch, err := MaterializeColumns(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.NumRows != 2 || len(batch.Columns) != 6 || batch.Columns[0].Field.Name != "amount" {
+		t.Fatalf("materialized %+v", batch)
+	}
+	if id := batch.Column("id"); id.Field != (ColumnField{Name: "id", Type: ColumnInt64}) || id.Ints[0] != 9007199254740993 || id.Ints[1] != 2 {
+		t.Errorf("id column %+v", id)
+	}
+	if region := batch.Column("region"); region.Field.Type != ColumnString || !region.Field.Nullable || region.Strings[0] != "eu" || region.Valid[1] {
+		t.Errorf("region column %+v", region)
+	}
+	if paid := batch.Column("paid"); paid.Field.Type != ColumnBool || !paid.Bools[0] || paid.Valid[1] {
+		t.Errorf("paid column %+v", paid)
+	}
+	created := batch.Column("created")
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); created.Field.Type != ColumnTimestamp || !created.Times[0].Equal(want) {
+		t.Errorf("created column %+v", created)
+	}
+	if items := batch.Column("items"); items.Field.Type != ColumnJSON || items.Strings[0] != "[1,2]" {
+		t.Errorf("items column %+v", items)
+	}
+
+	if _, err := MaterializeColumns(materializeTestMsgs(t, sd, nil, `{"amount": 1}`)); err == nil {
+		t.Error("expected a message not matching the schema to fail the batch")
+	}
+	if _, err := MaterializeColumns(nil); err == nil {
+		t.Error("expected an empty batch to fail")
+	}
+}
+
+func TestMaterializeColumnsAvro(t *testing.T) {
+	sd := schemaDetails{name: "order", schemaType: "avro", activeVersion: SchemaVersion{Content: `{
+		"type": "record",
+		"name": "order",
+		"fields": [
+			{"name": "amount", "type": "double"},
+			{"name": "note", "type": ["null", "string"], "default": null},
+			{"name": "created", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+			{"name": "tags", "type": {"type": "array", "items": "string"}}
+		]
+	}`}}
+	if err := sd.compileAvroSchema(); err != nil {
+		t.Fatal(err)
+	}
+	columns, err := avroColumns(sd.avroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ColumnField{{"amount", ColumnFloat64, false}, {"note", ColumnString, true}, {"created", ColumnTimestamp, false}, {"tags", ColumnJSON, false}}
+	for i, c := range columns {
+		if c.Field != want[i] {
+			t.Errorf("column %v is %+v, want %+v", i, c.Field, want[i])
+		}
+	}
+	if created := columns[2]; created.append(json.Number("1704164645000"), true) != nil || created.Times[0].Unix() != 1704164645 {
+		t.Errorf("created column %+v", created)
+	}
+
+	sd.activeVersion.Content = `{"type": "record", "name": "order", "fields": [
+		{"name": "amount", "type": "double"},
+		{"name": "note", "type": ["null", "string"], "default": null}
+	]}`
+	if err := sd.compileAvroSchema(); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := MaterializeColumns(materializeTestMsgs(t, sd, nil, `{"amount": 7.5, "note": null}`, `{"amount": 1, "note": "gift"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amount := batch.Column("amount"); amount.Floats[0] != 7.5 || amount.Floats[1] != 1 {
+		t.Errorf("amount column %+v", amount)
+	}
+	if note := batch.Column("note"); note.Valid[0] || note.Strings[1] != "gift" {
+		t.Errorf("note column %+v", note)
+	}
+}
+
+func TestMaterializeColumnsProtobuf(t *testing.T) {
+	schema, err := ParseProtoSchema(mustMarshal(t, orderDescriptorSet("order.proto")), "test.Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := schema.Validate(map[string]interface{}{"id": "5", "item": "book"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// proto3 doesn't serialize zero values
+	batch, err := MaterializeColumns(materializeTestMsgs(t, schemaDetails{}, schema, string(encoded), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := batch.Column("id")
+	if id.Field.Type != ColumnInt64 || id.Field.Nullable || id.Ints[0] != 5 || id.Ints[1] != 0 || !id.Valid[1] {
+		t.Errorf("id column %+v", id)
+	}
+	if item := batch.Column("item"); item.Field.Type != ColumnString || item.Strings[0] != "book" {
+		t.Errorf("item column %+v", item)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+// Package connect builds archival and ingestion pipelines out of memphis consumers and producers as plain Go
+// configuration, instead of deploying separate connectors. Sinks commit consumed messages in batches with
+// memphis.SinkBatcher, a message is acked only once the batch holding it is stored. Sources are polled by
+// RunSource, their position is committed only once the polled records are produced.
+package connect
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+)
+
+// Record - a message as written by sinks or read by sources.
+type Record struct {
+	// ID - the id a source's record is produced with, see memphis.MsgId, so records polled again after a failure
+	// are deduplicated by the station. Empty for records of sinks.
+	ID       string
+	Sequence uint64
+	// PublishedAt - the publish time stamped by producers created with memphis.ProducerPublishTimestamp, zero otherwise.
+	PublishedAt time.Time
+	Headers     map[string]string
+	Data        []byte
+}
+
+// NewRecord - the record of a consumed message.
+func NewRecord(msg *memphis.Msg) Record {
+	seq, _ := msg.GetSequenceNumber()
+	publishedAt, _ := msg.PublishedAt()
+	return Record{
+		Sequence:    seq,
+		PublishedAt: publishedAt,
+		Headers:     msg.GetHeaders(),
+		Data:        msg.Data(),
+	}
+}
+
+// Format - encodes a batch of records into a single object.
+type Format interface {
+	Extension() string
+	ContentType() string
+	Encode(records []Record) ([]byte, error)
+}
+
+// NDJSON - one JSON object per line with the record's sequence, publish time, headers and data. JSON data is
+// embedded as is, other data as a string.
+var NDJSON Format = ndjsonFormat{}
+
+type ndjsonFormat struct{}
+
+type ndjsonLine struct {
+	Sequence    uint64            `json:"sequence,omitempty"`
+	PublishedAt *time.Time        `json:"published_at,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Data        json.RawMessage   `json:"data"`
+}
+
+func (ndjsonFormat) Extension() string   { return ".ndjson" }
+func (ndjsonFormat) ContentType() string { return "application/x-ndjson" }
+
+func (ndjsonFormat) Encode(records []Record) ([]byte, error) {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	for _, record := range records {
+		line := ndjsonLine{Sequence: record.Sequence, Headers: record.Headers, Data: record.Data}
+		if !record.PublishedAt.IsZero() {
+			line.PublishedAt = &record.PublishedAt
+		}
+		if !json.Valid(record.Data) {
+			data, err := json.Marshal(string(record.Data))
+			if err != nil {
+				return nil, err
+			}
+			line.Data = data
+		}
+		if err := enc.Encode(line); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// CustomFormat - a format encoded by encode, for formats the module doesn't implement. NDJSON is the only built-in
+// format, Parquet objects take a parquet library, e.g.
+// CustomFormat(".parquet", "application/vnd.apache.parquet", encodeParquet).
+func CustomFormat(extension, contentType string, encode func(records []Record) ([]byte, error)) Format {
+	return customFormat{extension: extension, contentType: contentType, encode: encode}
+}
+
+type customFormat struct {
+	extension   string
+	contentType string
+	encode      func(records []Record) ([]byte, error)
+}
+
+func (f customFormat) Extension() string   { return f.extension }
+func (f customFormat) ContentType() string { return f.contentType }
+
+func (f customFormat) Encode(records []Record) ([]byte, error) {
+	if f.encode == nil {
+		return nil, errors.New("custom format without an encoder")
+	}
+	return f.encode(records)
+}
+
+// Partitioner - the partition path of a record, records of a batch are written to one object per partition.
+// now is the time the batch is written.
+type Partitioner func(record Record, now time.Time) (string, error)
+
+// TimePartitioner - partitions by the records' publish time formatted with layout in UTC, e.g.
+// "year=2006/month=01/day=02/hour=15". Records without a publish time are partitioned by the write time.
+func TimePartitioner(layout string) Partitioner {
+	return func(record Record, now time.Time) (string, error) {
+		t := record.PublishedAt
+		if t.IsZero() {
+			t = now
+		}
+		return t.UTC().Format(layout), nil
+	}
+}
+
+// HeaderPartitioner - partitions by the value of a header as "<header>=<value>", records without it go to
+// "<header>=none".
+func HeaderPartitioner(header string) Partitioner {
+	return func(record Record, now time.Time) (string, error) {
+		value := record.Headers[header]
+		if value == "" {
+			value = "none"
+		}
+		return header + "=" + url.PathEscape(value), nil
+	}
+}
+
+// Partitions - nests the partitions of several partitioners, in order.
+func Partitions(partitioners ...Partitioner) Partitioner {
+	return func(record Record, now time.Time) (string, error) {
+		paths := make([]string, 0, len(partitioners))
+		for _, partitioner := range partitioners {
+			path, err := partitioner(record, now)
+			if err != nil {
+				return "", err
+			}
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+		return strings.Join(paths, "/"), nil
+	}
+}
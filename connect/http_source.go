@@ -0,0 +1,201 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package connect
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// HTTPDecoder - extracts the records and the position after them from the body of a poll response.
+// An empty next position keeps the current one.
+type HTTPDecoder func(body []byte) (records []Record, next string, err error)
+
+// JSONArrayDecoder - decodes a JSON array, every element is a record identified by the hash of its content.
+// It never advances the position, repeated elements are deduplicated through their ids within the station's
+// idempotency window.
+func JSONArrayDecoder(body []byte) ([]Record, string, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(body, &elements); err != nil {
+		return nil, "", err
+	}
+	records := make([]Record, 0, len(elements))
+	for _, element := range elements {
+		sum := sha256.Sum256(element)
+		records = append(records, Record{ID: hex.EncodeToString(sum[:]), Data: element})
+	}
+	return records, "", nil
+}
+
+// HTTPSourceOpts - configuration options for an HTTP source.
+type HTTPSourceOpts struct {
+	Client      *http.Client
+	Header      http.Header
+	CursorParam string
+	Decoder     HTTPDecoder
+	Checkpoint  CheckpointStore
+}
+
+// HTTPSourceOpt - a function on the options for an HTTP source.
+type HTTPSourceOpt func(*HTTPSourceOpts) error
+
+// HTTPClient - the client polling the endpoint, default is http.DefaultClient.
+func HTTPClient(client *http.Client) HTTPSourceOpt {
+	return func(opts *HTTPSourceOpts) error {
+		if client == nil {
+			return errors.New("http client can not be nil")
+		}
+		opts.Client = client
+		return nil
+	}
+}
+
+// HTTPHeader - a header sent with every poll, e.g. an authorization header.
+func HTTPHeader(key, value string) HTTPSourceOpt {
+	return func(opts *HTTPSourceOpts) error {
+		opts.Header.Add(key, value)
+		return nil
+	}
+}
+
+// CursorParam - the query parameter the committed position is sent in, e.g. "since". Without it the same url
+// is polled every time.
+func CursorParam(param string) HTTPSourceOpt {
+	return func(opts *HTTPSourceOpts) error {
+		opts.CursorParam = param
+		return nil
+	}
+}
+
+// WithDecoder - extracts the records and the next position from poll responses, default is JSONArrayDecoder.
+func WithDecoder(decoder HTTPDecoder) HTTPSourceOpt {
+	return func(opts *HTTPSourceOpts) error {
+		if decoder == nil {
+			return errors.New("decoder can not be nil")
+		}
+		opts.Decoder = decoder
+		return nil
+	}
+}
+
+// WithCheckpoint - persists the committed position, so polling resumes from it after a restart.
+func WithCheckpoint(store CheckpointStore) HTTPSourceOpt {
+	return func(opts *HTTPSourceOpts) error {
+		opts.Checkpoint = store
+		return nil
+	}
+}
+
+// HTTPSource - a reference source polling an HTTP endpoint, the committed position is sent with every poll
+// in the cursor parameter and advanced by the decoder.
+type HTTPSource struct {
+	url  string
+	opts HTTPSourceOpts
+
+	mu        sync.Mutex
+	loaded    bool
+	committed string
+	next      string
+}
+
+// NewHTTPSource - creates a source polling rawURL with GET requests.
+func NewHTTPSource(rawURL string, opts ...HTTPSourceOpt) (*HTTPSource, error) {
+	if _, err := url.Parse(rawURL); err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	defaultOpts := HTTPSourceOpts{Client: http.DefaultClient, Header: http.Header{}, Decoder: JSONArrayDecoder}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, fmt.Errorf("connect: %w", err)
+			}
+		}
+	}
+	return &HTTPSource{url: rawURL, opts: defaultOpts}, nil
+}
+
+// HTTPSource.Position - the committed position.
+func (s *HTTPSource) Position() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.committed
+}
+
+// HTTPSource.Poll - requests the records after the committed position, a response other than 200 fails the poll.
+func (s *HTTPSource) Poll(ctx context.Context) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded && s.opts.Checkpoint != nil {
+		position, err := s.opts.Checkpoint.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load checkpoint: %w", err)
+		}
+		s.committed = position
+	}
+	s.loaded = true
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = s.opts.Header.Clone()
+	if s.opts.CursorParam != "" && s.committed != "" {
+		query := req.URL.Query()
+		query.Set(s.opts.CursorParam, s.committed)
+		req.URL.RawQuery = query.Encode()
+	}
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", resp.Status, string(body))
+	}
+	records, next, err := s.opts.Decoder(body)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	s.next = next
+	return records, nil
+}
+
+// HTTPSource.Commit - advances the committed position to the one after the last polled records and saves it
+// to the checkpoint store.
+func (s *HTTPSource) Commit(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == "" || s.next == s.committed {
+		return nil
+	}
+	if s.opts.Checkpoint != nil {
+		if err := s.opts.Checkpoint.Save(ctx, s.next); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+	}
+	s.committed = s.next
+	return nil
+}
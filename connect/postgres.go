@@ -0,0 +1,398 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package connect
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LSN - a position in the Postgres write-ahead log.
+type LSN uint64
+
+// LSN.String - the textual form used by Postgres, e.g. "16/B374D848".
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+// ParseLSN - parses the textual form of an LSN.
+func ParseLSN(s string) (LSN, error) {
+	var hi, lo uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &hi, &lo); err != nil {
+		return 0, fmt.Errorf("invalid lsn %q", s)
+	}
+	return LSN(uint64(hi)<<32 | uint64(lo)), nil
+}
+
+// WALMessage - the payload of an XLogData message of a pgoutput logical replication stream.
+type WALMessage struct {
+	WALStart LSN
+	Data     []byte
+}
+
+// ReplicationStream - a pgoutput logical replication connection, implemented by a thin adapter over a Postgres
+// driver, e.g. pglogrepl's ReceiveMessage and SendStandbyStatusUpdate. The adapter starts replication from
+// PostgresSource.ResumeLSN and answers the server's keepalives.
+type ReplicationStream interface {
+	// Receive - the next XLogData message.
+	Receive(ctx context.Context) (WALMessage, error)
+	// Acknowledge - reports the WAL up to lsn as flushed, the server can then recycle it.
+	Acknowledge(ctx context.Context, lsn LSN) error
+}
+
+// ChangeEvent - a row change produced by a PostgresSource as JSON.
+type ChangeEvent struct {
+	// Op - insert, update, delete or truncate.
+	Op         string    `json:"op"`
+	Schema     string    `json:"schema"`
+	Table      string    `json:"table"`
+	LSN        string    `json:"lsn"`
+	CommitTime time.Time `json:"commit_time"`
+	// Before - the old row of updates and deletes, only its key columns unless the table's replica identity is full.
+	Before map[string]any `json:"before,omitempty"`
+	After  map[string]any `json:"after,omitempty"`
+}
+
+// Postgres change event headers.
+const (
+	PostgresTableHeader = "pg-table"
+	PostgresOpHeader    = "pg-op"
+)
+
+// PostgresSource - a source producing the row changes of a pgoutput replication stream, one record per change,
+// a transaction at a time. Column values are mapped to JSON by type: booleans, numbers, json and jsonb keep their
+// type, numeric and bigint are JSON numbers with their exact digits, other types are strings. Unchanged TOASTed
+// values are left out. Records are identified by their transaction's commit LSN and their position in it, and
+// committing acknowledges the transaction's end LSN to the server and saves it to the checkpoint store.
+type PostgresSource struct {
+	stream     ReplicationStream
+	checkpoint CheckpointStore
+
+	mu        sync.Mutex
+	relations map[uint32]pgRelation
+	polled    []Record
+	polledEnd LSN
+}
+
+type pgRelation struct {
+	schema  string
+	table   string
+	columns []pgColumn
+}
+
+type pgColumn struct {
+	name string
+	oid  uint32
+}
+
+// NewPostgresSource - creates a source decoding stream, checkpoint may be nil when the replication slot's
+// confirmed position is enough to resume.
+func NewPostgresSource(stream ReplicationStream, checkpoint CheckpointStore) (*PostgresSource, error) {
+	if stream == nil {
+		return nil, errors.New("connect: a postgres source requires a replication stream")
+	}
+	return &PostgresSource{stream: stream, checkpoint: checkpoint, relations: map[uint32]pgRelation{}}, nil
+}
+
+// PostgresSource.ResumeLSN - the LSN to start replication from, zero when nothing was checkpointed, which starts
+// from the replication slot's confirmed position.
+func (s *PostgresSource) ResumeLSN(ctx context.Context) (LSN, error) {
+	if s.checkpoint == nil {
+		return 0, nil
+	}
+	position, err := s.checkpoint.Load(ctx)
+	if err != nil || position == "" {
+		return 0, err
+	}
+	return ParseLSN(position)
+}
+
+// PostgresSource.Poll - the changes of the next transaction, or those of the last polled one until it is committed.
+func (s *PostgresSource) Poll(ctx context.Context) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.polled != nil {
+		return s.polled, nil
+	}
+	var (
+		events     []ChangeEvent
+		commitTime time.Time
+		inTx       bool
+	)
+	for {
+		msg, err := s.stream.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(msg.Data) == 0 {
+			continue
+		}
+		r := &pgReader{data: msg.Data[1:]}
+		switch msg.Data[0] {
+		case 'B':
+			r.uint64() // final lsn
+			commitTime = pgTime(r.uint64())
+			inTx = true
+			events = events[:0]
+		case 'R':
+			relation := pgRelation{}
+			id := r.uint32()
+			relation.schema = r.string()
+			relation.table = r.string()
+			r.byte() // replica identity
+			columns := int(r.uint16())
+			for i := 0; i < columns && r.err == nil; i++ {
+				r.byte() // flags
+				name := r.string()
+				oid := r.uint32()
+				r.uint32() // type modifier
+				relation.columns = append(relation.columns, pgColumn{name: name, oid: oid})
+			}
+			if r.err == nil {
+				s.relations[id] = relation
+			}
+		case 'I', 'U', 'D':
+			event, err := s.decodeChange(msg.Data[0], r)
+			if err != nil {
+				return nil, err
+			}
+			event.CommitTime = commitTime
+			events = append(events, event)
+		case 'T':
+			count := int(r.uint32())
+			r.byte() // options
+			for i := 0; i < count && r.err == nil; i++ {
+				relation, ok := s.relations[r.uint32()]
+				if !ok {
+					return nil, errors.New("pgoutput: truncate of an unknown relation")
+				}
+				events = append(events, ChangeEvent{Op: "truncate", Schema: relation.schema, Table: relation.table, CommitTime: commitTime})
+			}
+		case 'C':
+			r.byte() // flags
+			commitLSN := LSN(r.uint64())
+			endLSN := LSN(r.uint64())
+			if r.err != nil {
+				return nil, fmt.Errorf("pgoutput: %w", r.err)
+			}
+			if !inTx || len(events) == 0 {
+				// nothing to produce, acknowledge the transaction right away
+				if err := s.commitLSN(ctx, endLSN); err != nil {
+					return nil, err
+				}
+				inTx = false
+				continue
+			}
+			records := make([]Record, 0, len(events))
+			for i, event := range events {
+				event.LSN = commitLSN.String()
+				record, err := changeRecord(event)
+				if err != nil {
+					return nil, err
+				}
+				record.ID = fmt.Sprintf("%v-%d", commitLSN, i)
+				records = append(records, record)
+			}
+			s.polled, s.polledEnd = records, endLSN
+			return records, nil
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("pgoutput: %w", r.err)
+		}
+	}
+}
+
+// PostgresSource.Commit - acknowledges the last polled transaction.
+func (s *PostgresSource) Commit(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.polled == nil {
+		return nil
+	}
+	if err := s.commitLSN(ctx, s.polledEnd); err != nil {
+		return err
+	}
+	s.polled = nil
+	return nil
+}
+
+func (s *PostgresSource) commitLSN(ctx context.Context, lsn LSN) error {
+	if s.checkpoint != nil {
+		if err := s.checkpoint.Save(ctx, lsn.String()); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+	}
+	return s.stream.Acknowledge(ctx, lsn)
+}
+
+// decodeChange - decodes an insert, update or delete message.
+func (s *PostgresSource) decodeChange(kind byte, r *pgReader) (ChangeEvent, error) {
+	relation, ok := s.relations[r.uint32()]
+	if !ok {
+		return ChangeEvent{}, errors.New("pgoutput: change of an unknown relation")
+	}
+	event := ChangeEvent{Schema: relation.schema, Table: relation.table}
+	switch kind {
+	case 'I':
+		event.Op = "insert"
+	case 'U':
+		event.Op = "update"
+	case 'D':
+		event.Op = "delete"
+	}
+	for r.err == nil && len(r.data) > 0 {
+		switch tuple := r.byte(); tuple {
+		case 'K', 'O':
+			event.Before = relation.decodeTuple(r)
+		case 'N':
+			event.After = relation.decodeTuple(r)
+		default:
+			return ChangeEvent{}, fmt.Errorf("pgoutput: unexpected tuple type %q", tuple)
+		}
+		if kind != 'U' {
+			break
+		}
+	}
+	if r.err != nil {
+		return ChangeEvent{}, fmt.Errorf("pgoutput: %w", r.err)
+	}
+	return event, nil
+}
+
+// decodeTuple - decodes the values of a row.
+func (relation pgRelation) decodeTuple(r *pgReader) map[string]any {
+	count := int(r.uint16())
+	row := make(map[string]any, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		name := strconv.Itoa(i)
+		var oid uint32
+		if i < len(relation.columns) {
+			name, oid = relation.columns[i].name, relation.columns[i].oid
+		}
+		switch kind := r.byte(); kind {
+		case 'n':
+			row[name] = nil
+		case 'u':
+			// unchanged TOASTed value, not sent by the server
+		case 't':
+			row[name] = pgValue(oid, r.bytes(int(r.uint32())))
+		case 'b':
+			row[name] = append([]byte(nil), r.bytes(int(r.uint32()))...)
+		default:
+			r.err = fmt.Errorf("unexpected column kind %q", kind)
+		}
+	}
+	return row
+}
+
+// pgValue - the JSON value of a column in text format.
+func pgValue(oid uint32, text []byte) any {
+	switch oid {
+	case 16: // bool
+		return string(text) == "t"
+	case 20, 21, 23, 26, 700, 701, 1700: // int8, int2, int4, oid, float4, float8, numeric
+		if json.Valid(text) {
+			return json.Number(text)
+		}
+	case 114, 3802: // json, jsonb
+		if json.Valid(text) {
+			return json.RawMessage(append([]byte(nil), text...))
+		}
+	}
+	return string(text)
+}
+
+// pgTime - a pgoutput timestamp, microseconds since 2000-01-01.
+func pgTime(micros uint64) time.Time {
+	return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(int64(micros)) * time.Microsecond)
+}
+
+func changeRecord(event ChangeEvent) (Record, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{
+		Headers: map[string]string{PostgresTableHeader: event.Schema + "." + event.Table, PostgresOpHeader: event.Op},
+		Data:    data,
+	}, nil
+}
+
+// pgReader - reads the big endian fields of a pgoutput message, the first error sticks.
+type pgReader struct {
+	data []byte
+	err  error
+}
+
+func (r *pgReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data) < n {
+		r.err = errors.New("message too short")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *pgReader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgReader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *pgReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, b := range r.data {
+		if b == 0 {
+			s := string(r.data[:i])
+			r.data = r.data[i+1:]
+			return s
+		}
+	}
+	r.err = errors.New("unterminated string")
+	return ""
+}
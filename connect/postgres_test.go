@@ -0,0 +1,129 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// pgMsg - builds pgoutput messages.
+type pgMsg []byte
+
+func (m pgMsg) byte(b byte) pgMsg   { return append(m, b) }
+func (m pgMsg) u16(v uint16) pgMsg  { return m.num(uint64(v), 2) }
+func (m pgMsg) u32(v uint32) pgMsg  { return m.num(uint64(v), 4) }
+func (m pgMsg) u64(v uint64) pgMsg  { return m.num(v, 8) }
+func (m pgMsg) str(s string) pgMsg  { return append(append(m, s...), 0) }
+func (m pgMsg) text(s string) pgMsg { return append(m.byte('t').u32(uint32(len(s))), s...) }
+
+func (m pgMsg) num(v uint64, size int) pgMsg {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return append(m, b[8-size:]...)
+}
+
+func begin() pgMsg                 { return pgMsg{'B'}.u64(0x200).u64(1_000_000).u32(7) }
+func commit(lsn, end uint64) pgMsg { return pgMsg{'C'}.byte(0).u64(lsn).u64(end).u64(1_000_000) }
+func insert(id, name string) pgMsg {
+	return pgMsg{'I'}.u32(1).byte('N').u16(3).text(id).text(name).byte('n')
+}
+func deleteRow(id string) pgMsg {
+	return pgMsg{'D'}.u32(1).byte('K').u16(3).text(id).byte('n').byte('n')
+}
+
+func relation() pgMsg {
+	m := pgMsg{'R'}.u32(1).str("public").str("users").byte('d').u16(3)
+	m = m.byte(1).str("id").u32(20).u32(0)
+	m = m.byte(0).str("name").u32(25).u32(0)
+	return m.byte(0).str("profile").u32(3802).u32(0)
+}
+
+type fakeReplicationStream struct {
+	msgs  []pgMsg
+	acked []LSN
+}
+
+func (f *fakeReplicationStream) Receive(ctx context.Context) (WALMessage, error) {
+	if len(f.msgs) == 0 {
+		return WALMessage{}, context.DeadlineExceeded
+	}
+	msg := f.msgs[0]
+	f.msgs = f.msgs[1:]
+	return WALMessage{Data: msg}, nil
+}
+
+func (f *fakeReplicationStream) Acknowledge(ctx context.Context, lsn LSN) error {
+	f.acked = append(f.acked, lsn)
+	return nil
+}
+
+func TestPostgresSource(t *testing.T) {
+	stream := &fakeReplicationStream{msgs: []pgMsg{
+		begin(), relation(), insert("9007199254740993", "ada"), deleteRow("1"), commit(0x100, 0x1A0),
+		begin(), commit(0x1B0, 0x1C0), // empty transaction
+		begin(), pgMsg{'T'}.u32(1).byte(0).u32(1), commit(0x200, 0x2A0),
+	}}
+	checkpoint := FileCheckpoint(filepath.Join(t.TempDir(), "lsn"))
+	source, err := NewPostgresSource(stream, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	records, err := source.Poll(ctx)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("polled %d records, err=%v", len(records), err)
+	}
+	if records[0].ID != "0/100-0" || records[0].Headers[PostgresTableHeader] != "public.users" || records[1].Headers[PostgresOpHeader] != "delete" {
+		t.Fatalf("unexpected record %v %v", records[0].ID, records[0].Headers)
+	}
+	var event map[string]any
+	dec := json.NewDecoder(bytes.NewReader(records[0].Data))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+	after := event["after"].(map[string]any)
+	if after["id"] != json.Number("9007199254740993") || after["name"] != "ada" || after["profile"] != nil || event["lsn"] != "0/100" {
+		t.Fatalf("unexpected event %s", records[0].Data)
+	}
+
+	// not committed, the same records are polled again
+	if again, _ := source.Poll(ctx); len(again) != 2 || again[0].ID != records[0].ID {
+		t.Fatalf("uncommitted records weren't polled again")
+	}
+	if err := source.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lsn, _ := source.ResumeLSN(ctx); lsn != 0x1A0 {
+		t.Fatalf("resume lsn %v, want 0/1A0", lsn)
+	}
+
+	records, err = source.Poll(ctx)
+	if err != nil || len(records) != 1 || records[0].Headers[PostgresOpHeader] != "truncate" {
+		t.Fatalf("polled %v, err=%v", records, err)
+	}
+	if len(stream.acked) != 2 || stream.acked[1] != 0x1C0 {
+		t.Fatalf("acknowledged %v, the empty transaction wasn't acknowledged", stream.acked)
+	}
+	if err := source.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Poll(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("poll returned %v", err)
+	}
+}
+
+func TestParseLSN(t *testing.T) {
+	lsn, err := ParseLSN("16/B374D848")
+	if err != nil || lsn != 0x16B374D848 || lsn.String() != "16/B374D848" {
+		t.Fatalf("parsed %v, err=%v", lsn, err)
+	}
+	if _, err := ParseLSN("16"); err == nil {
+		t.Fatalf("an invalid lsn was parsed")
+	}
+}
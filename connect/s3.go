@@ -0,0 +1,196 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+)
+
+// ObjectWriter - stores an object in a bucket, implemented by a thin adapter over an S3 compatible client,
+// e.g. a PutObject call of the AWS SDK or of minio-go.
+type ObjectWriter interface {
+	PutObject(ctx context.Context, key string, body []byte, contentType string) error
+}
+
+// ObjectWriterFunc - adapts a function to an ObjectWriter.
+type ObjectWriterFunc func(ctx context.Context, key string, body []byte, contentType string) error
+
+// ObjectWriterFunc.PutObject - calls f.
+func (f ObjectWriterFunc) PutObject(ctx context.Context, key string, body []byte, contentType string) error {
+	return f(ctx, key, body, contentType)
+}
+
+// S3SinkOpts - configuration options for an S3 sink.
+type S3SinkOpts struct {
+	Prefix        string
+	Format        Format
+	Partitioner   Partitioner
+	MaxBatchSize  int
+	MaxBatchDelay time.Duration
+	Clock         memphis.Clock
+}
+
+// S3SinkOpt - a function on the options for an S3 sink.
+type S3SinkOpt func(*S3SinkOpts) error
+
+// Prefix - the key prefix of the objects written by the sink, e.g. "archive/orders".
+func Prefix(prefix string) S3SinkOpt {
+	return func(opts *S3SinkOpts) error {
+		opts.Prefix = prefix
+		return nil
+	}
+}
+
+// WithFormat - the format of the objects, default is NDJSON.
+func WithFormat(format Format) S3SinkOpt {
+	return func(opts *S3SinkOpts) error {
+		if format == nil {
+			return errors.New("format can not be nil")
+		}
+		opts.Format = format
+		return nil
+	}
+}
+
+// PartitionBy - the partitions objects are written to, by default every batch is a single object under the prefix.
+func PartitionBy(partitioner Partitioner) S3SinkOpt {
+	return func(opts *S3SinkOpts) error {
+		opts.Partitioner = partitioner
+		return nil
+	}
+}
+
+// BatchSize - the number of messages after which a batch is written, default is 1000.
+func BatchSize(size int) S3SinkOpt {
+	return func(opts *S3SinkOpts) error {
+		if size < 1 {
+			return errors.New("batch size has to be positive")
+		}
+		opts.MaxBatchSize = size
+		return nil
+	}
+}
+
+// BatchDelay - the time after which a batch is written even if it is not full, default is 1 second.
+// It has to be shorter than the consumer's MaxAckTime.
+func BatchDelay(delay time.Duration) S3SinkOpt {
+	return func(opts *S3SinkOpts) error {
+		if delay <= 0 {
+			return errors.New("batch delay has to be positive")
+		}
+		opts.MaxBatchDelay = delay
+		return nil
+	}
+}
+
+// WithClock - the time source of the time partitions and of the object names, default is the system clock.
+func WithClock(clock memphis.Clock) S3SinkOpt {
+	return func(opts *S3SinkOpts) error {
+		if clock == nil {
+			return errors.New("clock can not be nil")
+		}
+		opts.Clock = clock
+		return nil
+	}
+}
+
+// S3Sink - archives consumed messages into an object store, one object per batch and partition named
+// "<prefix>/<partition>/<write time>-<first sequence>-<last sequence><extension>".
+type S3Sink struct {
+	writer ObjectWriter
+	opts   S3SinkOpts
+}
+
+// NewS3Sink - creates a sink writing objects with writer.
+func NewS3Sink(writer ObjectWriter, opts ...S3SinkOpt) (*S3Sink, error) {
+	if writer == nil {
+		return nil, errors.New("connect: an S3 sink requires an object writer")
+	}
+	defaultOpts := S3SinkOpts{
+		Format:        NDJSON,
+		MaxBatchSize:  1000,
+		MaxBatchDelay: time.Second,
+		Clock:         memphis.SystemClock(),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, fmt.Errorf("connect: %w", err)
+			}
+		}
+	}
+	return &S3Sink{writer: writer, opts: defaultOpts}, nil
+}
+
+// S3Sink.Run - consumes the consumer's messages into the sink until the returned batcher is stopped, the messages
+// of a batch are acked once all of its objects are written and redelivered after NakDelay when a write fails.
+func (s *S3Sink) Run(consumer *memphis.Consumer, opts ...memphis.ConsumingOpt) (*memphis.SinkBatcher, error) {
+	batcher, err := memphis.NewSinkBatcher(consumer, s.Write,
+		memphis.SinkMaxBatchSize(s.opts.MaxBatchSize),
+		memphis.SinkMaxBatchDelay(s.opts.MaxBatchDelay),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := batcher.Consume(opts...); err != nil {
+		return nil, err
+	}
+	return batcher, nil
+}
+
+// S3Sink.Write - writes msgs as one object per partition, it is the sink's memphis.SinkCommitFunc.
+// A message whose partition can't be determined fails the whole batch.
+func (s *S3Sink) Write(ctx context.Context, msgs []*memphis.Msg) error {
+	now := s.opts.Clock.Now()
+	var order []string
+	partitions := make(map[string][]Record)
+	for _, msg := range msgs {
+		record := NewRecord(msg)
+		partition := ""
+		if s.opts.Partitioner != nil {
+			var err error
+			if partition, err = s.opts.Partitioner(record, now); err != nil {
+				return fmt.Errorf("connect: partition: %w", err)
+			}
+		}
+		if _, ok := partitions[partition]; !ok {
+			order = append(order, partition)
+		}
+		partitions[partition] = append(partitions[partition], record)
+	}
+	for _, partition := range order {
+		records := partitions[partition]
+		body, err := s.opts.Format.Encode(records)
+		if err != nil {
+			return fmt.Errorf("connect: encode: %w", err)
+		}
+		key := s.objectKey(partition, records, now)
+		if err := s.writer.PutObject(ctx, key, body, s.opts.Format.ContentType()); err != nil {
+			return fmt.Errorf("connect: put %v: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// objectKey - the key of the object holding records of partition.
+func (s *S3Sink) objectKey(partition string, records []Record, now time.Time) string {
+	name := fmt.Sprintf("%d-%d-%d%s", now.UnixNano(), records[0].Sequence, records[len(records)-1].Sequence, s.opts.Format.Extension())
+	return path.Join(s.opts.Prefix, partition, name)
+}
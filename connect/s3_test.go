@@ -0,0 +1,137 @@
+package connect
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+	"github.com/memphisdev/memphis.go/memphistest"
+)
+
+type fixedClock struct {
+	memphis.Clock
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+type memoryBucket struct {
+	mu      sync.Mutex
+	objects map[string]string
+	fail    error
+}
+
+func (b *memoryBucket) PutObject(ctx context.Context, key string, body []byte, contentType string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail != nil {
+		return b.fail
+	}
+	if b.objects == nil {
+		b.objects = map[string]string{}
+	}
+	b.objects[key] = string(body)
+	return nil
+}
+
+func fetchAll(t *testing.T, produce map[string][]string) []*memphis.Msg {
+	t.Helper()
+	b := memphistest.NewBroker()
+	p, err := b.CreateProducer("orders", "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for region, msgs := range produce {
+		hdrs := memphis.Headers{}
+		hdrs.New()
+		if region != "" {
+			hdrs.Add("region", region)
+		}
+		for _, msg := range msgs {
+			if err := p.Produce(msg, memphis.MsgHeaders(hdrs)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	c, err := b.CreateConsumer("orders", "archiver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := c.Fetch(100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+func TestS3SinkWrite(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	bucket := &memoryBucket{}
+	sink, err := NewS3Sink(bucket,
+		Prefix("archive/orders"),
+		PartitionBy(Partitions(TimePartitioner("dt=2006-01-02"), HeaderPartitioner("region"))),
+		WithClock(fixedClock{now: now}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := fetchAll(t, map[string][]string{"eu": {`{"id":1}`, "plain"}})
+	if err := sink.Write(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	key := "archive/orders/dt=2024-03-01/region=eu/1709289000000000000-1-2.ndjson"
+	body, ok := bucket.objects[key]
+	if !ok || len(bucket.objects) != 1 {
+		t.Fatalf("objects %v, want %v", bucket.objects, key)
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"data":{"id":1}`) || !strings.Contains(lines[1], `"data":"plain"`) {
+		t.Fatalf("unexpected object %q", body)
+	}
+	if !strings.Contains(lines[0], `"sequence":1`) || !strings.Contains(lines[0], `"region":"eu"`) {
+		t.Fatalf("record metadata missing from %q", lines[0])
+	}
+}
+
+func TestS3SinkPartitionsAndFailures(t *testing.T) {
+	bucket := &memoryBucket{}
+	sink, err := NewS3Sink(bucket, PartitionBy(HeaderPartitioner("region")),
+		WithFormat(CustomFormat(".parquet", "application/vnd.apache.parquet", func(records []Record) ([]byte, error) {
+			return []byte{byte(len(records))}, nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := fetchAll(t, map[string][]string{"": {"a"}})
+	msgs = append(msgs, fetchAll(t, map[string][]string{"us": {"b", "c"}})...)
+	if err := sink.Write(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for key, body := range bucket.objects {
+		if !strings.HasSuffix(key, ".parquet") {
+			t.Fatalf("object %v doesn't have the format's extension", key)
+		}
+		counts[strings.Split(key, "/")[0]] = int(body[0])
+	}
+	if counts["region=none"] != 1 || counts["region=us"] != 2 {
+		t.Fatalf("partitioned %v", counts)
+	}
+
+	bucket.fail = errors.New("access denied")
+	if err := sink.Write(context.Background(), msgs); !errors.Is(err, bucket.fail) {
+		t.Fatalf("write error = %v", err)
+	}
+	if _, err := NewS3Sink(nil); err == nil {
+		t.Fatalf("a sink without a writer was created")
+	}
+	if _, err := NewS3Sink(bucket, BatchSize(0)); err == nil {
+		t.Fatalf("a zero batch size was accepted")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+)
+
+// Source - an ingestion connector. Poll returns the records after the last committed position, so records which
+// were polled but not committed are returned again by the next Poll. Commit checkpoints the position after the
+// records of the last Poll.
+type Source interface {
+	Poll(ctx context.Context) ([]Record, error)
+	Commit(ctx context.Context) error
+}
+
+// Producer - the producer surface used by RunSource, implemented by *memphis.Producer.
+type Producer interface {
+	ProduceWithContext(ctx context.Context, message any, opts ...memphis.ProduceOpt) error
+}
+
+// CheckpointStore - persists the position of a source across restarts.
+type CheckpointStore interface {
+	// Load - the saved position, empty when nothing was saved yet.
+	Load(ctx context.Context) (string, error)
+	Save(ctx context.Context, position string) error
+}
+
+// FileCheckpoint - a checkpoint store keeping the position in a file, the file is replaced atomically on save.
+func FileCheckpoint(path string) CheckpointStore {
+	return fileCheckpoint{path: path}
+}
+
+type fileCheckpoint struct {
+	path string
+}
+
+func (f fileCheckpoint) Load(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+func (f fileCheckpoint) Save(ctx context.Context, position string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(position); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// SourceOpts - configuration options for running a source.
+type SourceOpts struct {
+	PollInterval time.Duration
+	ErrHandler   func(error)
+	Clock        memphis.Clock
+}
+
+// SourceOpt - a function on the options for running a source.
+type SourceOpt func(*SourceOpts) error
+
+// PollInterval - the time waited before polling again after a Poll returned no records or an error,
+// default is 1 second. A Poll returning records is followed by the next one right away.
+func PollInterval(interval time.Duration) SourceOpt {
+	return func(opts *SourceOpts) error {
+		if interval <= 0 {
+			return errors.New("poll interval has to be positive")
+		}
+		opts.PollInterval = interval
+		return nil
+	}
+}
+
+// SourceErrHandler - called with the errors of polling, producing and committing, which are retried after the
+// poll interval. By default they are dropped.
+func SourceErrHandler(handler func(error)) SourceOpt {
+	return func(opts *SourceOpts) error {
+		opts.ErrHandler = handler
+		return nil
+	}
+}
+
+// SourceClock - the time source of the poll interval, default is the system clock.
+func SourceClock(clock memphis.Clock) SourceOpt {
+	return func(opts *SourceOpts) error {
+		if clock == nil {
+			return errors.New("clock can not be nil")
+		}
+		opts.Clock = clock
+		return nil
+	}
+}
+
+// RunSource - polls source and produces its records in order with producer until ctx is done, then returns
+// ctx's error. The source is committed once all the records of a poll are produced; when producing fails
+// nothing is committed and the records are polled and produced again, records with an ID are deduplicated.
+func RunSource(ctx context.Context, source Source, producer Producer, opts ...SourceOpt) error {
+	if source == nil || producer == nil {
+		return errors.New("connect: running a source requires a source and a producer")
+	}
+	defaultOpts := SourceOpts{PollInterval: time.Second, Clock: memphis.SystemClock()}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return fmt.Errorf("connect: %w", err)
+			}
+		}
+	}
+	for {
+		n, err := pollOnce(ctx, source, producer)
+		if err != nil && ctx.Err() == nil && defaultOpts.ErrHandler != nil {
+			defaultOpts.ErrHandler(err)
+		}
+		if n > 0 && err == nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		timer := defaultOpts.Clock.NewTimer(defaultOpts.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// pollOnce - produces the records of one poll and commits them, returns the number of records.
+func pollOnce(ctx context.Context, source Source, producer Producer) (int, error) {
+	records, err := source.Poll(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("connect: poll: %w", err)
+	}
+	for _, record := range records {
+		if err := producer.ProduceWithContext(ctx, record.Data, recordOpts(record)...); err != nil {
+			return len(records), fmt.Errorf("connect: produce: %w", err)
+		}
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	if err := source.Commit(ctx); err != nil {
+		return len(records), fmt.Errorf("connect: commit: %w", err)
+	}
+	return len(records), nil
+}
+
+// recordOpts - the produce options carrying a record's id and headers.
+func recordOpts(record Record) []memphis.ProduceOpt {
+	var opts []memphis.ProduceOpt
+	if record.ID != "" {
+		opts = append(opts, memphis.MsgId(record.ID))
+	}
+	if len(record.Headers) > 0 {
+		hdrs := memphis.Headers{}
+		hdrs.New()
+		for key, value := range record.Headers {
+			hdrs.Add(key, value)
+		}
+		opts = append(opts, memphis.MsgHeaders(hdrs))
+	}
+	return opts
+}
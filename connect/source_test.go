@@ -0,0 +1,120 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/memphisdev/memphis.go/memphistest"
+)
+
+// eventsDecoder - decodes {"events": [...], "next": "<cursor>"} pages.
+func eventsDecoder(body []byte) ([]Record, string, error) {
+	var page struct {
+		Events []json.RawMessage `json:"events"`
+		Next   string            `json:"next"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, "", err
+	}
+	var records []Record
+	for _, event := range page.Events {
+		records = append(records, Record{Data: event, Headers: map[string]string{"source": "http"}})
+	}
+	return records, page.Next, nil
+}
+
+func TestRunHTTPSource(t *testing.T) {
+	events := []string{`{"id":1}`, `{"id":2}`, `{"id":3}`}
+	var failures int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		page := map[string]any{"events": []json.RawMessage{}}
+		if since < len(events) {
+			// two events per page
+			end := since + 2
+			if end > len(events) {
+				end = len(events)
+			}
+			for _, e := range events[since:end] {
+				page["events"] = append(page["events"].([]json.RawMessage), json.RawMessage(e))
+			}
+			page["next"] = strconv.Itoa(end)
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	checkpoint := FileCheckpoint(filepath.Join(t.TempDir(), "position"))
+	source, err := NewHTTPSource(srv.URL, HTTPHeader("Authorization", "Bearer token"), CursorParam("since"),
+		WithDecoder(eventsDecoder), WithCheckpoint(checkpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := memphistest.NewBroker()
+	producer, err := broker.CreateProducer("events", "ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- RunSource(ctx, source, producer, PollInterval(5*time.Millisecond), SourceErrHandler(func(err error) { errs <- err }))
+	}()
+	deadline := time.Now().Add(time.Second)
+	for len(broker.Messages("events")) < len(events) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunSource returned %v", err)
+	}
+
+	msgs := broker.Messages("events")
+	if len(msgs) != len(events) || string(msgs[2]) != events[2] {
+		t.Fatalf("produced %q", msgs)
+	}
+	if position, _ := checkpoint.Load(context.Background()); position != "3" || source.Position() != "3" {
+		t.Fatalf("checkpoint %q, position %q, want 3", position, source.Position())
+	}
+	if len(errs) == 0 {
+		t.Fatalf("the failed poll wasn't reported")
+	}
+
+	// a new source resumes from the checkpoint
+	resumed, _ := NewHTTPSource(srv.URL, HTTPHeader("Authorization", "Bearer token"), CursorParam("since"),
+		WithDecoder(eventsDecoder), WithCheckpoint(checkpoint))
+	if records, err := resumed.Poll(context.Background()); err != nil || len(records) != 0 {
+		t.Fatalf("resumed poll returned %d records, err=%v", len(records), err)
+	}
+}
+
+func TestJSONArrayDecoder(t *testing.T) {
+	records, next, err := JSONArrayDecoder([]byte(`[{"a":1},{"a":1},{"a":2}]`))
+	if err != nil || next != "" || len(records) != 3 {
+		t.Fatalf("decoded %v %q %v", records, next, err)
+	}
+	if records[0].ID != records[1].ID || records[0].ID == records[2].ID {
+		t.Fatalf("ids are not derived from the content")
+	}
+	if _, _, err := JSONArrayDecoder([]byte(`{}`)); err == nil {
+		t.Fatalf("an object was decoded as an array")
+	}
+}
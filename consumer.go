@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -43,10 +44,14 @@ const (
 var (
 	ConsumerErrStationUnreachable = errors.New("station unreachable")
 	ConsumerErrConsumeInactive    = errors.New("consumer is inactive")
+	ConsumerErrConsumeActive      = errors.New("consumer is already consuming")
 	ConsumerErrDelayDlsMsg        = errors.New("cannot delay DLS message")
+	ConsumerErrFetchFailed        = errors.New("fetch failed")
 )
 
 // Consumer - memphis consumer object.
+// Consume, StopConsume, Pause, Resume, State, Fetch, SetContext and Destroy are safe to call from multiple goroutines,
+// the exported configuration fields should not be changed after creation.
 type Consumer struct {
 	Name                     string
 	ConsumerGroup            string
@@ -60,8 +65,8 @@ type Consumer struct {
 	jsConsumers              map[int]jetstream.Consumer
 	pingInterval             time.Duration
 	subscriptionActive       bool
-	consumeActive            bool
-	consumeQuit              chan struct{}
+	state                    int32
+	consumeCancel            context.CancelFunc
 	pingQuit                 chan struct{}
 	errHandler               ConsumerErrHandler
 	StartConsumeFromSequence uint64
@@ -70,9 +75,40 @@ type Consumer struct {
 	realName                 string
 	dlsCurrentIndex          int
 	dlsHandlerFunc           ConsumeHandler
+	dlsCallback              ConsumeHandler
 	dlsMsgs                  []*Msg
 	dlsMsgsMutex             sync.RWMutex
+	dlsStats                 DLSStats
 	PartitionGenerator       *RoundRobinProducerConsumerGenerator
+	stateMu                  sync.RWMutex
+	consumeMode              ConsumeMode
+	adaptivePull             bool
+	adaptivePullMin          time.Duration
+	adaptivePullMax          time.Duration
+	prefetchDepth            int
+	prefetchWatermark        int
+	prefetching              int32
+	partition                int
+	retryPolicy              *RetryPolicy
+	poisonClassifier         PoisonClassifierFunc
+	quarantineStation        string
+	schemaChangedId          int
+	resumed                  bool
+	startSequences           map[int]uint64
+	partitionsMu             sync.RWMutex
+	partitionsChanged        PartitionsChangedHandler
+	partitionsUpdated        chan struct{}
+	longPollHeartbeat        time.Duration
+	maxAckPending            int
+	ackPendingThrottled      int32
+	ackPendingMu             sync.Mutex
+	ackPendingCheckedAt      time.Time
+	raw                      bool
+	placement                *ConsumerPlacement
+	protoSchema              *ProtoSchema
+	schemaCache              schemaDetailsCache
+	inactiveThreshold        time.Duration
+	ephemeral                bool
 }
 
 // Msg - a received message, can be acked.
@@ -81,6 +117,15 @@ type Msg struct {
 	conn                *Conn
 	cgName              string
 	internalStationName string
+	retryPolicy         *RetryPolicy
+	poisonClassifier    PoisonClassifierFunc
+	quarantineStation   string
+	receivedAt          time.Time
+	dls                 bool
+	raw                 bool
+	protoSchema         *ProtoSchema
+	schemaCache         *schemaDetailsCache
+	decoded             *decodedData
 }
 
 type PMsgToAck struct {
@@ -88,8 +133,46 @@ type PMsgToAck struct {
 	CgName string `json:"cg_name"`
 }
 
+// NewMsg - wraps a JetStream message as a memphis message, for messages consumed outside of a memphis
+// consumer or in-memory fakes. Without a connection DataDeserialized returns the raw data.
+func NewMsg(msg jetstream.Msg) *Msg {
+	return &Msg{msg: msg}
+}
+
 // Msg.Data - get message's data.
 func (m *Msg) Data() []byte {
+	return m.rawData()
+}
+
+// Msg.DataNoCopy - get message's data as received from NATS, without copying it.
+// The returned slice is shared with the underlying NATS message and must be treated as read only.
+func (m *Msg) DataNoCopy() []byte {
+	return m.rawData()
+}
+
+// metadata - the JetStream metadata of the message.
+func (m *Msg) metadata() (*jetstream.MsgMetadata, error) {
+	if msg, ok := m.msg.(*nats.Msg); ok {
+		md, err := msg.Metadata()
+		if err != nil {
+			return nil, err
+		}
+		return &jetstream.MsgMetadata{
+			Sequence:     jetstream.SequencePair{Consumer: md.Sequence.Consumer, Stream: md.Sequence.Stream},
+			NumDelivered: md.NumDelivered,
+			NumPending:   md.NumPending,
+			Timestamp:    md.Timestamp,
+			Stream:       md.Stream,
+			Consumer:     md.Consumer,
+			Domain:       md.Domain,
+		}, nil
+	} else if jsMsg, ok := m.msg.(jetstream.Msg); ok {
+		return jsMsg.Metadata()
+	}
+	return nil, errors.New("Message format is not supported")
+}
+
+func (m *Msg) rawData() []byte {
 	if msg, ok := m.msg.(*nats.Msg); ok {
 		return msg.Data
 	} else {
@@ -104,7 +187,13 @@ func (m *Msg) Data() []byte {
 func (m *Msg) DataDeserialized() (any, error) {
 	var data map[string]interface{}
 
-	sd, err := m.conn.getSchemaDetails(m.internalStationName)
+	if m.decoded != nil {
+		return m.decoded.value, m.decoded.err
+	}
+	if m.conn == nil || m.raw {
+		return m.DataNoCopy(), nil
+	}
+	sd, err := m.schemaDetails()
 	if err != nil {
 		return nil, memphisError(errors.New("Schema validation has failed: " + err.Error()))
 	}
@@ -202,7 +291,7 @@ func (m *Msg) Ack() error {
 			headers = jsMsg.Headers()
 		}
 		id, ok := headers["$memphis_pm_id"]
-		if !ok {
+		if !ok || m.conn == nil {
 			return err
 		} else {
 			idNumber, err := strconv.Atoi(id[0])
@@ -266,19 +355,22 @@ func (m *Msg) Delay(duration time.Duration) error {
 type ConsumerErrHandler func(*Consumer, error)
 
 type createConsumerReq struct {
-	Name                     string `json:"name"`
-	StationName              string `json:"station_name"`
-	ConnectionId             string `json:"connection_id"`
-	ConsumerType             string `json:"consumer_type"`
-	ConsumerGroup            string `json:"consumers_group"`
-	MaxAckTimeMillis         int    `json:"max_ack_time_ms"`
-	MaxMsgDeliveries         int    `json:"max_msg_deliveries"`
-	Username                 string `json:"username"`
-	StartConsumeFromSequence uint64 `json:"start_consume_from_sequence"`
-	LastMessages             int64  `json:"last_messages"`
-	RequestVersion           int    `json:"req_version"`
-	AppId                    string `json:"app_id"`
-	SdkLang                  string `json:"sdk_lang"`
+	Name                     string            `json:"name"`
+	StationName              string            `json:"station_name"`
+	ConnectionId             string            `json:"connection_id"`
+	ConsumerType             string            `json:"consumer_type"`
+	ConsumerGroup            string            `json:"consumers_group"`
+	MaxAckTimeMillis         int               `json:"max_ack_time_ms"`
+	MaxMsgDeliveries         int               `json:"max_msg_deliveries"`
+	Username                 string            `json:"username"`
+	StartConsumeFromSequence uint64            `json:"start_consume_from_sequence"`
+	LastMessages             int64             `json:"last_messages"`
+	RequestVersion           int               `json:"req_version"`
+	AppId                    string            `json:"app_id"`
+	SdkLang                  string            `json:"sdk_lang"`
+	MaxAckPending            int               `json:"max_ack_pending,omitempty"`
+	InactiveThresholdMillis  int64             `json:"inactive_threshold_ms,omitempty"`
+	ClientMetadata           map[string]string `json:"client_metadata,omitempty"`
 }
 
 type removeConsumerReq struct {
@@ -303,15 +395,58 @@ type ConsumerOpts struct {
 	ErrHandler               ConsumerErrHandler
 	StartConsumeFromSequence uint64
 	LastMessages             int64
+	StartConsumeFromNow      bool
 	TimeoutRetry             int
+	RequestOpts              []RequestOpt
+	ConsumeMode              ConsumeMode
+	AdaptivePull             bool
+	AdaptivePullMin          time.Duration
+	AdaptivePullMax          time.Duration
+	PrefetchDepth            int
+	PrefetchWatermark        int
+	Partition                int
+	RetryPolicy              *RetryPolicy
+	PoisonClassifier         PoisonClassifierFunc
+	QuarantineStation        string
+	SchemaChanged            SchemaChangedHandler
+	ResumeFromLastAck        bool
+	PartitionsChanged        PartitionsChangedHandler
+	LongPollHeartbeat        time.Duration
+	MaxAckPending            int
+	Raw                      bool
+	Placement                *ConsumerPlacement
+	ProtoSchema              *ProtoSchema
+	InactiveThreshold        time.Duration
+	Ephemeral                bool
 }
 
+// ConsumeMode - the way Consume pulls messages from the broker
+type ConsumeMode int
+
+const (
+	// ConsumeModePullLoop - issue a new fetch every PullInterval
+	ConsumeModePullLoop ConsumeMode = iota
+	// ConsumeModePipelined - keep a standing pull request per partition, batches are handed to the handler as soon as they arrive
+	ConsumeModePipelined
+	// ConsumeModeLongPoll - like ConsumeModePipelined with long pull requests kept alive by idle heartbeats,
+	// missed heartbeats are reported as ConsumerErrHeartbeatMissed
+	ConsumeModeLongPoll
+	// ConsumeModePush - the broker pushes messages to the consumer as they are stored, through the consumer
+	// group's own consumer, which the broker has to have created as a push consumer
+	ConsumeModePush
+)
+
 type createConsumerResp struct {
 	SchemaUpdateInit SchemaUpdateInit `json:"schema_update"`
 	PartitionsUpdate PartitionsUpdate `json:"partitions_update"`
 	Err              string           `json:"error"`
 }
 
+// GetConsumerDefaultOptions - returns default configuration options for consumers.
+func GetConsumerDefaultOptions() ConsumerOpts {
+	return getDefaultConsumerOptions()
+}
+
 // getDefaultConsumerOptions - returns default configuration options for consumers.
 func getDefaultConsumerOptions() ConsumerOpts {
 	return ConsumerOpts{
@@ -325,6 +460,7 @@ func getDefaultConsumerOptions() ConsumerOpts {
 		StartConsumeFromSequence: 1,
 		LastMessages:             -1,
 		TimeoutRetry:             5,
+		PrefetchDepth:            1,
 	}
 }
 
@@ -344,10 +480,13 @@ func (c *Conn) CreateConsumer(stationName, consumerName string, opts ...Consumer
 			}
 		}
 	}
+	if err := defaultOpts.applyEphemeral(); err != nil {
+		return nil, memphisError(err)
+	}
 	if defaultOpts.ConsumerGroup == "" {
 		defaultOpts.ConsumerGroup = consumerName
 	}
-	consumer, err := defaultOpts.createConsumer(c, TimeoutRetry(defaultOpts.TimeoutRetry))
+	consumer, err := defaultOpts.createConsumer(c, append([]RequestOpt{TimeoutRetry(defaultOpts.TimeoutRetry)}, defaultOpts.RequestOpts...)...)
 	if err != nil {
 		return nil, memphisError(err)
 	}
@@ -384,6 +523,37 @@ func (opts *ConsumerOpts) createConsumer(c *Conn, options ...RequestOpt) (*Consu
 		dlsCurrentIndex:          0,
 		dlsHandlerFunc:           nil,
 		realName:                 nameWithoutSuffix,
+		consumeMode:              opts.ConsumeMode,
+		adaptivePull:             opts.AdaptivePull,
+		adaptivePullMin:          opts.AdaptivePullMin,
+		adaptivePullMax:          opts.AdaptivePullMax,
+		prefetchDepth:            opts.PrefetchDepth,
+		prefetchWatermark:        opts.PrefetchWatermark,
+		partition:                opts.Partition,
+		retryPolicy:              opts.RetryPolicy,
+		poisonClassifier:         opts.PoisonClassifier,
+		quarantineStation:        opts.QuarantineStation,
+		partitionsChanged:        opts.PartitionsChanged,
+		partitionsUpdated:        make(chan struct{}, 1),
+		longPollHeartbeat:        opts.LongPollHeartbeat,
+		maxAckPending:            opts.MaxAckPending,
+		raw:                      opts.Raw,
+		placement:                opts.Placement,
+		protoSchema:              opts.ProtoSchema,
+		inactiveThreshold:        opts.InactiveThreshold,
+		ephemeral:                opts.Ephemeral,
+	}
+
+	if consumer.raw && opts.SchemaChanged != nil {
+		return nil, memphisError(errors.New("a raw consumer can't be notified of schema changes"))
+	}
+
+	if consumer.poisonClassifier != nil && consumer.quarantineStation == "" {
+		consumer.quarantineStation = consumer.stationName + quarantineStationSuffix
+	}
+
+	if consumer.retryPolicy != nil && consumer.MaxMsgDeliveries < consumer.retryPolicy.MaxAttempts {
+		consumer.MaxMsgDeliveries = consumer.retryPolicy.MaxAttempts
 	}
 
 	if consumer.StartConsumeFromSequence == 0 {
@@ -398,49 +568,82 @@ func (opts *ConsumerOpts) createConsumer(c *Conn, options ...RequestOpt) (*Consu
 		return nil, memphisError(errors.New("Consumer creation options can't contain both startConsumeFromSequence and lastMessages"))
 	}
 
+	if opts.StartConsumeFromNow {
+		if consumer.StartConsumeFromSequence > 1 || consumer.LastMessages > -1 {
+			return nil, memphisError(errors.New("Consumer creation options can't contain startConsumeFromNow together with startConsumeFromSequence or lastMessages"))
+		}
+	}
+
 	if consumer.BatchSize > maxBatchSize || consumer.BatchSize < 1 {
 		return nil, memphisError(errors.New("Batch size can not be greater than " + strconv.Itoa(maxBatchSize) + " or less than 1"))
 	}
 
-	sn := getInternalName(consumer.stationName)
-	_, ok := c.stationUpdatesSubs[sn]
-	if !ok {
-		c.stationUpdatesSubs[sn] = &stationUpdateSub{
-			refCount:       1,
-			schemaUpdateCh: make(chan SchemaUpdate),
-			schemaDetails:  schemaDetails{},
+	if opts.ResumeFromLastAck {
+		consumer.resumed, err = c.consumerGroupExists(consumer.stationName, consumer.ConsumerGroup, options...)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+		if consumer.resumed {
+			// the group keeps its position, the start options only apply to a new group
+			consumer.StartConsumeFromSequence = 1
+			consumer.LastMessages = -1
 		}
 	}
 
+	if opts.StartConsumeFromNow && !consumer.resumed {
+		consumer.StartConsumeFromSequence, err = c.sequenceAfterLast(consumer.stationName, consumer.partition, options...)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+	}
+
+	sn := getInternalName(consumer.stationName)
+	if !consumer.raw {
+		c.ensureStationUpdatesSub(sn)
+	}
+
 	err = c.create(&consumer, options...)
 	if err != nil {
 		return nil, memphisError(err)
 	}
 
-	consumer.consumeQuit = make(chan struct{})
 	consumer.pingQuit = make(chan struct{}, 1)
 
 	consumer.pingInterval = consumerDefaultPingInterval
 
-	err = c.listenToSchemaUpdates(opts.StationName)
-	if err != nil {
-		return nil, memphisError(err)
+	if !consumer.raw {
+		err = c.listenToSchemaUpdates(opts.StationName)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+		consumer.schemaChangedId = c.addSchemaChangedHandler(opts.StationName, opts.SchemaChanged)
 	}
 
 	durable := getInternalName(consumer.ConsumerGroup)
 
-	if len(consumer.conn.stationPartitions[sn].PartitionsList) == 0 {
+	partitionsList := c.getStationPartitions(sn).PartitionsList
+	if consumer.partition > 0 {
+		streamName, err := partitionStreamName(sn, partitionsList, consumer.partition)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+		jsCons, err := c.jetstreamConsumer(streamName, durable, options...)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+		consumer.jsConsumers = map[int]jetstream.Consumer{consumer.partition: jsCons}
+	} else if len(partitionsList) == 0 {
 		consumer.jsConsumers = make(map[int]jetstream.Consumer, 1)
-		jsCons, err := c.jetstreamConsumer(sn, durable)
+		jsCons, err := c.jetstreamConsumer(sn, durable, options...)
 		if err != nil {
 			return nil, memphisError(err)
 		}
 		consumer.jsConsumers[1] = jsCons
 	} else {
-		consumer.jsConsumers = make(map[int]jetstream.Consumer, len(consumer.conn.stationPartitions[sn].PartitionsList))
-		for _, p := range consumer.conn.stationPartitions[sn].PartitionsList {
+		consumer.jsConsumers = make(map[int]jetstream.Consumer, len(partitionsList))
+		for _, p := range partitionsList {
 			streamName := fmt.Sprintf("%s$%s", sn, strconv.Itoa(p))
-			jsCons, err := c.jetstreamConsumer(streamName, durable)
+			jsCons, err := c.jetstreamConsumer(streamName, durable, options...)
 			if err != nil {
 				return nil, memphisError(err)
 			}
@@ -448,21 +651,98 @@ func (opts *ConsumerOpts) createConsumer(c *Conn, options ...RequestOpt) (*Consu
 		}
 	}
 
-	consumer.subscriptionActive = true
+	if err := consumer.applyMaxAckPending(consumer.jsConsumers, options...); err != nil {
+		return nil, memphisError(err)
+	}
+	if err := consumer.applyInactiveThreshold(consumer.jsConsumers, options...); err != nil {
+		return nil, memphisError(err)
+	}
+	consumer.applyPlacement(options...)
+	consumer.startSequences = startSequences(consumer.jsConsumers)
+	if consumer.partition == 0 {
+		if err := c.watchPartitions(); err != nil {
+			return nil, memphisError(err)
+		}
+	}
+	consumer.setSubscriptionActive(true)
 
 	go consumer.pingConsumer()
-	err = consumer.dlsSubscriptionInit()
-	if err != nil {
-		return nil, memphisError(err)
+	if !consumer.raw {
+		err = consumer.dlsSubscriptionInit()
+		if err != nil {
+			return nil, memphisError(err)
+		}
 	}
 	c.cacheConsumer(&consumer)
+	c.emit(Event{Type: EventConsumerCreated, Station: consumer.stationName, Consumer: consumer.Name, Partition: consumer.partition,
+		Details: map[string]string{"consumer_group": consumer.ConsumerGroup}})
 
 	return &consumer, err
 }
 
-// Station.CreateConsumer - creates a producer attached to this station.
+// CreatePartitionConsumer - creates a consumer bound to a single partition of the station, every fetch of the
+// consumer reads from that partition only. Partition consumers of the same consumer group living in the same
+// process need distinct names. DLS messages of the station are delivered to any consumer of the group.
+func (c *Conn) CreatePartitionConsumer(stationName, consumerName string, partition int, opts ...ConsumerOpt) (*Consumer, error) {
+	if partition < 1 {
+		return nil, memphisError(errors.New("partition number has to be positive"))
+	}
+	return c.CreateConsumer(stationName, consumerName, append(opts, func(o *ConsumerOpts) error {
+		o.Partition = partition
+		return nil
+	})...)
+}
+
+// partitionStreamName - the stream holding the given partition of a station, stations created before
+// partitions were introduced have a single stream which is partition 1.
+func partitionStreamName(internalStationName string, partitionsList []int, partition int) (string, error) {
+	if len(partitionsList) == 0 {
+		if partition != 1 {
+			return "", fmt.Errorf("station has no partition %d", partition)
+		}
+		return internalStationName, nil
+	}
+	for _, p := range partitionsList {
+		if p == partition {
+			return fmt.Sprintf("%s$%s", internalStationName, strconv.Itoa(p)), nil
+		}
+	}
+	return "", fmt.Errorf("station has no partition %d", partition)
+}
+
+// Consumer.Partition - the partition the consumer is bound to, 0 if it consumes from all partitions.
+func (c *Consumer) Partition() int {
+	return c.partition
+}
+
+// Station.CreatePartitionConsumer - creates a consumer bound to a single partition of this station,
+// the partition is checked against the station's cached partitions before the consumer is registered.
+func (s *Station) CreatePartitionConsumer(name string, partition int, opts ...ConsumerOpt) (*Consumer, error) {
+	if partitions := s.cachedPartitions(); partitions != nil && partition > 0 {
+		found := false
+		for _, p := range partitions {
+			found = found || p.Number == partition
+		}
+		if !found {
+			return nil, memphisError(fmt.Errorf("station has no partition %d", partition))
+		}
+	}
+	consumer, err := s.conn.CreatePartitionConsumer(s.Name, name, partition, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.learnPartitions()
+	return consumer, nil
+}
+
+// Station.CreateConsumer - creates a consumer attached to this station.
 func (s *Station) CreateConsumer(name string, opts ...ConsumerOpt) (*Consumer, error) {
-	return s.conn.CreateConsumer(s.Name, name, opts...)
+	consumer, err := s.conn.CreateConsumer(s.Name, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.learnPartitions()
+	return consumer, nil
 }
 
 func DefaultConsumerErrHandler(c *Consumer, err error) {
@@ -476,35 +756,40 @@ func (c *Consumer) callErrHandler(err error) {
 }
 
 func (c *Consumer) pingConsumer() {
-	ticker := time.NewTicker(c.pingInterval)
-	if !c.subscriptionActive {
+	ticker := c.clock().NewTicker(c.pingInterval)
+	if !c.isSubscriptionActive() {
 		log.Fatal("started ping for inactive subscription")
 	}
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			var generalErr error
+			var errMu sync.Mutex
 			wg := sync.WaitGroup{}
-			wg.Add(len(c.jsConsumers))
-			for _, jscons := range c.jsConsumers {
-				go func(jscons jetstream.Consumer) {
-					ctx, cancelfunc := context.WithTimeout(context.Background(), JetstreamOperationTimeout*time.Second)
+			jsConsumers := c.partitionConsumers()
+			wg.Add(len(jsConsumers))
+			for p, jscons := range jsConsumers {
+				go func(p int, jscons jetstream.Consumer) {
+					defer wg.Done()
+					ctx, cancelfunc := c.conn.jetstreamContext(getDefaultRequestOptions())
 					defer cancelfunc()
-					_, err := jscons.Info(ctx)
+					info, err := jscons.Info(ctx)
 					if err != nil {
+						errMu.Lock()
 						generalErr = err
-						wg.Done()
+						errMu.Unlock()
 						return
 					}
-					wg.Done()
-				}(jscons)
+					c.reportPending(p, info.NumPending)
+				}(p, jscons)
 			}
 			wg.Wait()
 			if generalErr != nil {
 				if strings.Contains(generalErr.Error(), "consumer not found") || strings.Contains(generalErr.Error(), "stream not found") {
-					c.subscriptionActive = false
+					c.setSubscriptionActive(false)
 					c.callErrHandler(ConsumerErrStationUnreachable)
+					c.stopConsume(ConsumerStateFailed)
 				}
 			}
 		case <-c.pingQuit:
@@ -516,7 +801,54 @@ func (c *Consumer) pingConsumer() {
 
 // Consumer.SetContext - set a context that will be passed to each message handler function call
 func (c *Consumer) SetContext(ctx context.Context) {
+	c.stateMu.Lock()
 	c.context = ctx
+	c.stateMu.Unlock()
+}
+
+func (c *Consumer) getContext() context.Context {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.context
+}
+
+func (c *Consumer) isSubscriptionActive() bool {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.subscriptionActive
+}
+
+func (c *Consumer) setSubscriptionActive(active bool) {
+	c.stateMu.Lock()
+	c.subscriptionActive = active
+	c.stateMu.Unlock()
+}
+
+func (c *Consumer) getDlsHandlerFunc() ConsumeHandler {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.dlsHandlerFunc
+}
+
+func (c *Consumer) setDlsHandlerFunc(handlerFunc ConsumeHandler) {
+	c.stateMu.Lock()
+	c.dlsHandlerFunc = handlerFunc
+	c.stateMu.Unlock()
+}
+
+// SetDLSHandler - set a handler for the messages of the consumer group's dead-letter station, called with a single
+// message and the consumer's context. Without one DLS messages are delivered to the Consume handler or returned by Fetch,
+// Msg.IsDLS tells them apart. Passing nil restores that behavior.
+func (c *Consumer) SetDLSHandler(handler ConsumeHandler) {
+	c.stateMu.Lock()
+	c.dlsCallback = handler
+	c.stateMu.Unlock()
+}
+
+func (c *Consumer) getDlsCallback() ConsumeHandler {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.dlsCallback
 }
 
 // ConsumeHandler - handler for consumed messages
@@ -526,8 +858,16 @@ type ConsumeHandler func([]*Msg, error, context.Context)
 type ConsumingOpts struct {
 	ConsumerPartitionKey    string
 	ConsumerPartitionNumber int
+	Filter                  MsgFilter
+	MaxBytes                int
+	NakDelay                time.Duration
+	SortByPublishTime       bool
+	DecodeConcurrency       int
 }
 
+// MsgFilter - decides whether a consumed message should be handed to the application.
+type MsgFilter func(*Msg) bool
+
 type ConsumingOpt func(*ConsumingOpts) error
 
 // ConsumerPartitionKey - Partition key for the consumer to consume from
@@ -546,6 +886,55 @@ func ConsumerPartitionNumber(ConsumerPartitionNumber int) ConsumingOpt {
 	}
 }
 
+// Filter - only messages the filter returns true for are passed on, the rest are acked and skipped.
+// The filter is evaluated client side since the broker can only filter by subject: skipped messages are still
+// delivered to the consumer, and failures to ack them are passed to the consumer's error handler.
+func Filter(filter MsgFilter) ConsumingOpt {
+	return func(opts *ConsumingOpts) error {
+		opts.Filter = filter
+		return nil
+	}
+}
+
+// HeaderFilter - only messages carrying the given header value are passed on, the rest are acked and skipped.
+// Like Filter it is evaluated client side, there is no broker side header filtering.
+func HeaderFilter(key, value string) ConsumingOpt {
+	return Filter(func(m *Msg) bool {
+		return m.GetHeaders()[key] == value
+	})
+}
+
+// MaxBytes - bounds each pull request by the total size of the messages in bytes instead of by the batch size,
+// so memory constrained consumers can cap how much a single batch holds.
+func MaxBytes(maxBytes int) ConsumingOpt {
+	return func(opts *ConsumingOpts) error {
+		if maxBytes < 1 {
+			return errors.New("max bytes has to be positive")
+		}
+		opts.MaxBytes = maxBytes
+		return nil
+	}
+}
+
+// Consumer.filterMsgs - acks and skips the expired messages and those filter returns false for, failed acks are
+// passed to the error handler.
+func (c *Consumer) filterMsgs(msgs []*Msg, filter MsgFilter) []*Msg {
+	if len(msgs) == 0 {
+		return msgs
+	}
+	filtered := make([]*Msg, 0, len(msgs))
+	for _, msg := range msgs {
+		if !msg.expired() && (filter == nil || filter(msg)) {
+			filtered = append(filtered, msg)
+			continue
+		}
+		if err := msg.Ack(); err != nil {
+			c.callErrHandler(memphisError(fmt.Errorf("failed to ack filtered message: %w", err)))
+		}
+	}
+	return filtered
+}
+
 func getDefaultConsumingOptions() ConsumingOpts {
 	return ConsumingOpts{
 		ConsumerPartitionKey:    "",
@@ -553,6 +942,57 @@ func getDefaultConsumingOptions() ConsumingOpts {
 	}
 }
 
+// ConsumerState - the state of a consumer's continuous consume operation.
+type ConsumerState int32
+
+const (
+	ConsumerStateStopped ConsumerState = iota
+	ConsumerStateActive
+	ConsumerStatePaused
+	ConsumerStateFailed
+)
+
+func (s ConsumerState) String() string {
+	return [...]string{"stopped", "active", "paused", "failed"}[s]
+}
+
+// Consumer.State - returns the state of the continuous consume operation.
+func (c *Consumer) State() ConsumerState {
+	return ConsumerState(atomic.LoadInt32(&c.state))
+}
+
+func (c *Consumer) isConsumeActive() bool {
+	state := c.State()
+	return state == ConsumerStateActive || state == ConsumerStatePaused
+}
+
+// startConsume - moves the consumer into the active state and returns the context bounding the consume loop.
+func (c *Consumer) startConsume() (context.Context, error) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.isConsumeActive() {
+		return nil, memphisError(ConsumerErrConsumeActive)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.consumeCancel = cancel
+	atomic.StoreInt32(&c.state, int32(ConsumerStateActive))
+	return ctx, nil
+}
+
+// stopConsume - cancels the consume loop and moves the consumer into the given state, it never blocks
+// so it is safe to call from within the consume loop itself.
+func (c *Consumer) stopConsume(state ConsumerState) bool {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if !c.isConsumeActive() {
+		return false
+	}
+	c.consumeCancel()
+	c.consumeCancel = nil
+	atomic.StoreInt32(&c.state, int32(state))
+	return true
+}
+
 // Consumer.Consume - start consuming messages according to the interval configured in the consumer object.
 // When a batch is consumed the handlerFunc will be called.
 func (c *Consumer) Consume(handlerFunc ConsumeHandler, opts ...ConsumingOpt) error {
@@ -567,107 +1007,453 @@ func (c *Consumer) Consume(handlerFunc ConsumeHandler, opts ...ConsumingOpt) err
 		}
 	}
 
-	go func(c *Consumer, partitionKey string, partitionNumber int) {
+	if defaultOpts.DecodeConcurrency > 0 {
+		handlerFunc = decodingHandler(handlerFunc, defaultOpts.DecodeConcurrency)
+	}
+	handlerFunc = c.instrument(handlerFunc)
+	if c.consumeMode == ConsumeModePipelined || c.consumeMode == ConsumeModeLongPoll {
+		return c.consumePipelined(handlerFunc, defaultOpts)
+	}
+	if c.consumeMode == ConsumeModePush {
+		return c.consumePush(handlerFunc, defaultOpts)
+	}
+
+	ctx, err := c.startConsume()
+	if err != nil {
+		return err
+	}
+	c.setDlsHandlerFunc(handlerFunc)
 
-		msgs, err := c.fetchSubscription(partitionKey, partitionNumber)
-		handlerFunc(msgs, memphisError(err), c.context)
-		c.dlsHandlerFunc = handlerFunc
-		ticker := time.NewTicker(c.PullInterval)
-		defer ticker.Stop()
+	go func(c *Consumer, partitionKey string, partitionNumber int, filter MsgFilter, limits fetchLimits) {
+		scheduler := c.newPullScheduler()
+		clock := c.clock()
+		timer := clock.NewTimer(0)
+		defer timer.Stop()
 
 		for {
-			// give first priority to quit signals
 			select {
-			case <-c.consumeQuit:
+			case <-ctx.Done():
 				return
-			default:
+			case <-timer.C():
 			}
 
-			select {
-			case <-ticker.C:
-				msgs, err := c.fetchSubscription(partitionKey, partitionNumber)
-				handlerFunc(msgs, memphisError(err), nil)
-			case <-c.consumeQuit:
-				return
+			if c.State() == ConsumerStatePaused {
+				timer.Reset(c.PullInterval)
+				continue
 			}
+
+			fetchStart := clock.Now()
+			msgs, err := c.fetchSubscription(c.BatchSize, partitionKey, partitionNumber, limits)
+			timer.Reset(scheduler.next(len(msgs), clock.Now().Sub(fetchStart)))
+			handlerFunc(c.filterMsgs(msgs, filter), memphisError(err), c.getContext())
 		}
-	}(c, defaultOpts.ConsumerPartitionKey, defaultOpts.ConsumerPartitionNumber)
-	c.consumeActive = true
+	}(c, defaultOpts.ConsumerPartitionKey, defaultOpts.ConsumerPartitionNumber, defaultOpts.Filter, defaultOpts.fetchLimits())
 	return nil
 }
 
 // StopConsume - stops the continuous consume operation.
 func (c *Consumer) StopConsume() {
-	if !c.consumeActive {
+	if !c.stopConsume(ConsumerStateStopped) {
 		c.callErrHandler(ConsumerErrConsumeInactive)
-		return
 	}
-	c.consumeQuit <- struct{}{}
-	c.consumeActive = false
 }
 
-func (c *Consumer) fetchSubscription(partitionKey string, partitionNum int) ([]*Msg, error) {
-	if !c.subscriptionActive {
-		return nil, memphisError(errors.New("station unreachable"))
+// Pause - stop fetching new messages without tearing down the consume operation.
+func (c *Consumer) Pause() error {
+	if !atomic.CompareAndSwapInt32(&c.state, int32(ConsumerStateActive), int32(ConsumerStatePaused)) {
+		return memphisError(ConsumerErrConsumeInactive)
+	}
+	return nil
+}
+
+// Resume - resume fetching messages after Pause.
+func (c *Consumer) Resume() error {
+	if !atomic.CompareAndSwapInt32(&c.state, int32(ConsumerStatePaused), int32(ConsumerStateActive)) {
+		return memphisError(errors.New("consumer is not paused"))
+	}
+	return nil
+}
+
+// consumePipelined - keeps a standing pull request open per partition so the next messages are already
+// buffered locally while the handler processes the current batch. In ConsumeModeLongPoll the pull requests
+// are long lived and kept alive by idle heartbeats. The pull requests follow the partitions added to and
+// removed from the station while consuming.
+func (c *Consumer) consumePipelined(handlerFunc ConsumeHandler, opts ConsumingOpts) error {
+	if !c.isSubscriptionActive() {
+		return memphisError(ConsumerErrStationUnreachable)
 	}
-	wrappedMsgs := make([]*Msg, 0, c.BatchSize)
-	partitionNumber := 1
 
-	if len(c.jsConsumers) > 1 {
-		if partitionKey != "" && partitionNum > 0 {
-			return nil, memphisError(fmt.Errorf("Can not use both partition number and partition key"))
+	fixedPartition := 0
+	if len(c.partitionConsumers()) > 1 && (opts.ConsumerPartitionKey != "" || opts.ConsumerPartitionNumber > 0) {
+		partitionNumber, err := c.resolvePartition(opts.ConsumerPartitionKey, opts.ConsumerPartitionNumber)
+		if err != nil {
+			return memphisError(err)
 		}
-		if partitionKey != "" {
-			partitionFromKey, err := c.conn.GetPartitionFromKey(partitionKey, c.stationName)
-			if err != nil {
-				return nil, memphisError(err)
+		fixedPartition = partitionNumber
+	}
+
+	ctx, err := c.startConsume()
+	if err != nil {
+		return err
+	}
+
+	pl := &pipeline{
+		consumer:  c,
+		pullOpts:  c.pullMessagesOpts(opts),
+		msgsCh:    make(chan jetstream.Msg, c.BatchSize),
+		errsCh:    make(chan error, 1),
+		done:      make(chan struct{}),
+		iterators: make(map[int]pipelineIterator),
+	}
+	if err := pl.sync(c.pipelinedConsumers(fixedPartition)); err != nil {
+		pl.stop()
+		close(pl.done)
+		c.stopConsume(ConsumerStateStopped)
+		return memphisError(err)
+	}
+
+	c.setDlsHandlerFunc(handlerFunc)
+	go func() {
+		defer close(pl.done)
+		defer pl.stop()
+		for {
+			if c.State() == ConsumerStatePaused {
+				select {
+				case <-ctx.Done():
+					return
+				case <-after(c.clock(), c.PullInterval):
+				}
+				continue
 			}
-			partitionNumber = partitionFromKey
-		} else if partitionNum > 0 {
-			err := c.conn.ValidatePartitionNumber(partitionNum, c.stationName)
-			if err != nil {
-				return nil, memphisError(err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.partitionsUpdated:
+				if err := pl.sync(c.pipelinedConsumers(fixedPartition)); err != nil {
+					handlerFunc(nil, memphisError(err), c.getContext())
+				}
+			case err := <-pl.errsCh:
+				handlerFunc(nil, memphisError(err), c.getContext())
+			case msg := <-pl.msgsCh:
+				msgs := make([]*Msg, 0, c.BatchSize)
+				msgs = append(msgs, c.newMsg(msg))
+			drain:
+				for len(msgs) < c.BatchSize {
+					select {
+					case msg := <-pl.msgsCh:
+						msgs = append(msgs, c.newMsg(msg))
+					default:
+						break drain
+					}
+				}
+				handlerFunc(c.filterMsgs(msgs, opts.Filter), nil, c.getContext())
 			}
-			partitionNumber = partitionNum
+		}
+	}()
+	return nil
+}
+
+// updateJetstreamConsumers - applies update to the config of every JetStream consumer in jsConsumers, pushes
+// the configs update reports as changed to the broker and replaces them in jsConsumers with the updated ones.
+func (c *Consumer) updateJetstreamConsumers(jsConsumers map[int]jetstream.Consumer, update func(cfg *jetstream.ConsumerConfig) bool, options ...RequestOpt) error {
+	requestOpts, err := getRequestOptions(options...)
+	if err != nil {
+		return err
+	}
+	for p, jsCons := range jsConsumers {
+		info := jsCons.CachedInfo()
+		if info == nil {
+			continue
+		}
+		cfg := info.Config
+		if !update(&cfg) {
+			continue
+		}
+		ctx, cancel := c.conn.jetstreamContext(requestOpts)
+		updated, err := c.conn.js.UpdateConsumer(ctx, info.Stream, cfg)
+		cancel()
+		if err != nil {
+			return err
+		}
+		jsConsumers[p] = updated
+	}
+	return nil
+}
+
+// Consumer.pipelinedConsumers - the JetStream consumers a pipelined Consume pulls from, only the one of
+// fixedPartition when it isn't zero.
+func (c *Consumer) pipelinedConsumers(fixedPartition int) map[int]jetstream.Consumer {
+	jsConsumers := c.partitionConsumers()
+	if fixedPartition == 0 {
+		return jsConsumers
+	}
+	if jsCons, ok := jsConsumers[fixedPartition]; ok {
+		return map[int]jetstream.Consumer{fixedPartition: jsCons}
+	}
+	return nil
+}
+
+// Consumer.notifyPartitionsUpdated - lets a pipelined Consume rebuild its pull requests after a rebalance.
+func (c *Consumer) notifyPartitionsUpdated() {
+	select {
+	case c.partitionsUpdated <- struct{}{}:
+	default:
+	}
+}
+
+// pipeline - the standing pull requests of a pipelined Consume, forwarding the messages of all partitions to one
+// channel, in order per partition.
+type pipeline struct {
+	consumer  *Consumer
+	pullOpts  []jetstream.PullMessagesOpt
+	msgsCh    chan jetstream.Msg
+	errsCh    chan error
+	done      chan struct{}
+	iterators map[int]pipelineIterator
+}
+
+type pipelineIterator struct {
+	jsCons jetstream.Consumer
+	it     jetstream.MessagesContext
+}
+
+// pipeline.sync - stops the pull requests of the partitions no longer consumed and opens ones for the new
+// partitions, only called from the goroutine consuming the pipeline.
+func (pl *pipeline) sync(jsConsumers map[int]jetstream.Consumer) error {
+	for partition, pi := range pl.iterators {
+		if jsCons, ok := jsConsumers[partition]; !ok || jsCons != pi.jsCons {
+			pi.it.Stop()
+			delete(pl.iterators, partition)
+		}
+	}
+	var errs multiError
+	for partition, jsCons := range jsConsumers {
+		if _, ok := pl.iterators[partition]; ok {
+			continue
+		}
+		it, err := jsCons.Messages(pl.pullOpts...)
+		if err != nil {
+			errs.add(fmt.Errorf("failed to consume from partition %d: %w", partition, err))
+			continue
+		}
+		pl.iterators[partition] = pipelineIterator{jsCons: jsCons, it: it}
+		go pl.forward(it, partition)
+	}
+	return errs.err()
+}
+
+// pipeline.forward - forwards the messages of a partition's pull request until it is stopped.
+func (pl *pipeline) forward(it jetstream.MessagesContext, partition int) {
+	for {
+		msg, err := it.Next()
+		if err != nil {
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return
+			}
+			select {
+			case pl.errsCh <- pl.consumer.pullError(partition, err):
+			case <-pl.done:
+				return
+			}
+			continue
+		}
+		select {
+		case pl.msgsCh <- msg:
+		case <-pl.done:
+			return
+		}
+	}
+}
+
+func (pl *pipeline) stop() {
+	for partition, pi := range pl.iterators {
+		pi.it.Stop()
+		delete(pl.iterators, partition)
+	}
+}
+
+// pullScheduler - decides how long the consume loop waits before the next fetch.
+type pullScheduler struct {
+	batchSize    int
+	pullInterval time.Duration
+	adaptive     bool
+	min          time.Duration
+	max          time.Duration
+	backoff      time.Duration
+}
+
+func (c *Consumer) newPullScheduler() *pullScheduler {
+	return &pullScheduler{
+		batchSize:    c.BatchSize,
+		pullInterval: c.PullInterval,
+		adaptive:     c.adaptivePull,
+		min:          c.adaptivePullMin,
+		max:          c.adaptivePullMax,
+	}
+}
+
+// next - returns the delay until the next fetch, the time the last fetch took is already accounted for
+// so a fetch which waited BatchMaxTimeToWait doesn't add up with PullInterval.
+func (ps *pullScheduler) next(received int, fetchDuration time.Duration) time.Duration {
+	if !ps.adaptive {
+		if fetchDuration >= ps.pullInterval {
+			return 0
+		}
+		return ps.pullInterval - fetchDuration
+	}
+
+	switch {
+	case received >= ps.batchSize:
+		ps.backoff = 0
+		return 0
+	case received > 0:
+		ps.backoff = 0
+		return ps.min
+	default:
+		if ps.backoff == 0 {
+			ps.backoff = ps.min
 		} else {
-			partitionNumber = c.PartitionGenerator.Next()
+			ps.backoff *= 2
+		}
+		if ps.backoff > ps.max {
+			ps.backoff = ps.max
+		}
+		return ps.backoff
+	}
+}
+
+// resolvePartition - picks the partition to fetch from according to the given key/number or the round robin generator.
+func (c *Consumer) resolvePartition(partitionKey string, partitionNum int) (int, error) {
+	if c.partition > 0 {
+		if partitionKey != "" || (partitionNum > 0 && partitionNum != c.partition) {
+			return 0, memphisError(fmt.Errorf("consumer is bound to partition %d", c.partition))
 		}
+		return c.partition, nil
+	}
+	c.partitionsMu.RLock()
+	onlyPartition := 1
+	partitionsCount := len(c.jsConsumers)
+	for p := range c.jsConsumers {
+		onlyPartition = p
+	}
+	c.partitionsMu.RUnlock()
+	if partitionsCount <= 1 {
+		return onlyPartition, nil
 	}
+	if partitionKey != "" && partitionNum > 0 {
+		return 0, memphisError(fmt.Errorf("Can not use both partition number and partition key"))
+	}
+	if partitionKey != "" {
+		partitionFromKey, err := c.conn.GetPartitionFromKey(partitionKey, c.stationName)
+		if err != nil {
+			return 0, memphisError(err)
+		}
+		return partitionFromKey, nil
+	} else if partitionNum > 0 {
+		err := c.conn.ValidatePartitionNumber(partitionNum, c.stationName)
+		if err != nil {
+			return 0, memphisError(err)
+		}
+		return partitionNum, nil
+	}
+	c.partitionsMu.RLock()
+	defer c.partitionsMu.RUnlock()
+	return c.PartitionGenerator.Next(), nil
+}
+
+// fetchLimits - how a single pull request is bounded besides the batch size.
+type fetchLimits struct {
+	maxBytes int
+	noWait   bool
+}
 
-	batch, err := c.jsConsumers[partitionNumber].Fetch(c.BatchSize, jetstream.FetchMaxWait(c.BatchMaxTimeToWait))
-	if err != nil && err != nats.ErrTimeout {
-		c.subscriptionActive = false
-		c.callErrHandler(ConsumerErrStationUnreachable)
-		c.StopConsume()
+func (opts ConsumingOpts) fetchLimits() fetchLimits {
+	return fetchLimits{maxBytes: opts.MaxBytes}
+}
+
+// pull - sends a single pull request, a byte limit takes the place of the batch size since jetstream
+// bounds a fetch by one or the other.
+func (l fetchLimits) pull(jsCons jetstream.Consumer, batchSize int, maxWait time.Duration) (jetstream.MessageBatch, error) {
+	switch {
+	case l.noWait:
+		return jsCons.FetchNoWait(batchSize)
+	case l.maxBytes > 0:
+		return jsCons.FetchBytes(l.maxBytes, jetstream.FetchMaxWait(maxWait))
+	default:
+		return jsCons.Fetch(batchSize, jetstream.FetchMaxWait(maxWait))
+	}
+}
+
+func (c *Consumer) fetchSubscription(batchSize int, partitionKey string, partitionNum int, limits fetchLimits) ([]*Msg, error) {
+	if !c.isSubscriptionActive() {
+		return nil, memphisError(ConsumerErrStationUnreachable)
+	}
+	wrappedMsgs := make([]*Msg, 0, batchSize)
+
+	partitionNumber, err := c.resolvePartition(partitionKey, partitionNum)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch errors are treated as transient, the consume loop keeps going and the ping
+	// routine is responsible for detecting that the station is actually gone
+	jsCons, ok := c.jsConsumer(partitionNumber)
+	if !ok {
+		return nil, memphisError(fmt.Errorf("station has no partition %d", partitionNumber))
 	}
-	if batch.Error() != nil && batch.Error() != nats.ErrTimeout {
-		c.subscriptionActive = false
-		c.callErrHandler(ConsumerErrStationUnreachable)
-		c.StopConsume()
+	batch, err := limits.pull(jsCons, batchSize, c.BatchMaxTimeToWait)
+	if err != nil {
+		if errors.Is(err, nats.ErrTimeout) {
+			return wrappedMsgs, nil
+		}
+		c.conn.emit(Event{Type: EventFetchFailed, Station: c.stationName, Consumer: c.Name, Partition: partitionNumber, Err: err})
+		return nil, memphisError(fmt.Errorf("%w: %v", ConsumerErrFetchFailed, err))
 	}
-	// msgs := batch.Messages()
-	internalStationName := getInternalName(c.stationName)
 	for msg := range batch.Messages() {
-		wrappedMsgs = append(wrappedMsgs, &Msg{msg: msg, conn: c.conn, cgName: c.ConsumerGroup, internalStationName: internalStationName})
+		wrappedMsgs = append(wrappedMsgs, c.newMsg(msg))
+	}
+	// the batch error is only final once the messages channel is drained
+	err = batch.Error()
+	if errors.Is(err, nats.ErrTimeout) {
+		err = nil
+	}
+	c.checkAckPending(jsCons, len(wrappedMsgs), err)
+	if err == nil {
+		c.reportFetched(partitionNumber, wrappedMsgs)
+	}
+	if err != nil {
+		c.conn.emit(Event{Type: EventFetchFailed, Station: c.stationName, Consumer: c.Name, Partition: partitionNumber, Err: err})
+		return wrappedMsgs, memphisError(fmt.Errorf("%w: %v", ConsumerErrFetchFailed, err))
 	}
 	return wrappedMsgs, nil
 }
 
+func (c *Consumer) newMsg(msg any) *Msg {
+	m := &Msg{msg: msg, conn: c.conn, cgName: c.ConsumerGroup, internalStationName: getInternalName(c.stationName),
+		retryPolicy: c.retryPolicy, poisonClassifier: c.poisonClassifier, quarantineStation: c.quarantineStation, receivedAt: c.clock().Now(),
+		raw: c.raw, protoSchema: c.protoSchema, schemaCache: &c.schemaCache}
+	c.recordLatency(m)
+	return m
+}
+
 type fetchResult struct {
 	msgs []*Msg
 	err  error
 }
 
-func (c *Consumer) fetchSubscriprionWithTimeout(partitionKey string, partitionNumber int) ([]*Msg, error) {
+func (c *Consumer) fetchSubscriprionWithTimeout(batchSize int, partitionKey string, partitionNumber int, limits fetchLimits) ([]*Msg, error) {
 	timeoutDuration := c.BatchMaxTimeToWait
 	out := make(chan fetchResult, 1)
 
 	go func(partitionKey string) {
-		msgs, err := c.fetchSubscription(partitionKey, partitionNumber)
+		msgs, err := c.fetchSubscription(batchSize, partitionKey, partitionNumber, limits)
 		out <- fetchResult{msgs: msgs, err: memphisError(err)}
 	}(partitionKey)
+	timer := c.clock().NewTimer(timeoutDuration)
+	defer timer.Stop()
 	select {
-	case <-time.After(timeoutDuration):
+	case <-timer.C():
 		return []*Msg{}, nil
 	case fetchRes := <-out:
 		return fetchRes.msgs, memphisError(fetchRes.err)
@@ -675,6 +1461,7 @@ func (c *Consumer) fetchSubscriprionWithTimeout(partitionKey string, partitionNu
 }
 
 // Fetch - immediately fetch a batch of messages.
+// The batch size only applies to this call, Fetch is safe to use while Consume is running on the same consumer.
 func (c *Consumer) Fetch(batchSize int, prefetch bool, opts ...ConsumingOpt) ([]*Msg, error) {
 	if batchSize > maxBatchSize || batchSize < 1 {
 		return nil, memphisError(errors.New("Batch size can not be greater than " + strconv.Itoa(maxBatchSize) + " or less than 1"))
@@ -690,60 +1477,140 @@ func (c *Consumer) Fetch(batchSize int, prefetch bool, opts ...ConsumingOpt) ([]
 		}
 	}
 
-	c.BatchSize = batchSize
-	var msgs []*Msg
-	if len(c.dlsMsgs) > 0 {
-		c.dlsMsgsMutex.Lock()
-		if len(c.dlsMsgs) <= batchSize {
-			msgs = c.dlsMsgs
-			c.dlsMsgs = []*Msg{}
-		} else {
-			msgs = c.dlsMsgs[:batchSize-1]
-			c.dlsMsgs = c.dlsMsgs[batchSize-1:]
-		}
-		c.dlsMsgsMutex.Unlock()
-		return msgs, nil
+	if msgs := c.takeDlsMsgs(batchSize); len(msgs) > 0 {
+		return c.filterMsgs(msgs, defaultOpts.Filter), nil
 	}
 
-	c.conn.prefetchedMsgs.lock.Lock()
-	lowerCaseStationName := getLowerCaseName(c.stationName)
-	if prefetchedMsgsForStation, ok := c.conn.prefetchedMsgs.msgs[lowerCaseStationName]; ok {
-		if prefetchedMsgsForCG, ok := prefetchedMsgsForStation[c.ConsumerGroup]; ok {
-			if len(prefetchedMsgsForCG) > 0 {
-				if len(prefetchedMsgsForCG) <= batchSize {
-					msgs = prefetchedMsgsForCG
-					prefetchedMsgsForCG = []*Msg{}
-				} else {
-					msgs = prefetchedMsgsForCG[:batchSize-1]
-					prefetchedMsgsForCG = prefetchedMsgsForCG[batchSize-1:]
-				}
-				c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup] = prefetchedMsgsForCG
+	msgs, buffered := c.takePrefetched(batchSize)
+	if prefetch && buffered < c.prefetchWatermarkFor(batchSize) {
+		go c.prefetchMsgs(batchSize, defaultOpts.ConsumerPartitionKey, defaultOpts.ConsumerPartitionNumber, defaultOpts.fetchLimits())
+	}
+	if len(msgs) > 0 {
+		return c.filterMsgs(msgs, defaultOpts.Filter), nil
+	}
+	msgs, err := c.fetchSubscriprionWithTimeout(batchSize, defaultOpts.ConsumerPartitionKey, defaultOpts.ConsumerPartitionNumber, defaultOpts.fetchLimits())
+	return c.filterMsgs(msgs, defaultOpts.Filter), err
+}
+
+// FetchNoWait - fetch a batch of messages without waiting for it to fill up, returns whatever is available
+// at the time of the call, possibly nothing.
+func (c *Consumer) FetchNoWait(batchSize int, opts ...ConsumingOpt) ([]*Msg, error) {
+	if batchSize > maxBatchSize || batchSize < 1 {
+		return nil, memphisError(errors.New("Batch size can not be greater than " + strconv.Itoa(maxBatchSize) + " or less than 1"))
+	}
+
+	defaultOpts := getDefaultConsumingOptions()
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
 			}
 		}
 	}
-	c.conn.prefetchedMsgs.lock.Unlock()
-	if prefetch {
-		go c.prefetchMsgs(defaultOpts.ConsumerPartitionKey, defaultOpts.ConsumerPartitionNumber)
+	if defaultOpts.MaxBytes > 0 {
+		return nil, memphisError(errors.New("MaxBytes can not be used with FetchNoWait"))
 	}
-	if len(msgs) > 0 {
-		return msgs, nil
+
+	if msgs := c.takeDlsMsgs(batchSize); len(msgs) > 0 {
+		return c.filterMsgs(msgs, defaultOpts.Filter), nil
 	}
-	return c.fetchSubscriprionWithTimeout(defaultOpts.ConsumerPartitionKey, defaultOpts.ConsumerPartitionNumber)
+
+	if msgs, _ := c.takePrefetched(batchSize); len(msgs) > 0 {
+		return c.filterMsgs(msgs, defaultOpts.Filter), nil
+	}
+	msgs, err := c.fetchSubscription(batchSize, defaultOpts.ConsumerPartitionKey, defaultOpts.ConsumerPartitionNumber, fetchLimits{noWait: true})
+	return c.filterMsgs(msgs, defaultOpts.Filter), err
+}
+
+// takeDlsMsgs - removes up to batchSize of the buffered DLS messages and returns them.
+func (c *Consumer) takeDlsMsgs(batchSize int) []*Msg {
+	c.dlsMsgsMutex.Lock()
+	var msgs []*Msg
+	if len(c.dlsMsgs) <= batchSize {
+		msgs = c.dlsMsgs
+		c.dlsMsgs = []*Msg{}
+	} else {
+		msgs = c.dlsMsgs[:batchSize]
+		c.dlsMsgs = c.dlsMsgs[batchSize:]
+	}
+	c.dlsMsgsMutex.Unlock()
+	c.countDls(dlsHandledMetric, len(msgs))
+	return msgs
+}
+
+// takePrefetched - removes up to batchSize prefetched messages from the buffer, returns them and the number of messages left in it.
+func (c *Consumer) takePrefetched(batchSize int) ([]*Msg, int) {
+	c.conn.prefetchedMsgs.lock.Lock()
+	defer c.conn.prefetchedMsgs.lock.Unlock()
+	lowerCaseStationName := getLowerCaseName(c.stationName)
+	prefetchedMsgsForCG := c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup]
+	if len(prefetchedMsgsForCG) == 0 {
+		return nil, 0
+	}
+	var msgs []*Msg
+	if len(prefetchedMsgsForCG) <= batchSize {
+		msgs = prefetchedMsgsForCG
+		prefetchedMsgsForCG = []*Msg{}
+	} else {
+		msgs = prefetchedMsgsForCG[:batchSize]
+		prefetchedMsgsForCG = prefetchedMsgsForCG[batchSize:]
+	}
+	c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup] = prefetchedMsgsForCG
+	return msgs, len(prefetchedMsgsForCG)
+}
+
+func (c *Consumer) prefetchedCount() int {
+	c.conn.prefetchedMsgs.lock.Lock()
+	defer c.conn.prefetchedMsgs.lock.Unlock()
+	return len(c.conn.prefetchedMsgs.msgs[getLowerCaseName(c.stationName)][c.ConsumerGroup])
 }
 
-func (c *Consumer) prefetchMsgs(partitionKey string, partitionNumber int) {
+// appendPrefetched - adds messages to the prefetch buffer, returns the number of buffered messages.
+func (c *Consumer) appendPrefetched(msgs []*Msg) int {
 	c.conn.prefetchedMsgs.lock.Lock()
 	defer c.conn.prefetchedMsgs.lock.Unlock()
 	lowerCaseStationName := getLowerCaseName(c.stationName)
 	if _, ok := c.conn.prefetchedMsgs.msgs[lowerCaseStationName]; !ok {
 		c.conn.prefetchedMsgs.msgs[lowerCaseStationName] = make(map[string][]*Msg)
 	}
-	if _, ok := c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup]; !ok {
-		c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup] = make([]*Msg, 0)
+	buffered := append(c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup], msgs...)
+	c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup] = buffered
+	return len(buffered)
+}
+
+// prefetchWatermarkFor - the buffer size under which a prefetching Fetch of batchSize messages triggers a refill.
+func (c *Consumer) prefetchWatermarkFor(batchSize int) int {
+	if c.prefetchWatermark > 0 {
+		return c.prefetchWatermark
 	}
-	msgs, err := c.fetchSubscriprionWithTimeout(partitionKey, partitionNumber)
-	if err == nil {
-		c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup] = append(c.conn.prefetchedMsgs.msgs[lowerCaseStationName][c.ConsumerGroup], msgs...)
+	return batchSize
+}
+
+// prefetchMsgs - refills the prefetch buffer up to PrefetchDepth batches, only one refill runs at a time per consumer.
+// The buffer lock isn't held while fetching so Fetch calls are served from the buffer meanwhile.
+func (c *Consumer) prefetchMsgs(batchSize int, partitionKey string, partitionNumber int, limits fetchLimits) {
+	if !atomic.CompareAndSwapInt32(&c.prefetching, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.prefetching, 0)
+
+	depth := c.prefetchDepth
+	if depth < 1 {
+		depth = 1
+	}
+	target := depth * batchSize
+	buffered := c.prefetchedCount()
+	for buffered < target {
+		msgs, err := c.fetchSubscriprionWithTimeout(batchSize, partitionKey, partitionNumber, limits)
+		if err != nil {
+			c.callErrHandler(err)
+			return
+		}
+		if len(msgs) == 0 {
+			return
+		}
+		buffered = c.appendPrefetched(msgs)
 	}
 }
 
@@ -755,25 +1622,36 @@ func (c *Consumer) dlsSubscriptionInit() error {
 
 func (c *Consumer) createDlsMsgHandler() nats.MsgHandler {
 	return func(msg *nats.Msg) {
-		// if a consume function is active
-		if c.dlsHandlerFunc != nil {
-			dlsMsg := []*Msg{{msg: msg, conn: c.conn, cgName: c.ConsumerGroup}}
-			c.dlsHandlerFunc(dlsMsg, nil, nil)
+		c.conn.emit(Event{Type: EventDlsMessage, Station: c.stationName, Consumer: c.Name,
+			Details: map[string]string{"consumer_group": c.ConsumerGroup}})
+		dlsMsg := c.newMsg(msg)
+		dlsMsg.dls = true
+		c.countDls(dlsReceivedMetric, 1)
+		if dlsCallback := c.getDlsCallback(); dlsCallback != nil {
+			c.countDls(dlsHandledMetric, 1)
+			dlsCallback([]*Msg{dlsMsg}, nil, c.getContext())
+		} else if dlsHandlerFunc := c.getDlsHandlerFunc(); dlsHandlerFunc != nil {
+			// if a consume function is active
+			c.countDls(dlsHandledMetric, 1)
+			dlsHandlerFunc([]*Msg{dlsMsg}, nil, nil)
 		} else {
 			// for fetch function
-			internalStationName := getInternalName(c.stationName)
+			overwritten := 0
 			c.dlsMsgsMutex.Lock()
 			if len(c.dlsMsgs) > 9999 {
 				indexToInsert := c.dlsCurrentIndex
 				if indexToInsert >= 10000 {
 					indexToInsert = indexToInsert % 10000
 				}
-				c.dlsMsgs[indexToInsert] = &Msg{msg: msg, conn: c.conn, cgName: c.ConsumerGroup, internalStationName: internalStationName}
+				c.dlsMsgs[indexToInsert] = dlsMsg
+				overwritten = 1
 			} else {
-				c.dlsMsgs = append(c.dlsMsgs, &Msg{msg: msg, conn: c.conn, cgName: c.ConsumerGroup, internalStationName: internalStationName})
+				c.dlsMsgs = append(c.dlsMsgs, dlsMsg)
 			}
 			c.dlsCurrentIndex = c.dlsCurrentIndex + 1
 			c.dlsMsgsMutex.Unlock()
+			c.countDls(dlsBufferedMetric, 1)
+			c.countDls(dlsOverwrittenMetric, overwritten)
 		}
 	}
 }
@@ -790,20 +1668,28 @@ func (c *Consumer) getDlsQueueName() string {
 
 // Destroy - destroy this consumer.
 func (c *Consumer) Destroy(options ...RequestOpt) error {
-	if err := c.conn.removeSchemaUpdatesListener(c.stationName); err != nil {
-		return memphisError(err)
-	}
-	if c.consumeActive {
-		c.StopConsume()
-	}
-	if c.subscriptionActive {
-		c.pingQuit <- struct{}{}
+	if !c.raw {
+		c.conn.removeSchemaChangedHandler(c.stationName, c.schemaChangedId)
+		if err := c.conn.removeSchemaUpdatesListener(c.stationName); err != nil {
+			return memphisError(err)
+		}
 	}
+	c.detach()
 
 	c.conn.unCacheConsumer(c)
 	return c.conn.destroy(c, options...)
 }
 
+// detach - stops the consumer's background routines without notifying the broker.
+func (c *Consumer) detach() {
+	c.stopConsume(ConsumerStateStopped)
+	c.setSubscriptionActive(false)
+	select {
+	case c.pingQuit <- struct{}{}:
+	default:
+	}
+}
+
 func (c *Consumer) getCreationSubject() string {
 	return "$memphis_consumer_creations"
 }
@@ -820,9 +1706,12 @@ func (c *Consumer) getCreationReq() any {
 		Username:                 c.conn.username,
 		StartConsumeFromSequence: c.StartConsumeFromSequence,
 		LastMessages:             c.LastMessages,
-		RequestVersion:           lastConsumerCreationReqVersion,
-		AppId:                    applicationId,
-		SdkLang:                  "go",
+		RequestVersion:           c.conn.consumerRequestVersion(),
+		AppId:                    c.conn.appId(),
+		SdkLang:                  c.conn.sdkLang(),
+		MaxAckPending:            c.maxAckPending,
+		InactiveThresholdMillis:  c.inactiveThreshold.Milliseconds(),
+		ClientMetadata:           c.conn.opts.ClientMetadata,
 	}
 }
 
@@ -832,7 +1721,7 @@ func (c *Consumer) handleCreationResp(resp []byte) error {
 	err := json.Unmarshal(resp, cr)
 	if err != nil {
 		// unmarshal failed, we may be dealing with an old broker
-		c.conn.stationPartitions[sn] = &PartitionsUpdate{}
+		c.conn.setStationPartitions(sn, &PartitionsUpdate{})
 		return defaultHandleCreationResp(resp)
 	}
 
@@ -840,12 +1729,15 @@ func (c *Consumer) handleCreationResp(resp []byte) error {
 		return memphisError(errors.New(cr.Err))
 	}
 
-	c.conn.stationUpdatesMu.Lock()
-	sd := &c.conn.stationUpdatesSubs[sn].schemaDetails
-	sd.handleSchemaUpdateInit(cr.SchemaUpdateInit)
-	c.conn.stationUpdatesMu.Unlock()
+	if !c.raw {
+		c.conn.stationUpdatesMu.Lock()
+		sd := &c.conn.stationUpdatesSubs[sn].schemaDetails
+		sd.handleSchemaUpdateInit(cr.SchemaUpdateInit)
+		c.conn.schemaUpdated()
+		c.conn.stationUpdatesMu.Unlock()
+	}
 
-	c.conn.stationPartitions[sn] = &cr.PartitionsUpdate
+	c.conn.setStationPartitions(sn, &cr.PartitionsUpdate)
 	if len(cr.PartitionsUpdate.PartitionsList) > 0 {
 		c.PartitionGenerator = newRoundRobinGenerator(cr.PartitionsUpdate.PartitionsList)
 	}
@@ -944,6 +1836,112 @@ func LastMessages(lastMessages int64) ConsumerOpt {
 	}
 }
 
+// Conn.sequenceAfterLast - the sequence following the last message stored in the station, the start sequence of
+// StartConsumeFromNow. The broker takes a single start sequence for all the partitions of a station, so stations
+// with multiple partitions are only supported by consumers bound to one of them.
+func (c *Conn) sequenceAfterLast(stationName string, partition int, options ...RequestOpt) (uint64, error) {
+	partitions, err := c.GetStationPartitions(stationName, options...)
+	if errors.Is(err, errStationNotFound) {
+		// created along with the consumer, there is nothing to skip
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	streamName := partitions[0].StreamName
+	if len(partitions) > 1 {
+		if partition == 0 {
+			return 0, errors.New("startConsumeFromNow is not supported for stations with multiple partitions, create a partition consumer with CreatePartitionConsumer")
+		}
+		streamName = ""
+		for _, p := range partitions {
+			if p.Number == partition {
+				streamName = p.StreamName
+			}
+		}
+		if streamName == "" {
+			return 0, fmt.Errorf("station %v has no partition %d", stationName, partition)
+		}
+	}
+
+	requestOpts, err := getRequestOptions(options...)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := c.jetstreamContext(requestOpts)
+	defer cancel()
+	stream, err := c.js.Stream(ctx, streamName)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stream.CachedInfo().State.LastSeq + 1, nil
+}
+
+// StartConsumeFromNow - consume only messages produced after the consumer group was created, skipping the existing backlog.
+// The group starts from the sequence following the last message stored when the consumer is created. Stations with
+// multiple partitions are only supported by partition consumers, creating any other consumer fails.
+func StartConsumeFromNow() ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		opts.StartConsumeFromNow = true
+		return nil
+	}
+}
+
+// ConsumeModeOpt - the way Consume pulls messages, default is ConsumeModePullLoop.
+func ConsumeModeOpt(consumeMode ConsumeMode) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		opts.ConsumeMode = consumeMode
+		return nil
+	}
+}
+
+// AdaptivePull - fetch again right away when a full batch is returned, wait min after a partial batch
+// and back off exponentially up to max while the station is empty. Replaces the fixed PullInterval.
+func AdaptivePull(min, max time.Duration) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if min <= 0 || max < min {
+			return errors.New("adaptive pull requires 0 < min <= max")
+		}
+		opts.AdaptivePull = true
+		opts.AdaptivePullMin = min
+		opts.AdaptivePullMax = max
+		return nil
+	}
+}
+
+// PrefetchDepth - number of batches a prefetching Fetch keeps buffered, defaults to 1.
+func PrefetchDepth(batches int) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if batches < 1 {
+			return errors.New("prefetch depth has to be at least 1")
+		}
+		opts.PrefetchDepth = batches
+		return nil
+	}
+}
+
+// PrefetchWatermark - a prefetching Fetch refills the buffer when it holds fewer messages than the watermark, defaults to the fetched batch size.
+func PrefetchWatermark(msgs int) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if msgs < 1 {
+			return errors.New("prefetch watermark has to be at least 1")
+		}
+		opts.PrefetchWatermark = msgs
+		return nil
+	}
+}
+
+// ConsumerRequestOpts - request options, e.g. RequestTimeout or RequestContext, for the requests creating the consumer.
+func ConsumerRequestOpts(requestOpts ...RequestOpt) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		opts.RequestOpts = append(opts.RequestOpts, requestOpts...)
+		return nil
+	}
+}
+
 // ConsumerTimeoutRetry - number of retries for consumer timeout. the default value is 5
 func ConsumerTimeoutRetry(timeoutRetry int) ConsumerOpt {
 	return func(opts *ConsumerOpts) error {
@@ -0,0 +1,131 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ConsumerGroupState - the position of a consumer group on every partition of a station, exported with
+// Conn.ExportConsumerGroupState and restored with Conn.ImportConsumerGroupState, e.g. across a broker migration
+// or a blue/green cluster cutover. It is JSON serializable.
+type ConsumerGroupState struct {
+	Station       string           `json:"station"`
+	ConsumerGroup string           `json:"consumer_group"`
+	ExportedAt    time.Time        `json:"exported_at"`
+	Partitions    []PartitionState `json:"partitions"`
+}
+
+// PartitionState - the position of a consumer group on a partition.
+type PartitionState struct {
+	Partition int `json:"partition"`
+	// AckFloor - the stream sequence up to which every message was acked.
+	AckFloor uint64 `json:"ack_floor"`
+	// Delivered - the last stream sequence delivered to the group.
+	Delivered  uint64 `json:"delivered"`
+	NumPending uint64 `json:"num_pending"`
+	// NumAckPending - messages delivered but not acked yet, they are redelivered after an import.
+	NumAckPending int `json:"num_ack_pending"`
+}
+
+// Conn.ExportConsumerGroupState - snapshots the position of a consumer group on every partition of a station.
+func (c *Conn) ExportConsumerGroupState(stationName, consumerGroup string, options ...RequestOpt) (ConsumerGroupState, error) {
+	state := ConsumerGroupState{Station: stationName, ConsumerGroup: consumerGroup, ExportedAt: c.clock().Now()}
+	partitions, err := c.GetStationPartitions(stationName, options...)
+	if err != nil {
+		return state, err
+	}
+	for _, partition := range partitions {
+		info, err := c.consumerGroupInfo(partition.StreamName, consumerGroup, options...)
+		if err != nil {
+			return state, err
+		}
+		state.Partitions = append(state.Partitions, PartitionState{
+			Partition:     partition.Number,
+			AckFloor:      info.AckFloor.Stream,
+			Delivered:     info.Delivered.Stream,
+			NumPending:    info.NumPending,
+			NumAckPending: info.NumAckPending,
+		})
+	}
+	return state, nil
+}
+
+// Conn.ImportConsumerGroupState - restores the position of a consumer group, every partition resumes from the
+// message after its exported ack floor, so messages which were delivered but not acked are delivered again.
+// The group has to exist on the station, create a consumer of the group first, and none of its consumers may be
+// fetching while the position is restored. The station's sequences have to match the exported ones, as they do
+// for mirrored streams. The state of every partition of the station has to be included.
+func (c *Conn) ImportConsumerGroupState(state ConsumerGroupState, options ...RequestOpt) error {
+	requestOpts, err := getRequestOptions(options...)
+	if err != nil {
+		return memphisError(err)
+	}
+	partitions, err := c.GetStationPartitions(state.Station, options...)
+	if err != nil {
+		return err
+	}
+	positions := make(map[int]uint64, len(state.Partitions))
+	for _, partition := range state.Partitions {
+		positions[partition.Partition] = partition.AckFloor + 1
+	}
+	infos := make([]*jetstream.ConsumerInfo, len(partitions))
+	for i, partition := range partitions {
+		if _, ok := positions[partition.Number]; !ok {
+			return memphisError(fmt.Errorf("the state of consumer group %v has no position for partition %d", state.ConsumerGroup, partition.Number))
+		}
+		info, err := c.consumerGroupInfo(partition.StreamName, state.ConsumerGroup, options...)
+		if err != nil {
+			return err
+		}
+		if info.NumWaiting > 0 {
+			return memphisError(fmt.Errorf("consumer group %v is consuming, stop its consumers before importing its state", state.ConsumerGroup))
+		}
+		infos[i] = info
+	}
+
+	for i, partition := range partitions {
+		cfg := infos[i].Config
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = positions[partition.Number]
+		cfg.OptStartTime = nil
+		ctx, cancel := c.jetstreamContext(requestOpts)
+		// the start position of a durable can't be updated, it is recreated with the same configuration
+		err := c.js.DeleteConsumer(ctx, partition.StreamName, cfg.Durable)
+		if err == nil {
+			_, err = c.js.CreateConsumer(ctx, partition.StreamName, cfg)
+		}
+		cancel()
+		if err != nil {
+			return memphisError(fmt.Errorf("restore partition %d of consumer group %v: %w", partition.Number, state.ConsumerGroup, err))
+		}
+	}
+	return nil
+}
+
+// consumerGroupInfo - the broker's info about the durable of a consumer group on a stream.
+func (c *Conn) consumerGroupInfo(streamName, consumerGroup string, options ...RequestOpt) (*jetstream.ConsumerInfo, error) {
+	jsConsumer, err := c.jetstreamConsumer(streamName, getInternalName(consumerGroup), options...)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		return nil, memphisError(fmt.Errorf("consumer group %v does not exist on %v", consumerGroup, streamName))
+	}
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return jsConsumer.CachedInfo(), nil
+}
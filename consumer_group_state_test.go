@@ -0,0 +1,104 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// durablesJetStream - holds the durables of consumer groups by stream.
+type durablesJetStream struct {
+	jetstream.JetStream
+	durables map[string]*jetstream.ConsumerInfo
+	deleted  []string
+}
+
+func (js *durablesJetStream) Consumer(_ context.Context, stream, durable string) (jetstream.Consumer, error) {
+	info, ok := js.durables[stream]
+	if !ok || info.Config.Durable != durable {
+		return nil, jetstream.ErrConsumerNotFound
+	}
+	return &cachedInfoConsumer{info: info}, nil
+}
+
+func (js *durablesJetStream) DeleteConsumer(_ context.Context, stream, durable string) error {
+	js.deleted = append(js.deleted, stream)
+	delete(js.durables, stream)
+	return nil
+}
+
+func (js *durablesJetStream) CreateConsumer(_ context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	info := &jetstream.ConsumerInfo{Stream: stream, Config: cfg}
+	js.durables[stream] = info
+	return &cachedInfoConsumer{info: info}, nil
+}
+
+func TestConsumerGroupState(t *testing.T) {
+	js := &durablesJetStream{durables: map[string]*jetstream.ConsumerInfo{
+		"orders$1": {Config: jetstream.ConsumerConfig{Durable: "billing", MaxAckPending: 100},
+			AckFloor: jetstream.SequenceInfo{Stream: 41}, Delivered: jetstream.SequenceInfo{Stream: 45}, NumAckPending: 4, NumPending: 10},
+		"orders$2": {Config: jetstream.ConsumerConfig{Durable: "billing", MaxAckPending: 100},
+			AckFloor: jetstream.SequenceInfo{Stream: 7}, Delivered: jetstream.SequenceInfo{Stream: 7}},
+	}}
+	c := &Conn{js: js, stationPartitions: map[string]*PartitionsUpdate{"orders": {PartitionsList: []int{2, 1}}}}
+
+	state, err := c.ExportConsumerGroupState("orders", "billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PartitionState{
+		{Partition: 1, AckFloor: 41, Delivered: 45, NumPending: 10, NumAckPending: 4},
+		{Partition: 2, AckFloor: 7, Delivered: 7},
+	}
+	if !reflect.DeepEqual(state.Partitions, want) {
+		t.Fatalf("exported %+v, want %+v", state.Partitions, want)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imported ConsumerGroupState
+	if err := json.Unmarshal(data, &imported); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.ImportConsumerGroupState(imported); err != nil {
+		t.Fatal(err)
+	}
+	restored := js.durables["orders$1"].Config
+	if restored.DeliverPolicy != jetstream.DeliverByStartSequencePolicy || restored.OptStartSeq != 42 || restored.MaxAckPending != 100 {
+		t.Fatalf("unexpected restored durable %+v", restored)
+	}
+	if js.durables["orders$2"].Config.OptStartSeq != 8 {
+		t.Fatalf("partition 2 starts from %v, want 8", js.durables["orders$2"].Config.OptStartSeq)
+	}
+
+	imported.Partitions = imported.Partitions[:1]
+	js.deleted = nil
+	if err := c.ImportConsumerGroupState(imported); err == nil || len(js.deleted) != 0 {
+		t.Fatalf("a state missing a partition was imported, err=%v deleted=%v", err, js.deleted)
+	}
+	js.durables["orders$2"].NumWaiting = 1
+	if err := c.ImportConsumerGroupState(state); err == nil {
+		t.Fatalf("the state of a consuming group was imported")
+	}
+	if _, err := c.ExportConsumerGroupState("orders", "unknown"); err == nil {
+		t.Fatalf("the state of an unknown group was exported")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+//go:build go1.23
+
+package memphis
+
+import (
+	"context"
+	"iter"
+)
+
+// Consumer.Messages - iterate over the consumer's messages, batches of BatchSize are fetched under the hood.
+// Fetch errors are yielded, after an error or an empty batch the next fetch happens after PullInterval.
+// The iteration ends when ctx is done or the loop breaks.
+// Messages fetched but not yet yielded when the iteration ends are redelivered after MaxAckTime.
+//
+//	for msg, err := range consumer.Messages(ctx) {
+//		if err != nil {
+//			continue
+//		}
+//		msg.Ack()
+//	}
+func (c *Consumer) Messages(ctx context.Context, opts ...ConsumingOpt) iter.Seq2[*Msg, error] {
+	return func(yield func(*Msg, error) bool) {
+		type fetchResult struct {
+			msgs []*Msg
+			err  error
+		}
+		results := make(chan fetchResult, 1)
+
+		for ctx.Err() == nil {
+			go func() {
+				msgs, err := c.Fetch(c.BatchSize, false, opts...)
+				results <- fetchResult{msgs: msgs, err: err}
+			}()
+
+			var res fetchResult
+			select {
+			case <-ctx.Done():
+				return
+			case res = <-results:
+			}
+
+			if res.err != nil {
+				if !yield(nil, res.err) {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-after(c.clock(), c.PullInterval):
+				}
+				continue
+			}
+			for _, msg := range res.msgs {
+				if ctx.Err() != nil || !yield(msg, nil) {
+					return
+				}
+			}
+			if len(res.msgs) == 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-after(c.clock(), c.PullInterval):
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+//go:build go1.23
+
+package memphis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConsumerMessagesIterator(t *testing.T) {
+	c := &Consumer{
+		stationName:        "station",
+		ConsumerGroup:      "cg",
+		BatchSize:          2,
+		PullInterval:       10 * time.Millisecond,
+		BatchMaxTimeToWait: 10 * time.Millisecond,
+		conn:               &Conn{prefetchedMsgs: PrefetchedMsgs{msgs: make(map[string]map[string][]*Msg)}},
+		dlsMsgs:            []*Msg{newTestMsg("a", nil), newTestMsg("b", nil), newTestMsg("c", nil)},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg, err := range c.Messages(ctx) {
+			if err != nil {
+				continue
+			}
+			got = append(got, string(msg.Data()))
+			if len(got) == 3 {
+				cancel()
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("iteration did not end after the context was cancelled")
+	}
+	if len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Fatalf("iterated %v", got)
+	}
+
+	c.dlsMsgs = []*Msg{newTestMsg("d", nil), newTestMsg("e", nil)}
+	for msg := range c.Messages(context.Background()) {
+		if string(msg.Data()) != "d" {
+			t.Fatalf("got %q", msg.Data())
+		}
+		break
+	}
+}
@@ -0,0 +1,658 @@
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func newTestMsg(data string, headers map[string]string) *Msg {
+	natsMsg := nats.NewMsg("test")
+	natsMsg.Data = []byte(data)
+	for k, v := range headers {
+		natsMsg.Header.Set(k, v)
+	}
+	return &Msg{msg: natsMsg}
+}
+
+func TestFilterMsgs(t *testing.T) {
+	msgs := []*Msg{
+		newTestMsg("a", map[string]string{"type": "order.created"}),
+		newTestMsg("b", map[string]string{"type": "order.deleted"}),
+		newTestMsg("c", map[string]string{"type": "order.created"}),
+	}
+
+	opts := getDefaultConsumingOptions()
+	if err := HeaderFilter("type", "order.created")(&opts); err != nil {
+		t.Error(err)
+	}
+
+	var ackErrs []error
+	c := &Consumer{errHandler: func(_ *Consumer, err error) { ackErrs = append(ackErrs, err) }}
+	filtered := c.filterMsgs(msgs, opts.Filter)
+	if len(filtered) != 2 {
+		t.Errorf("expected 2 messages, got %v", len(filtered))
+	}
+	// the test messages have no reply subject so acking the skipped one fails
+	if len(ackErrs) != 1 || !strings.Contains(ackErrs[0].Error(), "failed to ack filtered message") {
+		t.Errorf("expected the failed ack of the skipped message to reach the error handler, got %v", ackErrs)
+	}
+	for _, msg := range filtered {
+		if msg.GetHeaders()["type"] != "order.created" {
+			t.Errorf("unexpected message %v passed the filter", string(msg.Data()))
+		}
+	}
+
+	if len(c.filterMsgs(msgs, nil)) != len(msgs) {
+		t.Error("nil filter should pass all messages")
+	}
+}
+
+func TestMsgDataNoCopy(t *testing.T) {
+	c := &Consumer{stationName: "station"}
+	natsMsg := nats.NewMsg("test")
+	natsMsg.Data = []byte("payload")
+
+	m := c.newMsg(natsMsg)
+	if string(m.DataNoCopy()) != "payload" {
+		t.Errorf("unexpected data %v", string(m.DataNoCopy()))
+	}
+	if &m.DataNoCopy()[0] != &natsMsg.Data[0] {
+		t.Error("DataNoCopy should share the NATS message buffer")
+	}
+}
+
+func BenchmarkMsgDataNoCopy(b *testing.B) {
+	c := &Consumer{stationName: "station"}
+	natsMsg := nats.NewMsg("test")
+	natsMsg.Data = make([]byte, 256)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := c.newMsg(natsMsg)
+		if len(m.DataNoCopy()) != len(natsMsg.Data) {
+			b.Fatal("unexpected data length")
+		}
+	}
+}
+
+func TestPullScheduler(t *testing.T) {
+	fixed := &pullScheduler{batchSize: 10, pullInterval: time.Second}
+	if d := fixed.next(0, 300*time.Millisecond); d != 700*time.Millisecond {
+		t.Errorf("expected the fetch duration to be deducted from the pull interval, got %v", d)
+	}
+	if d := fixed.next(0, 5*time.Second); d != 0 {
+		t.Errorf("expected no delay after a fetch longer than the pull interval, got %v", d)
+	}
+
+	adaptive := &pullScheduler{batchSize: 10, adaptive: true, min: 10 * time.Millisecond, max: 50 * time.Millisecond}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}
+	for _, e := range expected {
+		if d := adaptive.next(0, 0); d != e {
+			t.Errorf("expected backoff of %v, got %v", e, d)
+		}
+	}
+	if d := adaptive.next(10, 0); d != 0 {
+		t.Errorf("expected immediate fetch after a full batch, got %v", d)
+	}
+	if d := adaptive.next(3, 0); d != 10*time.Millisecond {
+		t.Errorf("expected min delay after a partial batch, got %v", d)
+	}
+	if d := adaptive.next(0, 0); d != 10*time.Millisecond {
+		t.Errorf("expected backoff to restart from min, got %v", d)
+	}
+}
+
+func TestFetchDoesNotMutateConsumer(t *testing.T) {
+	c := &Consumer{
+		stationName:        "station",
+		ConsumerGroup:      "cg",
+		BatchSize:          10,
+		BatchMaxTimeToWait: 10 * time.Millisecond,
+		conn:               &Conn{prefetchedMsgs: PrefetchedMsgs{msgs: make(map[string]map[string][]*Msg)}},
+	}
+	dlsHandler := c.createDlsMsgHandler()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				dlsHandler(nats.NewMsg("dls"))
+			}
+		}()
+		go func(batchSize int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, _ = c.Fetch(batchSize, false)
+			}
+		}(i + 1)
+	}
+	wg.Wait()
+
+	if c.BatchSize != 10 {
+		t.Errorf("Fetch changed the consumer batch size to %v", c.BatchSize)
+	}
+}
+
+func TestConsumerStateConcurrentAccess(t *testing.T) {
+	c := &Consumer{stationName: "station", ConsumerGroup: "cg"}
+	dlsHandler := c.createDlsMsgHandler()
+	handler := func([]*Msg, error, context.Context) {}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.SetContext(context.Background())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.setDlsHandlerFunc(handler)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			dlsHandler(nats.NewMsg("dls"))
+			_ = c.getContext()
+		}
+	}()
+	wg.Wait()
+}
+
+func TestConsumersMapConcurrentAccess(t *testing.T) {
+	conn := &Conn{consumersMap: ConsumersMap{}}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			conn.cacheConsumer(&Consumer{stationName: "orders", realName: fmt.Sprint("c", i)})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cm := conn.getConsumersMap()
+			cm.unsetStationConsumers("orders")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cm := conn.getConsumersMap()
+			cm.getConsumer(fmt.Sprint("orders_c", i))
+		}
+	}()
+	wg.Wait()
+}
+
+func TestProduceSubjectConcurrentAccess(t *testing.T) {
+	conn := &Conn{stationFunctionSubs: map[string]*stationFunctionSub{}}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			stationFunctionsSubsLock.Lock()
+			conn.stationFunctionSubs["orders"] = &stationFunctionSub{
+				RefCount:          1,
+				FunctionsUpdateCh: make(chan FunctionsUpdate),
+				FunctionsDetails:  functionsDetails{PartitionsFunctions: map[int]int{1: 7}},
+			}
+			stationFunctionsSubsLock.Unlock()
+			conn.removeAllStationListeners()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			subject, err := conn.produceSubject("orders", "orders$1")
+			if err != nil || (subject != "orders$1.functions.7" && subject != "orders$1.final") {
+				t.Errorf("subject %v, err = %v", subject, err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestSendMsgToDlsConcurrentAccess(t *testing.T) {
+	conn := &Conn{clientsUpdatesSub: sdkClientsUpdateSub{
+		SdkClientsUpdatesCh:        make(chan SdkClientsUpdate),
+		done:                       make(chan struct{}),
+		ClusterConfigurations:      map[string]bool{},
+		StationSchemaverseToDlsMap: map[string]bool{},
+	}}
+	done := make(chan struct{})
+	go func() {
+		conn.clientsUpdatesSub.sdkClientUpdatesHandler(conn)
+		close(done)
+	}()
+	p := &Producer{conn: conn, stationName: "orders", Name: "p"}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			conn.clientsUpdatesSub.SdkClientsUpdatesCh <- SdkClientsUpdate{Type: "schemaverse_to_dls", StationName: "orders", Update: i%2 == 0}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		p.sendMsgToDls([]byte("bad"), nil, errors.New("invalid"))
+	}
+	wg.Wait()
+	close(conn.clientsUpdatesSub.done)
+	<-done
+}
+
+func TestSdkClientsUpdatesAfterTeardown(t *testing.T) {
+	conn := &Conn{clientsUpdatesSub: sdkClientsUpdateSub{
+		SdkClientsUpdatesCh:        make(chan SdkClientsUpdate),
+		done:                       make(chan struct{}),
+		ClusterConfigurations:      map[string]bool{},
+		StationSchemaverseToDlsMap: map[string]bool{},
+	}}
+	cus := &conn.clientsUpdatesSub
+	done := make(chan struct{})
+	go func() {
+		cus.sdkClientUpdatesHandler(conn)
+		close(done)
+	}()
+	handler := cus.createUpdatesHandler()
+	msg := &nats.Msg{Data: []byte(`{"type":"send_notification","update":true}`)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				handler(msg)
+			}
+		}()
+	}
+	close(cus.done)
+	<-done
+	// callbacks still in flight after the teardown must neither panic nor block
+	wg.Wait()
+	handler(msg)
+}
+
+func TestConsumerStateTransitions(t *testing.T) {
+	c := &Consumer{}
+	if c.State() != ConsumerStateStopped {
+		t.Fatalf("initial state = %v, want stopped", c.State())
+	}
+	if err := c.Pause(); err == nil {
+		t.Fatalf("pause of an inactive consumer should fail")
+	}
+
+	ctx, err := c.startConsume()
+	if err != nil {
+		t.Fatalf("startConsume: %v", err)
+	}
+	if _, err := c.startConsume(); err == nil {
+		t.Fatalf("second startConsume should fail while active")
+	}
+	if err := c.Pause(); err != nil || c.State() != ConsumerStatePaused {
+		t.Fatalf("pause: err=%v state=%v", err, c.State())
+	}
+	if err := c.Resume(); err != nil || c.State() != ConsumerStateActive {
+		t.Fatalf("resume: err=%v state=%v", err, c.State())
+	}
+
+	// called from within the consume loop on fetch failure, must not block
+	done := make(chan struct{})
+	go func() {
+		c.stopConsume(ConsumerStateFailed)
+		c.stopConsume(ConsumerStateFailed)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("stopConsume blocked")
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatalf("consume context was not cancelled")
+	}
+	if c.State() != ConsumerStateFailed {
+		t.Fatalf("state = %v, want failed", c.State())
+	}
+	if _, err := c.startConsume(); err != nil {
+		t.Fatalf("restart after failure: %v", err)
+	}
+	c.StopConsume()
+	if c.State() != ConsumerStateStopped {
+		t.Fatalf("state = %v, want stopped", c.State())
+	}
+}
+
+type failingJsConsumer struct {
+	jetstream.Consumer
+	err error
+}
+
+func (f failingJsConsumer) Fetch(int, ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	return nil, f.err
+}
+
+func TestFetchSubscriptionError(t *testing.T) {
+	c := &Consumer{
+		subscriptionActive: true,
+		jsConsumers:        map[int]jetstream.Consumer{1: failingJsConsumer{err: errors.New("nats: connection closed")}},
+	}
+
+	msgs, err := c.fetchSubscription(10, "", -1, fetchLimits{})
+	if !errors.Is(err, ConsumerErrFetchFailed) {
+		t.Fatalf("err = %v, want ConsumerErrFetchFailed", err)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("got %d msgs on failure", len(msgs))
+	}
+	if !c.isSubscriptionActive() {
+		t.Fatalf("a transient fetch failure should not mark the subscription inactive")
+	}
+
+	c.jsConsumers[1] = failingJsConsumer{err: nats.ErrTimeout}
+	if _, err := c.fetchSubscription(10, "", -1, fetchLimits{}); err != nil {
+		t.Fatalf("timeout should not be reported as an error, got %v", err)
+	}
+}
+
+type fakeBatch struct {
+	msgs chan jetstream.Msg
+}
+
+func (b fakeBatch) Messages() <-chan jetstream.Msg { return b.msgs }
+func (b fakeBatch) Error() error                   { return nil }
+
+type countingJsConsumer struct {
+	jetstream.Consumer
+	mu      sync.Mutex
+	fetches int
+}
+
+func (f *countingJsConsumer) Fetch(batch int, _ ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	f.mu.Lock()
+	f.fetches++
+	f.mu.Unlock()
+	msgs := make(chan jetstream.Msg, batch)
+	for i := 0; i < batch; i++ {
+		msgs <- &ackRecordingMsg{data: []byte("prefetched")}
+	}
+	close(msgs)
+	return fakeBatch{msgs: msgs}, nil
+}
+
+func (f *countingJsConsumer) fetchCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches
+}
+
+func TestFetchPrefetched(t *testing.T) {
+	js := &countingJsConsumer{}
+	c := &Consumer{
+		stationName:        "station",
+		ConsumerGroup:      "cg",
+		BatchMaxTimeToWait: time.Second,
+		subscriptionActive: true,
+		prefetchDepth:      3,
+		jsConsumers:        map[int]jetstream.Consumer{1: js},
+		conn:               &Conn{prefetchedMsgs: PrefetchedMsgs{msgs: make(map[string]map[string][]*Msg)}},
+	}
+	c.appendPrefetched([]*Msg{newTestMsg("1", nil), newTestMsg("2", nil), newTestMsg("3", nil), newTestMsg("4", nil), newTestMsg("5", nil)})
+
+	for _, expected := range []int{2, 2, 1} {
+		msgs, err := c.Fetch(2, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != expected {
+			t.Fatalf("expected %d prefetched messages, got %d", expected, len(msgs))
+		}
+	}
+	if js.fetchCount() != 0 {
+		t.Fatalf("buffered messages should be served without fetching")
+	}
+
+	// an empty buffer is refilled up to the prefetch depth
+	if _, err := c.Fetch(2, true); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.prefetchedCount() < 6 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if c.prefetchedCount() != 6 {
+		t.Fatalf("expected 3 batches to be prefetched, got %d messages", c.prefetchedCount())
+	}
+
+	// above the watermark no refill is triggered
+	fetches := js.fetchCount()
+	if msgs, _ := c.Fetch(2, true); len(msgs) != 2 {
+		t.Fatalf("expected 2 prefetched messages, got %d", len(msgs))
+	}
+	time.Sleep(10 * time.Millisecond)
+	if js.fetchCount() != fetches {
+		t.Fatalf("a buffer above the watermark should not be refilled")
+	}
+}
+
+// limitsJsConsumer - records which kind of pull request was sent.
+type limitsJsConsumer struct {
+	jetstream.Consumer
+	calls []string
+}
+
+func (f *limitsJsConsumer) batch(n int) jetstream.MessageBatch {
+	msgs := make(chan jetstream.Msg, n)
+	for i := 0; i < n; i++ {
+		msgs <- &ackRecordingMsg{data: []byte("msg")}
+	}
+	close(msgs)
+	return fakeBatch{msgs: msgs}
+}
+
+func (f *limitsJsConsumer) Fetch(batch int, _ ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	f.calls = append(f.calls, fmt.Sprintf("fetch %d", batch))
+	return f.batch(batch), nil
+}
+
+func (f *limitsJsConsumer) FetchBytes(maxBytes int, _ ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	f.calls = append(f.calls, fmt.Sprintf("bytes %d", maxBytes))
+	return f.batch(maxBytes / 100), nil
+}
+
+func (f *limitsJsConsumer) FetchNoWait(batch int) (jetstream.MessageBatch, error) {
+	f.calls = append(f.calls, fmt.Sprintf("nowait %d", batch))
+	return f.batch(1), nil
+}
+
+func TestFetchLimits(t *testing.T) {
+	js := &limitsJsConsumer{}
+	c := &Consumer{
+		stationName:        "station",
+		ConsumerGroup:      "cg",
+		BatchMaxTimeToWait: time.Second,
+		subscriptionActive: true,
+		jsConsumers:        map[int]jetstream.Consumer{1: js},
+		conn:               &Conn{prefetchedMsgs: PrefetchedMsgs{msgs: make(map[string]map[string][]*Msg)}},
+	}
+
+	if msgs, err := c.Fetch(5, false); err != nil || len(msgs) != 5 {
+		t.Fatalf("fetch: %d msgs, err=%v", len(msgs), err)
+	}
+	if msgs, err := c.Fetch(5, false, MaxBytes(300)); err != nil || len(msgs) != 3 {
+		t.Fatalf("fetch bytes: %d msgs, err=%v", len(msgs), err)
+	}
+	if msgs, err := c.FetchNoWait(5); err != nil || len(msgs) != 1 {
+		t.Fatalf("fetch no wait: %d msgs, err=%v", len(msgs), err)
+	}
+	if _, err := c.FetchNoWait(5, MaxBytes(300)); err == nil {
+		t.Fatalf("MaxBytes should be rejected by FetchNoWait")
+	}
+	if _, err := c.Fetch(5, false, MaxBytes(0)); err == nil {
+		t.Fatalf("a non positive MaxBytes should be rejected")
+	}
+	expected := []string{"fetch 5", "bytes 300", "nowait 5"}
+	if !reflect.DeepEqual(js.calls, expected) {
+		t.Fatalf("calls = %v, want %v", js.calls, expected)
+	}
+
+	// buffered messages are served before asking the broker
+	c.appendPrefetched([]*Msg{newTestMsg("1", nil), newTestMsg("2", nil)})
+	if msgs, err := c.FetchNoWait(5); err != nil || len(msgs) != 2 {
+		t.Fatalf("fetch no wait from buffer: %d msgs, err=%v", len(msgs), err)
+	}
+	if len(js.calls) != len(expected) {
+		t.Fatalf("buffered messages should be served without fetching")
+	}
+}
+
+func TestPartitionConsumer(t *testing.T) {
+	if name, err := partitionStreamName("orders", []int{1, 2, 3}, 2); err != nil || name != "orders$2" {
+		t.Errorf("expected stream orders$2, got %v %v", name, err)
+	}
+	if _, err := partitionStreamName("orders", []int{1, 2, 3}, 4); err == nil {
+		t.Error("expected an error for a missing partition")
+	}
+	if name, err := partitionStreamName("orders", nil, 1); err != nil || name != "orders" {
+		t.Errorf("expected the station stream for a station without partitions, got %v %v", name, err)
+	}
+
+	c := &Consumer{partition: 3}
+	if p, err := c.resolvePartition("", -1); err != nil || p != 3 {
+		t.Errorf("expected the bound partition, got %v %v", p, err)
+	}
+	if p, err := c.resolvePartition("", 3); err != nil || p != 3 {
+		t.Errorf("expected the bound partition, got %v %v", p, err)
+	}
+	if _, err := c.resolvePartition("", 2); err == nil {
+		t.Error("expected an error fetching another partition")
+	}
+	if _, err := c.resolvePartition("key", -1); err == nil {
+		t.Error("expected an error fetching by partition key")
+	}
+}
+
+type infoJsConsumer struct {
+	jetstream.Consumer
+	info *jetstream.ConsumerInfo
+}
+
+func (f *infoJsConsumer) CachedInfo() *jetstream.ConsumerInfo {
+	return f.info
+}
+
+func TestStartSequences(t *testing.T) {
+	c := &Consumer{startSequences: startSequences(map[int]jetstream.Consumer{
+		1: &infoJsConsumer{info: &jetstream.ConsumerInfo{AckFloor: jetstream.SequenceInfo{Stream: 41}}},
+		2: &infoJsConsumer{info: &jetstream.ConsumerInfo{}},
+	})}
+	sequences := c.StartSequences()
+	if sequences[1] != 42 || sequences[2] != 1 {
+		t.Fatalf("unexpected start sequences %v", sequences)
+	}
+	sequences[1] = 7
+	if c.StartSequences()[1] != 42 {
+		t.Errorf("the start sequences were modified through the returned map")
+	}
+}
+
+func TestDLSHandler(t *testing.T) {
+	c := &Consumer{stationName: "orders", ConsumerGroup: "workers", context: context.WithValue(context.Background(), "key", "value")}
+	dlsMsg := nats.NewMsg("$memphis_dls_orders.workers")
+	dlsMsg.Data = []byte("poison")
+	handle := c.createDlsMsgHandler()
+
+	var consumed []*Msg
+	c.setDlsHandlerFunc(func(msgs []*Msg, err error, ctx context.Context) { consumed = append(consumed, msgs...) })
+	handle(dlsMsg)
+	if len(consumed) != 1 || !consumed[0].IsDLS() {
+		t.Fatalf("expected the consume handler to get a DLS message, got %v", consumed)
+	}
+
+	var dls []*Msg
+	c.SetDLSHandler(func(msgs []*Msg, err error, ctx context.Context) {
+		if ctx.Value("key") != "value" {
+			t.Errorf("DLS handler did not get the consumer's context")
+		}
+		dls = append(dls, msgs...)
+	})
+	handle(dlsMsg)
+	if len(consumed) != 1 || len(dls) != 1 || !dls[0].IsDLS() || string(dls[0].Data()) != "poison" {
+		t.Fatalf("consumed %d, dls %d", len(consumed), len(dls))
+	}
+
+	c.SetDLSHandler(nil)
+	c.setDlsHandlerFunc(nil)
+	handle(dlsMsg)
+	if len(dls) != 1 || len(c.dlsMsgs) != 1 || !c.dlsMsgs[0].IsDLS() {
+		t.Fatalf("expected the message to be kept for Fetch, dls %d, buffered %d", len(dls), len(c.dlsMsgs))
+	}
+
+	if newTestMsg("a", nil).IsDLS() {
+		t.Fatal("a station message reported as DLS")
+	}
+	if !newTestMsg("a", map[string]string{"$memphis_pm_id": "1", "$memphis_pm_cg_name": "workers"}).IsDLS() {
+		t.Fatal("a message with dead-letter headers was not reported as DLS")
+	}
+}
+
+// lastSeqJetStream - a broker listing and describing its streams.
+type lastSeqJetStream struct {
+	storedStreamsJetStream
+}
+
+func (js *lastSeqJetStream) StreamNames(context.Context, ...jetstream.StreamListOpt) jetstream.StreamNameLister {
+	names := make(chan string, len(js.streams))
+	for name := range js.streams {
+		names <- name
+	}
+	close(names)
+	return streamNames(names)
+}
+
+func TestSequenceAfterLast(t *testing.T) {
+	js := &lastSeqJetStream{storedStreamsJetStream{streams: map[string]*storedStream{
+		"orders":     {lastSeq: 4},
+		"payments$1": {lastSeq: 3},
+		"payments$2": {lastSeq: 7},
+	}}}
+	c := &Conn{js: js, stationPartitions: map[string]*PartitionsUpdate{"payments": {PartitionsList: []int{1, 2}}}}
+
+	if seq, err := c.sequenceAfterLast("orders", 0); err != nil || seq != 5 {
+		t.Fatalf("sequence after last = %v, err = %v, want 5", seq, err)
+	}
+	if seq, err := c.sequenceAfterLast("new-station", 0); err != nil || seq != 1 {
+		t.Fatalf("sequence of a station created with the consumer = %v, err = %v, want 1", seq, err)
+	}
+	if _, err := c.sequenceAfterLast("payments", 0); err == nil {
+		t.Fatal("expected a station with multiple partitions to be rejected")
+	}
+	if seq, err := c.sequenceAfterLast("payments", 2); err != nil || seq != 8 {
+		t.Fatalf("sequence after last of partition 2 = %v, err = %v, want 8", seq, err)
+	}
+	if _, err := c.sequenceAfterLast("payments", 3); err == nil {
+		t.Fatal("expected a missing partition to be rejected")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DecodeConcurrency - deserialize and validate the messages of every batch with the station's schema on up to n
+// goroutines before the handler is called, so Msg.DataDeserialized returns right away. Typed consumers decode
+// their values with the codec concurrently instead. Combined with prefetching or ConsumeModePipelined, decoding
+// overlaps with fetching the next batch.
+func DecodeConcurrency(n int) ConsumingOpt {
+	return func(opts *ConsumingOpts) error {
+		if n < 1 {
+			return errors.New("decode concurrency has to be positive")
+		}
+		opts.DecodeConcurrency = n
+		return nil
+	}
+}
+
+// noDecodeConcurrency - disables the deserialization of Msg.DataDeserialized, for handlers decoding messages
+// themselves.
+func noDecodeConcurrency() ConsumingOpt {
+	return func(opts *ConsumingOpts) error {
+		opts.DecodeConcurrency = 0
+		return nil
+	}
+}
+
+// decodedData - the result of a message's deserialization.
+type decodedData struct {
+	value any
+	err   error
+}
+
+// decodeConcurrently - calls decode with every index below n on at most workers goroutines.
+func decodeConcurrently(n, workers int, decode func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			decode(i)
+		}
+		return
+	}
+	indexes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				decode(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// decodingHandler - deserializes the messages of every batch on workers goroutines before calling handlerFunc.
+func decodingHandler(handlerFunc ConsumeHandler, workers int) ConsumeHandler {
+	return func(msgs []*Msg, err error, ctx context.Context) {
+		decodeConcurrently(len(msgs), workers, func(i int) {
+			value, err := msgs[i].DataDeserialized()
+			msgs[i].decoded = &decodedData{value: value, err: err}
+		})
+		handlerFunc(msgs, err, ctx)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDecodeConcurrently(t *testing.T) {
+	var running, maxRunning int32
+	decoded := make([]bool, 20)
+	decodeConcurrently(len(decoded), 4, func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		decoded[i] = true
+		atomic.AddInt32(&running, -1)
+	})
+	for i, ok := range decoded {
+		if !ok {
+			t.Fatalf("message %d was not decoded", i)
+		}
+	}
+	if maxRunning > 4 {
+		t.Fatalf("%d decodes ran concurrently, want at most 4", maxRunning)
+	}
+	if err := DecodeConcurrency(0)(&ConsumingOpts{}); err == nil {
+		t.Fatal("a concurrency of 0 was accepted")
+	}
+}
+
+func TestDecodingHandler(t *testing.T) {
+	msgs := make([]*Msg, 8)
+	for i := range msgs {
+		msgs[i] = newTestMsg(fmt.Sprintf(`{"id": %d}`, i), nil)
+	}
+	var handled []*Msg
+	decodingHandler(func(msgs []*Msg, err error, ctx context.Context) {
+		handled = msgs
+	}, 3)(msgs, nil, context.Background())
+
+	if len(handled) != len(msgs) {
+		t.Fatalf("handled %d messages, want %d", len(handled), len(msgs))
+	}
+	for i, msg := range handled {
+		if msg.decoded == nil {
+			t.Fatalf("message %d was not decoded before the handler", i)
+		}
+		// a message without a connection deserializes to its raw data
+		data, err := msg.DataDeserialized()
+		if err != nil || string(data.([]byte)) != fmt.Sprintf(`{"id": %d}`, i) {
+			t.Fatalf("message %d deserialized to %v, %v", i, data, err)
+		}
+	}
+}
+
+func TestTypedConsumerDecodeConcurrency(t *testing.T) {
+	c := &Consumer{}
+	tc := NewTypedConsumer[order](c, JSONCodec[order]{})
+	raw := make([]*ackRecordingMsg, 10)
+	msgs := make([]*Msg, len(raw))
+	for i := range raw {
+		raw[i] = &ackRecordingMsg{data: []byte(fmt.Sprintf(`{"id":%d}`, i))}
+		msgs[i] = &Msg{msg: raw[i]}
+	}
+	var handled []int
+	tc.handle(context.Background(), msgs, func(_ context.Context, o order) error {
+		handled = append(handled, o.ID)
+		return nil
+	}, 4)
+	for i, id := range handled {
+		if id != i || !raw[i].acked {
+			t.Fatalf("handled %v, the decoded values have to be handled in order and acked", handled)
+		}
+	}
+	if len(handled) != len(msgs) {
+		t.Fatalf("handled %d messages, want %d", len(handled), len(msgs))
+	}
+}
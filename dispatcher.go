@@ -0,0 +1,156 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// KeyFunc - extracts the key messages are dispatched on.
+type KeyFunc func(*Msg) (string, error)
+
+// HeaderKey - dispatches messages on the value of a header, messages without it share the empty key.
+func HeaderKey(header string) KeyFunc {
+	return func(msg *Msg) (string, error) {
+		return msg.GetHeaders()[header], nil
+	}
+}
+
+// PayloadFieldKey - dispatches JSON messages on the value of a field, nested fields are separated by dots,
+// e.g. "customer.id". Messages without the field share the empty key, messages which aren't JSON objects fail.
+func PayloadFieldKey(path string) KeyFunc {
+	fields := strings.Split(path, ".")
+	return func(msg *Msg) (string, error) {
+		raw := json.RawMessage(msg.DataNoCopy())
+		for _, field := range fields {
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &object); err != nil {
+				return "", fmt.Errorf("dispatch key %v: %w", path, err)
+			}
+			value, ok := object[field]
+			if !ok {
+				return "", nil
+			}
+			raw = value
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s, nil
+		}
+		return string(raw), nil
+	}
+}
+
+// KeyedDispatcherOpts - configuration options for a keyed dispatcher.
+type KeyedDispatcherOpts struct {
+	Workers int
+}
+
+// KeyedDispatcherOpt - a function on the options for a keyed dispatcher.
+type KeyedDispatcherOpt func(*KeyedDispatcherOpts) error
+
+// DispatchWorkers - the number of messages handled in parallel, default is GOMAXPROCS.
+func DispatchWorkers(workers int) KeyedDispatcherOpt {
+	return func(opts *KeyedDispatcherOpts) error {
+		if workers < 1 {
+			return errors.New("dispatch workers has to be positive")
+		}
+		opts.Workers = workers
+		return nil
+	}
+}
+
+// KeyedDispatcher - handles the messages of a consumer on a fixed number of workers, the messages with the same
+// key always go to the same worker so they are handled in the order they were consumed while different keys are
+// handled in parallel. Each batch is fully handled before the next one is fetched.
+type KeyedDispatcher struct {
+	consumer *Consumer
+	key      KeyFunc
+	workers  int
+}
+
+// NewKeyedDispatcher - creates a dispatcher for the consumer's messages, keyed by key.
+func NewKeyedDispatcher(consumer *Consumer, key KeyFunc, opts ...KeyedDispatcherOpt) (*KeyedDispatcher, error) {
+	if consumer == nil || key == nil {
+		return nil, memphisError(errors.New("a keyed dispatcher requires a consumer and a key function"))
+	}
+	defaultOpts := KeyedDispatcherOpts{Workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	return &KeyedDispatcher{consumer: consumer, key: key, workers: defaultOpts.Workers}, nil
+}
+
+// KeyedDispatcher.Consume - starts consuming, each message is settled according to handler's result like with
+// Consumer.ConsumeEachWithResult. A message whose key can't be extracted is settled with the key error.
+// A redelivered message is handled again after the messages consumed before its redelivery.
+func (d *KeyedDispatcher) Consume(handler MsgResultHandler, opts ...ConsumingOpt) error {
+	nakDelay, err := resultNakDelay(opts)
+	if err != nil {
+		return err
+	}
+	c := d.consumer
+	return c.Consume(func(msgs []*Msg, err error, ctx context.Context) {
+		if err != nil {
+			c.callErrHandler(err)
+		}
+		ctx = resultContext(ctx)
+		shards := make([][]*Msg, d.workers)
+		for _, msg := range msgs {
+			key, err := d.key(msg)
+			if err != nil {
+				c.settle(msg, err, nakDelay)
+				continue
+			}
+			worker := d.worker(key)
+			shards[worker] = append(shards[worker], msg)
+		}
+		var wg sync.WaitGroup
+		for _, shard := range shards {
+			if len(shard) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(shard []*Msg) {
+				defer wg.Done()
+				for _, msg := range shard {
+					c.settle(msg, handler(ctx, msg), nakDelay)
+				}
+			}(shard)
+		}
+		wg.Wait()
+	}, opts...)
+}
+
+// KeyedDispatcher.StopConsume - stops consuming, the batch being handled completes.
+func (d *KeyedDispatcher) StopConsume() {
+	d.consumer.StopConsume()
+}
+
+// worker - the index of the worker handling key.
+func (d *KeyedDispatcher) worker(key string) int {
+	return int(murmur3.Sum32WithSeed([]byte(key), SEED) % uint32(d.workers))
+}
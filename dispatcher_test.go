@@ -0,0 +1,83 @@
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestPayloadFieldKey(t *testing.T) {
+	key := PayloadFieldKey("customer.id")
+	for data, want := range map[string]string{
+		`{"customer": {"id": "c-1"}}`: "c-1",
+		`{"customer": {"id": 42}}`:    "42",
+		`{"customer": {}}`:            "",
+		`{"order": 1}`:                "",
+	} {
+		if got, err := key(newTestMsg(data, nil)); err != nil || got != want {
+			t.Errorf("key of %s = %q, %v, want %q", data, got, err, want)
+		}
+	}
+	if _, err := key(newTestMsg("not json", nil)); err == nil {
+		t.Error("expected a payload which isn't JSON to fail")
+	}
+	if got, _ := HeaderKey("tenant")(newTestMsg("", map[string]string{"tenant": "t-1"})); got != "t-1" {
+		t.Errorf("header key = %q", got)
+	}
+}
+
+func TestKeyedDispatcher(t *testing.T) {
+	if _, err := NewKeyedDispatcher(&Consumer{}, HeaderKey("k"), DispatchWorkers(0)); err == nil {
+		t.Fatal("expected zero workers to be rejected")
+	}
+
+	var data []string
+	for i := 0; i < 20; i++ {
+		data = append(data, fmt.Sprintf(`{"key": "k%d", "n": %d}`, i%4, i))
+	}
+	data = append(data, "not json")
+	settled := make(chan string, len(data))
+	c := newResultConsumer(settled, data...)
+	d, err := NewKeyedDispatcher(c, PayloadFieldKey("key"), DispatchWorkers(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	handled := map[string][]int{}
+	err = d.Consume(func(ctx context.Context, msg *Msg) error {
+		var v struct {
+			Key string `json:"key"`
+			N   int    `json:"n"`
+		}
+		if err := json.Unmarshal(msg.Data(), &v); err != nil {
+			return err
+		}
+		mu.Lock()
+		handled[v.Key] = append(handled[v.Key], v.N)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.StopConsume()
+
+	got := collectSettled(t, settled, len(data))
+	sort.Strings(got)
+	if i := sort.SearchStrings(got, "not json"); got[i] != "not json:nak 0s" {
+		t.Fatalf("the message without a key was settled %v", got[i])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for k := 0; k < 4; k++ {
+		want := []int{k, k + 4, k + 8, k + 12, k + 16}
+		if got := handled[fmt.Sprintf("k%d", k)]; !reflect.DeepEqual(got, want) {
+			t.Errorf("key k%d handled in order %v, want %v", k, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// headers the broker sets on poison messages it resends to a consumer group
+const (
+	dlsIdHeader            = "$memphis_pm_id"
+	dlsConsumerGroupHeader = "$memphis_pm_cg_name"
+)
+
+// metrics of the DLS messages resent to a consumer group
+const (
+	dlsReceivedMetric    = "memphis_consumer_dls_received_total"
+	dlsBufferedMetric    = "memphis_consumer_dls_buffered_total"
+	dlsOverwrittenMetric = "memphis_consumer_dls_overwritten_total"
+	dlsHandledMetric     = "memphis_consumer_dls_handled_total"
+)
+
+// DLSInfo - the dead-letter details the broker sets on a poison message it resends to a consumer group.
+type DLSInfo struct {
+	// Id - the broker's id of the dead-letter message.
+	Id int
+	// ConsumerGroup - the consumer group which failed to process the message.
+	ConsumerGroup string
+}
+
+// Msg.IsDLS - whether the message was delivered from the station's dead-letter station, after the consumer group
+// failed to process it.
+func (m *Msg) IsDLS() bool {
+	if m.dls {
+		return true
+	}
+	_, ok := m.rawHeaders()[dlsIdHeader]
+	return ok
+}
+
+// Msg.DLSInfo - the dead-letter details of the message, ok is false when it isn't a DLS message.
+func (m *Msg) DLSInfo() (info DLSInfo, ok bool) {
+	if !m.IsDLS() {
+		return DLSInfo{}, false
+	}
+	headers := m.rawHeaders()
+	info.Id, _ = strconv.Atoi(headers.Get(dlsIdHeader))
+	info.ConsumerGroup = headers.Get(dlsConsumerGroupHeader)
+	return info, true
+}
+
+// Msg.DLSConsumerGroup - the consumer group which failed to process the message, empty when it isn't a DLS message.
+func (m *Msg) DLSConsumerGroup() string {
+	info, _ := m.DLSInfo()
+	return info.ConsumerGroup
+}
+
+func (m *Msg) rawHeaders() nats.Header {
+	if msg, ok := m.msg.(*nats.Msg); ok {
+		return msg.Header
+	} else if jsMsg, ok := m.msg.(jetstream.Msg); ok {
+		return jsMsg.Headers()
+	}
+	return nil
+}
+
+// DLSStats - the DLS messages the broker resent to the consumer since it was created. Messages arriving while no
+// Consume is active are buffered for Fetch, up to 10000 of them, beyond which the oldest are overwritten and lost.
+type DLSStats struct {
+	// Received - the DLS messages received.
+	Received uint64
+	// Buffered - the DLS messages buffered for Fetch.
+	Buffered uint64
+	// Overwritten - the buffered DLS messages overwritten by newer ones when the buffer was full.
+	Overwritten uint64
+	// Handled - the DLS messages handed to a consume handler or returned by Fetch.
+	Handled uint64
+	// Pending - the DLS messages currently buffered.
+	Pending int
+}
+
+// Consumer.DLSStats - the consumer's DLS message counters, they are also recorded into the connection's metrics
+// labeled by station and consumer group.
+func (c *Consumer) DLSStats() DLSStats {
+	c.dlsMsgsMutex.RLock()
+	defer c.dlsMsgsMutex.RUnlock()
+	stats := c.dlsStats
+	stats.Pending = len(c.dlsMsgs)
+	return stats
+}
+
+// Consumer.countDls - adds delta to the DLS counter of metric.
+func (c *Consumer) countDls(metric string, delta int) {
+	if delta == 0 {
+		return
+	}
+	c.dlsMsgsMutex.Lock()
+	switch metric {
+	case dlsReceivedMetric:
+		c.dlsStats.Received += uint64(delta)
+	case dlsBufferedMetric:
+		c.dlsStats.Buffered += uint64(delta)
+	case dlsOverwrittenMetric:
+		c.dlsStats.Overwritten += uint64(delta)
+	case dlsHandledMetric:
+		c.dlsStats.Handled += uint64(delta)
+	}
+	c.dlsMsgsMutex.Unlock()
+	c.conn.addCounter(metric, map[string]string{
+		metricsStationLabel:       c.stationName,
+		metricsConsumerGroupLabel: c.ConsumerGroup,
+	}, float64(delta))
+}
@@ -0,0 +1,63 @@
+package memphis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestDLSInfo(t *testing.T) {
+	if _, ok := newTestMsg("a", nil).DLSInfo(); ok {
+		t.Fatal("a station message reported DLS info")
+	}
+
+	msg := newTestMsg("a", map[string]string{dlsIdHeader: "7", dlsConsumerGroupHeader: "workers"})
+	info, ok := msg.DLSInfo()
+	if want := (DLSInfo{Id: 7, ConsumerGroup: "workers"}); !ok || info != want {
+		t.Fatalf("DLSInfo = %+v, want %+v", info, want)
+	}
+	if msg.DLSConsumerGroup() != "workers" {
+		t.Fatal("DLSConsumerGroup doesn't match DLSInfo")
+	}
+
+	// received on the consumer group's DLS subject without the broker's headers
+	msg = &Msg{msg: nats.NewMsg("$memphis_dls_orders.workers"), dls: true}
+	if info, ok := msg.DLSInfo(); !ok || info != (DLSInfo{}) {
+		t.Fatalf("DLSInfo = %+v, %v", info, ok)
+	}
+}
+
+func TestDLSStats(t *testing.T) {
+	metrics := NewInMemoryMetrics()
+	c := &Consumer{conn: &Conn{opts: Options{Metrics: metrics}}, stationName: "orders", ConsumerGroup: "workers"}
+	handle := c.createDlsMsgHandler()
+	dlsMsg := nats.NewMsg("$memphis_dls_orders.workers")
+
+	c.setDlsHandlerFunc(func([]*Msg, error, context.Context) {})
+	handle(dlsMsg)
+	c.setDlsHandlerFunc(nil)
+	for i := 0; i < 10000; i++ {
+		handle(dlsMsg)
+	}
+	handle(dlsMsg)
+	handle(dlsMsg)
+	want := DLSStats{Received: 10003, Buffered: 10002, Overwritten: 2, Handled: 1, Pending: 10000}
+	if stats := c.DLSStats(); stats != want {
+		t.Fatalf("DLSStats = %+v, want %+v", stats, want)
+	}
+
+	if msgs := c.takeDlsMsgs(100); len(msgs) != 100 {
+		t.Fatalf("took %v messages", len(msgs))
+	}
+	want.Handled, want.Pending = 101, 9900
+	if stats := c.DLSStats(); stats != want {
+		t.Fatalf("DLSStats = %+v, want %+v", stats, want)
+	}
+	labels := map[string]string{metricsStationLabel: "orders", metricsConsumerGroupLabel: "workers"}
+	for metric, count := range map[string]float64{dlsReceivedMetric: 10003, dlsBufferedMetric: 10002, dlsOverwrittenMetric: 2, dlsHandledMetric: 101} {
+		if got := metrics.Counter(metric, labels); got != count {
+			t.Errorf("%v = %v, want %v", metric, got, count)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// drillDialer - dials the broker connection and keeps the current socket, so failover drills can break it.
+type drillDialer struct {
+	dialer nats.CustomDialer
+	mu     sync.Mutex
+	conn   net.Conn
+}
+
+func newDrillDialer(dialer nats.CustomDialer, timeout time.Duration) *drillDialer {
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: timeout}
+	}
+	return &drillDialer{dialer: dialer}
+}
+
+func (d *drillDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.dialer.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.conn = conn
+	d.mu.Unlock()
+	return conn, nil
+}
+
+// drop - closes the current socket under the client's feet, the client sees it as a network failure.
+func (d *drillDialer) drop() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn == nil {
+		return errors.New("no broker connection to drop")
+	}
+	err := d.conn.Close()
+	d.conn = nil
+	return err
+}
+
+func (c *Conn) checkDrill() error {
+	if c.dialer == nil || c.brokerConn == nil || !c.brokerConn.IsConnected() {
+		return errors.New("not connected to the broker")
+	}
+	if !c.opts.Reconnect {
+		return errors.New("failover drills require Reconnect to be enabled")
+	}
+	return nil
+}
+
+// SimulateDisconnect - breaks the connection to the broker as a network failure would, messages buffered for
+// sending are kept for the reconnect. The SDK then goes through its regular reconnect and consumer recovery,
+// so platform teams can run chaos drills against it in staging. Requires Reconnect to be enabled.
+func (c *Conn) SimulateDisconnect() error {
+	if err := c.checkDrill(); err != nil {
+		return memphisError(err)
+	}
+	return memphisError(c.dialer.drop())
+}
+
+// ForceReconnect - flushes the messages buffered for sending and reconnects to the broker, the next server of the
+// pool is tried first. Requires Reconnect to be enabled.
+func (c *Conn) ForceReconnect() error {
+	if err := c.checkDrill(); err != nil {
+		return memphisError(err)
+	}
+	if err := c.brokerConn.FlushTimeout(c.opts.Timeout); err != nil {
+		return memphisError(err)
+	}
+	return memphisError(c.dialer.drop())
+}
@@ -0,0 +1,78 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type pipeDialer struct {
+	remote chan net.Conn
+}
+
+func (d pipeDialer) Dial(network, address string) (net.Conn, error) {
+	local, remote := net.Pipe()
+	d.remote <- remote
+	return local, nil
+}
+
+func TestDrillDialer(t *testing.T) {
+	remotes := make(chan net.Conn, 2)
+	d := newDrillDialer(pipeDialer{remote: remotes}, time.Second)
+	if err := d.drop(); err == nil {
+		t.Fatal("dropping before dialing should fail")
+	}
+
+	if _, err := d.Dial("tcp", "broker:6666"); err != nil {
+		t.Fatal(err)
+	}
+	first := <-remotes
+	local, err := d.Dial("tcp", "broker:6666")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := <-remotes
+
+	// only the current socket is dropped
+	if err := d.drop(); err != nil {
+		t.Fatal(err)
+	}
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("the broker side read %v, want EOF", err)
+	}
+	if _, err := local.Write([]byte("x")); err == nil {
+		t.Fatal("the dropped socket is still writable")
+	}
+	first.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := first.Read(make([]byte, 1)); err == io.EOF {
+		t.Fatal("a previous socket was closed")
+	}
+	if err := d.drop(); err == nil {
+		t.Fatal("a socket can only be dropped once")
+	}
+}
+
+func TestDrillsRequireConnection(t *testing.T) {
+	c := &Conn{}
+	if err := c.SimulateDisconnect(); err == nil {
+		t.Fatal("SimulateDisconnect without a connection should fail")
+	}
+	if err := c.ForceReconnect(); err == nil {
+		t.Fatal("ForceReconnect without a connection should fail")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"strings"
+)
+
+// EnricherFunc - stamps an outgoing message with metadata, e.g. the service name, version, environment or trace ids.
+// It runs after the connection's default headers are applied and before the message is validated and published.
+type EnricherFunc func(hdrs *Headers) error
+
+// DefaultHeaders - headers added to every message produced through the connection, headers set on the message take precedence.
+func DefaultHeaders(headers map[string]string) Option {
+	return func(o *Options) error {
+		for key := range headers {
+			if strings.HasPrefix(key, "$memphis") {
+				return errors.New("keys in headers should not start with $memphis")
+			}
+		}
+		if o.DefaultHeaders == nil {
+			o.DefaultHeaders = make(map[string]string, len(headers))
+		}
+		for key, value := range headers {
+			o.DefaultHeaders[key] = value
+		}
+		return nil
+	}
+}
+
+// Enricher - a hook called for every message the producer produces, to enforce envelope conventions in one place.
+func Enricher(enricher EnricherFunc) ProducerOpt {
+	return func(opts *ProducerOpts) error {
+		if enricher == nil {
+			return errors.New("enricher can not be nil")
+		}
+		opts.Enricher = enricher
+		return nil
+	}
+}
+
+// Producer.enrich - applies the connection's default headers and the producer's enricher to the message headers.
+func (p *Producer) enrich(hdrs *Headers) error {
+	if hdrs.MsgHeaders == nil {
+		hdrs.New()
+	}
+	for key, value := range p.conn.opts.DefaultHeaders {
+		if _, ok := hdrs.MsgHeaders[key]; !ok {
+			hdrs.MsgHeaders[key] = []string{value}
+		}
+	}
+	if p.enricher == nil {
+		return nil
+	}
+	if err := p.enricher(hdrs); err != nil {
+		return memphisError(err)
+	}
+	for key := range hdrs.MsgHeaders {
+		if strings.HasPrefix(key, "$memphis") {
+			return memphisError(errors.New("enricher can not set headers starting with $memphis"))
+		}
+	}
+	return nil
+}
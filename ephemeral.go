@@ -0,0 +1,62 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ephemeralInactiveThreshold - how long the consumer group of an ephemeral consumer outlives a client which
+// disconnected without closing the connection, unless InactiveThreshold is set.
+const ephemeralInactiveThreshold = 30 * time.Second
+
+// Ephemeral - the consumer gets a consumer group of its own which is destroyed when the consumer is destroyed or
+// the connection is closed, and removed by the broker shortly after the client disconnects otherwise, so live
+// tails and debugging sessions leave no state behind. The group's name is the consumer's name with a random
+// suffix, it can't be combined with ConsumerGroup or ResumeFromLastAck.
+func Ephemeral() ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		opts.Ephemeral = true
+		return nil
+	}
+}
+
+// applyEphemeral - names the consumer group of an ephemeral consumer and bounds its lifetime after a disconnect.
+func (opts *ConsumerOpts) applyEphemeral() error {
+	if !opts.Ephemeral {
+		return nil
+	}
+	if opts.ConsumerGroup != "" {
+		return errors.New("an ephemeral consumer can't join a consumer group")
+	}
+	if opts.ResumeFromLastAck {
+		return errors.New("an ephemeral consumer can't resume from the last ack")
+	}
+	suffix, err := randomHex(4)
+	if err != nil {
+		return err
+	}
+	opts.ConsumerGroup = strings.ToLower(opts.Name) + "-ephemeral-" + suffix
+	if opts.InactiveThreshold == 0 {
+		opts.InactiveThreshold = ephemeralInactiveThreshold
+	}
+	return nil
+}
+
+// Consumer.IsEphemeral - whether the consumer was created with Ephemeral.
+func (c *Consumer) IsEphemeral() bool {
+	return c.ephemeral
+}
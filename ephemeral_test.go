@@ -0,0 +1,45 @@
+package memphis
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEphemeral(t *testing.T) {
+	opts := getDefaultConsumerOptions()
+	opts.Name = "Tail"
+	if err := Ephemeral()(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.applyEphemeral(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(opts.ConsumerGroup, "tail-ephemeral-") || validateName(opts.ConsumerGroup, "consumer group") != nil {
+		t.Errorf("unexpected consumer group %q", opts.ConsumerGroup)
+	}
+	if opts.InactiveThreshold != ephemeralInactiveThreshold {
+		t.Errorf("expected the default inactive threshold, got %v", opts.InactiveThreshold)
+	}
+
+	opts = getDefaultConsumerOptions()
+	opts.Name = "tail"
+	opts.Ephemeral = true
+	opts.InactiveThreshold = time.Minute
+	if err := opts.applyEphemeral(); err != nil || opts.InactiveThreshold != time.Minute {
+		t.Errorf("expected an explicit inactive threshold to be kept, got %v %v", opts.InactiveThreshold, err)
+	}
+
+	opts = getDefaultConsumerOptions()
+	opts.Ephemeral = true
+	opts.ConsumerGroup = "cg"
+	if err := opts.applyEphemeral(); err == nil {
+		t.Error("expected an ephemeral consumer with a consumer group to be rejected")
+	}
+	opts = getDefaultConsumerOptions()
+	opts.Ephemeral = true
+	opts.ResumeFromLastAck = true
+	if err := opts.applyEphemeral(); err == nil {
+		t.Error("expected an ephemeral consumer resuming from the last ack to be rejected")
+	}
+}
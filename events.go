@@ -0,0 +1,98 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// EventType - the kind of an SDK internal action reported to the event sink.
+type EventType string
+
+const (
+	EventConsumerCreated   EventType = "consumer_created"
+	EventProducerCreated   EventType = "producer_created"
+	EventSchemaUpdated     EventType = "schema_updated"
+	EventPartitionsUpdated EventType = "partitions_updated"
+	EventDlsMessage        EventType = "dls_message"
+	EventDisconnected      EventType = "disconnected"
+	EventReconnected       EventType = "reconnected"
+	EventFetchFailed       EventType = "fetch_failed"
+)
+
+// Event - a structured record of an SDK internal state transition, fields that don't apply to the event are empty.
+type Event struct {
+	Type         EventType
+	Time         time.Time
+	ConnectionId string
+	Station      string
+	Consumer     string
+	Producer     string
+	Partition    int
+	Server       string
+	Err          error
+	Details      map[string]string
+}
+
+// EventSink - receives the SDK's events, it is called synchronously from the SDK's goroutines and should not block.
+type EventSink func(event Event)
+
+// WithEventSink - report the SDK's internal actions, e.g. consumers created, schema and partition updates, DLS
+// messages, reconnects and fetch failures, to correlate them with the application's logs.
+func WithEventSink(sink EventSink) Option {
+	return func(o *Options) error {
+		if sink == nil {
+			return errors.New("event sink can not be nil")
+		}
+		o.EventSink = sink
+		return nil
+	}
+}
+
+// EventsChannel - an event sink sending the events to ch, events are dropped while ch is full.
+func EventsChannel(ch chan<- Event) EventSink {
+	return func(event Event) {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Conn.emit - reports the event to the connection's event sink, if any.
+func (c *Conn) emit(event Event) {
+	if c == nil || c.opts.EventSink == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = c.clock().Now()
+	}
+	event.ConnectionId = c.ConnId
+	c.opts.EventSink(event)
+}
+
+func (c *Conn) disconnected(nc *nats.Conn, err error) {
+	disconnectedError(nc, err)
+	c.emit(Event{Type: EventDisconnected, Err: err})
+}
+
+func (c *Conn) reconnected(nc *nats.Conn) {
+	c.kickProducerBuffers()
+	c.addCounter(reconnectsMetric, nil, 1)
+	c.emit(Event{Type: EventReconnected, Server: strings.TrimPrefix(nc.ConnectedUrlRedacted(), "nats://")})
+}
@@ -0,0 +1,42 @@
+package memphis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestEventSink(t *testing.T) {
+	events := make(chan Event, 2)
+	opts := Options{}
+	if err := WithEventSink(EventsChannel(events))(&opts); err != nil {
+		t.Fatal(err)
+	}
+	c := &Conn{opts: opts, ConnId: "conn-1", stationPartitions: map[string]*PartitionsUpdate{}, consumersMap: ConsumersMap{}}
+	c.setStationPartitions("orders", &PartitionsUpdate{PartitionsList: []int{1}})
+
+	c.handleStreamAdvisory(&nats.Msg{Subject: "$JS.EVENT.ADVISORY.STREAM.CREATED.orders$2"})
+	c.disconnected(nil, errors.New("connection reset"))
+	c.disconnected(nil, errors.New("dropped, the channel is full"))
+
+	event := <-events
+	if event.Type != EventPartitionsUpdated || event.Station != "orders" || event.Partition != 2 || event.ConnectionId != "conn-1" || event.Time.IsZero() {
+		t.Errorf("unexpected partitions event %+v", event)
+	}
+	if event.Details["action"] != "added" || event.Details["partitions"] != "[1 2]" {
+		t.Errorf("unexpected partitions event details %v", event.Details)
+	}
+	if event = <-events; event.Type != EventDisconnected || event.Err == nil {
+		t.Errorf("unexpected disconnect event %+v", event)
+	}
+	select {
+	case event = <-events:
+		t.Errorf("expected events to be dropped while the channel is full, got %+v", event)
+	default:
+	}
+
+	if err := WithEventSink(nil)(&Options{}); err == nil {
+		t.Error("expected a nil sink to be rejected")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SortByPublishTime - FetchAll returns the messages of all partitions ordered by the time they were published,
+// instead of grouped by partition.
+func SortByPublishTime() ConsumingOpt {
+	return func(opts *ConsumingOpts) error {
+		opts.SortByPublishTime = true
+		return nil
+	}
+}
+
+// FetchAll - fetches up to batchSize messages from every partition of the station concurrently and merges them,
+// grouped by partition in partition order or, with SortByPublishTime, ordered by publish time. Buffered DLS
+// messages come first. A partition which fails doesn't fail the others, the messages fetched are returned
+// together with the errors. ConsumerPartitionKey and ConsumerPartitionNumber can't be used with FetchAll.
+func (c *Consumer) FetchAll(batchSize int, opts ...ConsumingOpt) ([]*Msg, error) {
+	if batchSize > maxBatchSize || batchSize < 1 {
+		return nil, memphisError(errors.New("Batch size can not be greater than " + strconv.Itoa(maxBatchSize) + " or less than 1"))
+	}
+	defaultOpts := getDefaultConsumingOptions()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	if defaultOpts.ConsumerPartitionKey != "" || defaultOpts.ConsumerPartitionNumber > 0 {
+		return nil, memphisError(errors.New("FetchAll fetches from all partitions, a partition key or number can not be used"))
+	}
+
+	jsConsumers := c.partitionConsumers()
+	partitions := make([]int, 0, len(jsConsumers))
+	for p := range jsConsumers {
+		partitions = append(partitions, p)
+	}
+	sort.Ints(partitions)
+
+	results := make([]fetchResult, len(partitions))
+	var wg sync.WaitGroup
+	for i, p := range partitions {
+		wg.Add(1)
+		go func(i, p int) {
+			defer wg.Done()
+			msgs, err := c.fetchSubscriprionWithTimeout(batchSize, "", p, defaultOpts.fetchLimits())
+			results[i] = fetchResult{msgs: msgs, err: err}
+		}(i, p)
+	}
+	dlsMsgs := c.takeDlsMsgs(batchSize)
+	wg.Wait()
+
+	var fetched []*Msg
+	var errs multiError
+	for _, res := range results {
+		fetched = append(fetched, res.msgs...)
+		errs.add(res.err)
+	}
+	if defaultOpts.SortByPublishTime {
+		sortByPublishTime(fetched)
+	}
+	msgs := make([]*Msg, 0, len(dlsMsgs)+len(fetched))
+	msgs = append(append(msgs, dlsMsgs...), fetched...)
+	return c.filterMsgs(msgs, defaultOpts.Filter), memphisError(errs.err())
+}
+
+// sortByPublishTime - orders msgs by the time the broker stored them, messages without metadata keep their place
+// relative to each other and come first.
+func sortByPublishTime(msgs []*Msg) {
+	times := make(map[*Msg]time.Time, len(msgs))
+	for _, msg := range msgs {
+		times[msg] = msg.publishTime()
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return times[msgs[i]].Before(times[msgs[j]])
+	})
+}
+
+// publishTime - the time the broker stored the message, zero when it has no metadata.
+func (m *Msg) publishTime() time.Time {
+	md, err := m.metadata()
+	if err != nil {
+		return time.Time{}
+	}
+	return md.Timestamp
+}
@@ -0,0 +1,78 @@
+package memphis
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// timestampedMsg - a stored message published at a given time.
+type timestampedMsg struct {
+	jetstream.Msg
+	data      string
+	timestamp time.Time
+}
+
+func (m *timestampedMsg) Data() []byte         { return []byte(m.data) }
+func (m *timestampedMsg) Headers() nats.Header { return nats.Header{} }
+func (m *timestampedMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{Timestamp: m.timestamp}, nil
+}
+
+func TestFetchAll(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	partition := func(offsets map[string]int) *onceJsConsumer {
+		js := &onceJsConsumer{}
+		for _, data := range []string{"a", "b", "c", "d"} {
+			if offset, ok := offsets[data]; ok {
+				js.msgs = append(js.msgs, &timestampedMsg{data: data, timestamp: start.Add(time.Duration(offset) * time.Second)})
+			}
+		}
+		return js
+	}
+	newConsumer := func() *Consumer {
+		conn := &Conn{stationPartitions: map[string]*PartitionsUpdate{"station": {PartitionsList: []int{1, 2, 3}}}}
+		return &Consumer{
+			conn:               conn,
+			stationName:        "station",
+			BatchMaxTimeToWait: time.Second,
+			subscriptionActive: true,
+			PartitionGenerator: newRoundRobinGenerator([]int{1, 2, 3}),
+			jsConsumers: map[int]jetstream.Consumer{
+				1: partition(map[string]int{"a": 1, "c": 3}),
+				2: partition(map[string]int{"b": 2, "d": 4}),
+				3: &failingJsConsumer{err: errors.New("partition unavailable")},
+			},
+		}
+	}
+	data := func(msgs []*Msg) []string {
+		var out []string
+		for _, msg := range msgs {
+			out = append(out, string(msg.Data()))
+		}
+		return out
+	}
+
+	c := newConsumer()
+	c.dlsMsgs = []*Msg{newTestMsg("dls", nil)}
+	msgs, err := c.FetchAll(10)
+	if !errors.Is(err, ConsumerErrFetchFailed) {
+		t.Fatalf("expected the failing partition to be reported, got %v", err)
+	}
+	if got, want := data(msgs), []string{"dls", "a", "c", "b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("fetched %v, want %v", got, want)
+	}
+
+	msgs, _ = newConsumer().FetchAll(10, SortByPublishTime())
+	if got, want := data(msgs), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("fetched %v, want %v", got, want)
+	}
+
+	if _, err := newConsumer().FetchAll(10, ConsumerPartitionNumber(1)); err == nil {
+		t.Fatal("expected a partition number to be rejected")
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FilterExpr - only messages whose deserialized data matches the expression are passed on, the rest are acked and
+// skipped, e.g. FilterExpr("amount > 100 && region == 'eu'"). The expression is compiled once and evaluated client
+// side against each message, combined with && with a filter set before it. Expressions support:
+//
+//   - fields of the message, nested ones by dotted paths: customer.address.country
+//   - string, number, true, false and null literals: 'eu', "eu", -1.5
+//   - comparisons: == != < <= > >=, numbers compare numerically and strings lexicographically
+//   - && || ! and parentheses
+//
+// A missing field is null. Messages which can't be deserialized are passed on so their error reaches the handler.
+func FilterExpr(expr string) ConsumingOpt {
+	return func(opts *ConsumingOpts) error {
+		filter, err := compileFilterExpr(expr)
+		if err != nil {
+			return memphisError(err)
+		}
+		opts.Filter = andFilters(opts.Filter, filter)
+		return nil
+	}
+}
+
+// FetchFilterExpr - FilterExpr for FetchMessages.
+func FetchFilterExpr(expr string) FetchOpt {
+	return func(opts *FetchOpts) error {
+		filter, err := compileFilterExpr(expr)
+		if err != nil {
+			return memphisError(err)
+		}
+		opts.Filter = andFilters(opts.Filter, filter)
+		return nil
+	}
+}
+
+// andFilters - a filter passing on the messages both filters pass on.
+func andFilters(first, second MsgFilter) MsgFilter {
+	if first == nil {
+		return second
+	}
+	return func(m *Msg) bool {
+		return first(m) && second(m)
+	}
+}
+
+// exprNode - a compiled expression, evaluated against a deserialized message.
+type exprNode func(data interface{}) interface{}
+
+// compileFilterExpr - the filter of the expression expr.
+func compileFilterExpr(expr string) (MsgFilter, error) {
+	tokens, err := tokenizeExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression %q: %v", expr, err.Error())
+	}
+	p := exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression %q: %v", expr, err.Error())
+	}
+	return func(m *Msg) bool {
+		data, err := m.DataDeserialized()
+		if err != nil {
+			return true
+		}
+		return node(data) == true
+	}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// exprOperators - the operators, two character ones first so they are matched before their prefixes.
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func tokenizeExpr(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '\'' || ch == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(expr) && expr[j] != ch; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				sb.WriteByte(expr[j])
+			}
+			if j == len(expr) {
+				return nil, fmt.Errorf("unterminated string at %v", i)
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: sb.String(), pos: i})
+			i = j + 1
+		case isExprDigit(ch) || (ch == '-' && i+1 < len(expr) && (isExprDigit(expr[i+1]) || expr[i+1] == '.')) || ch == '.':
+			j := i + 1
+			for j < len(expr) && (isExprDigit(expr[j]) || strings.IndexByte(".eE", expr[j]) >= 0 || ((expr[j] == '-' || expr[j] == '+') && (expr[j-1] == 'e' || expr[j-1] == 'E'))) {
+				j++
+			}
+			if _, err := strconv.ParseFloat(expr[i:j], 64); err != nil {
+				return nil, fmt.Errorf("invalid number %v at %v", expr[i:j], i)
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: expr[i:j], pos: i})
+			i = j
+		case isExprIdentStart(ch):
+			j := i + 1
+			for j < len(expr) && (isExprIdentStart(expr[j]) || isExprDigit(expr[j]) || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: expr[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range exprOperators {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %v", ch, i)
+			}
+			tokens = append(tokens, exprToken{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: tokenEnd, pos: len(expr)}), nil
+}
+
+func isExprDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isExprIdentStart(ch byte) bool {
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// exprParser - a recursive descent parser compiling the tokens into exprNodes.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokenEnd {
+		return errors.New("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %v at %v", t.text, t.pos)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(data interface{}) interface{} {
+			return l(data) == true || right(data) == true
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(data interface{}) interface{} {
+			return l(data) == true && right(data) == true
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(data interface{}) interface{} {
+			return operand(data) != true
+		}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokenOp {
+		return left, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := t.text
+	return func(data interface{}) interface{} {
+		return compareExprValues(op, left(data), right(data))
+	}, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		value := t.text
+		return func(interface{}) interface{} { return value }, nil
+	case tokenNumber:
+		value, _ := strconv.ParseFloat(t.text, 64)
+		return func(interface{}) interface{} { return value }, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			value := t.text == "true"
+			return func(interface{}) interface{} { return value }, nil
+		case "null":
+			return func(interface{}) interface{} { return nil }, nil
+		}
+		path := strings.Split(t.text, ".")
+		for _, part := range path {
+			if part == "" {
+				return nil, fmt.Errorf("invalid field %v at %v", t.text, t.pos)
+			}
+		}
+		return func(data interface{}) interface{} {
+			return exprField(data, path)
+		}, nil
+	case tokenOp:
+		if t.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, p.unexpected()
+			}
+			return node, nil
+		}
+	}
+	if t.kind != tokenEnd {
+		p.pos--
+	}
+	return nil, p.unexpected()
+}
+
+// exprField - the value at path of the deserialized message data, nil when it is missing.
+func exprField(data interface{}, path []string) interface{} {
+	for _, part := range path {
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if data, ok = obj[part]; !ok {
+			return nil
+		}
+	}
+	return data
+}
+
+// compareExprValues - the result of comparing left and right with op. Values of different types are only ever not
+// equal, numbers serialized as strings by protojson compare as numbers.
+func compareExprValues(op string, left, right interface{}) bool {
+	_, leftNumber := left.(float64)
+	_, rightNumber := right.(float64)
+	if leftNumber || rightNumber {
+		l, lok := exprNumber(left)
+		r, rok := exprNumber(right)
+		if lok && rok {
+			return compareOrdered(op, l, r)
+		}
+		return op == "!="
+	}
+	switch l := left.(type) {
+	case string:
+		if r, ok := right.(string); ok {
+			return compareOrdered(op, l, r)
+		}
+	case bool:
+		if r, ok := right.(bool); ok && (op == "==" || op == "!=") {
+			return (l == r) == (op == "==")
+		}
+	case nil:
+		if op == "==" || op == "!=" {
+			return (right == nil) == (op == "==")
+		}
+		return false
+	}
+	return op == "!="
+}
+
+// exprNumber - v as a number, strings are numbers only when compared to a number.
+func exprNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func compareOrdered[T float64 | string](op string, l, r T) bool {
+	switch op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
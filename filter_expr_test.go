@@ -0,0 +1,81 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"testing"
+)
+
+func TestFilterExpr(t *testing.T) {
+	sd := schemaDetails{name: "order", schemaType: "json", activeVersion: SchemaVersion{Content: `{"type": "object"}`}}
+	if err := sd.compileJsonSchema(); err != nil {
+		t.Fatal(err)
+	}
+	msgs := materializeTestMsgs(t, sd, nil,
+		`{"amount": 150, "region": "eu", "customer": {"vip": true}}`,
+		`{"amount": 150, "region": "us"}`,
+		`{"amount": 50, "region": "eu", "note": null}`,
+		`{"amount": "200", "region": "eu"}`,
+	)
+	tests := []struct {
+		expr string
+		want []int
+	}{
+		{"amount > 100 && region == 'eu'", []int{0, 3}},
+		{`region != "eu" || amount <= 50`, []int{1, 2}},
+		{"!(amount >= 100)", []int{2}},
+		{"customer.vip == true", []int{0}},
+		{"customer.vip", []int{0}},
+		{"note == null", []int{0, 1, 2, 3}},
+		{"region > 'f'", []int{1}},
+		{"amount == -1.5e2 || amount == 1.5e2", []int{0, 1}},
+		{"region == 150", nil},
+	}
+	for _, test := range tests {
+		opts := getDefaultConsumingOptions()
+		if err := FilterExpr(test.expr)(&opts); err != nil {
+			t.Fatalf("%v: %v", test.expr, err)
+		}
+		var got []int
+		for i, m := range msgs {
+			if opts.Filter(m) {
+				got = append(got, i)
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%v matched %v, want %v", test.expr, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%v matched %v, want %v", test.expr, got, test.want)
+				break
+			}
+		}
+	}
+
+	opts := getDefaultConsumingOptions()
+	Filter(func(m *Msg) bool { return m != msgs[0] })(&opts)
+	FilterExpr("region == 'eu'")(&opts)
+	c := &Consumer{}
+	if filtered := c.filterMsgs(msgs, opts.Filter); len(filtered) != 2 || filtered[0] != msgs[2] {
+		t.Errorf("filtered %v messages, want the expression combined with the previous filter", len(filtered))
+	}
+
+	for _, expr := range []string{"", "amount >", "(amount > 1", "region == 'eu", "amount # 1", "a..b == 1", "amount > 1 region"} {
+		if err := FilterExpr(expr)(&opts); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}
@@ -13,6 +13,7 @@ require (
 	github.com/hamba/avro/v2 v2.13.0
 	github.com/santhosh-tekuri/jsonschema/v5 v5.1.0
 	github.com/spaolacci/murmur3 v1.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,159 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// ProduceInfo - the message a produce hook is called for.
+type ProduceInfo struct {
+	Station  string
+	Producer string
+	// Headers - the message's headers, a BeforeProduce hook can add to them, e.g. to propagate a trace context.
+	Headers *Headers
+	Async   bool
+}
+
+// HandleInfo - the batch a handle hook is called for.
+type HandleInfo struct {
+	Station       string
+	ConsumerGroup string
+	Consumer      string
+	Msgs          []*Msg
+	// Err - the fetch error handed to the handler along with the batch.
+	Err error
+}
+
+// Hooks - instrumentation points for APM integrations, every hook is optional. A Before hook returns the context
+// passed to its After hook and to the message handler, e.g. with a span. AfterProduce gets the broker's ack, nil for
+// async produces, and the produce error. AfterHandle gets the time the handler took.
+type Hooks struct {
+	BeforeProduce func(ctx context.Context, info ProduceInfo) context.Context
+	AfterProduce  func(ctx context.Context, info ProduceInfo, ack *ProduceAck, err error)
+	BeforeHandle  func(ctx context.Context, info HandleInfo) context.Context
+	AfterHandle   func(ctx context.Context, info HandleInfo, elapsed time.Duration)
+}
+
+// WithHooks - instruments the producers and consumers of the connection with hooks, several hooks can be set:
+// Before hooks are called in the order they were set and After hooks in the reverse order.
+func WithHooks(hooks Hooks) Option {
+	return func(o *Options) error {
+		o.Hooks = append(o.Hooks, hooks)
+		return nil
+	}
+}
+
+// Conn.beforeProduce - calls the BeforeProduce hooks, returns the context for afterProduce.
+func (c *Conn) beforeProduce(ctx context.Context, info ProduceInfo) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, hooks := range c.opts.Hooks {
+		if hooks.BeforeProduce != nil {
+			ctx = hooks.BeforeProduce(ctx, info)
+		}
+	}
+	return ctx
+}
+
+// Conn.afterProduce - calls the AfterProduce hooks.
+func (c *Conn) afterProduce(ctx context.Context, info ProduceInfo, ack *ProduceAck, err error) {
+	for i := len(c.opts.Hooks) - 1; i >= 0; i-- {
+		if hook := c.opts.Hooks[i].AfterProduce; hook != nil {
+			hook(ctx, info, ack, err)
+		}
+	}
+}
+
+// Producer.produceInfo - describes a message produced with opts to the hooks.
+func (p *Producer) produceInfo(opts *ProduceOpts) ProduceInfo {
+	if opts.MsgHeaders.MsgHeaders == nil {
+		opts.MsgHeaders.New()
+	}
+	station, _ := p.stationName.(string)
+	return ProduceInfo{Station: station, Producer: p.Name, Headers: &opts.MsgHeaders, Async: opts.AsyncProduce}
+}
+
+// Consumer.instrument - wraps handler with the connection's handle hooks.
+func (c *Consumer) instrument(handler ConsumeHandler) ConsumeHandler {
+	if c.conn == nil || len(c.conn.opts.Hooks) == 0 {
+		return handler
+	}
+	hooks := c.conn.opts.Hooks
+	clock := c.clock()
+	return func(msgs []*Msg, err error, ctx context.Context) {
+		info := HandleInfo{Station: c.stationName, ConsumerGroup: c.ConsumerGroup, Consumer: c.Name, Msgs: msgs, Err: err}
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		for _, h := range hooks {
+			if h.BeforeHandle != nil {
+				ctx = h.BeforeHandle(ctx, info)
+			}
+		}
+		start := clock.Now()
+		handler(msgs, err, ctx)
+		elapsed := clock.Now().Sub(start)
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if hooks[i].AfterHandle != nil {
+				hooks[i].AfterHandle(ctx, info, elapsed)
+			}
+		}
+	}
+}
+
+// FinishSpanFunc - ends a span, err is the result of the traced operation.
+type FinishSpanFunc func(err error)
+
+// StartSpanFunc - starts a span of an APM tracer as a child of the span in ctx, e.g. with the Datadog or New Relic
+// Go agents, returning the context holding it.
+type StartSpanFunc func(ctx context.Context, operation string, tags map[string]string) (context.Context, FinishSpanFunc)
+
+// spanKey - the context key of the finish function of a SpanHooks span, distinct for every SpanHooks.
+type spanKey struct{ _ byte }
+
+// SpanHooks - a reference integration tracing every produce as a "memphis.produce" span and every handled batch
+// as a "memphis.handle" span tagged with the station, producer or consumer group and batch size. A fetch error
+// handed to the handler finishes the handle span with it.
+func SpanHooks(start StartSpanFunc) Hooks {
+	key := &spanKey{}
+	finish := func(ctx context.Context, err error) {
+		if f, ok := ctx.Value(key).(FinishSpanFunc); ok {
+			f(err)
+		}
+	}
+	return Hooks{
+		BeforeProduce: func(ctx context.Context, info ProduceInfo) context.Context {
+			ctx, f := start(ctx, "memphis.produce", map[string]string{"station": info.Station, "producer": info.Producer})
+			return context.WithValue(ctx, key, f)
+		},
+		AfterProduce: func(ctx context.Context, info ProduceInfo, ack *ProduceAck, err error) {
+			finish(ctx, err)
+		},
+		BeforeHandle: func(ctx context.Context, info HandleInfo) context.Context {
+			ctx, f := start(ctx, "memphis.handle", map[string]string{
+				"station":        info.Station,
+				"consumer_group": info.ConsumerGroup,
+				"batch_size":     strconv.Itoa(len(info.Msgs)),
+			})
+			return context.WithValue(ctx, key, f)
+		},
+		AfterHandle: func(ctx context.Context, info HandleInfo, elapsed time.Duration) {
+			finish(ctx, info.Err)
+		},
+	}
+}
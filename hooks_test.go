@@ -0,0 +1,126 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSpanKey struct{}
+
+type recordedSpan struct {
+	operation string
+	tags      map[string]string
+	err       error
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []recordedSpan
+}
+
+func (r *spanRecorder) start(ctx context.Context, operation string, tags map[string]string) (context.Context, FinishSpanFunc) {
+	return context.WithValue(ctx, testSpanKey{}, operation), func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.spans = append(r.spans, recordedSpan{operation: operation, tags: tags, err: err})
+	}
+}
+
+func TestProduceHooks(t *testing.T) {
+	var calls []string
+	traceparent := Hooks{
+		BeforeProduce: func(ctx context.Context, info ProduceInfo) context.Context {
+			calls = append(calls, "before:"+info.Station+"/"+info.Producer)
+			info.Headers.Add("traceparent", "00-abc-def-01")
+			return ctx
+		},
+		AfterProduce: func(ctx context.Context, info ProduceInfo, ack *ProduceAck, err error) {
+			if ctx.Value(testSpanKey{}) != "memphis.produce" {
+				t.Errorf("the outer hook's context wasn't passed on")
+			}
+			calls = append(calls, "after:"+info.Producer)
+		},
+	}
+	spans := &spanRecorder{}
+	js := &ackingJetStream{released: make(chan struct{})}
+	close(js.released)
+	c := &Conn{
+		js:                 js,
+		opts:               Options{Hooks: []Hooks{SpanHooks(spans.start), traceparent}},
+		stationPartitions:  map[string]*PartitionsUpdate{},
+		stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {}},
+	}
+	p := &Producer{conn: c, Name: "checkout", stationName: "orders"}
+
+	ack, err := p.ProduceWithAck([]byte("a"))
+	if err != nil || ack == nil {
+		t.Fatalf("produce: %v %v", ack, err)
+	}
+	if _, err := p.ProduceBatch([]BatchMessage{{Payload: []byte("b")}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"before:orders/checkout", "after:checkout", "before:orders/checkout", "after:checkout"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("hooks called %v, want %v", calls, want)
+	}
+	for _, msg := range js.msgs {
+		if msg.Header.Get("traceparent") != "00-abc-def-01" {
+			t.Fatalf("the header added by the hook wasn't produced")
+		}
+	}
+	if len(spans.spans) != 2 || spans.spans[0].operation != "memphis.produce" || spans.spans[0].tags["station"] != "orders" {
+		t.Fatalf("recorded spans %+v", spans.spans)
+	}
+}
+
+func TestHandleHooks(t *testing.T) {
+	settled := make(chan string, 10)
+	c := newResultConsumer(settled, "a", "b")
+	c.Name, c.ConsumerGroup = "worker", "billing"
+	spans := &spanRecorder{}
+	handled := make(chan time.Duration, 1)
+	c.conn = &Conn{opts: Options{Hooks: []Hooks{SpanHooks(spans.start), {
+		AfterHandle: func(ctx context.Context, info HandleInfo, elapsed time.Duration) {
+			if len(info.Msgs) > 0 {
+				handled <- elapsed
+			}
+		},
+	}}}}
+
+	failure := errors.New("handler failed")
+	err := c.ConsumeWithResult(func(ctx context.Context, msgs []*Msg) error {
+		if ctx.Value(testSpanKey{}) != "memphis.handle" {
+			t.Errorf("the handler didn't get the span's context")
+		}
+		return failure
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopConsume()
+	collectSettled(t, settled, 2)
+	<-handled
+
+	spans.mu.Lock()
+	defer spans.mu.Unlock()
+	span := spans.spans[0]
+	if span.operation != "memphis.handle" || span.tags["consumer_group"] != "billing" || span.tags["batch_size"] != "2" {
+		t.Fatalf("unexpected span %+v", span)
+	}
+}
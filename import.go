@@ -0,0 +1,381 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ImportFormat - the format of a file imported with ImportFile.
+type ImportFormat int
+
+const (
+	// ImportCSV - comma separated values, the first row holds the column names.
+	ImportCSV ImportFormat = iota
+	// ImportNDJSON - newline delimited json, one json value per line.
+	ImportNDJSON
+)
+
+// ErrSkipRecord - returned by an ImportMapper to leave a record out of the import.
+var ErrSkipRecord = errors.New("skip record")
+
+// ImportRecord - a record read from an imported file.
+type ImportRecord struct {
+	// Line - the line the record starts at, 1 based
+	Line int64
+	// Offset - the byte offset the record starts at
+	Offset int64
+	// Raw - the record's bytes without the line break
+	Raw []byte
+	// Fields - the values of a csv record by column name, nil for ndjson
+	Fields map[string]string
+}
+
+// ImportMapper - turns a record into the message produced for it. The default mapper produces ndjson lines as
+// is and csv records as a json object of their fields, with an id made of the file name and the record's offset
+// so a resumed import doesn't produce a record twice within the station's idempotency window.
+type ImportMapper func(record ImportRecord) (BatchMessage, error)
+
+// ImportProgress - how far an import got.
+type ImportProgress struct {
+	// Records - the number of records produced
+	Records int64
+	// Skipped - the number of records the mapper skipped
+	Skipped int64
+	// Offset - the offset in bytes the import reached, a resumed import continues from it
+	Offset int64
+	// Size - the size in bytes of the file
+	Size int64
+}
+
+// ImportOpts - configuration options for ImportFile.
+type ImportOpts struct {
+	BatchSize      int
+	Progress       func(ImportProgress)
+	CheckpointFile string
+	ProduceOpts    []ProduceOpt
+}
+
+// ImportOpt - a function on the options for ImportFile.
+type ImportOpt func(*ImportOpts) error
+
+func getDefaultImportOpts() ImportOpts {
+	return ImportOpts{BatchSize: 500}
+}
+
+// ImportBatchSize - the number of records produced with a single ProduceBatch, defaults to 500.
+func ImportBatchSize(batchSize int) ImportOpt {
+	return func(opts *ImportOpts) error {
+		if batchSize < 1 {
+			return errors.New("import batch size has to be at least 1")
+		}
+		opts.BatchSize = batchSize
+		return nil
+	}
+}
+
+// ImportProgressHandler - called after every batch is produced.
+func ImportProgressHandler(handler func(ImportProgress)) ImportOpt {
+	return func(opts *ImportOpts) error {
+		opts.Progress = handler
+		return nil
+	}
+}
+
+// ImportCheckpointFile - saves the offset reached after every batch to path, an import started with an existing
+// checkpoint file resumes from its offset.
+func ImportCheckpointFile(path string) ImportOpt {
+	return func(opts *ImportOpts) error {
+		if path == "" {
+			return errors.New("import checkpoint file can not be empty")
+		}
+		opts.CheckpointFile = path
+		return nil
+	}
+}
+
+// ImportProduceOpts - options applied to every batch, e.g. MsgHeaders added to every message.
+func ImportProduceOpts(produceOpts ...ProduceOpt) ImportOpt {
+	return func(opts *ImportOpts) error {
+		opts.ProduceOpts = append(opts.ProduceOpts, produceOpts...)
+		return nil
+	}
+}
+
+// ImportFile - streams a csv or ndjson file into the producer's station in batches, mapper turns every record into
+// a message and can be nil for the default mapping. ctx bounds the import, the progress reached is returned along
+// with the error. A message the broker fails to store stops the import, the records of its batch before it are
+// produced and the checkpoint is kept before it, so the records after it in the batch are produced again on resume.
+func ImportFile(ctx context.Context, producer BatchProducer, path string, format ImportFormat, mapper ImportMapper, opts ...ImportOpt) (ImportProgress, error) {
+	importOpts := getDefaultImportOpts()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&importOpts); err != nil {
+				return ImportProgress{}, memphisError(err)
+			}
+		}
+	}
+	if producer == nil {
+		return ImportProgress{}, memphisError(errors.New("producer is required"))
+	}
+	if format != ImportCSV && format != ImportNDJSON {
+		return ImportProgress{}, memphisError(fmt.Errorf("unknown import format %v", format))
+	}
+	if mapper == nil {
+		mapper = defaultImportMapper(filepath.Base(path))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return ImportProgress{}, memphisError(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ImportProgress{}, memphisError(err)
+	}
+
+	reader := &importReader{reader: bufio.NewReader(f), format: format, line: 1}
+	if format == ImportCSV {
+		if err := reader.readHeader(); err != nil {
+			return ImportProgress{}, memphisError(err)
+		}
+	}
+	if importOpts.CheckpointFile != "" {
+		offset, line, err := readImportCheckpoint(importOpts.CheckpointFile)
+		if err != nil {
+			return ImportProgress{}, memphisError(err)
+		}
+		if offset > reader.offset {
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				return ImportProgress{}, memphisError(err)
+			}
+			reader.reader.Reset(f)
+			reader.offset, reader.line = offset, line
+		}
+	}
+
+	progress := ImportProgress{Offset: reader.offset, Size: info.Size()}
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, memphisError(err)
+		}
+		records, msgs, skipped, err := reader.readBatch(importOpts.BatchSize, mapper)
+		if err != nil {
+			return progress, memphisError(err)
+		}
+		if len(records) == 0 {
+			if skipped == 0 && reader.offset == progress.Offset {
+				return progress, nil
+			}
+			// trailing records were skipped or blank
+			progress.Skipped += skipped
+			progress.Offset = reader.offset
+			if err := importOpts.checkpoint(progress.Offset, reader.line); err != nil {
+				return progress, memphisError(err)
+			}
+			if importOpts.Progress != nil {
+				importOpts.Progress(progress)
+			}
+			return progress, nil
+		}
+
+		results, err := producer.ProduceBatch(msgs, append(append([]ProduceOpt(nil), importOpts.ProduceOpts...), ProduceContext(ctx))...)
+		if err != nil {
+			return progress, memphisError(err)
+		}
+		for i, result := range results {
+			if result.Err != nil {
+				progress.Offset = records[i].Offset
+				if err := importOpts.checkpoint(records[i].Offset, records[i].Line); err != nil {
+					return progress, memphisError(err)
+				}
+				return progress, memphisError(fmt.Errorf("line %v: %w", records[i].Line, result.Err))
+			}
+			progress.Records++
+		}
+		progress.Skipped += skipped
+		progress.Offset = reader.offset
+		if err := importOpts.checkpoint(progress.Offset, reader.line); err != nil {
+			return progress, memphisError(err)
+		}
+		if importOpts.Progress != nil {
+			importOpts.Progress(progress)
+		}
+	}
+}
+
+func defaultImportMapper(fileName string) ImportMapper {
+	return func(record ImportRecord) (BatchMessage, error) {
+		msg := BatchMessage{ID: fileName + ":" + strconv.FormatInt(record.Offset, 10)}
+		if record.Fields == nil {
+			msg.Payload = record.Raw
+			return msg, nil
+		}
+		payload, err := json.Marshal(record.Fields)
+		if err != nil {
+			return BatchMessage{}, err
+		}
+		msg.Payload = payload
+		return msg, nil
+	}
+}
+
+// ImportOpts.checkpoint - saves the offset and line to the checkpoint file, replacing it atomically.
+func (opts *ImportOpts) checkpoint(offset, line int64) error {
+	if opts.CheckpointFile == "" {
+		return nil
+	}
+	tmp := opts.CheckpointFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", offset, line)), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, opts.CheckpointFile)
+}
+
+func readImportCheckpoint(path string) (int64, int64, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 1, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var offset, line int64
+	if _, err := fmt.Sscanf(string(content), "%d %d", &offset, &line); err != nil {
+		return 0, 0, fmt.Errorf("invalid import checkpoint %v: %w", path, err)
+	}
+	return offset, line, nil
+}
+
+// importReader - reads the records of an imported file, keeping track of the offset and line they start at.
+type importReader struct {
+	reader  *bufio.Reader
+	format  ImportFormat
+	columns []string
+	offset  int64
+	line    int64
+}
+
+func (r *importReader) readHeader() error {
+	record, err := r.next()
+	if err == io.EOF {
+		return errors.New("csv file has no header")
+	}
+	if err != nil {
+		return err
+	}
+	r.columns, err = parseCSVRecord(record.Raw)
+	if err != nil {
+		return fmt.Errorf("line 1: %w", err)
+	}
+	return nil
+}
+
+// importReader.readBatch - reads records until batchSize messages are mapped or the file ends.
+func (r *importReader) readBatch(batchSize int, mapper ImportMapper) ([]ImportRecord, []BatchMessage, int64, error) {
+	var records []ImportRecord
+	var msgs []BatchMessage
+	var skipped int64
+	for len(msgs) < batchSize {
+		record, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if len(bytes.TrimSpace(record.Raw)) == 0 {
+			continue
+		}
+		if err := r.parse(&record); err != nil {
+			return nil, nil, 0, fmt.Errorf("line %v: %w", record.Line, err)
+		}
+		msg, err := mapper(record)
+		if errors.Is(err, ErrSkipRecord) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("line %v: %w", record.Line, err)
+		}
+		records = append(records, record)
+		msgs = append(msgs, msg)
+	}
+	return records, msgs, skipped, nil
+}
+
+func (r *importReader) parse(record *ImportRecord) error {
+	if r.format == ImportNDJSON {
+		if !json.Valid(record.Raw) {
+			return errors.New("invalid json")
+		}
+		return nil
+	}
+	values, err := parseCSVRecord(record.Raw)
+	if err != nil {
+		return err
+	}
+	if len(values) != len(r.columns) {
+		return fmt.Errorf("%v fields, the header has %v", len(values), len(r.columns))
+	}
+	record.Fields = make(map[string]string, len(values))
+	for i, value := range values {
+		record.Fields[r.columns[i]] = value
+	}
+	return nil
+}
+
+// importReader.next - reads the next record, a csv record with a quoted field spanning lines is read whole.
+func (r *importReader) next() (ImportRecord, error) {
+	record := ImportRecord{Line: r.line, Offset: r.offset}
+	var raw []byte
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if len(raw) > 0 && err == io.EOF {
+				return ImportRecord{}, fmt.Errorf("line %v: unterminated quoted field", record.Line)
+			}
+			return ImportRecord{}, err
+		}
+		if err != nil && err != io.EOF {
+			return ImportRecord{}, err
+		}
+		r.offset += int64(len(line))
+		r.line++
+		raw = append(raw, line...)
+		if r.format == ImportNDJSON || bytes.Count(raw, []byte{'"'})%2 == 0 || err == io.EOF {
+			break
+		}
+	}
+	record.Raw = bytes.TrimRight(raw, "\r\n")
+	return record, nil
+}
+
+func parseCSVRecord(raw []byte) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(string(raw)))
+	reader.FieldsPerRecord = -1
+	return reader.Read()
+}
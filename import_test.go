@@ -0,0 +1,120 @@
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// importRecordingProducer - a batch producer failing the message with the payload in failOn once.
+type importRecordingProducer struct {
+	produced []BatchMessage
+	failOn   string
+}
+
+func (p *importRecordingProducer) ProduceBatch(msgs []BatchMessage, opts ...ProduceOpt) ([]BatchResult, error) {
+	results := make([]BatchResult, len(msgs))
+	for i, msg := range msgs {
+		if string(msg.Payload.([]byte)) == p.failOn {
+			p.failOn = ""
+			results[i].Err = errors.New("rejected")
+			continue
+		}
+		p.produced = append(p.produced, msg)
+		results[i].Ack = &ProduceAck{Sequence: uint64(len(p.produced))}
+	}
+	return results, nil
+}
+
+func TestImportNDJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	content := "{\"id\":1}\n{\"id\":2}\n\n{\"id\":3}\n{\"id\":4}\n{\"id\":5}"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := filepath.Join(dir, "events.checkpoint")
+	p := &importRecordingProducer{failOn: `{"id":4}`}
+	var reports []ImportProgress
+	progress, err := ImportFile(context.Background(), p, path, ImportNDJSON, nil,
+		ImportBatchSize(2), ImportCheckpointFile(checkpoint),
+		ImportProgressHandler(func(progress ImportProgress) { reports = append(reports, progress) }))
+	if err == nil {
+		t.Fatal("expected the rejected message to stop the import")
+	}
+	if progress.Records != 3 || len(reports) != 1 || reports[0].Records != 2 {
+		t.Fatalf("progress %+v, reports %+v", progress, reports)
+	}
+
+	progress, err = ImportFile(context.Background(), p, path, ImportNDJSON, nil, ImportBatchSize(2), ImportCheckpointFile(checkpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Records != 2 || progress.Offset != int64(len(content)) || progress.Size != int64(len(content)) {
+		t.Fatalf("resumed progress %+v", progress)
+	}
+	var ids []int
+	for _, msg := range p.produced {
+		var v struct{ ID int }
+		json.Unmarshal(msg.Payload.([]byte), &v)
+		ids = append(ids, v.ID)
+	}
+	if len(ids) != 5 || ids[3] != 4 || ids[4] != 5 {
+		t.Fatalf("produced %v", ids)
+	}
+	if p.produced[0].ID != "events.ndjson:0" || p.produced[1].ID != "events.ndjson:9" {
+		t.Errorf("unexpected ids %q %q", p.produced[0].ID, p.produced[1].ID)
+	}
+
+	// a completed import resumes at the end of the file
+	if progress, err = ImportFile(context.Background(), p, path, ImportNDJSON, nil, ImportCheckpointFile(checkpoint)); err != nil || progress.Records != 0 {
+		t.Fatalf("rerun produced %d records, err = %v", progress.Records, err)
+	}
+
+	bad := filepath.Join(dir, "bad.ndjson")
+	os.WriteFile(bad, []byte("{\"id\":1}\nnot json\n"), 0o600)
+	if _, err := ImportFile(context.Background(), p, bad, ImportNDJSON, nil); err == nil {
+		t.Error("expected invalid json to fail the import")
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.csv")
+	content := "name,bio\nada,\"first line\nsecond line\"\nskip,me\r\nbob,\"says \"\"hi\"\"\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var lines []int64
+	p := &importRecordingProducer{}
+	progress, err := ImportFile(context.Background(), p, path, ImportCSV, func(record ImportRecord) (BatchMessage, error) {
+		if record.Fields["name"] == "skip" {
+			return BatchMessage{}, ErrSkipRecord
+		}
+		lines = append(lines, record.Line)
+		return BatchMessage{Payload: []byte(record.Fields["name"] + ": " + record.Fields["bio"])}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Records != 2 || progress.Skipped != 1 {
+		t.Fatalf("progress %+v", progress)
+	}
+	if got := string(p.produced[0].Payload.([]byte)); got != "ada: first line\nsecond line" {
+		t.Errorf("first record %q", got)
+	}
+	if got := string(p.produced[1].Payload.([]byte)); got != `bob: says "hi"` {
+		t.Errorf("second record %q", got)
+	}
+	if len(lines) != 2 || lines[0] != 2 || lines[1] != 5 {
+		t.Errorf("record lines %v, want [2 5]", lines)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ImportFile(ctx, p, path, ImportCSV, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
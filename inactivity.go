@@ -0,0 +1,48 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// InactiveThreshold - the broker removes the consumer group once none of its consumers fetched or acked messages
+// for d, so consumers of short-lived jobs which exit without Destroy don't leak. A consumer whose group was removed
+// stops with ConsumerErrStationUnreachable passed to its error handler.
+func InactiveThreshold(d time.Duration) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if d <= 0 {
+			return errors.New("inactive threshold has to be positive")
+		}
+		opts.InactiveThreshold = d
+		return nil
+	}
+}
+
+// applyInactiveThreshold - brings the consumer group's JetStream consumers in jsConsumers in line with the consumer's InactiveThreshold.
+func (c *Consumer) applyInactiveThreshold(jsConsumers map[int]jetstream.Consumer, options ...RequestOpt) error {
+	if c.inactiveThreshold == 0 {
+		return nil
+	}
+	return c.updateJetstreamConsumers(jsConsumers, func(cfg *jetstream.ConsumerConfig) bool {
+		if cfg.InactiveThreshold == c.inactiveThreshold {
+			return false
+		}
+		cfg.InactiveThreshold = c.inactiveThreshold
+		return true
+	}, options...)
+}
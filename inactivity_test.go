@@ -0,0 +1,58 @@
+package memphis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// consumerConfigJetStream - a broker recording the consumer updates.
+type consumerConfigJetStream struct {
+	jetstream.JetStream
+	updates []jetstream.ConsumerConfig
+}
+
+type cachedInfoConsumer struct {
+	jetstream.Consumer
+	info *jetstream.ConsumerInfo
+}
+
+func (c *cachedInfoConsumer) CachedInfo() *jetstream.ConsumerInfo {
+	return c.info
+}
+
+func (js *consumerConfigJetStream) UpdateConsumer(_ context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	js.updates = append(js.updates, cfg)
+	return &cachedInfoConsumer{info: &jetstream.ConsumerInfo{Stream: stream, Config: cfg}}, nil
+}
+
+func TestInactiveThreshold(t *testing.T) {
+	opts := getDefaultConsumerOptions()
+	if err := InactiveThreshold(0)(&opts); err == nil {
+		t.Error("expected a non positive threshold to be rejected")
+	}
+
+	js := &consumerConfigJetStream{}
+	c := &Consumer{
+		conn:              &Conn{js: js},
+		inactiveThreshold: time.Minute,
+		jsConsumers: map[int]jetstream.Consumer{
+			1: &cachedInfoConsumer{info: &jetstream.ConsumerInfo{Stream: "orders$1", Config: jetstream.ConsumerConfig{Durable: "cg"}}},
+			2: &cachedInfoConsumer{info: &jetstream.ConsumerInfo{Stream: "orders$2", Config: jetstream.ConsumerConfig{Durable: "cg", InactiveThreshold: time.Minute}}},
+		},
+	}
+	if err := c.applyInactiveThreshold(c.jsConsumers); err != nil {
+		t.Fatal(err)
+	}
+	if len(js.updates) != 1 || js.updates[0].InactiveThreshold != time.Minute || js.updates[0].Durable != "cg" {
+		t.Fatalf("expected only partition 1 to be updated, got %+v", js.updates)
+	}
+	if info := c.jsConsumers[1].CachedInfo(); info.Config.InactiveThreshold != time.Minute {
+		t.Error("expected the updated consumer to replace the partition's consumer")
+	}
+	if req := c.getCreationReq().(createConsumerReq); req.InactiveThresholdMillis != 60000 {
+		t.Errorf("unexpected inactive threshold in the creation request %v", req.InactiveThresholdMillis)
+	}
+}
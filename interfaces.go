@@ -0,0 +1,61 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"time"
+)
+
+// The interfaces below let application code depend on the producer, consumer and message
+// surface instead of the concrete types, so tests can inject fakes (hand written, generated
+// with mockgen/moq or the ones in the memphistest package).
+
+// Message - the message surface, implemented by *Msg.
+type Message interface {
+	Data() []byte
+	DataNoCopy() []byte
+	DataDeserialized() (any, error)
+	GetHeaders() map[string]string
+	GetSequenceNumber() (uint64, error)
+	Ack() error
+	Delay(duration time.Duration) error
+}
+
+// MessageProducer - the producer surface, implemented by *Producer.
+type MessageProducer interface {
+	Produce(message any, opts ...ProduceOpt) error
+	Destroy(options ...RequestOpt) error
+}
+
+// BatchProducer - a producer of message batches, implemented by *Producer.
+type BatchProducer interface {
+	ProduceBatch(msgs []BatchMessage, opts ...ProduceOpt) ([]BatchResult, error)
+}
+
+// MessageConsumer - the consumer surface, implemented by *Consumer.
+type MessageConsumer interface {
+	Consume(handlerFunc ConsumeHandler, opts ...ConsumingOpt) error
+	StopConsume()
+	Fetch(batchSize int, prefetch bool, opts ...ConsumingOpt) ([]*Msg, error)
+	SetContext(ctx context.Context)
+	Destroy(options ...RequestOpt) error
+}
+
+var (
+	_ Message         = (*Msg)(nil)
+	_ MessageProducer = (*Producer)(nil)
+	_ BatchProducer   = (*Producer)(nil)
+	_ MessageConsumer = (*Consumer)(nil)
+)
@@ -0,0 +1,449 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+// Package kafkacompat exposes sarama-like SyncProducer and ConsumerGroup APIs backed by memphis stations,
+// to migrate Kafka code bases call site by call site. Topics map to stations, message keys to partition
+// keys and offsets to station sequence numbers. Marking a message acks it, there are no offset commits.
+package kafkacompat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+)
+
+const keyHeader = "kafka-key"
+
+var (
+	ErrClosed = errors.New("kafkacompat: client is closed")
+)
+
+// Producer - the memphis producer surface used by the shim, implemented by *memphis.Producer.
+type Producer interface {
+	ProduceWithAck(message any, opts ...memphis.ProduceOpt) (*memphis.ProduceAck, error)
+	Destroy(options ...memphis.RequestOpt) error
+}
+
+// Backend - creates the memphis producers and consumers backing the shim.
+type Backend interface {
+	CreateProducer(stationName, name string) (Producer, error)
+	CreateConsumer(stationName, name string, opts ...memphis.ConsumerOpt) (memphis.MessageConsumer, error)
+}
+
+type connBackend struct {
+	conn *memphis.Conn
+}
+
+// ConnBackend - a Backend creating producers and consumers on a memphis connection.
+func ConnBackend(conn *memphis.Conn) Backend {
+	return connBackend{conn: conn}
+}
+
+func (b connBackend) CreateProducer(stationName, name string) (Producer, error) {
+	return b.conn.CreateProducer(stationName, name)
+}
+
+func (b connBackend) CreateConsumer(stationName, name string, opts ...memphis.ConsumerOpt) (memphis.MessageConsumer, error) {
+	return b.conn.CreateConsumer(stationName, name, opts...)
+}
+
+// Config - configuration of the shim's producers and consumer groups.
+type Config struct {
+	// ClientID - name of the memphis producers and prefix of the consumers' names
+	ClientID string
+	// BatchSize - max number of messages fetched at once by consumer groups
+	BatchSize int
+	// IdleWait - how long consumer groups wait before fetching again after an empty batch
+	IdleWait time.Duration
+	// ConsumerOpts - extra options of the memphis consumers created by consumer groups
+	ConsumerOpts []memphis.ConsumerOpt
+}
+
+// NewConfig - returns the default configuration.
+func NewConfig() *Config {
+	return &Config{
+		ClientID:  "kafkacompat",
+		BatchSize: 10,
+		IdleWait:  100 * time.Millisecond,
+	}
+}
+
+// RecordHeader - a message header.
+type RecordHeader struct {
+	Key   []byte
+	Value []byte
+}
+
+// ProducerMessage - a message to produce, Topic is the station name.
+type ProducerMessage struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers []RecordHeader
+
+	// set by the producer
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+}
+
+// SyncProducer - produces messages and waits for their acknowledgement.
+type SyncProducer interface {
+	SendMessage(msg *ProducerMessage) (partition int32, offset int64, err error)
+	SendMessages(msgs []*ProducerMessage) error
+	Close() error
+}
+
+type syncProducer struct {
+	backend   Backend
+	config    *Config
+	mu        sync.Mutex
+	producers map[string]Producer
+	closed    bool
+}
+
+// NewSyncProducer - creates a SyncProducer, one memphis producer is created per topic on first use.
+func NewSyncProducer(backend Backend, config *Config) (SyncProducer, error) {
+	if backend == nil {
+		return nil, errors.New("kafkacompat: backend is required")
+	}
+	if config == nil {
+		config = NewConfig()
+	}
+	return &syncProducer{backend: backend, config: config, producers: make(map[string]Producer)}, nil
+}
+
+func (p *syncProducer) producer(topic string) (Producer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	if producer, ok := p.producers[topic]; ok {
+		return producer, nil
+	}
+	producer, err := p.backend.CreateProducer(topic, p.config.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	p.producers[topic] = producer
+	return producer, nil
+}
+
+func (p *syncProducer) SendMessage(msg *ProducerMessage) (int32, int64, error) {
+	if msg.Topic == "" {
+		return 0, 0, errors.New("kafkacompat: message has no topic")
+	}
+	producer, err := p.producer(msg.Topic)
+	if err != nil {
+		return 0, 0, err
+	}
+	var hdrs memphis.Headers
+	hdrs.New()
+	for _, h := range msg.Headers {
+		if err := hdrs.Add(string(h.Key), string(h.Value)); err != nil {
+			return 0, 0, err
+		}
+	}
+	if msg.Key != nil {
+		if err := hdrs.Add(keyHeader, string(msg.Key)); err != nil {
+			return 0, 0, err
+		}
+	}
+	opts := []memphis.ProduceOpt{memphis.MsgHeaders(hdrs)}
+	if msg.Key != nil {
+		opts = append(opts, memphis.ProducerPartitionKey(string(msg.Key)))
+	}
+	ack, err := producer.ProduceWithAck(msg.Value, opts...)
+	if err != nil {
+		return 0, 0, err
+	}
+	msg.Partition = int32(ack.Partition)
+	msg.Offset = int64(ack.Sequence)
+	msg.Timestamp = ack.Timestamp
+	return msg.Partition, msg.Offset, nil
+}
+
+func (p *syncProducer) SendMessages(msgs []*ProducerMessage) error {
+	for _, msg := range msgs {
+		if _, _, err := p.SendMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *syncProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	var firstErr error
+	for _, producer := range p.producers {
+		if err := producer.Destroy(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ConsumerMessage - a consumed message, Topic is the station name and Offset its sequence number.
+type ConsumerMessage struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []*RecordHeader
+	Timestamp time.Time
+
+	msg *memphis.Msg
+}
+
+// ConsumerGroupSession - the state of a Consume call.
+type ConsumerGroupSession interface {
+	Claims() map[string][]int32
+	MemberID() string
+	// MarkMessage - acks the message, metadata is ignored
+	MarkMessage(msg *ConsumerMessage, metadata string)
+	Context() context.Context
+}
+
+// ConsumerGroupClaim - the messages of one topic, all partitions of a station are served by a single claim on partition 0.
+type ConsumerGroupClaim interface {
+	Topic() string
+	Partition() int32
+	Messages() <-chan *ConsumerMessage
+}
+
+// ConsumerGroupHandler - handles the claims of a session, ConsumeClaim runs in its own goroutine per claim.
+type ConsumerGroupHandler interface {
+	Setup(ConsumerGroupSession) error
+	Cleanup(ConsumerGroupSession) error
+	ConsumeClaim(ConsumerGroupSession, ConsumerGroupClaim) error
+}
+
+// ConsumerGroup - consumes topics as a memphis consumer group.
+type ConsumerGroup interface {
+	// Consume - runs a session until ctx is done or a ConsumeClaim call returns, then returns so it can be called again in a loop.
+	Consume(ctx context.Context, topics []string, handler ConsumerGroupHandler) error
+	Errors() <-chan error
+	Close() error
+}
+
+type consumerGroup struct {
+	backend   Backend
+	groupID   string
+	config    *Config
+	errors    chan error
+	mu        sync.Mutex
+	consumers map[string]memphis.MessageConsumer
+	closed    bool
+}
+
+// NewConsumerGroup - creates a consumer group, one memphis consumer of consumer group groupID is created per topic on first use.
+func NewConsumerGroup(backend Backend, groupID string, config *Config) (ConsumerGroup, error) {
+	if backend == nil {
+		return nil, errors.New("kafkacompat: backend is required")
+	}
+	if groupID == "" {
+		return nil, errors.New("kafkacompat: group id is required")
+	}
+	if config == nil {
+		config = NewConfig()
+	}
+	return &consumerGroup{
+		backend:   backend,
+		groupID:   groupID,
+		config:    config,
+		errors:    make(chan error, 16),
+		consumers: make(map[string]memphis.MessageConsumer),
+	}, nil
+}
+
+func (g *consumerGroup) Errors() <-chan error {
+	return g.errors
+}
+
+func (g *consumerGroup) consumer(topic string) (memphis.MessageConsumer, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil, ErrClosed
+	}
+	if consumer, ok := g.consumers[topic]; ok {
+		return consumer, nil
+	}
+	opts := append([]memphis.ConsumerOpt{memphis.ConsumerGroup(g.groupID)}, g.config.ConsumerOpts...)
+	consumer, err := g.backend.CreateConsumer(topic, fmt.Sprintf("%s-%s", g.config.ClientID, g.groupID), opts...)
+	if err != nil {
+		return nil, err
+	}
+	g.consumers[topic] = consumer
+	return consumer, nil
+}
+
+func (g *consumerGroup) Consume(ctx context.Context, topics []string, handler ConsumerGroupHandler) error {
+	if len(topics) == 0 {
+		return errors.New("kafkacompat: no topics to consume")
+	}
+	claims := make([]*claim, 0, len(topics))
+	for _, topic := range topics {
+		consumer, err := g.consumer(topic)
+		if err != nil {
+			return err
+		}
+		claims = append(claims, &claim{topic: topic, consumer: consumer, messages: make(chan *ConsumerMessage, g.config.BatchSize)})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sess := &session{ctx: ctx, memberID: fmt.Sprintf("%s-%s", g.config.ClientID, g.groupID), claims: make(map[string][]int32)}
+	for _, c := range claims {
+		sess.claims[c.topic] = []int32{0}
+	}
+	if err := handler.Setup(sess); err != nil {
+		return err
+	}
+
+	var fetchers, handlers sync.WaitGroup
+	handlerErrs := make(chan error, len(claims))
+	for _, c := range claims {
+		fetchers.Add(1)
+		go func(c *claim) {
+			defer fetchers.Done()
+			defer close(c.messages)
+			g.fetch(ctx, c)
+		}(c)
+		handlers.Add(1)
+		go func(c *claim) {
+			defer handlers.Done()
+			// a returning claim ends the session like a rebalance does
+			defer cancel()
+			if err := handler.ConsumeClaim(sess, c); err != nil {
+				handlerErrs <- err
+			}
+		}(c)
+	}
+	handlers.Wait()
+	cancel()
+	fetchers.Wait()
+
+	err := handler.Cleanup(sess)
+	close(handlerErrs)
+	if handlerErr := <-handlerErrs; handlerErr != nil {
+		return handlerErr
+	}
+	return err
+}
+
+// fetch - feeds the claim's messages until ctx is done.
+func (g *consumerGroup) fetch(ctx context.Context, c *claim) {
+	for ctx.Err() == nil {
+		msgs, err := c.consumer.Fetch(g.config.BatchSize, false)
+		if err != nil {
+			g.reportErr(err)
+		}
+		if len(msgs) == 0 {
+			timer := time.NewTimer(g.config.IdleWait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			select {
+			case c.messages <- newConsumerMessage(c.topic, msg):
+			case <-ctx.Done():
+				// unhandled messages are redelivered after the consumer's MaxAckTime
+				return
+			}
+		}
+	}
+}
+
+func (g *consumerGroup) reportErr(err error) {
+	select {
+	case g.errors <- err:
+	default:
+	}
+}
+
+func (g *consumerGroup) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	var firstErr error
+	for _, consumer := range g.consumers {
+		if err := consumer.Destroy(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func newConsumerMessage(topic string, msg *memphis.Msg) *ConsumerMessage {
+	cm := &ConsumerMessage{Topic: topic, Value: msg.Data(), msg: msg}
+	if seq, err := msg.GetSequenceNumber(); err == nil {
+		cm.Offset = int64(seq)
+	}
+	if publishedAt, err := msg.PublishedAt(); err == nil {
+		cm.Timestamp = publishedAt
+	}
+	for k, v := range msg.GetHeaders() {
+		if k == keyHeader {
+			cm.Key = []byte(v)
+			continue
+		}
+		cm.Headers = append(cm.Headers, &RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return cm
+}
+
+type session struct {
+	ctx      context.Context
+	memberID string
+	claims   map[string][]int32
+}
+
+func (s *session) Claims() map[string][]int32 { return s.claims }
+func (s *session) MemberID() string           { return s.memberID }
+func (s *session) Context() context.Context   { return s.ctx }
+
+func (s *session) MarkMessage(msg *ConsumerMessage, _ string) {
+	if msg.msg != nil {
+		_ = msg.msg.Ack()
+	}
+}
+
+type claim struct {
+	topic    string
+	consumer memphis.MessageConsumer
+	messages chan *ConsumerMessage
+}
+
+func (c *claim) Topic() string                     { return c.topic }
+func (c *claim) Partition() int32                  { return 0 }
+func (c *claim) Messages() <-chan *ConsumerMessage { return c.messages }
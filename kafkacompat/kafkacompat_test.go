@@ -0,0 +1,122 @@
+package kafkacompat
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+	"github.com/memphisdev/memphis.go/memphistest"
+)
+
+type brokerBackend struct {
+	broker *memphistest.Broker
+}
+
+func (b brokerBackend) CreateProducer(stationName, name string) (Producer, error) {
+	return b.broker.CreateProducer(stationName, name)
+}
+
+func (b brokerBackend) CreateConsumer(stationName, name string, opts ...memphis.ConsumerOpt) (memphis.MessageConsumer, error) {
+	return b.broker.CreateConsumer(stationName, name, opts...)
+}
+
+type collectingHandler struct {
+	mu       sync.Mutex
+	want     int
+	received []*ConsumerMessage
+	done     chan struct{}
+}
+
+func (h *collectingHandler) Setup(ConsumerGroupSession) error   { return nil }
+func (h *collectingHandler) Cleanup(ConsumerGroupSession) error { return nil }
+
+func (h *collectingHandler) ConsumeClaim(sess ConsumerGroupSession, claim ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		sess.MarkMessage(msg, "")
+		h.mu.Lock()
+		h.received = append(h.received, msg)
+		if len(h.received) == h.want {
+			close(h.done)
+		}
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+func TestSendMessageAck(t *testing.T) {
+	clock := memphistest.NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	backend := brokerBackend{broker: memphistest.NewBrokerWithClock(clock)}
+	producer, err := NewSyncProducer(backend, NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	msg := &ProducerMessage{Topic: "orders", Value: []byte("a")}
+	partition, offset, err := producer.SendMessage(msg)
+	if err != nil {
+		t.Fatalf("send with the default produce options: %v", err)
+	}
+	if partition != 1 || offset != 1 || msg.Partition != 1 || msg.Offset != 1 || !msg.Timestamp.Equal(clock.Now()) {
+		t.Fatalf("unexpected result %d %d %+v", partition, offset, msg)
+	}
+}
+
+func TestProduceAndConsumeGroup(t *testing.T) {
+	backend := brokerBackend{broker: memphistest.NewBroker()}
+	config := NewConfig()
+	config.IdleWait = 5 * time.Millisecond
+
+	producer, err := NewSyncProducer(backend, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	for i, value := range []string{"a", "b", "c"} {
+		_, offset, err := producer.SendMessage(&ProducerMessage{
+			Topic:   "orders",
+			Key:     []byte("customer-1"),
+			Value:   []byte(value),
+			Headers: []RecordHeader{{Key: []byte("source"), Value: []byte("legacy")}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != int64(i+1) {
+			t.Errorf("expected offset %d, got %d", i+1, offset)
+		}
+	}
+
+	group, err := NewConsumerGroup(backend, "billing", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer group.Close()
+
+	handler := &collectingHandler{want: 3, done: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	consumed := make(chan error, 1)
+	go func() { consumed <- group.Consume(ctx, []string{"orders"}, handler) }()
+
+	select {
+	case <-handler.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("messages were not consumed")
+	}
+	cancel()
+	if err := <-consumed; err != nil {
+		t.Fatal(err)
+	}
+
+	for i, msg := range handler.received {
+		if string(msg.Value) != []string{"a", "b", "c"}[i] || string(msg.Key) != "customer-1" || msg.Offset != int64(i+1) {
+			t.Errorf("unexpected message %+v", msg)
+		}
+		if len(msg.Headers) != 1 || string(msg.Headers[0].Key) != "source" {
+			t.Errorf("unexpected headers %+v", msg.Headers)
+		}
+	}
+}
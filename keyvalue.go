@@ -0,0 +1,301 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ErrKeyNotFound - the key doesn't exist in the key value bucket or was deleted.
+var ErrKeyNotFound = jetstream.ErrKeyNotFound
+
+// ErrRevisionMismatch - the key was created or updated concurrently, its latest revision isn't the expected one.
+var ErrRevisionMismatch = jetstream.ErrKeyExists
+
+// BucketOpts - configuration options for key value and object store buckets.
+type BucketOpts struct {
+	// Create - create the bucket when it doesn't exist.
+	Create      bool
+	TTL         time.Duration
+	History     uint8
+	Replicas    int
+	MaxBytes    int64
+	RequestOpts []RequestOpt
+}
+
+// BucketOpt - a function on the options for key value and object store buckets.
+type BucketOpt func(*BucketOpts) error
+
+// CreateBucket - create the bucket with the given options when it doesn't exist.
+func CreateBucket() BucketOpt {
+	return func(opts *BucketOpts) error {
+		opts.Create = true
+		return nil
+	}
+}
+
+// BucketTTL - how long the values of a created bucket are kept, default is forever.
+func BucketTTL(ttl time.Duration) BucketOpt {
+	return func(opts *BucketOpts) error {
+		if ttl < 0 {
+			return errors.New("bucket ttl can not be negative")
+		}
+		opts.TTL = ttl
+		return nil
+	}
+}
+
+// BucketHistory - the number of values kept per key of a created key value bucket, default is 1.
+func BucketHistory(history uint8) BucketOpt {
+	return func(opts *BucketOpts) error {
+		if history > jetstream.KeyValueMaxHistory {
+			return errors.New("bucket history is limited to 64 values")
+		}
+		opts.History = history
+		return nil
+	}
+}
+
+// BucketReplicas - the replicas of a created bucket, default is 1.
+func BucketReplicas(replicas int) BucketOpt {
+	return func(opts *BucketOpts) error {
+		opts.Replicas = replicas
+		return nil
+	}
+}
+
+// BucketMaxBytes - the size limit of a created bucket, default is unlimited.
+func BucketMaxBytes(maxBytes int64) BucketOpt {
+	return func(opts *BucketOpts) error {
+		opts.MaxBytes = maxBytes
+		return nil
+	}
+}
+
+// BucketRequestOpts - options for the requests on the bucket.
+func BucketRequestOpts(requestOpts ...RequestOpt) BucketOpt {
+	return func(opts *BucketOpts) error {
+		opts.RequestOpts = requestOpts
+		return nil
+	}
+}
+
+// getBucketOpts - the bucket options with opts applied.
+func getBucketOpts(opts ...BucketOpt) (BucketOpts, error) {
+	var defaultOpts BucketOpts
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return defaultOpts, memphisError(err)
+			}
+		}
+	}
+	return defaultOpts, nil
+}
+
+// KeyValue - a JetStream key value bucket, for small per station metadata, consumer checkpoints or feature flags.
+type KeyValue struct {
+	Bucket      string
+	kv          jetstream.KeyValue
+	requestOpts RequestOpts
+	timeout     time.Duration
+}
+
+// KVEntry - a value of a key.
+type KVEntry struct {
+	Key      string
+	Value    []byte
+	Revision uint64
+	Created  time.Time
+	// Deleted - the key was deleted, only set for watched entries.
+	Deleted bool
+}
+
+func newKVEntry(entry jetstream.KeyValueEntry) *KVEntry {
+	return &KVEntry{
+		Key:      entry.Key(),
+		Value:    entry.Value(),
+		Revision: entry.Revision(),
+		Created:  entry.Created(),
+		Deleted:  entry.Operation() != jetstream.KeyValuePut,
+	}
+}
+
+// Conn.KeyValue - the key value bucket, created with CreateBucket when it doesn't exist.
+func (c *Conn) KeyValue(bucket string, opts ...BucketOpt) (*KeyValue, error) {
+	bucketOpts, err := getBucketOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	requestOpts, err := getRequestOptions(bucketOpts.RequestOpts...)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	var cfg *jetstream.KeyValueConfig
+	if bucketOpts.Create {
+		cfg = &jetstream.KeyValueConfig{
+			Bucket:   bucket,
+			TTL:      bucketOpts.TTL,
+			History:  bucketOpts.History,
+			Replicas: bucketOpts.Replicas,
+			MaxBytes: bucketOpts.MaxBytes,
+		}
+	}
+	kv, err := c.keyValueBucket(bucket, cfg, requestOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyValue{
+		Bucket:      bucket,
+		kv:          kv,
+		requestOpts: requestOpts,
+		timeout:     c.operationTimeout(requestOpts, JetstreamOperationTimeout*time.Second),
+	}, nil
+}
+
+// Conn.DeleteKeyValue - deletes the key value bucket with all of its values.
+func (c *Conn) DeleteKeyValue(bucket string, options ...RequestOpt) error {
+	requestOpts, err := getRequestOptions(options...)
+	if err != nil {
+		return memphisError(err)
+	}
+	ctx, cancel := c.jetstreamContext(requestOpts)
+	defer cancel()
+	return memphisError(c.js.DeleteKeyValue(ctx, bucket))
+}
+
+// Conn.keyValueBucket - the key value bucket, created with cfg when it doesn't exist and cfg isn't nil.
+func (c *Conn) keyValueBucket(bucket string, cfg *jetstream.KeyValueConfig, requestOpts RequestOpts) (jetstream.KeyValue, error) {
+	ctx, cancel := c.jetstreamContext(requestOpts)
+	defer cancel()
+	kv, err := c.js.KeyValue(ctx, bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) && cfg != nil {
+		kv, err = c.js.CreateKeyValue(ctx, *cfg)
+	}
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return kv, nil
+}
+
+// KeyValue.context - ctx bounded by the operation timeout of the bucket.
+func (kv *KeyValue) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = kv.requestOpts.Context
+	}
+	return context.WithTimeout(ctx, kv.timeout)
+}
+
+// KeyValue.Get - the latest value of the key, ErrKeyNotFound when it doesn't exist.
+func (kv *KeyValue) Get(ctx context.Context, key string) (*KVEntry, error) {
+	ctx, cancel := kv.context(ctx)
+	defer cancel()
+	entry, err := kv.kv.Get(ctx, key)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return newKVEntry(entry), nil
+}
+
+// KeyValue.Put - sets the value of the key, returns its revision.
+func (kv *KeyValue) Put(ctx context.Context, key string, value []byte) (uint64, error) {
+	ctx, cancel := kv.context(ctx)
+	defer cancel()
+	revision, err := kv.kv.Put(ctx, key, value)
+	return revision, memphisError(err)
+}
+
+// KeyValue.Create - sets the value of a key which doesn't exist, ErrRevisionMismatch when it does.
+func (kv *KeyValue) Create(ctx context.Context, key string, value []byte) (uint64, error) {
+	ctx, cancel := kv.context(ctx)
+	defer cancel()
+	revision, err := kv.kv.Create(ctx, key, value)
+	return revision, memphisError(err)
+}
+
+// KeyValue.Update - sets the value of the key when its latest revision is the given one, ErrRevisionMismatch
+// otherwise.
+func (kv *KeyValue) Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	ctx, cancel := kv.context(ctx)
+	defer cancel()
+	revision, err := kv.kv.Update(ctx, key, value, revision)
+	return revision, memphisError(err)
+}
+
+// KeyValue.Delete - deletes the key, its history is kept until it is replaced by newer values.
+func (kv *KeyValue) Delete(ctx context.Context, key string) error {
+	ctx, cancel := kv.context(ctx)
+	defer cancel()
+	return memphisError(kv.kv.Delete(ctx, key))
+}
+
+// KeyValue.Keys - the keys of the bucket.
+func (kv *KeyValue) Keys(ctx context.Context) ([]string, error) {
+	ctx, cancel := kv.context(ctx)
+	defer cancel()
+	keys, err := kv.kv.Keys(ctx)
+	if errors.Is(err, jetstream.ErrNoKeysFound) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return keys, nil
+}
+
+// KeyValue.History - the kept values of the key, oldest first.
+func (kv *KeyValue) History(ctx context.Context, key string) ([]*KVEntry, error) {
+	ctx, cancel := kv.context(ctx)
+	defer cancel()
+	entries, err := kv.kv.History(ctx, key)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	history := make([]*KVEntry, 0, len(entries))
+	for _, entry := range entries {
+		history = append(history, newKVEntry(entry))
+	}
+	return history, nil
+}
+
+// KeyValue.Watch - calls handler with the latest values of the keys matching keys, which may contain the
+// wildcards * and >, then with every update until ctx is done.
+func (kv *KeyValue) Watch(ctx context.Context, keys string, handler func(*KVEntry)) error {
+	watcher, err := kv.kv.Watch(ctx, keys)
+	if err != nil {
+		return memphisError(err)
+	}
+	go func() {
+		defer watcher.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				// nil marks the end of the latest values
+				if entry != nil {
+					handler(newKVEntry(entry))
+				}
+			}
+		}
+	}()
+	return nil
+}
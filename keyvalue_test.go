@@ -0,0 +1,69 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestKeyValue(t *testing.T) {
+	js := &kvJetStream{buckets: map[string]*memKV{}}
+	c := &Conn{js: js}
+	if _, err := c.KeyValue("flags"); !errors.Is(err, jetstream.ErrBucketNotFound) {
+		t.Fatalf("opened a missing bucket, err=%v", err)
+	}
+	kv, err := c.KeyValue("flags", CreateBucket(), BucketHistory(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if keys, err := kv.Keys(ctx); err != nil || len(keys) != 0 {
+		t.Fatalf("keys of an empty bucket: %v, %v", keys, err)
+	}
+	revision, err := kv.Create(ctx, "orders.dark-launch", []byte("on"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Create(ctx, "orders.dark-launch", []byte("off")); !errors.Is(err, ErrRevisionMismatch) {
+		t.Fatalf("created an existing key, err=%v", err)
+	}
+	if _, err := kv.Update(ctx, "orders.dark-launch", []byte("off"), revision); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Update(ctx, "orders.dark-launch", []byte("on"), revision); !errors.Is(err, ErrRevisionMismatch) {
+		t.Fatalf("updated a stale revision, err=%v", err)
+	}
+	entry, err := kv.Get(ctx, "orders.dark-launch")
+	if err != nil || string(entry.Value) != "off" || entry.Revision != revision+1 {
+		t.Fatalf("got %+v, %v", entry, err)
+	}
+	if _, err := kv.Put(ctx, "billing.checkpoint", []byte("42")); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := kv.Keys(ctx); err != nil || !reflect.DeepEqual(keys, []string{"billing.checkpoint", "orders.dark-launch"}) {
+		t.Fatalf("keys %v, %v", keys, err)
+	}
+	if err := kv.Delete(ctx, "billing.checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Get(ctx, "billing.checkpoint"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("got a deleted key, err=%v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ScaleDirection - the direction of a scale recommendation.
+type ScaleDirection int
+
+const (
+	ScaleNone ScaleDirection = iota
+	ScaleUp
+	ScaleDown
+)
+
+func (d ScaleDirection) String() string {
+	switch d {
+	case ScaleUp:
+		return "up"
+	case ScaleDown:
+		return "down"
+	}
+	return "none"
+}
+
+// LagSample - the lag of a consumer group at a point in time.
+type LagSample struct {
+	Time time.Time `json:"time"`
+	// Pending - the messages not delivered to the group yet, by partition.
+	Pending map[int]uint64 `json:"pending"`
+	// AckPending - the messages delivered to the group and not acked yet, by partition.
+	AckPending map[int]int `json:"ack_pending"`
+	// Lag - the pending and ack pending messages of every partition.
+	Lag uint64 `json:"lag"`
+}
+
+// ScaleRecommendation - the number of consumers a LagWatcher recommends for a consumer group.
+type ScaleRecommendation struct {
+	Sample    LagSample      `json:"sample"`
+	Current   int            `json:"current"`
+	Desired   int            `json:"desired"`
+	Direction ScaleDirection `json:"-"`
+}
+
+// LagWatcherOpts - configuration options for a lag watcher.
+type LagWatcherOpts struct {
+	Interval             time.Duration
+	TargetLagPerConsumer uint64
+	MinConsumers         int
+	MaxConsumers         int
+	// ScaleDownSamples - the consecutive samples recommending fewer consumers before scaling down is recommended.
+	ScaleDownSamples int
+	RequestOpts      []RequestOpt
+}
+
+// LagWatcherOpt - a function on the options for a lag watcher.
+type LagWatcherOpt func(*LagWatcherOpts) error
+
+// LagSampleInterval - the time between samples of Watch, default is 15 seconds.
+func LagSampleInterval(interval time.Duration) LagWatcherOpt {
+	return func(opts *LagWatcherOpts) error {
+		if interval <= 0 {
+			return errors.New("lag sample interval has to be positive")
+		}
+		opts.Interval = interval
+		return nil
+	}
+}
+
+// TargetLagPerConsumer - the lag a single consumer is expected to keep up with, default is 1000 messages.
+func TargetLagPerConsumer(lag uint64) LagWatcherOpt {
+	return func(opts *LagWatcherOpts) error {
+		if lag == 0 {
+			return errors.New("target lag per consumer has to be positive")
+		}
+		opts.TargetLagPerConsumer = lag
+		return nil
+	}
+}
+
+// ConsumerReplicas - the bounds of the recommended number of consumers, default is 1 to the number of partitions
+// for partitioned stations and unbounded otherwise. max 0 means unbounded.
+func ConsumerReplicas(min, max int) LagWatcherOpt {
+	return func(opts *LagWatcherOpts) error {
+		if min < 0 || (max > 0 && max < min) {
+			return errors.New("invalid consumer replicas bounds")
+		}
+		opts.MinConsumers, opts.MaxConsumers = min, max
+		return nil
+	}
+}
+
+// ScaleDownSamples - the consecutive samples recommending fewer consumers before scaling down, so a short lull
+// doesn't scale the group down, default is 3.
+func ScaleDownSamples(samples int) LagWatcherOpt {
+	return func(opts *LagWatcherOpts) error {
+		if samples < 1 {
+			return errors.New("scale down samples has to be positive")
+		}
+		opts.ScaleDownSamples = samples
+		return nil
+	}
+}
+
+// LagWatcherRequestOpts - options for the requests sampling the consumer group.
+func LagWatcherRequestOpts(requestOpts ...RequestOpt) LagWatcherOpt {
+	return func(opts *LagWatcherOpts) error {
+		opts.RequestOpts = requestOpts
+		return nil
+	}
+}
+
+// LagWatcher - samples the lag of a consumer group on every partition of a station and recommends the number of
+// consumers to run, as autoscaling signals. Handler serves the latest recommendation for the KEDA metrics-api scaler.
+type LagWatcher struct {
+	conn          *Conn
+	station       string
+	consumerGroup string
+	opts          LagWatcherOpts
+
+	mu         sync.Mutex
+	belowCount int
+	last       *ScaleRecommendation
+}
+
+// Conn.NewLagWatcher - creates a lag watcher for a consumer group of a station.
+func (c *Conn) NewLagWatcher(stationName, consumerGroup string, opts ...LagWatcherOpt) (*LagWatcher, error) {
+	defaultOpts := LagWatcherOpts{Interval: 15 * time.Second, TargetLagPerConsumer: 1000, MinConsumers: 1, MaxConsumers: -1, ScaleDownSamples: 3}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	return &LagWatcher{conn: c, station: stationName, consumerGroup: consumerGroup, opts: defaultOpts}, nil
+}
+
+// LagWatcher.Sample - the current lag of the consumer group.
+func (w *LagWatcher) Sample() (LagSample, error) {
+	sample := LagSample{Time: w.conn.clock().Now(), Pending: map[int]uint64{}, AckPending: map[int]int{}}
+	partitions, err := w.conn.GetStationPartitions(w.station, w.opts.RequestOpts...)
+	if err != nil {
+		return sample, err
+	}
+	for _, partition := range partitions {
+		info, err := w.conn.consumerGroupInfo(partition.StreamName, w.consumerGroup, w.opts.RequestOpts...)
+		if err != nil {
+			return sample, err
+		}
+		sample.Pending[partition.Number] = info.NumPending
+		sample.AckPending[partition.Number] = info.NumAckPending
+		sample.Lag += info.NumPending + uint64(info.NumAckPending)
+	}
+	return sample, nil
+}
+
+// LagWatcher.Recommend - the number of consumers needed for the sample's lag given current consumers: one per
+// TargetLagPerConsumer messages within the replica bounds. Scaling down is only recommended after
+// ScaleDownSamples consecutive recommendations below current.
+func (w *LagWatcher) Recommend(sample LagSample, current int) ScaleRecommendation {
+	target := w.opts.TargetLagPerConsumer
+	desired := int((sample.Lag + target - 1) / target)
+	if desired < w.opts.MinConsumers {
+		desired = w.opts.MinConsumers
+	}
+	max := w.opts.MaxConsumers
+	if max < 0 && len(sample.Pending) > 1 {
+		// a partition is consumed by a single consumer of the group at a time
+		max = len(sample.Pending)
+	}
+	if max > 0 && desired > max {
+		desired = max
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	rec := ScaleRecommendation{Sample: sample, Current: current, Desired: desired}
+	switch {
+	case desired > current:
+		rec.Direction = ScaleUp
+		w.belowCount = 0
+	case desired < current:
+		if w.belowCount++; w.belowCount >= w.opts.ScaleDownSamples {
+			rec.Direction = ScaleDown
+			w.belowCount = 0
+		} else {
+			rec.Desired = current
+		}
+	default:
+		w.belowCount = 0
+	}
+	w.last = &rec
+	return rec
+}
+
+// LagWatcher.Watch - samples the lag every interval until ctx is done and calls handler with every recommendation,
+// current returns the number of consumers running. Sampling errors are passed to errHandler when it isn't nil.
+func (w *LagWatcher) Watch(ctx context.Context, current func() int, handler func(ScaleRecommendation), errHandler func(error)) {
+	ticker := w.conn.clock().NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		sample, err := w.Sample()
+		if err != nil {
+			if errHandler != nil {
+				errHandler(err)
+			}
+		} else if rec := w.Recommend(sample, current()); handler != nil {
+			handler(rec)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// LagWatcher.Handler - serves the latest recommendation as JSON, {"lag": ..., "desired": ..., ...}, for the KEDA
+// metrics-api scaler, e.g. with valueLocation "lag" and a target value of TargetLagPerConsumer. It responds with
+// 503 until a first sample was taken.
+func (w *LagWatcher) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w.mu.Lock()
+		last := w.last
+		w.mu.Unlock()
+		if last == nil {
+			http.Error(rw, "no lag sample yet", http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(map[string]any{
+			"station":        w.station,
+			"consumer_group": w.consumerGroup,
+			"lag":            last.Sample.Lag,
+			"pending":        last.Sample.Pending,
+			"ack_pending":    last.Sample.AckPending,
+			"current":        last.Current,
+			"desired":        last.Desired,
+			"direction":      last.Direction.String(),
+			"time":           last.Sample.Time,
+		})
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestLagWatcher(t *testing.T) {
+	js := &durablesJetStream{durables: map[string]*jetstream.ConsumerInfo{
+		"orders$1": {Config: jetstream.ConsumerConfig{Durable: "billing"}, NumPending: 2500, NumAckPending: 100},
+		"orders$2": {Config: jetstream.ConsumerConfig{Durable: "billing"}, NumPending: 400},
+	}}
+	c := &Conn{js: js, stationPartitions: map[string]*PartitionsUpdate{"orders": {PartitionsList: []int{1, 2}}}}
+	w, err := c.NewLagWatcher("orders", "billing", TargetLagPerConsumer(1000), ScaleDownSamples(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("served %v before a sample", rec.Code)
+	}
+
+	sample, err := w.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sample.Lag != 3000 || sample.Pending[1] != 2500 || sample.AckPending[1] != 100 {
+		t.Fatalf("unexpected sample %+v", sample)
+	}
+	// bounded by the number of partitions
+	if r := w.Recommend(sample, 1); r.Direction != ScaleUp || r.Desired != 2 {
+		t.Fatalf("recommended %v to %v, want up to 2", r.Direction, r.Desired)
+	}
+
+	js.durables["orders$1"].NumPending, js.durables["orders$1"].NumAckPending = 10, 0
+	if sample, err = w.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	if r := w.Recommend(sample, 2); r.Direction != ScaleNone || r.Desired != 2 {
+		t.Fatalf("scaled down after a single sample: %v to %v", r.Direction, r.Desired)
+	}
+	if r := w.Recommend(sample, 2); r.Direction != ScaleDown || r.Desired != 1 {
+		t.Fatalf("recommended %v to %v, want down to 1", r.Direction, r.Desired)
+	}
+
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var served struct {
+		Lag     uint64 `json:"lag"`
+		Desired int    `json:"desired"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&served); err != nil {
+		t.Fatal(err)
+	}
+	if served.Lag != 410 || served.Desired != 1 {
+		t.Fatalf("served %+v", served)
+	}
+
+	if _, err := c.NewLagWatcher("orders", "billing", ConsumerReplicas(3, 2)); err == nil {
+		t.Fatalf("created a lag watcher with invalid replica bounds")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	publishedAtHeader         = "$memphis_publishedAt"
+	deliveryLatencyMetric     = "memphis_consumer_delivery_latency_seconds"
+	metricsStationLabel       = "station"
+	metricsConsumerGroupLabel = "consumer_group"
+)
+
+var (
+	ConsumerErrNoPublishTimestamp = errors.New("message has no publish timestamp")
+)
+
+// lastPublishStamp - the last stamped publish time, stamps never go backwards within the process.
+var lastPublishStamp int64
+
+// publishStamp - the current time in unix nanoseconds, strictly greater than any previous stamp.
+func publishStamp() int64 {
+	for {
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&lastPublishStamp)
+		if now <= last {
+			now = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastPublishStamp, last, now) {
+			return now
+		}
+	}
+}
+
+// ProducerPublishTimestamp - stamp every produced message with its publish time, letting consumers compute
+// its delivery latency with Msg.Latency. Latencies are only as accurate as the clock sync between hosts.
+func ProducerPublishTimestamp() ProducerOpt {
+	return func(opts *ProducerOpts) error {
+		opts.PublishTimestamp = true
+		return nil
+	}
+}
+
+// Msg.PublishedAt - the publish time stamped by a producer created with ProducerPublishTimestamp.
+func (m *Msg) PublishedAt() (time.Time, error) {
+	var headers nats.Header
+	if msg, ok := m.msg.(*nats.Msg); ok {
+		headers = msg.Header
+	} else if jsMsg, ok := m.msg.(jetstream.Msg); ok {
+		headers = jsMsg.Headers()
+	}
+	values := headers[publishedAtHeader]
+	if len(values) == 0 {
+		return time.Time{}, memphisError(ConsumerErrNoPublishTimestamp)
+	}
+	nanos, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return time.Time{}, memphisError(err)
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// Msg.Latency - the time between the message's publish and its reception by the consumer.
+func (m *Msg) Latency() (time.Duration, error) {
+	publishedAt, err := m.PublishedAt()
+	if err != nil {
+		return 0, err
+	}
+	receivedAt := m.receivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	return receivedAt.Sub(publishedAt), nil
+}
+
+// recordLatency - records the delivery latency of a received message into the connection's metrics.
+func (c *Consumer) recordLatency(m *Msg) {
+	if c.conn == nil || c.conn.opts.Metrics == nil {
+		return
+	}
+	latency, err := m.Latency()
+	if err != nil {
+		return
+	}
+	c.conn.observeHistogram(deliveryLatencyMetric, map[string]string{
+		metricsStationLabel:       c.stationName,
+		metricsConsumerGroupLabel: c.ConsumerGroup,
+	}, latency.Seconds())
+}
@@ -0,0 +1,341 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const defaultLocksBucket = "memphis_locks"
+
+// ErrLockLost - the lock expired and was taken by another holder.
+var ErrLockLost = errors.New("lock was lost")
+
+// LockOpts - configuration options for locks and elections.
+type LockOpts struct {
+	Bucket string
+	// TTL - how long the lock is held without being renewed.
+	TTL         time.Duration
+	RequestOpts []RequestOpt
+}
+
+// LockOpt - a function on the options for locks and elections.
+type LockOpt func(*LockOpts) error
+
+// LockBucket - the key value bucket holding the locks, created if it doesn't exist, default is memphis_locks.
+func LockBucket(bucket string) LockOpt {
+	return func(opts *LockOpts) error {
+		opts.Bucket = bucket
+		return nil
+	}
+}
+
+// LockTTL - how long the lock is held without being renewed, default is 10 seconds.
+func LockTTL(ttl time.Duration) LockOpt {
+	return func(opts *LockOpts) error {
+		if ttl <= 0 {
+			return errors.New("lock ttl has to be positive")
+		}
+		opts.TTL = ttl
+		return nil
+	}
+}
+
+// LockRequestOpts - options for the requests on the key value bucket.
+func LockRequestOpts(requestOpts ...RequestOpt) LockOpt {
+	return func(opts *LockOpts) error {
+		opts.RequestOpts = requestOpts
+		return nil
+	}
+}
+
+// Lock - a distributed lock on a key of a JetStream key value bucket, held while it is renewed before its TTL
+// passes. Locks expire according to the clocks of their holders, so the clocks have to be synchronized well
+// within the TTL.
+type Lock struct {
+	Name   string
+	kv     jetstream.KeyValue
+	key    string
+	holder string
+	ttl    time.Duration
+	clock  Clock
+	// timeout - bounds the requests of elections.
+	timeout time.Duration
+
+	mu       sync.Mutex
+	revision uint64
+	expires  time.Time
+}
+
+type lockValue struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var invalidKeyCharsRegex = regexp.MustCompile(`[^-/_=.a-zA-Z0-9]`)
+
+// Conn.NewLock - a lock with the given name, the lock is not acquired.
+func (c *Conn) NewLock(name string, opts ...LockOpt) (*Lock, error) {
+	defaultOpts := LockOpts{Bucket: defaultLocksBucket, TTL: 10 * time.Second}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	if name == "" {
+		return nil, memphisError(errors.New("lock name can not be empty"))
+	}
+	requestOpts, err := getRequestOptions(defaultOpts.RequestOpts...)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	kv, err := c.keyValueBucket(defaultOpts.Bucket, &jetstream.KeyValueConfig{Bucket: defaultOpts.Bucket}, requestOpts)
+	if err != nil {
+		return nil, err
+	}
+	suffix, err := randomHex(4)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return &Lock{
+		Name:    name,
+		kv:      kv,
+		key:     invalidKeyCharsRegex.ReplaceAllString(name, "_"),
+		holder:  c.ConnId + "." + suffix,
+		ttl:     defaultOpts.TTL,
+		clock:   c.clock(),
+		timeout: c.operationTimeout(requestOpts, JetstreamOperationTimeout*time.Second),
+	}, nil
+}
+
+// Lock.TryAcquire - acquires the lock when no one holds it or its holder let it expire.
+func (l *Lock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var revision uint64
+	expires := l.clock.Now().Add(l.ttl)
+	entry, err := l.kv.Get(ctx, l.key)
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+		revision, err = l.kv.Create(ctx, l.key, l.value(expires))
+	case err != nil:
+		return false, memphisError(err)
+	default:
+		var current lockValue
+		if err := json.Unmarshal(entry.Value(), &current); err == nil && current.Holder != l.holder && l.clock.Now().Before(current.ExpiresAt) {
+			return false, nil
+		}
+		revision, err = l.kv.Update(ctx, l.key, l.value(expires), entry.Revision())
+	}
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		// another holder acquired it first
+		return false, nil
+	}
+	if err != nil {
+		return false, memphisError(err)
+	}
+	l.revision, l.expires = revision, expires
+	return true, nil
+}
+
+// Lock.Acquire - waits until the lock is acquired or ctx is done, trying every third of the TTL.
+func (l *Lock) Acquire(ctx context.Context) error {
+	ticker := l.clock.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		acquired, err := l.TryAcquire(ctx)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return memphisError(ctx.Err())
+		case <-ticker.C():
+		}
+	}
+}
+
+// Lock.Renew - extends the held lock by its TTL, fails with ErrLockLost when it was taken over.
+func (l *Lock) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.revision == 0 {
+		return memphisError(ErrLockLost)
+	}
+	expires := l.clock.Now().Add(l.ttl)
+	revision, err := l.kv.Update(ctx, l.key, l.value(expires), l.revision)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		l.revision = 0
+		return memphisError(ErrLockLost)
+	}
+	if err != nil {
+		return memphisError(err)
+	}
+	l.revision, l.expires = revision, expires
+	return nil
+}
+
+// Lock.Release - releases the held lock unless it was taken over.
+func (l *Lock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.revision == 0 {
+		return nil
+	}
+	err := l.kv.Delete(ctx, l.key, jetstream.LastRevision(l.revision))
+	if err != nil && !errors.Is(err, jetstream.ErrKeyExists) {
+		return memphisError(err)
+	}
+	l.revision = 0
+	return nil
+}
+
+// Lock.Held - whether the lock is held and didn't expire.
+func (l *Lock) Held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.revision != 0 && l.clock.Now().Before(l.expires)
+}
+
+// Lock.Expires - when the held lock expires unless it is renewed.
+func (l *Lock) Expires() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.expires
+}
+
+// Lock.value - the value of the lock held until expires.
+func (l *Lock) value(expires time.Time) []byte {
+	value, _ := json.Marshal(lockValue{Holder: l.holder, ExpiresAt: expires})
+	return value
+}
+
+// Election - elects a single leader among the instances campaigning with the same name, over a Lock.
+type Election struct {
+	lock *Lock
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// ElectedFunc - called when the instance is elected, it stays a follower when an error is returned.
+type ElectedFunc func() error
+
+// Conn.NewElection - an election with the given name.
+func (c *Conn) NewElection(name string, opts ...LockOpt) (*Election, error) {
+	lock, err := c.NewLock(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Election{lock: lock}, nil
+}
+
+// Election.Leader - whether the instance is the leader.
+func (e *Election) Leader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Election.Campaign - campaigns for the leadership until ctx is done, elected is called when the instance is
+// elected and resigned when it lost the leadership or ctx is done. The leader renews the lock every third of its
+// TTL, errors are passed to errHandler when it isn't nil.
+func (e *Election) Campaign(ctx context.Context, elected ElectedFunc, resigned func(), errHandler func(error)) {
+	ticker := e.lock.clock.NewTicker(e.lock.ttl / 3)
+	defer ticker.Stop()
+	for {
+		e.step(ctx, elected, resigned, errHandler)
+		select {
+		case <-ctx.Done():
+			e.resign(resigned, errHandler)
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// Election.step - acquires the lock and becomes the leader as a follower, renews it as the leader.
+func (e *Election) step(ctx context.Context, elected ElectedFunc, resigned func(), errHandler func(error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, e.lock.timeout)
+	defer cancel()
+	reportErr := func(err error) {
+		if errHandler != nil {
+			errHandler(err)
+		}
+	}
+	if !e.leader {
+		acquired, err := e.lock.TryAcquire(ctx)
+		if err != nil {
+			reportErr(err)
+		}
+		if !acquired {
+			return
+		}
+		if elected != nil {
+			if err := elected(); err != nil {
+				reportErr(err)
+				_ = e.lock.Release(ctx)
+				return
+			}
+		}
+		e.leader = true
+		return
+	}
+
+	err := e.lock.Renew(ctx)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, ErrLockLost) && e.lock.Held() {
+		// still the leader, renewing is retried on the next step
+		reportErr(err)
+		return
+	}
+	e.leader = false
+	if resigned != nil {
+		resigned()
+	}
+}
+
+// Election.resign - steps down as the leader, releasing the lock so another instance is elected right away.
+func (e *Election) resign(resigned func(), errHandler func(error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.leader {
+		return
+	}
+	e.leader = false
+	if resigned != nil {
+		resigned()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.lock.timeout)
+	defer cancel()
+	if err := e.lock.Release(ctx); err != nil && errHandler != nil {
+		errHandler(err)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// kvJetStream - holds in memory key value buckets.
+type kvJetStream struct {
+	jetstream.JetStream
+	buckets map[string]*memKV
+}
+
+func (js *kvJetStream) KeyValue(_ context.Context, bucket string) (jetstream.KeyValue, error) {
+	kv, ok := js.buckets[bucket]
+	if !ok {
+		return nil, jetstream.ErrBucketNotFound
+	}
+	return kv, nil
+}
+
+func (js *kvJetStream) CreateKeyValue(_ context.Context, cfg jetstream.KeyValueConfig) (jetstream.KeyValue, error) {
+	kv := newMemKV(cfg.Bucket)
+	js.buckets[cfg.Bucket] = kv
+	return kv, nil
+}
+
+// memKV - an in memory key value bucket with revisions.
+type memKV struct {
+	jetstream.KeyValue
+	mu       sync.Mutex
+	bucket   string
+	revision uint64
+	entries  map[string]*memKVEntry
+}
+
+type memKVEntry struct {
+	jetstream.KeyValueEntry
+	key      string
+	value    []byte
+	revision uint64
+}
+
+func (e *memKVEntry) Key() string        { return e.key }
+func (e *memKVEntry) Value() []byte      { return e.value }
+func (e *memKVEntry) Revision() uint64   { return e.revision }
+func (e *memKVEntry) Created() time.Time { return time.Time{} }
+func (e *memKVEntry) Operation() jetstream.KeyValueOp {
+	return jetstream.KeyValuePut
+}
+
+func newMemKV(bucket string) *memKV {
+	return &memKV{bucket: bucket, entries: map[string]*memKVEntry{}}
+}
+
+func (kv *memKV) Bucket() string { return kv.bucket }
+
+func (kv *memKV) Get(_ context.Context, key string) (jetstream.KeyValueEntry, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	entry, ok := kv.entries[key]
+	if !ok {
+		return nil, jetstream.ErrKeyNotFound
+	}
+	return entry, nil
+}
+
+func (kv *memKV) Put(ctx context.Context, key string, value []byte) (uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.put(key, value), nil
+}
+
+func (kv *memKV) put(key string, value []byte) uint64 {
+	kv.revision++
+	kv.entries[key] = &memKVEntry{key: key, value: value, revision: kv.revision}
+	return kv.revision
+}
+
+func (kv *memKV) Create(_ context.Context, key string, value []byte) (uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if _, ok := kv.entries[key]; ok {
+		return 0, jetstream.ErrKeyExists
+	}
+	return kv.put(key, value), nil
+}
+
+func (kv *memKV) Update(_ context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if entry, ok := kv.entries[key]; !ok || entry.revision != revision {
+		return 0, jetstream.ErrKeyExists
+	}
+	return kv.put(key, value), nil
+}
+
+func (kv *memKV) Keys(_ context.Context, _ ...jetstream.WatchOpt) ([]string, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if len(kv.entries) == 0 {
+		return nil, jetstream.ErrNoKeysFound
+	}
+	var keys []string
+	for key := range kv.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (kv *memKV) Delete(_ context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	delete(kv.entries, key)
+	return nil
+}
+
+func TestLock(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	js := &kvJetStream{buckets: map[string]*memKV{}}
+	newLock := func(connId string) *Lock {
+		c := &Conn{ConnId: connId, js: js, opts: Options{Clock: clock}}
+		lock, err := c.NewLock("reports/daily", LockTTL(6*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lock
+	}
+	first, second := newLock("a"), newLock("b")
+	if _, ok := js.buckets[defaultLocksBucket]; !ok {
+		t.Fatal("the locks bucket was not created")
+	}
+	ctx := context.Background()
+
+	if acquired, err := first.TryAcquire(ctx); err != nil || !acquired {
+		t.Fatalf("acquired=%v, err=%v", acquired, err)
+	}
+	if acquired, err := second.TryAcquire(ctx); err != nil || acquired {
+		t.Fatalf("a held lock was acquired again, err=%v", err)
+	}
+	clock.advance(4 * time.Second)
+	if err := first.Renew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(4 * time.Second)
+	if acquired, _ := second.TryAcquire(ctx); acquired {
+		t.Fatal("a renewed lock was acquired")
+	}
+	clock.advance(3 * time.Second)
+	if first.Held() {
+		t.Fatal("an expired lock is held")
+	}
+	if acquired, err := second.TryAcquire(ctx); err != nil || !acquired {
+		t.Fatalf("an expired lock wasn't acquired, err=%v", err)
+	}
+	if err := first.Renew(ctx); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("renewing a lost lock: %v", err)
+	}
+	if err := second.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Acquire(ctx); err != nil || !first.Held() {
+		t.Fatalf("a released lock wasn't acquired, err=%v", err)
+	}
+}
+
+func TestElection(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	js := &kvJetStream{buckets: map[string]*memKV{}}
+	var events []string
+	candidate := func(name string, fail bool) (*Election, func(context.Context)) {
+		c := &Conn{ConnId: name, js: js, opts: Options{Clock: clock}}
+		e, err := c.NewElection("scheduler", LockTTL(6*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		elected := func() error {
+			if fail {
+				return errors.New("not ready")
+			}
+			events = append(events, name)
+			return nil
+		}
+		resigned := func() { events = append(events, "-"+name) }
+		return e, func(ctx context.Context) { e.step(ctx, elected, resigned, nil) }
+	}
+	a, stepA := candidate("a", false)
+	b, stepB := candidate("b", false)
+	_, stepBroken := candidate("broken", true)
+	ctx := context.Background()
+
+	stepBroken(ctx) // releases after failing to start leading
+	stepA(ctx)
+	stepB(ctx)
+	if !a.Leader() || b.Leader() {
+		t.Fatalf("a leader=%v, b leader=%v", a.Leader(), b.Leader())
+	}
+	clock.advance(7 * time.Second)
+	stepB(ctx)
+	stepA(ctx)
+	if a.Leader() || !b.Leader() {
+		t.Fatalf("the leadership didn't move, a leader=%v, b leader=%v", a.Leader(), b.Leader())
+	}
+	b.resign(func() { events = append(events, "-b") }, nil)
+	stepA(ctx)
+	if want := []string{"a", "b", "-a", "-b", "a"}; !reflect.DeepEqual(events, want) {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+}
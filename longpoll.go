@@ -0,0 +1,72 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	defaultLongPollHeartbeat = 5 * time.Second
+	// longPollExpiry - how long a single long pull request stays open on the broker, heartbeats
+	// have to arrive at least twice within it.
+	longPollExpiry = 30 * time.Second
+)
+
+// ConsumerErrHeartbeatMissed - the broker's idle heartbeats stopped arriving on a long pull request,
+// the connection to the broker is most likely broken.
+var ConsumerErrHeartbeatMissed = errors.New("missed heartbeats from the broker")
+
+// LongPollHeartbeat - the idle heartbeat interval of the long pull requests issued in ConsumeModeLongPoll,
+// missing two heartbeats in a row is reported as ConsumerErrHeartbeatMissed. Defaults to 5 seconds.
+func LongPollHeartbeat(heartbeat time.Duration) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if heartbeat < 500*time.Millisecond || heartbeat > longPollExpiry/2 {
+			return fmt.Errorf("long poll heartbeat has to be between 500ms and %v", longPollExpiry/2)
+		}
+		opts.LongPollHeartbeat = heartbeat
+		return nil
+	}
+}
+
+// pullMessagesOpts - the options of the standing pull requests opened by the pipelined and long poll modes.
+func (c *Consumer) pullMessagesOpts(opts ConsumingOpts) []jetstream.PullMessagesOpt {
+	// the broker accepts either a message or a byte limit on a standing pull request, not both
+	var limit jetstream.PullMessagesOpt = jetstream.PullMaxMessages(c.BatchSize)
+	if opts.MaxBytes > 0 {
+		limit = jetstream.PullMaxBytes(opts.MaxBytes)
+	}
+	if c.consumeMode != ConsumeModeLongPoll {
+		return []jetstream.PullMessagesOpt{limit}
+	}
+	heartbeat := c.longPollHeartbeat
+	if heartbeat == 0 {
+		heartbeat = defaultLongPollHeartbeat
+	}
+	return []jetstream.PullMessagesOpt{limit, jetstream.PullExpiry(longPollExpiry), jetstream.PullHeartbeat(heartbeat)}
+}
+
+// pullError - translates an error of a standing pull request, a missed heartbeat is reported as a connectivity failure.
+// The pull request is reissued by the iterator on the next message so no further handling is needed.
+func (c *Consumer) pullError(partition int, err error) error {
+	if !errors.Is(err, jetstream.ErrNoHeartbeat) {
+		return err
+	}
+	c.conn.emit(Event{Type: EventFetchFailed, Station: c.stationName, Consumer: c.Name, Partition: partition, Err: err})
+	return fmt.Errorf("%w: %v", ConsumerErrHeartbeatMissed, err)
+}
@@ -0,0 +1,147 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// heartbeatIterator - a standing pull request which misses a heartbeat and then delivers a message.
+type heartbeatIterator struct {
+	jetstream.MessagesContext
+	results chan error
+	stopped chan struct{}
+}
+
+func (it *heartbeatIterator) Next() (jetstream.Msg, error) {
+	select {
+	case err, ok := <-it.results:
+		if ok && err != nil {
+			return nil, err
+		}
+		if ok {
+			return &ackRecordingMsg{data: []byte("msg")}, nil
+		}
+	case <-it.stopped:
+	}
+	<-it.stopped
+	return nil, jetstream.ErrMsgIteratorClosed
+}
+
+func (it *heartbeatIterator) Stop() {
+	select {
+	case <-it.stopped:
+	default:
+		close(it.stopped)
+	}
+}
+
+type messagesJsConsumer struct {
+	jetstream.Consumer
+	it   *heartbeatIterator
+	opts []jetstream.PullMessagesOpt
+}
+
+func (f *messagesJsConsumer) Messages(opts ...jetstream.PullMessagesOpt) (jetstream.MessagesContext, error) {
+	f.opts = opts
+	return f.it, nil
+}
+
+func TestConsumeLongPoll(t *testing.T) {
+	it := &heartbeatIterator{results: make(chan error, 2), stopped: make(chan struct{})}
+	it.results <- jetstream.ErrNoHeartbeat
+	it.results <- nil
+	js := &messagesJsConsumer{it: it}
+	var events []Event
+	c := &Consumer{
+		stationName:        "station",
+		BatchSize:          10,
+		PullInterval:       time.Millisecond,
+		subscriptionActive: true,
+		consumeMode:        ConsumeModeLongPoll,
+		longPollHeartbeat:  time.Second,
+		jsConsumers:        map[int]jetstream.Consumer{1: js},
+		conn:               &Conn{opts: Options{EventSink: func(e Event) { events = append(events, e) }}},
+	}
+
+	errs := make(chan error, 2)
+	received := make(chan int, 2)
+	err := c.Consume(func(msgs []*Msg, err error, _ context.Context) {
+		if err != nil {
+			errs <- err
+			return
+		}
+		received <- len(msgs)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ConsumerErrHeartbeatMissed) {
+			t.Fatalf("err = %v, want ConsumerErrHeartbeatMissed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the missed heartbeat was not reported")
+	}
+	select {
+	case n := <-received:
+		if n != 1 {
+			t.Fatalf("got %d msgs, want 1", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("consuming did not go on after the missed heartbeat")
+	}
+	c.StopConsume()
+
+	var heartbeat time.Duration
+	var expiry time.Duration
+	for _, opt := range js.opts {
+		switch o := opt.(type) {
+		case jetstream.PullHeartbeat:
+			heartbeat = time.Duration(o)
+		case jetstream.PullExpiry:
+			expiry = time.Duration(o)
+		}
+	}
+	if heartbeat != time.Second || expiry != longPollExpiry {
+		t.Fatalf("pull request heartbeat = %v expiry = %v", heartbeat, expiry)
+	}
+	if len(events) != 1 || events[0].Type != EventFetchFailed || events[0].Partition != 1 {
+		t.Fatalf("events = %+v", events)
+	}
+}
+
+func TestLongPollHeartbeat(t *testing.T) {
+	for _, heartbeat := range []time.Duration{100 * time.Millisecond, time.Minute} {
+		if err := LongPollHeartbeat(heartbeat)(&ConsumerOpts{}); err == nil {
+			t.Errorf("heartbeat %v should be rejected", heartbeat)
+		}
+	}
+	opts := ConsumerOpts{}
+	if err := LongPollHeartbeat(2 * time.Second)(&opts); err != nil || opts.LongPollHeartbeat != 2*time.Second {
+		t.Fatalf("heartbeat = %v, err = %v", opts.LongPollHeartbeat, err)
+	}
+
+	// the pipelined mode keeps the broker's defaults
+	c := &Consumer{BatchSize: 10, consumeMode: ConsumeModePipelined}
+	if opts := c.pullMessagesOpts(ConsumingOpts{}); len(opts) != 1 {
+		t.Fatalf("pipelined pull options = %v", opts)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphistest
+
+import (
+	"sync"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+)
+
+var _ memphis.Clock = (*FakeClock)(nil)
+
+// FakeClock - a memphis.Clock which only moves when Advance is called, safe for concurrent use.
+// Pass it to NewBrokerWithClock or to memphis.WithClock to drive pull intervals, redeliveries and
+// timeouts without sleeping.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters map[*fakeWaiter]struct{}
+}
+
+// fakeWaiter - a timer, or a ticker when period is set.
+type fakeWaiter struct {
+	clock    *FakeClock
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration
+}
+
+// NewFakeClock - creates a fake clock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now, waiters: make(map[*fakeWaiter]struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now - returns the fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance - moves the clock forward by d and fires the timers and tickers which became due.
+// Like time.Ticker, a ticker whose previous tick was not received drops the new ticks.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for w := range c.waiters {
+		if w.deadline.After(c.now) {
+			continue
+		}
+		w.fire(c.now)
+		if w.period == 0 {
+			delete(c.waiters, w)
+			continue
+		}
+		for !w.deadline.After(c.now) {
+			w.deadline = w.deadline.Add(w.period)
+		}
+	}
+	c.cond.Broadcast()
+}
+
+// BlockUntil - blocks until at least n timers and tickers are waiting on the clock, it lets a test
+// advance the clock only once the code under test scheduled its next wakeup.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// NewTimer - creates a timer firing once the clock was advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) memphis.Timer {
+	w := &fakeWaiter{clock: c, c: make(chan time.Time, 1)}
+	w.Reset(d)
+	return w
+}
+
+// NewTicker - creates a ticker firing every time the clock was advanced by d.
+func (c *FakeClock) NewTicker(d time.Duration) memphis.Ticker {
+	if d <= 0 {
+		panic("memphistest: non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{clock: c, c: make(chan time.Time, 1), period: d}
+	w.schedule(d)
+	return fakeTicker{w}
+}
+
+func (w *fakeWaiter) fire(now time.Time) {
+	select {
+	case w.c <- now:
+	default:
+	}
+}
+
+// schedule - registers the waiter to fire after d, it reports whether it was already waiting.
+func (w *fakeWaiter) schedule(d time.Duration) bool {
+	c := w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.waiters[w]
+	if d <= 0 && w.period == 0 {
+		delete(c.waiters, w)
+		w.fire(c.now)
+	} else {
+		w.deadline = c.now.Add(d)
+		c.waiters[w] = struct{}{}
+	}
+	c.cond.Broadcast()
+	return active
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	return w.schedule(d)
+}
+
+func (w *fakeWaiter) Stop() bool {
+	c := w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.waiters[w]
+	delete(c.waiters, w)
+	return active
+}
+
+type fakeTicker struct {
+	w *fakeWaiter
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.w.c
+}
+
+func (t fakeTicker) Stop() {
+	t.w.Stop()
+}
@@ -0,0 +1,81 @@
+package memphistest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	timer := clock.NewTimer(time.Second)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatalf("the timer fired early")
+	case <-ticker.C():
+		t.Fatalf("the ticker fired early")
+	default:
+	}
+	clock.Advance(time.Second)
+	if now := <-timer.C(); !now.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Fatalf("the timer fired at %v", now)
+	}
+	<-ticker.C()
+	if timer.Stop() {
+		t.Fatalf("stopping a fired timer reported it as active")
+	}
+	if timer.Reset(time.Second) {
+		t.Fatalf("resetting a fired timer reported it as active")
+	}
+	if !timer.Stop() {
+		t.Fatalf("stopping a pending timer reported it as inactive")
+	}
+	clock.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatalf("a stopped timer fired")
+	default:
+	}
+	<-ticker.C()
+}
+
+func TestBrokerWithFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := NewBrokerWithClock(clock)
+	p, _ := b.CreateProducer("orders", "svc")
+	p.Produce("a")
+
+	c, err := b.CreateConsumer("orders", "worker", memphis.PullInterval(time.Minute), memphis.MaxAckTime(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []*memphis.Msg, 1)
+	c.Consume(func(msgs []*memphis.Msg, err error, _ context.Context) {
+		received <- msgs
+	})
+	defer c.StopConsume()
+
+	if msgs := <-received; len(msgs) != 1 {
+		t.Fatalf("first pull got %d msgs", len(msgs))
+	}
+	// the message is not acked, it is redelivered once MaxAckTime passed on the fake clock
+	for i := 0; i < 59; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		if msgs := <-received; len(msgs) != 0 {
+			t.Fatalf("redelivered after %d minutes", i+1)
+		}
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	if msgs := <-received; len(msgs) != 1 || string(msgs[0].Data()) != "a" {
+		t.Fatalf("expected a to be redelivered after an hour, got %d msgs", len(msgs))
+	}
+}
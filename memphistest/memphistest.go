@@ -0,0 +1,695 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+// Package memphistest provides an in-memory stand-in for a memphis broker so application code
+// producing and consuming messages can be unit tested without a running broker.
+//
+// Producers and consumers created from a Broker implement memphis.MessageProducer and memphis.MessageConsumer,
+// accept the regular memphis options and hand out regular *memphis.Msg values. Consumers sharing a consumer group share the station's messages,
+// unacked messages are redelivered after MaxAckTime and moved to the station's dead letters after
+// MaxMsgDeliveries attempts, a consumer with a DLS handler receives the ones it dead letters. Schemas, partitions
+// and functions are not emulated.
+package memphistest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	ErrConsumerDestroyed = errors.New("consumer was destroyed")
+	ErrProducerDestroyed = errors.New("producer was destroyed")
+	ErrConsumeActive     = errors.New("consumer is already consuming")
+	ErrConsumeInactive   = errors.New("consumer is inactive")
+)
+
+var (
+	_ memphis.MessageProducer = (*Producer)(nil)
+	_ memphis.MessageConsumer = (*Consumer)(nil)
+)
+
+// Broker - in-memory memphis broker, safe for concurrent use.
+type Broker struct {
+	mu       sync.Mutex
+	stations map[string]*station
+	clock    memphis.Clock
+}
+
+type station struct {
+	name        string
+	msgs        []*storedMsg
+	msgIds      map[string]uint64
+	groups      map[string]*group
+	deadLetters []*storedMsg
+}
+
+type storedMsg struct {
+	seq       uint64
+	data      []byte
+	headers   nats.Header
+	timestamp time.Time
+}
+
+// group - delivery state of a consumer group, shared by all its consumers.
+type group struct {
+	cursor        int
+	consumerSeq   uint64
+	pending       map[uint64]*pendingMsg
+	maxAckTime    time.Duration
+	maxDeliveries int
+	maxAckPending int
+}
+
+type pendingMsg struct {
+	msg        *storedMsg
+	deliveries int
+	redeliver  time.Time
+}
+
+// NewBroker - creates an empty in-memory broker.
+func NewBroker() *Broker {
+	return NewBrokerWithClock(memphis.SystemClock())
+}
+
+// NewBrokerWithClock - creates an empty in-memory broker whose redeliveries, timestamps and consume
+// loops follow clock, use a FakeClock to drive them without sleeping.
+func NewBrokerWithClock(clock memphis.Clock) *Broker {
+	return &Broker{stations: make(map[string]*station), clock: clock}
+}
+
+func stationKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// getStation - must be called with the broker's lock held.
+func (b *Broker) getStation(name string) *station {
+	key := stationKey(name)
+	s, ok := b.stations[key]
+	if !ok {
+		s = &station{name: key, msgIds: make(map[string]uint64), groups: make(map[string]*group)}
+		b.stations[key] = s
+	}
+	return s
+}
+
+// CreateStation - creates a station, stations are also created implicitly by producers and consumers.
+func (b *Broker) CreateStation(name string, opts ...memphis.StationOpt) error {
+	stationOpts := memphis.GetStationDefaultOptions()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&stationOpts); err != nil {
+				return err
+			}
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.getStation(name)
+	return nil
+}
+
+// Messages - the payloads stored in the station, in production order.
+func (b *Broker) Messages(stationName string) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.getStation(stationName)
+	payloads := make([][]byte, len(s.msgs))
+	for i, msg := range s.msgs {
+		payloads[i] = msg.data
+	}
+	return payloads
+}
+
+// DeadLetters - the payloads which exceeded their consumer group's MaxMsgDeliveries.
+func (b *Broker) DeadLetters(stationName string) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.getStation(stationName)
+	payloads := make([][]byte, len(s.deadLetters))
+	for i, msg := range s.deadLetters {
+		payloads[i] = msg.data
+	}
+	return payloads
+}
+
+// Producer - in-memory counterpart of memphis.Producer.
+type Producer struct {
+	Name        string
+	broker      *Broker
+	stationName string
+	enricher    memphis.EnricherFunc
+	protoSchema *memphis.ProtoSchema
+	mu          sync.Mutex
+	destroyed   bool
+}
+
+// CreateProducer - creates a producer for the station.
+func (b *Broker) CreateProducer(stationName, name string, opts ...memphis.ProducerOpt) (*Producer, error) {
+	var producerOpts memphis.ProducerOpts
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&producerOpts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	b.mu.Lock()
+	b.getStation(stationName)
+	b.mu.Unlock()
+	return &Producer{Name: strings.ToLower(name), broker: b, stationName: stationName, enricher: producerOpts.Enricher,
+		protoSchema: producerOpts.ProtoSchema}, nil
+}
+
+func encodeMessage(message any) ([]byte, error) {
+	switch m := message.(type) {
+	case []byte:
+		return append([]byte(nil), m...), nil
+	case string:
+		return []byte(m), nil
+	default:
+		return json.Marshal(m)
+	}
+}
+
+// Produce - stores the message in the station. []byte and string messages are stored as is,
+// any other value is stored json encoded. Messages with a MsgId already stored are dropped.
+// A producer created with memphis.ProducerProtoSchema validates and serializes the messages with it.
+func (p *Producer) Produce(message any, opts ...memphis.ProduceOpt) error {
+	_, err := p.ProduceWithAck(message, opts...)
+	return err
+}
+
+// ProduceWithContext - stores the message like Produce unless ctx is already done.
+func (p *Producer) ProduceWithContext(ctx context.Context, message any, opts ...memphis.ProduceOpt) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.Produce(message, opts...)
+}
+
+// ProduceWithAck - stores the message like Produce and returns its acknowledgement, a message with an
+// already seen msg-id header is acknowledged as a duplicate with the sequence of the original. Like
+// memphis.Producer.ProduceWithAck, the message is stored before returning even with memphis.AsyncProduce.
+func (p *Producer) ProduceWithAck(message any, opts ...memphis.ProduceOpt) (*memphis.ProduceAck, error) {
+	p.mu.Lock()
+	destroyed := p.destroyed
+	p.mu.Unlock()
+	if destroyed {
+		return nil, ErrProducerDestroyed
+	}
+
+	produceOpts := memphis.GetProduceDefaultOptions()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&produceOpts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	produceOpts.AsyncProduce = false
+	if p.enricher != nil {
+		if err := p.enricher(&produceOpts.MsgHeaders); err != nil {
+			return nil, err
+		}
+	}
+	var data []byte
+	var err error
+	if p.protoSchema != nil {
+		data, err = p.protoSchema.Validate(message)
+	} else {
+		data, err = encodeMessage(message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	headers := nats.Header{}
+	for key, values := range produceOpts.MsgHeaders.MsgHeaders {
+		headers[key] = append([]string(nil), values...)
+	}
+	headers.Set("$memphis_producedBy", p.Name)
+
+	p.broker.mu.Lock()
+	defer p.broker.mu.Unlock()
+	s := p.broker.getStation(p.stationName)
+	ack := &memphis.ProduceAck{Stream: s.name, Partition: 1, Timestamp: p.broker.clock.Now()}
+	msgId := headers.Get("msg-id")
+	if seq, ok := s.msgIds[msgId]; ok && msgId != "" {
+		ack.Sequence = seq
+		ack.Duplicate = true
+		return ack, nil
+	}
+	ack.Sequence = uint64(len(s.msgs) + 1)
+	if msgId != "" {
+		s.msgIds[msgId] = ack.Sequence
+	}
+	s.msgs = append(s.msgs, &storedMsg{seq: ack.Sequence, data: data, headers: headers, timestamp: ack.Timestamp})
+	return ack, nil
+}
+
+// ProduceBatch - stores the messages in order like ProduceWithAck and returns the result of each one.
+func (p *Producer) ProduceBatch(msgs []memphis.BatchMessage, opts ...memphis.ProduceOpt) ([]memphis.BatchResult, error) {
+	results := make([]memphis.BatchResult, len(msgs))
+	for i, msg := range msgs {
+		msg := msg
+		batchMsgOpt := func(produceOpts *memphis.ProduceOpts) error {
+			headers := map[string][]string{}
+			for key, values := range produceOpts.MsgHeaders.MsgHeaders {
+				headers[key] = values
+			}
+			for key, values := range msg.Headers.MsgHeaders {
+				headers[key] = values
+			}
+			if msg.ID != "" {
+				headers["msg-id"] = []string{msg.ID}
+			}
+			produceOpts.MsgHeaders = memphis.Headers{MsgHeaders: headers}
+			return nil
+		}
+		results[i].Ack, results[i].Err = p.ProduceWithAck(msg.Payload, append(append([]memphis.ProduceOpt(nil), opts...), batchMsgOpt)...)
+		if results[i].Err == ErrProducerDestroyed {
+			return nil, ErrProducerDestroyed
+		}
+	}
+	return results, nil
+}
+
+// Destroy - destroys the producer, further Produce calls fail.
+func (p *Producer) Destroy(options ...memphis.RequestOpt) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.destroyed = true
+	return nil
+}
+
+// Consumer - in-memory counterpart of memphis.Consumer.
+type Consumer struct {
+	Name          string
+	ConsumerGroup string
+	BatchSize     int
+	PullInterval  time.Duration
+	broker        *Broker
+	stationName   string
+	errHandler    memphis.ConsumerErrHandler
+	mu            sync.Mutex
+	ctx           context.Context
+	consumeCancel context.CancelFunc
+	dlsHandler    memphis.ConsumeHandler
+	destroyed     bool
+}
+
+// CreateConsumer - creates a consumer for the station, consumers with the same ConsumerGroup share the messages.
+func (b *Broker) CreateConsumer(stationName, name string, opts ...memphis.ConsumerOpt) (*Consumer, error) {
+	consumerOpts := memphis.GetConsumerDefaultOptions()
+	consumerOpts.Name = name
+	consumerOpts.StationName = stationName
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&consumerOpts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if consumerOpts.ConsumerGroup == "" {
+		consumerOpts.ConsumerGroup = name
+	}
+
+	b.mu.Lock()
+	s := b.getStation(stationName)
+	groupName := strings.ToLower(consumerOpts.ConsumerGroup)
+	if _, ok := s.groups[groupName]; !ok {
+		g := &group{
+			pending:       make(map[uint64]*pendingMsg),
+			maxAckTime:    consumerOpts.MaxAckTime,
+			maxDeliveries: consumerOpts.MaxMsgDeliveries,
+			maxAckPending: consumerOpts.MaxAckPending,
+		}
+		switch {
+		case consumerOpts.StartConsumeFromNow:
+			g.cursor = len(s.msgs)
+		case consumerOpts.LastMessages >= 0:
+			if start := len(s.msgs) - int(consumerOpts.LastMessages); start > 0 {
+				g.cursor = start
+			}
+		case consumerOpts.StartConsumeFromSequence > 1:
+			g.cursor = int(consumerOpts.StartConsumeFromSequence) - 1
+			if g.cursor > len(s.msgs) {
+				g.cursor = len(s.msgs)
+			}
+		}
+		s.groups[groupName] = g
+	}
+	b.mu.Unlock()
+
+	return &Consumer{
+		Name:          strings.ToLower(name),
+		ConsumerGroup: groupName,
+		BatchSize:     consumerOpts.BatchSize,
+		PullInterval:  consumerOpts.PullInterval,
+		broker:        b,
+		stationName:   stationName,
+		errHandler:    consumerOpts.ErrHandler,
+		ctx:           context.Background(),
+	}, nil
+}
+
+// Fetch - returns up to batchSize messages without waiting, redeliveries first.
+func (c *Consumer) Fetch(batchSize int, prefetch bool, opts ...memphis.ConsumingOpt) ([]*memphis.Msg, error) {
+	consumingOpts := memphis.ConsumingOpts{ConsumerPartitionNumber: -1}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&consumingOpts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	c.mu.Lock()
+	destroyed := c.destroyed
+	c.mu.Unlock()
+	if destroyed {
+		return nil, ErrConsumerDestroyed
+	}
+
+	c.broker.mu.Lock()
+	s := c.broker.getStation(c.stationName)
+	g := s.groups[c.ConsumerGroup]
+	now := c.broker.clock.Now()
+	var delivered []*fakeMsg
+	var dead []*pendingMsg
+
+	pendingSeqs := make([]uint64, 0, len(g.pending))
+	for seq := range g.pending {
+		pendingSeqs = append(pendingSeqs, seq)
+	}
+	sort.Slice(pendingSeqs, func(i, j int) bool { return pendingSeqs[i] < pendingSeqs[j] })
+	for _, seq := range pendingSeqs {
+		p := g.pending[seq]
+		if len(delivered) >= batchSize {
+			break
+		}
+		if now.Before(p.redeliver) {
+			continue
+		}
+		if p.deliveries >= g.maxDeliveries {
+			delete(g.pending, seq)
+			s.deadLetters = append(s.deadLetters, p.msg)
+			dead = append(dead, p)
+			continue
+		}
+		delivered = append(delivered, c.deliver(g, p, now))
+	}
+	throttled := false
+	for len(delivered) < batchSize && g.cursor < len(s.msgs) {
+		if g.maxAckPending > 0 && len(g.pending) >= g.maxAckPending {
+			throttled = len(delivered) == 0
+			break
+		}
+		p := &pendingMsg{msg: s.msgs[g.cursor]}
+		g.cursor++
+		g.pending[p.msg.seq] = p
+		delivered = append(delivered, c.deliver(g, p, now))
+	}
+	c.broker.mu.Unlock()
+	if throttled && c.errHandler != nil {
+		c.errHandler(nil, memphis.ErrMaxAckPendingReached)
+	}
+	c.mu.Lock()
+	dlsHandler, handlerCtx := c.dlsHandler, c.ctx
+	c.mu.Unlock()
+	if dlsHandler != nil {
+		for _, p := range dead {
+			dlsMsg := &fakeMsg{consumer: c, msg: p.msg, deliveries: p.deliveries, dls: true}
+			dlsHandler([]*memphis.Msg{memphis.NewMsg(dlsMsg)}, nil, handlerCtx)
+		}
+	}
+
+	msgs := make([]*memphis.Msg, 0, len(delivered))
+	for _, fm := range delivered {
+		msg := memphis.NewMsg(fm)
+		if consumingOpts.Filter != nil && !consumingOpts.Filter(msg) {
+			msg.Ack()
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// FetchNoWait - same as Fetch, the fake broker never waits for a batch to fill up.
+func (c *Consumer) FetchNoWait(batchSize int, opts ...memphis.ConsumingOpt) ([]*memphis.Msg, error) {
+	return c.Fetch(batchSize, false, opts...)
+}
+
+// deliver - must be called with the broker's lock held.
+func (c *Consumer) deliver(g *group, p *pendingMsg, now time.Time) *fakeMsg {
+	p.deliveries++
+	p.redeliver = now.Add(g.maxAckTime)
+	g.consumerSeq++
+	return &fakeMsg{
+		consumer:    c,
+		msg:         p.msg,
+		consumerSeq: g.consumerSeq,
+		deliveries:  p.deliveries,
+	}
+}
+
+// ConsumeWithResult - like memphis.Consumer.ConsumeWithResult, each batch is settled with Msg.Settle
+// according to the handler's result.
+func (c *Consumer) ConsumeWithResult(handler memphis.ResultHandler, opts ...memphis.ConsumingOpt) error {
+	return c.consumeWithResult(func(ctx context.Context, msgs []*memphis.Msg) []error {
+		result := handler(ctx, msgs)
+		results := make([]error, len(msgs))
+		for i := range results {
+			results[i] = result
+		}
+		return results
+	}, opts)
+}
+
+// ConsumeEachWithResult - like memphis.Consumer.ConsumeEachWithResult, each message is settled with
+// Msg.Settle according to its own result.
+func (c *Consumer) ConsumeEachWithResult(handler memphis.MsgResultHandler, opts ...memphis.ConsumingOpt) error {
+	return c.consumeWithResult(func(ctx context.Context, msgs []*memphis.Msg) []error {
+		results := make([]error, len(msgs))
+		for i, msg := range msgs {
+			results[i] = handler(ctx, msg)
+		}
+		return results
+	}, opts)
+}
+
+func (c *Consumer) consumeWithResult(handle func(context.Context, []*memphis.Msg) []error, opts []memphis.ConsumingOpt) error {
+	var consumingOpts memphis.ConsumingOpts
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&consumingOpts); err != nil {
+				return err
+			}
+		}
+	}
+	return c.Consume(func(msgs []*memphis.Msg, err error, ctx context.Context) {
+		if err != nil && c.errHandler != nil {
+			c.errHandler(nil, err)
+		}
+		if len(msgs) == 0 {
+			return
+		}
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		for i, result := range handle(ctx, msgs) {
+			if err := msgs[i].Settle(result, consumingOpts.NakDelay); err != nil && c.errHandler != nil {
+				c.errHandler(nil, err)
+			}
+		}
+	}, opts...)
+}
+
+// Consume - calls handlerFunc every PullInterval with the next batch of messages, like memphis.Consumer.Consume
+// the handler is also called with empty batches.
+func (c *Consumer) Consume(handlerFunc memphis.ConsumeHandler, opts ...memphis.ConsumingOpt) error {
+	c.mu.Lock()
+	if c.destroyed {
+		c.mu.Unlock()
+		return ErrConsumerDestroyed
+	}
+	if c.consumeCancel != nil {
+		c.mu.Unlock()
+		return ErrConsumeActive
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.consumeCancel = cancel
+	c.mu.Unlock()
+
+	go func() {
+		timer := c.broker.clock.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C():
+			}
+			msgs, err := c.Fetch(c.BatchSize, false, opts...)
+			c.mu.Lock()
+			handlerCtx := c.ctx
+			c.mu.Unlock()
+			handlerFunc(msgs, err, handlerCtx)
+			timer.Reset(c.PullInterval)
+		}
+	}()
+	return nil
+}
+
+// StopConsume - stops the consume loop started by Consume, a handler call in progress completes.
+// It does not block so it can be called from within the handler.
+func (c *Consumer) StopConsume() {
+	c.mu.Lock()
+	cancel := c.consumeCancel
+	c.consumeCancel = nil
+	c.mu.Unlock()
+	if cancel == nil {
+		if c.errHandler != nil {
+			c.errHandler(nil, ErrConsumeInactive)
+		}
+		return
+	}
+	cancel()
+}
+
+// SetDLSHandler - set a handler for the messages this consumer moves to the dead letters, they carry the
+// dead-letter headers so Msg.IsDLS and Msg.DLSInfo work as with the broker, acking them is a no-op.
+func (c *Consumer) SetDLSHandler(handler memphis.ConsumeHandler) {
+	c.mu.Lock()
+	c.dlsHandler = handler
+	c.mu.Unlock()
+}
+
+// SetContext - set a context that will be passed to each message handler function call.
+func (c *Consumer) SetContext(ctx context.Context) {
+	c.mu.Lock()
+	c.ctx = ctx
+	c.mu.Unlock()
+}
+
+// Destroy - stops consuming, further Fetch and Consume calls fail.
+func (c *Consumer) Destroy(options ...memphis.RequestOpt) error {
+	c.mu.Lock()
+	active := c.consumeCancel != nil
+	c.destroyed = true
+	c.mu.Unlock()
+	if active {
+		c.StopConsume()
+	}
+	return nil
+}
+
+// fakeMsg - in-memory jetstream.Msg backing the delivered memphis messages.
+type fakeMsg struct {
+	consumer    *Consumer
+	msg         *storedMsg
+	consumerSeq uint64
+	deliveries  int
+	dls         bool
+}
+
+func (m *fakeMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{
+		Sequence:     jetstream.SequencePair{Consumer: m.consumerSeq, Stream: m.msg.seq},
+		NumDelivered: uint64(m.deliveries),
+		Timestamp:    m.msg.timestamp,
+		Stream:       m.consumer.stationName,
+		Consumer:     m.consumer.ConsumerGroup,
+	}, nil
+}
+
+func (m *fakeMsg) Data() []byte {
+	return m.msg.data
+}
+
+func (m *fakeMsg) Headers() nats.Header {
+	if !m.dls {
+		return m.msg.headers
+	}
+	headers := nats.Header{}
+	for key, values := range m.msg.headers {
+		headers[key] = values
+	}
+	headers.Set("$memphis_pm_id", strconv.FormatUint(m.msg.seq, 10))
+	headers.Set("$memphis_pm_cg_name", m.consumer.ConsumerGroup)
+	return headers
+}
+
+func (m *fakeMsg) Subject() string {
+	return m.consumer.stationName
+}
+
+func (m *fakeMsg) Reply() string {
+	return ""
+}
+
+// settle - applies fn to the message's pending entry if this delivery is still the current one.
+func (m *fakeMsg) settle(fn func(g *group, p *pendingMsg)) error {
+	if m.dls {
+		return nil
+	}
+	b := m.consumer.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g := b.getStation(m.consumer.stationName).groups[m.consumer.ConsumerGroup]
+	p, ok := g.pending[m.msg.seq]
+	if !ok || p.deliveries != m.deliveries {
+		return errors.New("message was already acknowledged or redelivered")
+	}
+	fn(g, p)
+	return nil
+}
+
+func (m *fakeMsg) Ack() error {
+	return m.settle(func(g *group, p *pendingMsg) {
+		delete(g.pending, m.msg.seq)
+	})
+}
+
+func (m *fakeMsg) DoubleAck(context.Context) error {
+	return m.Ack()
+}
+
+func (m *fakeMsg) Nak() error {
+	return m.NakWithDelay(0)
+}
+
+func (m *fakeMsg) NakWithDelay(delay time.Duration) error {
+	return m.settle(func(g *group, p *pendingMsg) {
+		p.redeliver = m.consumer.broker.clock.Now().Add(delay)
+	})
+}
+
+func (m *fakeMsg) InProgress() error {
+	return m.settle(func(g *group, p *pendingMsg) {
+		p.redeliver = m.consumer.broker.clock.Now().Add(g.maxAckTime)
+	})
+}
+
+func (m *fakeMsg) Term() error {
+	return m.Ack()
+}
@@ -0,0 +1,331 @@
+package memphistest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	memphis "github.com/memphisdev/memphis.go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestProduceFetchAck(t *testing.T) {
+	b := NewBroker()
+	p, err := b.CreateProducer("orders", "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdrs := memphis.Headers{}
+	hdrs.New()
+	hdrs.Add("kind", "created")
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := p.Produce(msg, memphis.MsgHeaders(hdrs)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Produce("a-again", memphis.MsgId("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Produce("a-dup", memphis.MsgId("a")); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(b.Messages("orders")); got != 4 {
+		t.Fatalf("stored %d messages, want 4", got)
+	}
+
+	c, err := b.CreateConsumer("orders", "worker", memphis.MaxAckTime(50*time.Millisecond), memphis.MaxMsgDeliveries(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := c.Fetch(2, false)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("fetch: %d msgs, err=%v", len(msgs), err)
+	}
+	if string(msgs[0].Data()) != "a" || msgs[0].GetHeaders()["kind"] != "created" {
+		t.Fatalf("unexpected message %q %v", msgs[0].Data(), msgs[0].GetHeaders())
+	}
+	if seq, _ := msgs[1].GetSequenceNumber(); seq != 2 {
+		t.Fatalf("sequence = %d, want 2", seq)
+	}
+	msgs[0].Ack()
+
+	// b is not acked, it is redelivered after MaxAckTime and dead lettered after MaxMsgDeliveries
+	time.Sleep(60 * time.Millisecond)
+	msgs, _ = c.Fetch(10, false)
+	if len(msgs) != 3 || string(msgs[0].Data()) != "b" {
+		t.Fatalf("expected b to be redelivered first, got %d msgs", len(msgs))
+	}
+	for _, msg := range msgs[1:] {
+		msg.Ack()
+	}
+	time.Sleep(60 * time.Millisecond)
+	if msgs, _ = c.Fetch(10, false); len(msgs) != 0 {
+		t.Fatalf("expected no messages, got %d", len(msgs))
+	}
+	if dls := b.DeadLetters("orders"); len(dls) != 1 || string(dls[0]) != "b" {
+		t.Fatalf("dead letters = %q", dls)
+	}
+}
+
+func TestConsumerGroupsAndConsume(t *testing.T) {
+	b := NewBroker()
+	p, _ := b.CreateProducer("events", "svc")
+	for i := 0; i < 10; i++ {
+		p.Produce([]byte{byte(i)})
+	}
+
+	c1, _ := b.CreateConsumer("events", "c1", memphis.ConsumerGroup("g"), memphis.PullInterval(5*time.Millisecond), memphis.BatchSize(3))
+	c2, _ := b.CreateConsumer("events", "c2", memphis.ConsumerGroup("g"), memphis.PullInterval(5*time.Millisecond), memphis.BatchSize(3))
+	other, _ := b.CreateConsumer("events", "other")
+
+	var mu sync.Mutex
+	seen := map[byte]int{}
+	done := make(chan struct{})
+	handler := func(msgs []*memphis.Msg, err error, ctx context.Context) {
+		if ctx.Value("key") != "value" {
+			t.Errorf("handler context was not passed")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range msgs {
+			seen[msg.Data()[0]]++
+			msg.Ack()
+		}
+		if len(seen) == 10 {
+			select {
+			case <-done:
+			default:
+				close(done)
+			}
+		}
+	}
+	for _, c := range []*Consumer{c1, c2} {
+		c.SetContext(context.WithValue(context.Background(), "key", "value"))
+		if err := c.Consume(handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("messages were not consumed")
+	}
+	c1.StopConsume()
+	c2.Destroy()
+
+	mu.Lock()
+	for v, count := range seen {
+		if count != 1 {
+			t.Errorf("message %d delivered %d times within the group", v, count)
+		}
+	}
+	mu.Unlock()
+
+	if msgs, _ := other.Fetch(20, false); len(msgs) != 10 {
+		t.Errorf("another group got %d messages, want 10", len(msgs))
+	}
+	if _, err := c2.Fetch(1, false); err != ErrConsumerDestroyed {
+		t.Errorf("fetch after destroy: %v", err)
+	}
+}
+
+func TestStartConsumeFromNow(t *testing.T) {
+	b := NewBroker()
+	p, _ := b.CreateProducer("orders", "svc")
+	p.Produce("backlog")
+	c, err := b.CreateConsumer("orders", "worker", memphis.StartConsumeFromNow())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Produce("new")
+	msgs, _ := c.Fetch(10, false)
+	if len(msgs) != 1 || string(msgs[0].Data()) != "new" {
+		t.Fatalf("fetched %d messages, want only the one produced after the consumer was created", len(msgs))
+	}
+}
+
+func TestProduceWithAck(t *testing.T) {
+	b := NewBroker()
+	p, err := b.CreateProducer("orders", "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := p.ProduceWithAck("a", memphis.MsgId("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.ProduceWithAck("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup, err := p.ProduceWithAck("a-dup", memphis.MsgId("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Sequence != 1 || second.Sequence != 2 || first.Duplicate || second.Duplicate {
+		t.Fatalf("unexpected acks %+v %+v", first, second)
+	}
+	if !dup.Duplicate || dup.Sequence != first.Sequence {
+		t.Fatalf("expected a duplicate ack of sequence 1, got %+v", dup)
+	}
+	async, err := p.ProduceWithAck("c", memphis.AsyncProduce())
+	if err != nil || async.Sequence != 3 {
+		t.Fatalf("AsyncProduce should be ignored, got %+v %v", async, err)
+	}
+}
+
+func TestMaxAckPending(t *testing.T) {
+	b := NewBroker()
+	p, _ := b.CreateProducer("orders", "svc")
+	for _, msg := range []string{"a", "b", "c"} {
+		p.Produce(msg)
+	}
+	var reported []error
+	c, err := b.CreateConsumer("orders", "worker", memphis.MaxAckPending(2),
+		memphis.ConsumerErrorHandler(func(_ *memphis.Consumer, err error) { reported = append(reported, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := c.Fetch(10, false)
+	if len(msgs) != 2 {
+		t.Fatalf("fetched %d messages, want 2", len(msgs))
+	}
+	if msgs, _ := c.Fetch(10, false); len(msgs) != 0 {
+		t.Fatalf("fetched %d messages above the limit", len(msgs))
+	}
+	if len(reported) != 1 || reported[0] != memphis.ErrMaxAckPendingReached {
+		t.Fatalf("reported %v", reported)
+	}
+	msgs[0].Ack()
+	if msgs, _ := c.Fetch(10, false); len(msgs) != 1 || string(msgs[0].Data()) != "c" {
+		t.Fatalf("expected c once a message was acked, got %d messages", len(msgs))
+	}
+}
+
+func TestConsumeEachWithResult(t *testing.T) {
+	clock := NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := NewBrokerWithClock(clock)
+	p, _ := b.CreateProducer("orders", "svc")
+	for _, msg := range []string{"ok", "retry", "discard"} {
+		p.Produce(msg)
+	}
+	c, _ := b.CreateConsumer("orders", "worker", memphis.PullInterval(time.Second), memphis.MaxAckTime(time.Hour))
+
+	handled := make(chan string, 10)
+	err := c.ConsumeEachWithResult(func(_ context.Context, msg *memphis.Msg) error {
+		handled <- string(msg.Data())
+		switch string(msg.Data()) {
+		case "retry":
+			return errors.New("not yet")
+		case "discard":
+			return memphis.ErrDiscard
+		}
+		return nil
+	}, memphis.NakDelay(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopConsume()
+
+	for _, want := range []string{"ok", "retry", "discard"} {
+		if got := <-handled; got != want {
+			t.Fatalf("handled %q, want %q", got, want)
+		}
+	}
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Second)
+	clock.BlockUntil(1)
+	if len(handled) != 0 {
+		t.Fatalf("%q was redelivered before the nak delay", <-handled)
+	}
+	clock.Advance(30 * time.Second)
+	if got := <-handled; got != "retry" {
+		t.Fatalf("redelivered %q, want retry", got)
+	}
+	if dls := b.DeadLetters("orders"); len(dls) != 0 {
+		t.Fatalf("dead letters = %q", dls)
+	}
+}
+
+func TestDLSHandler(t *testing.T) {
+	b := NewBroker()
+	p, _ := b.CreateProducer("orders", "svc")
+	p.Produce("poison")
+	c, _ := b.CreateConsumer("orders", "worker", memphis.MaxAckTime(10*time.Millisecond), memphis.MaxMsgDeliveries(1))
+
+	var dls []*memphis.Msg
+	c.SetDLSHandler(func(msgs []*memphis.Msg, err error, ctx context.Context) { dls = append(dls, msgs...) })
+	msgs, _ := c.Fetch(1, false)
+	if len(msgs) != 1 || msgs[0].IsDLS() {
+		t.Fatalf("expected a station message, got %d", len(msgs))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if msgs, _ = c.Fetch(1, false); len(msgs) != 0 {
+		t.Fatalf("fetched %d messages past MaxMsgDeliveries", len(msgs))
+	}
+	if len(dls) != 1 || !dls[0].IsDLS() || string(dls[0].Data()) != "poison" {
+		t.Fatalf("DLS handler got %d messages", len(dls))
+	}
+	info, ok := dls[0].DLSInfo()
+	want := memphis.DLSInfo{Id: 1, ConsumerGroup: "worker"}
+	if !ok || info != want {
+		t.Fatalf("DLSInfo = %+v, want %+v", info, want)
+	}
+	if err := dls[0].Ack(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProduceBatch(t *testing.T) {
+	b := NewBroker()
+	p, _ := b.CreateProducer("orders", "importer")
+	hdrs := memphis.Headers{}
+	hdrs.New()
+	hdrs.Add("kind", "created")
+	results, err := p.ProduceBatch([]memphis.BatchMessage{
+		{Payload: "a", Headers: hdrs, ID: "a"},
+		{Payload: "a-dup", ID: "a"},
+		{Payload: "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Ack.Sequence != 1 || !results[1].Ack.Duplicate || results[2].Ack.Sequence != 2 {
+		t.Fatalf("unexpected results %+v %+v %+v", results[0].Ack, results[1].Ack, results[2].Ack)
+	}
+	stored := b.Messages("orders")
+	if len(stored) != 2 || string(stored[1]) != "b" {
+		t.Fatalf("stored %q", stored)
+	}
+	p.Destroy()
+	if _, err := p.ProduceBatch([]memphis.BatchMessage{{Payload: "c"}}); err != ErrProducerDestroyed {
+		t.Fatalf("produce after destroy: %v", err)
+	}
+}
+
+func TestProducerProtoSchema(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(structpb.File_google_protobuf_struct_proto),
+	}}
+	data, _ := proto.Marshal(set)
+	schema, err := memphis.ParseProtoSchema(data, "google.protobuf.ListValue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBroker()
+	p, _ := b.CreateProducer("orders", "svc", memphis.ProducerProtoSchema(schema))
+	if err := p.Produce(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("a")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Produce([]byte{0xff, 0xff}); err == nil {
+		t.Fatal("expected an invalid message to be rejected")
+	}
+	if stored := b.Messages("orders"); len(stored) != 1 {
+		t.Fatalf("stored %d messages", len(stored))
+	}
+}
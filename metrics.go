@@ -0,0 +1,242 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MetricsRecorder - receives the metrics recorded by the SDK, implement it to forward them to
+// prometheus, statsd, etc. or use InMemoryMetrics. Implementations must be safe for concurrent use.
+type MetricsRecorder interface {
+	AddCounter(name string, labels map[string]string, delta float64)
+	ObserveHistogram(name string, labels map[string]string, value float64)
+}
+
+// Metrics - record the SDK's metrics into recorder, metrics are not recorded by default.
+func Metrics(recorder MetricsRecorder) Option {
+	return func(o *Options) error {
+		o.Metrics = recorder
+		return nil
+	}
+}
+
+func (c *Conn) addCounter(name string, labels map[string]string, delta float64) {
+	if c == nil || c.opts.Metrics == nil {
+		return
+	}
+	c.opts.Metrics.AddCounter(name, labels, delta)
+}
+
+func (c *Conn) observeHistogram(name string, labels map[string]string, value float64) {
+	if c == nil || c.opts.Metrics == nil {
+		return
+	}
+	c.opts.Metrics.ObserveHistogram(name, labels, value)
+}
+
+// DefaultLatencyBuckets - histogram bucket upper bounds in seconds, from 0.5ms to 60s.
+var DefaultLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Histogram - a fixed bucket histogram, safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+	min    float64
+	max    float64
+}
+
+// HistogramSnapshot - the state of a histogram at some point in time, Counts[i] is the number of values
+// lower or equal to Bounds[i] and greater than the previous bound, the last count holds values above all bounds.
+type HistogramSnapshot struct {
+	Bounds []float64
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+	Min    float64
+	Max    float64
+}
+
+// NewHistogram - creates a histogram with the given ascending bucket upper bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return &Histogram{bounds: b, counts: make([]uint64, len(b)+1)}
+}
+
+// Histogram.Observe - records a value.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+}
+
+// Histogram.Snapshot - returns a copy of the histogram's state.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: append([]uint64(nil), h.counts...),
+		Count:  h.count,
+		Sum:    h.sum,
+		Min:    h.min,
+		Max:    h.max,
+	}
+}
+
+// Histogram.Reset - clears all recorded values.
+func (h *Histogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts = make([]uint64, len(h.bounds)+1)
+	h.count = 0
+	h.sum = 0
+	h.min = 0
+	h.max = 0
+}
+
+// HistogramSnapshot.Mean - the mean of the recorded values.
+func (s HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// HistogramSnapshot.Quantile - estimates the q quantile (0 <= q <= 1), as the upper bound of the bucket
+// holding it, capped by the largest recorded value.
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(s.Count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, c := range s.Counts {
+		seen += c
+		if seen >= rank {
+			if i < len(s.Bounds) && s.Bounds[i] < s.Max {
+				return s.Bounds[i]
+			}
+			return s.Max
+		}
+	}
+	return s.Max
+}
+
+// InMemoryMetrics - a MetricsRecorder keeping counters and histograms in memory.
+type InMemoryMetrics struct {
+	mu         sync.Mutex
+	buckets    []float64
+	counters   map[string]float64
+	histograms map[string]*Histogram
+}
+
+// NewInMemoryMetrics - creates an in memory recorder, histograms use DefaultLatencyBuckets.
+func NewInMemoryMetrics() *InMemoryMetrics {
+	return &InMemoryMetrics{
+		buckets:    DefaultLatencyBuckets,
+		counters:   make(map[string]float64),
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+func (m *InMemoryMetrics) AddCounter(name string, labels map[string]string, delta float64) {
+	key := metricKey(name, labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[key] += delta
+}
+
+func (m *InMemoryMetrics) ObserveHistogram(name string, labels map[string]string, value float64) {
+	key := metricKey(name, labels)
+	m.mu.Lock()
+	h, ok := m.histograms[key]
+	if !ok {
+		h = NewHistogram(m.buckets)
+		m.histograms[key] = h
+	}
+	m.mu.Unlock()
+	h.Observe(value)
+}
+
+// InMemoryMetrics.Counter - the value of a counter.
+func (m *InMemoryMetrics) Counter(name string, labels map[string]string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[metricKey(name, labels)]
+}
+
+// InMemoryMetrics.Histogram - a snapshot of a histogram, false if nothing was recorded into it.
+func (m *InMemoryMetrics) Histogram(name string, labels map[string]string) (HistogramSnapshot, bool) {
+	m.mu.Lock()
+	h, ok := m.histograms[metricKey(name, labels)]
+	m.mu.Unlock()
+	if !ok {
+		return HistogramSnapshot{}, false
+	}
+	return h.Snapshot(), true
+}
+
+// InMemoryMetrics.Reset - clears all counters and histograms.
+func (m *InMemoryMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = make(map[string]float64)
+	m.histograms = make(map[string]*Histogram)
+}
+
+// metricKey - name{label="value",...} with the labels sorted by name.
+func metricKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(k)
+		sb.WriteString(`="`)
+		sb.WriteString(labels[k])
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package memphis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{1, 2, 5, 10})
+	for _, v := range []float64{0.5, 1.5, 1.5, 3, 4, 7, 20} {
+		h.Observe(v)
+	}
+	s := h.Snapshot()
+	if s.Count != 7 || s.Min != 0.5 || s.Max != 20 || s.Sum != 37.5 {
+		t.Fatalf("unexpected snapshot %+v", s)
+	}
+	cases := map[float64]float64{0: 1, 0.5: 5, 0.8: 10, 1: 20}
+	for q, expected := range cases {
+		if v := s.Quantile(q); v != expected {
+			t.Errorf("quantile %v: expected %v, got %v", q, expected, v)
+		}
+	}
+
+	h.Reset()
+	if s := h.Snapshot(); s.Count != 0 || s.Quantile(0.99) != 0 {
+		t.Errorf("expected an empty histogram after reset, got %+v", s)
+	}
+}
+
+func TestInMemoryMetrics(t *testing.T) {
+	m := NewInMemoryMetrics()
+	m.AddCounter("requests", map[string]string{"b": "2", "a": "1"}, 1)
+	m.AddCounter("requests", map[string]string{"a": "1", "b": "2"}, 2)
+	if v := m.Counter("requests", map[string]string{"a": "1", "b": "2"}); v != 3 {
+		t.Errorf("expected counter 3, got %v", v)
+	}
+	if k := metricKey("requests", map[string]string{"b": "2", "a": "1"}); k != `requests{a="1",b="2"}` {
+		t.Errorf("unexpected metric key %v", k)
+	}
+
+	m.ObserveHistogram("latency", nil, 0.2)
+	if s, ok := m.Histogram("latency", nil); !ok || s.Count != 1 {
+		t.Errorf("expected one observation, got %+v %v", s, ok)
+	}
+	if _, ok := m.Histogram("missing", nil); ok {
+		t.Error("expected no histogram for an unknown metric")
+	}
+}
+
+func TestMsgLatency(t *testing.T) {
+	first, second := publishStamp(), publishStamp()
+	if second <= first {
+		t.Fatalf("publish stamps should be strictly increasing, got %v then %v", first, second)
+	}
+
+	published := time.Now().Add(-250 * time.Millisecond)
+	natsMsg := nats.NewMsg("test")
+	natsMsg.Header.Set(publishedAtHeader, strconv.FormatInt(published.UnixNano(), 10))
+
+	metrics := NewInMemoryMetrics()
+	c := &Consumer{stationName: "orders", ConsumerGroup: "cg", conn: &Conn{opts: Options{Metrics: metrics}}}
+	msg := c.newMsg(natsMsg)
+	latency, err := msg.Latency()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latency < 250*time.Millisecond || latency > time.Second {
+		t.Errorf("unexpected latency %v", latency)
+	}
+	s, ok := metrics.Histogram(deliveryLatencyMetric, map[string]string{metricsStationLabel: "orders", metricsConsumerGroupLabel: "cg"})
+	if !ok || s.Count != 1 {
+		t.Errorf("expected the latency to be recorded, got %+v", s)
+	}
+
+	if _, err := newTestMsg("no stamp", nil).Latency(); err == nil {
+		t.Error("expected an error for a message without a publish timestamp")
+	}
+}
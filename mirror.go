@@ -0,0 +1,162 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// StationSource - a station whose messages are copied into another station, see MirrorStation.
+type StationSource struct {
+	// Station - the name of the source station
+	Station string
+	// Partitions - the number of partitions of the source station, looked up when empty, required for a
+	// station of another account
+	Partitions int
+	// APIPrefix - for a station of another account, the prefix its JetStream API is imported under, e.g. "$JS.<account>.API"
+	APIPrefix string
+	// DeliverPrefix - for a station of another account, the prefix its messages are delivered under
+	DeliverPrefix string
+}
+
+// external - whether the source is a station of another account.
+func (s StationSource) external() bool {
+	return s.APIPrefix != ""
+}
+
+// MirrorStation - copies the messages of the source stations into the station, e.g. for disaster recovery or to
+// share a station with another account. Messages of source partition n are copied into partition n of the
+// station, wrapping around when it has fewer partitions, so the order within a partition is kept. The copy is
+// set up by the SDK on the station's streams once it is created, it needs brokers running NATS 2.10 or later
+// and is not shown in the station's settings. A source of another account has to export its JetStream API and
+// delivery subjects to the station's account.
+func MirrorStation(sources ...StationSource) StationOpt {
+	return func(opts *StationOpts) error {
+		if len(sources) == 0 {
+			return errors.New("at least one source station is required")
+		}
+		for _, source := range sources {
+			if err := validateName(source.Station, "station"); err != nil {
+				return err
+			}
+			if source.external() && source.Partitions < 1 {
+				return fmt.Errorf("the partitions of station %v of another account have to be given", source.Station)
+			}
+			if !source.external() && source.DeliverPrefix != "" {
+				return fmt.Errorf("a deliver prefix needs an api prefix for station %v", source.Station)
+			}
+		}
+		opts.Sources = append(opts.Sources, sources...)
+		return nil
+	}
+}
+
+// Conn.addStationSources - adds the sources to the streams of the station's partitions, sources already set are kept.
+func (c *Conn) addStationSources(opts StationOpts) error {
+	partitions, err := c.GetStationPartitions(opts.Name, opts.RequestOpts...)
+	if err != nil {
+		return memphisError(err)
+	}
+	streamSources := make(map[string][]*jetstream.StreamSource, len(partitions))
+	for _, source := range opts.Sources {
+		if getInternalName(source.Station) == getInternalName(opts.Name) && !source.external() {
+			return memphisError(errors.New("a station can not mirror itself"))
+		}
+		sourcePartitions, err := c.sourcePartitions(source, opts.RequestOpts)
+		if err != nil {
+			return memphisError(err)
+		}
+		for i, sourcePartition := range sourcePartitions {
+			partition := partitions[i%len(partitions)]
+			streamSources[partition.StreamName] = append(streamSources[partition.StreamName], &jetstream.StreamSource{
+				Name: sourcePartition.StreamName,
+				SubjectTransforms: []jetstream.SubjectTransformConfig{{
+					Source:      sourcePartition.StreamName + ".>",
+					Destination: partition.StreamName + ".>",
+				}},
+				External: source.externalStream(),
+			})
+		}
+	}
+
+	requestOpts, err := getRequestOptions(opts.RequestOpts...)
+	if err != nil {
+		return memphisError(err)
+	}
+	for _, partition := range partitions {
+		if err := c.addStreamSources(requestOpts, partition.StreamName, streamSources[partition.StreamName]); err != nil {
+			return memphisError(fmt.Errorf("partition %v: %w", partition.Number, err))
+		}
+	}
+	return nil
+}
+
+// Conn.sourcePartitions - the partitions of a source station, by number when given.
+func (c *Conn) sourcePartitions(source StationSource, options []RequestOpt) ([]StationPartition, error) {
+	if source.Partitions > 0 {
+		return partitionsOf(getInternalName(source.Station), partitionNumbers(source.Partitions)), nil
+	}
+	partitions, err := c.GetStationPartitions(source.Station, options...)
+	if err != nil {
+		return nil, fmt.Errorf("source station %v: %w", source.Station, err)
+	}
+	return partitions, nil
+}
+
+func (s StationSource) externalStream() *jetstream.ExternalStream {
+	if !s.external() {
+		return nil
+	}
+	return &jetstream.ExternalStream{APIPrefix: s.APIPrefix, DeliverPrefix: s.DeliverPrefix}
+}
+
+// Conn.addStreamSources - updates the stream's config with the sources it doesn't have yet.
+func (c *Conn) addStreamSources(requestOpts RequestOpts, streamName string, sources []*jetstream.StreamSource) error {
+	if len(sources) == 0 {
+		return nil
+	}
+	ctx, cancel := c.jetstreamContext(requestOpts)
+	defer cancel()
+	stream, err := c.js.Stream(ctx, streamName)
+	if err != nil {
+		return err
+	}
+	config := stream.CachedInfo().Config
+	added := false
+	for _, source := range sources {
+		if hasStreamSource(config.Sources, source) {
+			continue
+		}
+		config.Sources = append(config.Sources, source)
+		added = true
+	}
+	if !added {
+		return nil
+	}
+	_, err = c.js.UpdateStream(ctx, config)
+	return err
+}
+
+func hasStreamSource(sources []*jetstream.StreamSource, source *jetstream.StreamSource) bool {
+	for _, s := range sources {
+		if s.Name == source.Name && (s.External == nil) == (source.External == nil) &&
+			(s.External == nil || s.External.APIPrefix == source.External.APIPrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package memphis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// configJetStream - a broker keeping the config of its streams.
+type configJetStream struct {
+	jetstream.JetStream
+	configs map[string]jetstream.StreamConfig
+	updates int
+}
+
+type configStream struct {
+	jetstream.Stream
+	config jetstream.StreamConfig
+}
+
+func (s *configStream) CachedInfo() *jetstream.StreamInfo {
+	return &jetstream.StreamInfo{Config: s.config}
+}
+
+func (js *configJetStream) Stream(_ context.Context, name string) (jetstream.Stream, error) {
+	config, ok := js.configs[name]
+	if !ok {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	return &configStream{config: config}, nil
+}
+
+func (js *configJetStream) UpdateStream(_ context.Context, config jetstream.StreamConfig) (jetstream.Stream, error) {
+	js.updates++
+	js.configs[config.Name] = config
+	return &configStream{config: config}, nil
+}
+
+func TestMirrorStation(t *testing.T) {
+	js := &configJetStream{configs: map[string]jetstream.StreamConfig{
+		"orders-dr$1": {Name: "orders-dr$1"},
+		"orders-dr$2": {Name: "orders-dr$2"},
+	}}
+	c := &Conn{js: js, stationPartitions: map[string]*PartitionsUpdate{
+		"orders":    {PartitionsList: []int{1, 2, 3}},
+		"orders-dr": {PartitionsList: []int{1, 2}},
+	}}
+	opts := GetStationDefaultOptions()
+	opts.Name = "orders-dr"
+	err := MirrorStation(
+		StationSource{Station: "orders"},
+		StationSource{Station: "payments", Partitions: 1, APIPrefix: "$JS.finance.API", DeliverPrefix: "deliver.finance"},
+	)(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.addStationSources(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	first := js.configs["orders-dr$1"].Sources
+	if len(first) != 3 {
+		t.Fatalf("partition 1 has %d sources, want 3", len(first))
+	}
+	want := []string{"orders$1", "orders$3", "payments$1"}
+	for i, source := range first {
+		if source.Name != want[i] {
+			t.Errorf("source %d = %v, want %v", i, source.Name, want[i])
+		}
+		if transform := source.SubjectTransforms[0]; transform.Source != source.Name+".>" || transform.Destination != "orders-dr$1.>" {
+			t.Errorf("source %v transform %+v", source.Name, transform)
+		}
+	}
+	if first[0].External != nil || first[2].External == nil || first[2].External.APIPrefix != "$JS.finance.API" || first[2].External.DeliverPrefix != "deliver.finance" {
+		t.Errorf("unexpected external streams %+v %+v", first[0].External, first[2].External)
+	}
+	if second := js.configs["orders-dr$2"].Sources; len(second) != 1 || second[0].Name != "orders$2" {
+		t.Errorf("partition 2 sources %+v", second)
+	}
+
+	// sources already set are not added again
+	updates := js.updates
+	if err := c.addStationSources(opts); err != nil {
+		t.Fatal(err)
+	}
+	if js.updates != updates || len(js.configs["orders-dr$1"].Sources) != 3 {
+		t.Errorf("sources were added twice")
+	}
+
+	self := GetStationDefaultOptions()
+	self.Name = "orders"
+	MirrorStation(StationSource{Station: "orders"})(&self)
+	if err := c.addStationSources(self); err == nil {
+		t.Error("expected a station mirroring itself to be rejected")
+	}
+	for _, source := range []StationSource{{Station: "x", APIPrefix: "$JS.a.API"}, {Station: "x", DeliverPrefix: "d"}, {Station: ""}} {
+		if err := MirrorStation(source)(&StationOpts{}); err == nil {
+			t.Errorf("expected %+v to be rejected", source)
+		}
+	}
+}
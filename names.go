@@ -0,0 +1,33 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+// NormalizeName - the name of a station, producer, consumer, consumer group or schema as the SDK sends it to the
+// broker, names are case insensitive and lowercased.
+func NormalizeName(name string) string {
+	return getLowerCaseName(name)
+}
+
+// InternalName - the name of a station or consumer group as it appears in subjects and stream and durable names,
+// the normalized name with '.' replaced by '#'.
+func InternalName(name string) string {
+	return getInternalName(name)
+}
+
+// ValidateName - validates a station, producer, consumer, consumer group or schema name the way the broker does,
+// after normalizing it: at most 128 alphanumeric, '_', '-' and '.' characters, starting and ending with an
+// alphanumeric character. Names supplied by users can be validated before creating anything with them.
+func ValidateName(name string) error {
+	return memphisError(validateName(NormalizeName(name), "object"))
+}
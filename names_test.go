@@ -0,0 +1,38 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"orders", "Orders.EU", "orders_2023-10", "a"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "orders eu", "_orders", "orders.", "orders$1", strings.Repeat("a", 129)} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("%q was valid", name)
+		}
+	}
+	if got := NormalizeName("Orders.EU"); got != "orders.eu" {
+		t.Errorf("normalized to %q", got)
+	}
+	if got := InternalName("Orders.EU"); got != "orders#eu" {
+		t.Errorf("internal name %q", got)
+	}
+}
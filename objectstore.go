@@ -0,0 +1,196 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrObjectNotFound - the object doesn't exist in the object store.
+var ErrObjectNotFound = nats.ErrObjectNotFound
+
+// ObjectStore - a JetStream object store bucket, for large payloads and artifacts referenced by messages.
+type ObjectStore struct {
+	Bucket      string
+	store       nats.ObjectStore
+	requestOpts RequestOpts
+	timeout     time.Duration
+}
+
+// ObjectInfo - the description of a stored object.
+type ObjectInfo struct {
+	Name        string
+	Description string
+	Metadata    map[string]string
+	Size        uint64
+	Chunks      uint32
+	Digest      string
+	ModTime     time.Time
+}
+
+func newObjectInfo(info *nats.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Name:        info.Name,
+		Description: info.Description,
+		Metadata:    info.Metadata,
+		Size:        info.Size,
+		Chunks:      info.Chunks,
+		Digest:      info.Digest,
+		ModTime:     info.ModTime,
+	}
+}
+
+// Conn.ObjectStore - the object store bucket, created with CreateBucket when it doesn't exist.
+func (c *Conn) ObjectStore(bucket string, opts ...BucketOpt) (*ObjectStore, error) {
+	bucketOpts, err := getBucketOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	requestOpts, err := getRequestOptions(bucketOpts.RequestOpts...)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	timeout := c.operationTimeout(requestOpts, JetstreamOperationTimeout*time.Second)
+	js, err := c.brokerConn.JetStream(nats.MaxWait(timeout))
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return objectStore(js, bucket, bucketOpts, requestOpts, timeout)
+}
+
+// objectStore - the object store bucket of the manager, created when it doesn't exist and the options ask to.
+func objectStore(manager nats.ObjectStoreManager, bucket string, bucketOpts BucketOpts, requestOpts RequestOpts, timeout time.Duration) (*ObjectStore, error) {
+	store, err := manager.ObjectStore(bucket)
+	if errors.Is(err, nats.ErrStreamNotFound) && bucketOpts.Create {
+		store, err = manager.CreateObjectStore(&nats.ObjectStoreConfig{
+			Bucket:   bucket,
+			TTL:      bucketOpts.TTL,
+			Replicas: bucketOpts.Replicas,
+			MaxBytes: bucketOpts.MaxBytes,
+		})
+	}
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		err = nats.ErrBucketNotFound
+	}
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return &ObjectStore{Bucket: bucket, store: store, requestOpts: requestOpts, timeout: timeout}, nil
+}
+
+// Conn.DeleteObjectStore - deletes the object store bucket with all of its objects.
+func (c *Conn) DeleteObjectStore(bucket string, options ...RequestOpt) error {
+	requestOpts, err := getRequestOptions(options...)
+	if err != nil {
+		return memphisError(err)
+	}
+	js, err := c.brokerConn.JetStream(nats.MaxWait(c.operationTimeout(requestOpts, JetstreamOperationTimeout*time.Second)))
+	if err != nil {
+		return memphisError(err)
+	}
+	return memphisError(js.DeleteObjectStore(bucket))
+}
+
+// ObjectStore.context - ctx bounded by the operation timeout of the bucket.
+func (o *ObjectStore) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = o.requestOpts.Context
+	}
+	return context.WithTimeout(ctx, o.timeout)
+}
+
+// ObjectStore.Put - stores the object read from r, replacing the object with the same name.
+func (o *ObjectStore) Put(ctx context.Context, name string, r io.Reader) (*ObjectInfo, error) {
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	info, err := o.store.Put(&nats.ObjectMeta{Name: name}, r, nats.Context(ctx))
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return newObjectInfo(info), nil
+}
+
+// ObjectStore.PutBytes - stores data as the object, replacing the object with the same name.
+func (o *ObjectStore) PutBytes(ctx context.Context, name string, data []byte) (*ObjectInfo, error) {
+	return o.Put(ctx, name, bytes.NewReader(data))
+}
+
+// ObjectStore.Get - a reader of the object, which has to be closed, ErrObjectNotFound when it doesn't exist.
+// The reader fails when the object's digest doesn't match its content.
+func (o *ObjectStore) Get(ctx context.Context, name string) (io.ReadCloser, *ObjectInfo, error) {
+	if ctx == nil {
+		ctx = o.requestOpts.Context
+	}
+	result, err := o.store.Get(name, nats.Context(ctx))
+	if err != nil {
+		return nil, nil, memphisError(err)
+	}
+	info, err := result.Info()
+	if err != nil {
+		result.Close()
+		return nil, nil, memphisError(err)
+	}
+	return result, newObjectInfo(info), nil
+}
+
+// ObjectStore.GetBytes - the content of the object, ErrObjectNotFound when it doesn't exist.
+func (o *ObjectStore) GetBytes(ctx context.Context, name string) ([]byte, error) {
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	data, err := o.store.GetBytes(name, nats.Context(ctx))
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return data, nil
+}
+
+// ObjectStore.Info - the description of the object, ErrObjectNotFound when it doesn't exist.
+func (o *ObjectStore) Info(ctx context.Context, name string) (*ObjectInfo, error) {
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	info, err := o.store.GetInfo(name, nats.Context(ctx))
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return newObjectInfo(info), nil
+}
+
+// ObjectStore.Delete - deletes the object.
+func (o *ObjectStore) Delete(name string) error {
+	return memphisError(o.store.Delete(name))
+}
+
+// ObjectStore.List - the descriptions of the objects of the bucket.
+func (o *ObjectStore) List(ctx context.Context) ([]*ObjectInfo, error) {
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	infos, err := o.store.List(nats.Context(ctx))
+	if errors.Is(err, nats.ErrNoObjectsFound) {
+		return []*ObjectInfo{}, nil
+	}
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	objects := make([]*ObjectInfo, 0, len(infos))
+	for _, info := range infos {
+		objects = append(objects, newObjectInfo(info))
+	}
+	return objects, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// memObjectStores - holds in memory object stores.
+type memObjectStores struct {
+	nats.ObjectStoreManager
+	stores map[string]*memObjectStore
+}
+
+func (m *memObjectStores) ObjectStore(bucket string) (nats.ObjectStore, error) {
+	store, ok := m.stores[bucket]
+	if !ok {
+		return nil, nats.ErrStreamNotFound
+	}
+	return store, nil
+}
+
+func (m *memObjectStores) CreateObjectStore(cfg *nats.ObjectStoreConfig) (nats.ObjectStore, error) {
+	store := &memObjectStore{objects: map[string][]byte{}}
+	m.stores[cfg.Bucket] = store
+	return store, nil
+}
+
+type memObjectStore struct {
+	nats.ObjectStore
+	objects map[string][]byte
+}
+
+func (s *memObjectStore) Put(meta *nats.ObjectMeta, r io.Reader, _ ...nats.ObjectOpt) (*nats.ObjectInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s.objects[meta.Name] = data
+	return s.GetInfo(meta.Name)
+}
+
+func (s *memObjectStore) GetBytes(name string, _ ...nats.GetObjectOpt) ([]byte, error) {
+	data, ok := s.objects[name]
+	if !ok {
+		return nil, nats.ErrObjectNotFound
+	}
+	return data, nil
+}
+
+func (s *memObjectStore) GetInfo(name string, _ ...nats.GetObjectInfoOpt) (*nats.ObjectInfo, error) {
+	data, ok := s.objects[name]
+	if !ok {
+		return nil, nats.ErrObjectNotFound
+	}
+	return &nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: name}, Size: uint64(len(data)), ModTime: time.Unix(0, 0)}, nil
+}
+
+func (s *memObjectStore) Delete(name string) error {
+	delete(s.objects, name)
+	return nil
+}
+
+func (s *memObjectStore) List(_ ...nats.ListObjectsOpt) ([]*nats.ObjectInfo, error) {
+	if len(s.objects) == 0 {
+		return nil, nats.ErrNoObjectsFound
+	}
+	var infos []*nats.ObjectInfo
+	for name := range s.objects {
+		info, _ := s.GetInfo(name)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func TestObjectStore(t *testing.T) {
+	manager := &memObjectStores{stores: map[string]*memObjectStore{}}
+	requestOpts := getDefaultRequestOptions()
+	if _, err := objectStore(manager, "artifacts", BucketOpts{}, requestOpts, time.Second); !errors.Is(err, nats.ErrBucketNotFound) {
+		t.Fatalf("opened a missing bucket, err=%v", err)
+	}
+	store, err := objectStore(manager, "artifacts", BucketOpts{Create: true}, requestOpts, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if objects, err := store.List(ctx); err != nil || len(objects) != 0 {
+		t.Fatalf("objects of an empty bucket: %v, %v", objects, err)
+	}
+	info, err := store.Put(ctx, "reports/2023-10.csv", strings.NewReader("id,amount\n1,100\n"))
+	if err != nil || info.Size != 16 || info.Name != "reports/2023-10.csv" {
+		t.Fatalf("put %+v, %v", info, err)
+	}
+	data, err := store.GetBytes(ctx, "reports/2023-10.csv")
+	if err != nil || string(data) != "id,amount\n1,100\n" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if objects, err := store.List(ctx); err != nil || len(objects) != 1 {
+		t.Fatalf("objects %v, %v", objects, err)
+	}
+	if err := store.Delete("reports/2023-10.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Info(ctx, "reports/2023-10.csv"); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("got a deleted object, err=%v", err)
+	}
+}
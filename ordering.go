@@ -0,0 +1,73 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import "sync"
+
+// StrictOrdering - serializes the produces of a message key, or of a partition for messages without a key, so
+// consumers observe them in the order they were produced even when a produce is retried. Every produce waits for
+// the broker's ack before the next one with the same key is published, so there is at most one message per key
+// in flight and AsyncProduce is ignored. Messages with different keys are still produced concurrently.
+func StrictOrdering() ProducerOpt {
+	return func(opts *ProducerOpts) error {
+		opts.StrictOrdering = true
+		return nil
+	}
+}
+
+// orderingLocks - a mutex per ordering key, a key's entry is dropped once nobody holds or waits for it.
+type orderingLocks struct {
+	mu    sync.Mutex
+	locks map[string]*orderingLock
+}
+
+type orderingLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock - blocks until the key is free and returns the function releasing it.
+func (l *orderingLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*orderingLock)
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &orderingLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	kl.Lock()
+	return func() {
+		kl.Unlock()
+		l.mu.Lock()
+		kl.refs--
+		if kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// orderingKey - the key the produce is serialized on, the partition key if the message has one and the
+// partition's stream otherwise.
+func (opts *ProduceOpts) orderingKey(streamName string) string {
+	if opts.ProducerPartitionKey != "" {
+		return "key:" + opts.ProducerPartitionKey
+	}
+	return "stream:" + streamName
+}
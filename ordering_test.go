@@ -0,0 +1,76 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrderingLocks(t *testing.T) {
+	var l orderingLocks
+	unlockA := l.lock("a")
+
+	// another key isn't blocked
+	done := make(chan struct{})
+	go func() {
+		l.lock("b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a produce with another key was blocked")
+	}
+
+	// the same key waits until the in-flight produce is acked
+	acquired := make(chan struct{})
+	go func() {
+		unlock := l.lock("a")
+		close(acquired)
+		unlock()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("two produces with the same key were in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlockA()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the key was not released")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.locks) != 0 {
+		t.Fatalf("%d released keys are kept", len(l.locks))
+	}
+}
+
+func TestOrderingKey(t *testing.T) {
+	keyed := ProduceOpts{ProducerPartitionKey: "customer-1"}
+	if keyed.orderingKey("orders$1") != keyed.orderingKey("orders$2") {
+		t.Error("messages with the same key should share an ordering key")
+	}
+	unkeyed := ProduceOpts{}
+	if unkeyed.orderingKey("orders$1") == unkeyed.orderingKey("orders$2") {
+		t.Error("messages without a key should be ordered per partition")
+	}
+	opts := ProducerOpts{}
+	if err := StrictOrdering()(&opts); err != nil || !opts.StrictOrdering {
+		t.Fatalf("StrictOrdering was not set, err = %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// OutboxRecord - a row of an outbox table. ID has to be unique and stable, it is used as the message id
+// so a record published twice, e.g. after a crash before it was marked, is deduplicated by the station's
+// idempotency window. Station overrides the outbox's default station.
+type OutboxRecord struct {
+	ID      string
+	Station string
+	Payload []byte
+	Headers map[string]string
+}
+
+// OutboxStore - access to the outbox table, implement it over the database the service writes to.
+type OutboxStore interface {
+	// Pending - returns up to limit records which were not marked as published yet, in publish order.
+	Pending(ctx context.Context, limit int) ([]OutboxRecord, error)
+	// MarkPublished - marks the records as published, e.g. by deleting them or setting a published_at column.
+	MarkPublished(ctx context.Context, ids []string) error
+}
+
+// OutboxOpts - configuration options for an outbox relay.
+type OutboxOpts struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	ErrHandler   func(error)
+}
+
+// OutboxOpt - a function on the options for an outbox relay.
+type OutboxOpt func(*OutboxOpts) error
+
+func getDefaultOutboxOpts() OutboxOpts {
+	return OutboxOpts{
+		PollInterval: time.Second,
+		BatchSize:    100,
+		MinBackoff:   100 * time.Millisecond,
+		MaxBackoff:   30 * time.Second,
+		ErrHandler: func(err error) {
+			log.Printf("Outbox: %v", err)
+		},
+	}
+}
+
+// OutboxPollInterval - how often the outbox table is polled when it has no pending records, defaults to 1 second.
+func OutboxPollInterval(interval time.Duration) OutboxOpt {
+	return func(opts *OutboxOpts) error {
+		if interval <= 0 {
+			return errors.New("outbox poll interval has to be positive")
+		}
+		opts.PollInterval = interval
+		return nil
+	}
+}
+
+// OutboxBatchSize - max number of records read from the outbox table at once, defaults to 100.
+func OutboxBatchSize(batchSize int) OutboxOpt {
+	return func(opts *OutboxOpts) error {
+		if batchSize < 1 {
+			return errors.New("outbox batch size has to be at least 1")
+		}
+		opts.BatchSize = batchSize
+		return nil
+	}
+}
+
+// OutboxBackoff - the delay before retrying after a failure, doubled on every consecutive failure up to max,
+// defaults to 100ms and 30 seconds.
+func OutboxBackoff(min, max time.Duration) OutboxOpt {
+	return func(opts *OutboxOpts) error {
+		if min <= 0 || max < min {
+			return errors.New("outbox backoff min has to be positive and not greater than max")
+		}
+		opts.MinBackoff = min
+		opts.MaxBackoff = max
+		return nil
+	}
+}
+
+// OutboxErrorHandler - called with every error of the relay, the relay keeps running after errors, by default errors are logged.
+func OutboxErrorHandler(handler func(error)) OutboxOpt {
+	return func(opts *OutboxOpts) error {
+		opts.ErrHandler = handler
+		return nil
+	}
+}
+
+type outboxProducer interface {
+	ProduceWithAck(message any, opts ...ProduceOpt) (*ProduceAck, error)
+}
+
+// Outbox - relays the records of an outbox table to stations, in order, marking them as published once stored.
+type Outbox struct {
+	store       OutboxStore
+	station     string
+	opts        OutboxOpts
+	producerFor func(station string) (outboxProducer, error)
+	clock       Clock
+}
+
+// NewOutbox - creates a relay publishing the records of store to stationName, unless a record names another
+// station, using producers named producerName.
+func (c *Conn) NewOutbox(store OutboxStore, stationName, producerName string, opts ...OutboxOpt) (*Outbox, error) {
+	if store == nil {
+		return nil, memphisError(errors.New("outbox store is required"))
+	}
+	defaultOpts := getDefaultOutboxOpts()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	return &Outbox{
+		store:   store,
+		station: stationName,
+		opts:    defaultOpts,
+		producerFor: func(station string) (outboxProducer, error) {
+			return c.CreateProducer(station, producerName)
+		},
+		clock: c.clock(),
+	}, nil
+}
+
+// Outbox.Run - relays records until ctx is done. Pending records are published back to back, the table is
+// polled every PollInterval once drained and failures are retried with backoff, preserving the order.
+func (o *Outbox) Run(ctx context.Context) error {
+	backoff := o.opts.MinBackoff
+	for {
+		published, err := o.PublishPending(ctx)
+		var wait time.Duration
+		switch {
+		case err != nil:
+			o.handleErr(err)
+			wait = backoff
+			backoff *= 2
+			if backoff > o.opts.MaxBackoff {
+				backoff = o.opts.MaxBackoff
+			}
+		case published == 0:
+			backoff = o.opts.MinBackoff
+			wait = o.opts.PollInterval
+		default:
+			backoff = o.opts.MinBackoff
+		}
+		if wait == 0 {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		timer := clockOrSystem(o.clock).NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+// Outbox.PublishPending - publishes one batch of pending records and returns how many were published.
+// Publishing stops at the first failure so records are never published out of order, the records
+// published before it are still marked.
+func (o *Outbox) PublishPending(ctx context.Context) (int, error) {
+	records, err := o.store.Pending(ctx, o.opts.BatchSize)
+	if err != nil {
+		return 0, memphisError(fmt.Errorf("outbox pending records: %w", err))
+	}
+	published := make([]string, 0, len(records))
+	var publishErr error
+	for _, record := range records {
+		if ctx.Err() != nil {
+			publishErr = ctx.Err()
+			break
+		}
+		if err := o.publish(record); err != nil {
+			publishErr = fmt.Errorf("outbox record %v: %w", record.ID, err)
+			break
+		}
+		published = append(published, record.ID)
+	}
+	if len(published) > 0 {
+		if err := o.store.MarkPublished(ctx, published); err != nil {
+			return 0, memphisError(fmt.Errorf("outbox mark published: %w", err))
+		}
+	}
+	if publishErr != nil {
+		return len(published), memphisError(publishErr)
+	}
+	return len(published), nil
+}
+
+func (o *Outbox) publish(record OutboxRecord) error {
+	if record.ID == "" {
+		return errors.New("record has no id")
+	}
+	station := record.Station
+	if station == "" {
+		station = o.station
+	}
+	p, err := o.producerFor(station)
+	if err != nil {
+		return err
+	}
+	var hdrs Headers
+	hdrs.New()
+	for k, v := range record.Headers {
+		if err := hdrs.Add(k, v); err != nil {
+			return err
+		}
+	}
+	_, err = p.ProduceWithAck(record.Payload, MsgHeaders(hdrs), MsgId(record.ID))
+	return err
+}
+
+func (o *Outbox) handleErr(err error) {
+	if o.opts.ErrHandler != nil {
+		o.opts.ErrHandler(err)
+	}
+}
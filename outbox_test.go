@@ -0,0 +1,161 @@
+package memphis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memOutboxStore struct {
+	mu        sync.Mutex
+	records   []OutboxRecord
+	published map[string]bool
+}
+
+func (s *memOutboxStore) Pending(_ context.Context, limit int) ([]OutboxRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []OutboxRecord
+	for _, r := range s.records {
+		if !s.published[r.ID] && len(pending) < limit {
+			pending = append(pending, r)
+		}
+	}
+	return pending, nil
+}
+
+func (s *memOutboxStore) MarkPublished(_ context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.published[id] = true
+	}
+	return nil
+}
+
+type outboxRecordingProducer struct {
+	mu       sync.Mutex
+	failOn   string
+	produced []string
+	stations []string
+}
+
+func (p *outboxRecordingProducer) producerFor(station string) (outboxProducer, error) {
+	p.mu.Lock()
+	p.stations = append(p.stations, station)
+	p.mu.Unlock()
+	return p, nil
+}
+
+func (p *outboxRecordingProducer) ProduceWithAck(message any, opts ...ProduceOpt) (*ProduceAck, error) {
+	produceOpts := getDefaultProduceOpts()
+	for _, opt := range opts {
+		if err := opt(&produceOpts); err != nil {
+			return nil, err
+		}
+	}
+	id := produceOpts.MsgHeaders.MsgHeaders["msg-id"][0]
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id == p.failOn {
+		return nil, errors.New("broker unavailable")
+	}
+	p.produced = append(p.produced, id)
+	return &ProduceAck{Sequence: uint64(len(p.produced))}, nil
+}
+
+func TestOutboxPublishPending(t *testing.T) {
+	store := &memOutboxStore{
+		records: []OutboxRecord{
+			{ID: "1", Payload: []byte("a")},
+			{ID: "2", Payload: []byte("b"), Station: "audit"},
+			{ID: "3", Payload: []byte("c")},
+		},
+		published: map[string]bool{},
+	}
+	producer := &outboxRecordingProducer{failOn: "2"}
+	o := &Outbox{store: store, station: "orders", opts: getDefaultOutboxOpts(), producerFor: producer.producerFor}
+
+	n, err := o.PublishPending(context.Background())
+	if err == nil || n != 1 {
+		t.Fatalf("expected the batch to stop at the failing record, got %d %v", n, err)
+	}
+	if !store.published["1"] || store.published["2"] || store.published["3"] {
+		t.Fatalf("only the records before the failure should be marked, got %v", store.published)
+	}
+
+	producer.failOn = ""
+	n, err = o.PublishPending(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("expected the remaining 2 records to be published, got %d %v", n, err)
+	}
+	if len(producer.produced) != 3 || producer.produced[1] != "2" || producer.produced[2] != "3" {
+		t.Errorf("records were not published in order: %v", producer.produced)
+	}
+	if producer.stations[len(producer.stations)-2] != "audit" || producer.stations[len(producer.stations)-1] != "orders" {
+		t.Errorf("record station should override the default station, got %v", producer.stations)
+	}
+}
+
+func TestOutboxPublishPendingWithProducer(t *testing.T) {
+	js := &ackingJetStream{released: make(chan struct{})}
+	close(js.released)
+	c := &Conn{js: js, stationPartitions: map[string]*PartitionsUpdate{}, stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {}}}
+	producerFor := func(station string) (outboxProducer, error) {
+		return &Producer{conn: c, Name: "relay", stationName: station}, nil
+	}
+	store := &memOutboxStore{
+		records:   []OutboxRecord{{ID: "1", Payload: []byte("a")}, {ID: "2", Payload: []byte("b")}},
+		published: map[string]bool{},
+	}
+	o := &Outbox{store: store, station: "orders", opts: getDefaultOutboxOpts(), producerFor: producerFor}
+
+	published, err := o.PublishPending(context.Background())
+	if err != nil || published != 2 {
+		t.Fatalf("published %d records, err %v", published, err)
+	}
+	if len(js.msgs) != 2 || js.msgs[0].Header.Get("msg-id") != "1" || js.msgs[1].Header.Get("msg-id") != "2" {
+		t.Fatalf("unexpected produced messages %v", js.msgs)
+	}
+}
+
+func TestOutboxRun(t *testing.T) {
+	store := &memOutboxStore{published: map[string]bool{}}
+	producer := &outboxRecordingProducer{}
+	opts := getDefaultOutboxOpts()
+	opts.PollInterval = 5 * time.Millisecond
+	o := &Outbox{store: store, station: "orders", opts: opts, producerFor: producer.producerFor}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- o.Run(ctx) }()
+
+	store.mu.Lock()
+	store.records = append(store.records, OutboxRecord{ID: "1", Payload: []byte("a")})
+	store.mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		store.mu.Lock()
+		published := store.published["1"]
+		store.mu.Unlock()
+		if published {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("record was not relayed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
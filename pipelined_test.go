@@ -0,0 +1,279 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// streamIterator - a standing pull request over a stream of messages, every batch of them takes a round trip.
+type streamIterator struct {
+	jetstream.MessagesContext
+	msgs      <-chan jetstream.Msg
+	batch     int
+	latency   time.Duration
+	delivered int
+	stopped   chan struct{}
+	stopOnce  sync.Once
+}
+
+func (it *streamIterator) Next() (jetstream.Msg, error) {
+	if it.latency > 0 && it.delivered%it.batch == 0 {
+		time.Sleep(it.latency)
+	}
+	select {
+	case msg := <-it.msgs:
+		it.delivered++
+		return msg, nil
+	case <-it.stopped:
+		return nil, jetstream.ErrMsgIteratorClosed
+	}
+}
+
+func (it *streamIterator) Stop() {
+	it.stopOnce.Do(func() { close(it.stopped) })
+}
+
+func (it *streamIterator) isStopped() bool {
+	select {
+	case <-it.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// streamJsConsumer - a JetStream consumer over a stream of messages, pulled with a round trip per pull request.
+type streamJsConsumer struct {
+	jetstream.Consumer
+	msgs      chan jetstream.Msg
+	batch     int
+	latency   time.Duration
+	mu        sync.Mutex
+	iterators []*streamIterator
+}
+
+func newStreamJsConsumer(batch int, latency time.Duration, msgs ...string) *streamJsConsumer {
+	f := &streamJsConsumer{msgs: make(chan jetstream.Msg, len(msgs)+1024), batch: batch, latency: latency}
+	for _, data := range msgs {
+		f.msgs <- &ackRecordingMsg{data: []byte(data)}
+	}
+	return f
+}
+
+func (f *streamJsConsumer) Messages(...jetstream.PullMessagesOpt) (jetstream.MessagesContext, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	it := &streamIterator{msgs: f.msgs, batch: f.batch, latency: f.latency, stopped: make(chan struct{})}
+	f.iterators = append(f.iterators, it)
+	return it, nil
+}
+
+func (f *streamJsConsumer) Fetch(batch int, _ ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	time.Sleep(f.latency)
+	msgs := make(chan jetstream.Msg, batch)
+	for len(msgs) < batch {
+		select {
+		case msg := <-f.msgs:
+			msgs <- msg
+			continue
+		default:
+		}
+		break
+	}
+	close(msgs)
+	return fakeBatch{msgs: msgs}, nil
+}
+
+func (f *streamJsConsumer) allStopped() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, it := range f.iterators {
+		if !it.isStopped() {
+			return false
+		}
+	}
+	return true
+}
+
+func newPipelinedTestConsumer(mode ConsumeMode, jsConsumers map[int]jetstream.Consumer) *Consumer {
+	return &Consumer{
+		stationName:        "station",
+		ConsumerGroup:      "cg",
+		BatchSize:          10,
+		BatchMaxTimeToWait: time.Second,
+		subscriptionActive: true,
+		consumeMode:        mode,
+		jsConsumers:        jsConsumers,
+		partitionsUpdated:  make(chan struct{}, 1),
+		conn:               &Conn{},
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConsumePipelined(t *testing.T) {
+	data := make([]string, 100)
+	for i := range data {
+		data[i] = strconv.Itoa(i)
+	}
+	js := newStreamJsConsumer(10, 0, data...)
+	c := newPipelinedTestConsumer(ConsumeModePipelined, map[int]jetstream.Consumer{1: js})
+
+	var mu sync.Mutex
+	var received []*Msg
+	err := c.Consume(func(msgs []*Msg, err error, _ context.Context) {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(msgs) > c.BatchSize {
+			t.Errorf("got a batch of %d messages, the batch size is %d", len(msgs), c.BatchSize)
+		}
+		for _, msg := range msgs {
+			if err := msg.Ack(); err != nil {
+				t.Error(err)
+			}
+		}
+		mu.Lock()
+		received = append(received, msgs...)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "all the messages", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == len(data)
+	})
+	for i, msg := range received {
+		if string(msg.Data()) != data[i] {
+			t.Fatalf("message %d is %q, want %q", i, msg.Data(), data[i])
+		}
+		if !msg.msg.(*ackRecordingMsg).acked {
+			t.Fatalf("message %d was not acked", i)
+		}
+	}
+
+	c.StopConsume()
+	waitFor(t, "the pull requests to stop", js.allStopped)
+	js.msgs <- &ackRecordingMsg{data: []byte("after stop")}
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != len(data) {
+		t.Fatalf("a message was handled after StopConsume")
+	}
+}
+
+func TestConsumePipelinedFollowsPartitions(t *testing.T) {
+	first := newStreamJsConsumer(10, 0, "a")
+	second := newStreamJsConsumer(10, 0, "b")
+	c := newPipelinedTestConsumer(ConsumeModePipelined, map[int]jetstream.Consumer{1: first})
+
+	received := make(chan string, 2)
+	err := c.Consume(func(msgs []*Msg, err error, _ context.Context) {
+		for _, msg := range msgs {
+			received <- string(msg.Data())
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopConsume()
+	if got := <-received; got != "a" {
+		t.Fatalf("received %q from the first partition", got)
+	}
+
+	// partition 2 added and partition 1 removed while consuming, as rebalance does
+	c.partitionsMu.Lock()
+	c.jsConsumers = map[int]jetstream.Consumer{2: second}
+	c.partitionsMu.Unlock()
+	c.notifyPartitionsUpdated()
+
+	select {
+	case got := <-received:
+		if got != "b" {
+			t.Fatalf("received %q, want the message of the added partition", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the added partition was not consumed")
+	}
+	waitFor(t, "the removed partition's pull request to stop", first.allStopped)
+}
+
+// benchmarkConsume - consumes b.N messages with a handler taking as long as a pull request's round trip.
+func benchmarkConsume(b *testing.B, mode ConsumeMode) {
+	const latency = 200 * time.Microsecond
+	js := newStreamJsConsumer(10, latency)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case js.msgs <- &ackRecordingMsg{data: []byte("msg")}:
+			case <-done:
+				return
+			}
+		}
+	}()
+	c := newPipelinedTestConsumer(mode, map[int]jetstream.Consumer{1: js})
+
+	var handled sync.WaitGroup
+	handled.Add(b.N)
+	var mu sync.Mutex
+	remaining := b.N
+	b.ResetTimer()
+	err := c.Consume(func(msgs []*Msg, _ error, _ context.Context) {
+		time.Sleep(latency)
+		mu.Lock()
+		defer mu.Unlock()
+		for range msgs {
+			if remaining > 0 {
+				remaining--
+				handled.Done()
+			}
+		}
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	handled.Wait()
+	b.StopTimer()
+	c.StopConsume()
+}
+
+func BenchmarkConsumeSerialFetch(b *testing.B) {
+	benchmarkConsume(b, ConsumeModePullLoop)
+}
+
+func BenchmarkConsumePipelined(b *testing.B) {
+	benchmarkConsume(b, ConsumeModePipelined)
+}
@@ -0,0 +1,119 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const consumerLeaderStepdownSubjectTemplate = "$JS.API.CONSUMER.LEADER.STEPDOWN.%s.%s"
+
+// ConsumerPlacement - where the consumer group's JetStream consumers should be led from. The consumer leader
+// serves every delivery, so placing it on a replica close to the consumers keeps reads local.
+type ConsumerPlacement struct {
+	// Cluster - the cluster the leader should be in.
+	Cluster string `json:"cluster,omitempty"`
+	// Tags - server tags the leader's server should have, e.g. the availability zone.
+	Tags []string `json:"tags,omitempty"`
+	// Preferred - the name of the server which should lead.
+	Preferred string `json:"preferred,omitempty"`
+}
+
+// PreferredPlacement - after the consumer is created, asks the broker to move the leadership of the consumer
+// group's JetStream consumers to a replica matching placement, when their leader doesn't already match it.
+// Brokers older than NATS 2.11 and users not allowed to step down consumer leaders can't honor it, the failure is
+// passed to the consumer's error handler and the consumer keeps reading from the current leader.
+func PreferredPlacement(placement ConsumerPlacement) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if placement.Cluster == "" && len(placement.Tags) == 0 && placement.Preferred == "" {
+			return errors.New("placement needs a cluster, tags or a preferred server")
+		}
+		opts.Placement = &placement
+		return nil
+	}
+}
+
+// needsPlacement - whether the consumer described by info is led from outside placement. The leader's tags
+// are not reported, so a placement with tags is always requested.
+func (p *ConsumerPlacement) needsPlacement(info *jetstream.ConsumerInfo) bool {
+	if info.Cluster == nil || info.Cluster.Leader == "" {
+		return false
+	}
+	if len(p.Tags) > 0 {
+		return true
+	}
+	if p.Preferred != "" && info.Cluster.Leader != p.Preferred {
+		return true
+	}
+	return p.Cluster != "" && info.Cluster.Name != p.Cluster
+}
+
+type consumerStepdownReq struct {
+	Placement *ConsumerPlacement `json:"placement,omitempty"`
+}
+
+type consumerStepdownResp struct {
+	Success bool `json:"success"`
+	Error   *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error,omitempty"`
+}
+
+func parseStepdownResp(data []byte) error {
+	var resp consumerStepdownResp
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s (%d)", resp.Error.Description, resp.Error.Code)
+	}
+	if !resp.Success {
+		return errors.New("leader stepdown was not performed")
+	}
+	return nil
+}
+
+// applyPlacement - asks the broker to move the leadership of every partition's JetStream consumer which is led
+// from outside the consumer's placement. Failures are reported to the error handler, they don't fail the consumer.
+func (c *Consumer) applyPlacement(options ...RequestOpt) {
+	if c.placement == nil {
+		return
+	}
+	requestOpts, err := getRequestOptions(options...)
+	if err != nil {
+		c.callErrHandler(memphisError(err))
+		return
+	}
+	req, _ := json.Marshal(consumerStepdownReq{Placement: c.placement})
+	for p, jsCons := range c.jsConsumers {
+		info := jsCons.CachedInfo()
+		if info == nil || !c.placement.needsPlacement(info) {
+			continue
+		}
+		ctx, cancel := c.conn.jetstreamContext(requestOpts)
+		msg, err := c.conn.brokerConn.RequestWithContext(ctx, fmt.Sprintf(consumerLeaderStepdownSubjectTemplate, info.Stream, info.Name), req)
+		cancel()
+		if err == nil {
+			err = parseStepdownResp(msg.Data)
+		}
+		if err != nil {
+			c.callErrHandler(memphisError(fmt.Errorf("placement of partition %d: %w", p, err)))
+		}
+	}
+}
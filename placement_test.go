@@ -0,0 +1,52 @@
+package memphis
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestConsumerPlacement(t *testing.T) {
+	opts := getDefaultConsumerOptions()
+	if err := PreferredPlacement(ConsumerPlacement{})(&opts); err == nil {
+		t.Fatal("expected an empty placement to be rejected")
+	}
+
+	info := &jetstream.ConsumerInfo{Cluster: &jetstream.ClusterInfo{Name: "eu", Leader: "eu-1"}}
+	for _, tc := range []struct {
+		placement ConsumerPlacement
+		want      bool
+	}{
+		{ConsumerPlacement{Cluster: "eu"}, false},
+		{ConsumerPlacement{Cluster: "us"}, true},
+		{ConsumerPlacement{Preferred: "eu-1"}, false},
+		{ConsumerPlacement{Cluster: "eu", Preferred: "eu-2"}, true},
+		{ConsumerPlacement{Tags: []string{"az:eu-1a"}}, true},
+	} {
+		if got := tc.placement.needsPlacement(info); got != tc.want {
+			t.Errorf("placement %+v needed = %v, want %v", tc.placement, got, tc.want)
+		}
+	}
+	if (&ConsumerPlacement{Cluster: "us"}).needsPlacement(&jetstream.ConsumerInfo{}) {
+		t.Error("a consumer which isn't clustered can't be placed")
+	}
+
+	if err := parseStepdownResp([]byte(`{"type": "io.nats.jetstream.api.v1.consumer_leader_stepdown_response", "success": true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseStepdownResp([]byte(`{"error": {"code": 400, "description": "no suitable peers for placement"}}`)); err == nil || err.Error() != "no suitable peers for placement (400)" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// nothing is requested for consumers already led from the placement
+	var reported []error
+	c := &Consumer{
+		placement:   &ConsumerPlacement{Cluster: "eu"},
+		jsConsumers: map[int]jetstream.Consumer{1: &infoJsConsumer{info: info}},
+		errHandler:  func(_ *Consumer, err error) { reported = append(reported, err) },
+	}
+	c.applyPlacement()
+	if len(reported) != 0 {
+		t.Fatalf("reported %v", reported)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// BatchMessage - a message produced by Producer.ProduceBatch.
+type BatchMessage struct {
+	// Payload - the message, of the types accepted by Producer.Produce
+	Payload any
+	// Headers - the message's headers, added to the ones set with MsgHeaders for the whole batch
+	Headers Headers
+	// PartitionKey - the partition key of the message, see ProducerPartitionKey
+	PartitionKey string
+	// ID - the idempotency id of the message, see MsgId
+	ID string
+}
+
+// BatchResult - the outcome of a message produced by Producer.ProduceBatch, Ack is set when Err is nil.
+type BatchResult struct {
+	Ack *ProduceAck
+	Err error
+}
+
+// Producer.ProduceBatch - produces the messages in order and returns the result of each one, at the same index.
+// All the messages are published before waiting for the acknowledgements, so a batch costs about one round trip
+// instead of one per message. opts apply to every message of the batch, the produce is always synchronous and
+// ProduceContext bounds the whole batch. A message failing, e.g. on schema validation, doesn't stop the others,
+// the returned error is set only when the batch couldn't be produced at all. Not supported for multi station producers.
+func (p *Producer) ProduceBatch(msgs []BatchMessage, opts ...ProduceOpt) ([]BatchResult, error) {
+	if p.isMultiStationProducer {
+		return nil, memphisError(errors.New("ProduceBatch is not supported for multi station producers"))
+	}
+
+	results := make([]BatchResult, len(msgs))
+	batchOpts := make([]ProduceOpts, len(msgs))
+	for i, msg := range msgs {
+		produceOpts, err := msg.produceOpts(opts)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+		batchOpts[i] = produceOpts
+	}
+
+	if p.strictOrdering {
+		// every message holds its ordering key until it is acknowledged
+		for i := range batchOpts {
+			results[i].Ack, results[i].Err = batchOpts[i].publish(p)
+		}
+		return results, nil
+	}
+
+	pafs := make([]jetstream.PubAckFuture, len(msgs))
+	streamNames := make([]string, len(msgs))
+	hooked := len(p.conn.opts.Hooks) > 0
+	infos := make([]ProduceInfo, len(msgs))
+	ctxs := make([]context.Context, len(msgs))
+	for i := range batchOpts {
+		if hooked {
+			infos[i] = p.produceInfo(&batchOpts[i])
+			ctxs[i] = p.conn.beforeProduce(batchOpts[i].Context, infos[i])
+		}
+		natsMessage, streamName, err := batchOpts[i].prepare(p)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if pafs[i], err = batchOpts[i].send(p, natsMessage); err != nil {
+			results[i].Err = err
+			continue
+		}
+		streamNames[i] = streamName
+	}
+	for i, paf := range pafs {
+		if paf != nil {
+			results[i].Ack, results[i].Err = batchOpts[i].awaitAck(p, paf, streamNames[i])
+		}
+		if hooked {
+			p.conn.afterProduce(ctxs[i], infos[i], results[i].Ack, results[i].Err)
+		}
+	}
+	return results, nil
+}
+
+// BatchMessage.produceOpts - the produce options of the message, the batch's options with the message's
+// headers, partition key and id. The headers are copied since producing adds to them.
+func (m BatchMessage) produceOpts(opts []ProduceOpt) (ProduceOpts, error) {
+	produceOpts := getDefaultProduceOpts()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&produceOpts); err != nil {
+				return ProduceOpts{}, err
+			}
+		}
+	}
+	produceOpts.Message = m.Payload
+	produceOpts.AsyncProduce = false
+
+	headers := make(map[string][]string, len(produceOpts.MsgHeaders.MsgHeaders)+len(m.Headers.MsgHeaders)+1)
+	for key, values := range produceOpts.MsgHeaders.MsgHeaders {
+		headers[key] = values
+	}
+	for key, values := range m.Headers.MsgHeaders {
+		if err := m.Headers.validateHeaderKey(key); err != nil {
+			return ProduceOpts{}, err
+		}
+		headers[key] = values
+	}
+	if m.ID != "" {
+		headers["msg-id"] = []string{m.ID}
+	}
+	produceOpts.MsgHeaders = Headers{MsgHeaders: headers}
+	if m.PartitionKey != "" {
+		produceOpts.ProducerPartitionKey = m.PartitionKey
+	}
+	return produceOpts, nil
+}
@@ -0,0 +1,118 @@
+package memphis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ackingJetStream - a broker storing published messages, their acknowledgements resolve once release is called.
+type ackingJetStream struct {
+	jetstream.JetStream
+	mu       sync.Mutex
+	msgs     []*nats.Msg
+	released chan struct{}
+}
+
+type releasedAck struct {
+	jetstream.PubAckFuture
+	ack      chan *jetstream.PubAck
+	released chan struct{}
+}
+
+func (a releasedAck) Ok() <-chan *jetstream.PubAck {
+	<-a.released
+	return a.ack
+}
+func (releasedAck) Err() <-chan error { return nil }
+
+func (js *ackingJetStream) PublishMsgAsync(msg *nats.Msg, _ ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.msgs = append(js.msgs, msg)
+	ack := make(chan *jetstream.PubAck, 1)
+	ack <- &jetstream.PubAck{Stream: "orders", Sequence: uint64(len(js.msgs))}
+	return releasedAck{ack: ack, released: js.released}, nil
+}
+
+func TestProduceBatch(t *testing.T) {
+	js := &ackingJetStream{released: make(chan struct{})}
+	c := &Conn{
+		js:                 js,
+		stationPartitions:  map[string]*PartitionsUpdate{},
+		stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {}},
+	}
+	p := &Producer{conn: c, Name: "importer", stationName: "orders"}
+
+	common := Headers{}
+	common.New()
+	common.Add("source", "import")
+	invalid := Headers{}
+	invalid.New()
+	invalid.Add(PartitionHeader, "three")
+	first := Headers{}
+	first.New()
+	first.Add("kind", "created")
+
+	msgs := []BatchMessage{
+		{Payload: []byte("a"), Headers: first, ID: "a"},
+		{Payload: []byte("b"), Headers: invalid},
+		{Payload: []byte("c"), PartitionKey: "k"},
+	}
+	done := make(chan struct{})
+	var results []BatchResult
+	var err error
+	go func() {
+		defer close(done)
+		results, err = p.ProduceBatch(msgs, MsgHeaders(common))
+	}()
+
+	// every message is published before the first acknowledgement is awaited
+	for {
+		js.mu.Lock()
+		published := len(js.msgs)
+		js.mu.Unlock()
+		if published == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(js.released)
+	<-done
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results", len(results))
+	}
+	if results[0].Err != nil || results[0].Ack.Sequence != 1 || results[2].Err != nil || results[2].Ack.Sequence != 2 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if results[1].Err == nil || results[1].Ack != nil {
+		t.Fatalf("expected the invalid partition header to fail, got %+v", results[1])
+	}
+
+	a, third := js.msgs[0].Header, js.msgs[1].Header
+	if a.Get("kind") != "created" || a.Get("source") != "import" || a.Get("msg-id") != "a" || a.Get("$memphis_producedBy") != "importer" {
+		t.Errorf("unexpected headers of the first message %v", a)
+	}
+	if third.Get("kind") != "" || third.Get("msg-id") != "" || third.Get("source") != "import" {
+		t.Errorf("headers leaked between messages %v", third)
+	}
+	if len(common.MsgHeaders) != 1 {
+		t.Errorf("the batch's headers were modified %v", common.MsgHeaders)
+	}
+
+	bad := Headers{MsgHeaders: map[string][]string{"$memphis_producedBy": {"spoofed"}}}
+	if _, err := p.ProduceBatch([]BatchMessage{{Payload: []byte("x"), Headers: bad}}); err == nil {
+		t.Error("expected $memphis headers to be rejected")
+	}
+	p.isMultiStationProducer = true
+	if _, err := p.ProduceBatch(msgs); err == nil {
+		t.Error("expected multi station producers to be rejected")
+	}
+}
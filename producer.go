@@ -15,6 +15,7 @@
 package memphis
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -23,6 +24,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -42,24 +44,35 @@ const (
 )
 
 // Producer - memphis producer object.
+// Produce is safe to call from multiple goroutines on the same producer.
 type Producer struct {
 	Name                   string
 	stationName            interface{}
 	conn                   *Conn
 	realName               string
 	PartitionGenerator     *RoundRobinProducerConsumerGenerator
+	partitionsMu           sync.RWMutex
 	isMultiStationProducer bool
+	publishTimestamp       bool
+	enricher               EnricherFunc
+	schemaChanged          SchemaChangedHandler
+	schemaChangedId        int
+	strictOrdering         bool
+	ordering               orderingLocks
+	buffer                 *producerBuffer
+	protoSchema            *ProtoSchema
 }
 
 type createProducerReq struct {
-	Name           string `json:"name"`
-	StationName    string `json:"station_name"`
-	ConnectionId   string `json:"connection_id"`
-	ProducerType   string `json:"producer_type"`
-	RequestVersion int    `json:"req_version"`
-	Username       string `json:"username"`
-	AppId          string `json:"app_id"`
-	SdkLang        string `json:"sdk_lang"`
+	Name           string            `json:"name"`
+	StationName    string            `json:"station_name"`
+	ConnectionId   string            `json:"connection_id"`
+	ProducerType   string            `json:"producer_type"`
+	RequestVersion int               `json:"req_version"`
+	Username       string            `json:"username"`
+	AppId          string            `json:"app_id"`
+	SdkLang        string            `json:"sdk_lang"`
+	ClientMetadata map[string]string `json:"client_metadata,omitempty"`
 }
 
 type createProducerResp struct {
@@ -107,8 +120,16 @@ type removeProducerReq struct {
 
 // ProducerOpts - configuration options for producer creation.
 type ProducerOpts struct {
-	GenUniqueSuffix bool
-	TimeoutRetry    int
+	GenUniqueSuffix  bool
+	TimeoutRetry     int
+	RequestOpts      []RequestOpt
+	PublishTimestamp bool
+	Enricher         EnricherFunc
+	SchemaChanged    SchemaChangedHandler
+	StrictOrdering   bool
+	BufferStore      BufferStore
+	BufferOpts       BufferOpts
+	ProtoSchema      *ProtoSchema
 }
 
 type Notification struct {
@@ -190,12 +211,20 @@ func (c *Conn) CreateProducer(stationName interface{}, name string, opts ...Prod
 }
 
 func (c *Conn) createMultiStationProducer(stationNames []string, name, nameWithoutSuffix string, opts ProducerOpts) (*Producer, error) {
+	if opts.BufferStore != nil {
+		return nil, memphisError(errors.New("ProducerBuffer is not supported for multi station producers"))
+	}
 	return &Producer{
 		Name:                   name,
 		stationName:            stationNames,
 		conn:                   c,
 		realName:               nameWithoutSuffix,
 		isMultiStationProducer: true,
+		publishTimestamp:       opts.PublishTimestamp,
+		enricher:               opts.Enricher,
+		schemaChanged:          opts.SchemaChanged,
+		strictOrdering:         opts.StrictOrdering,
+		protoSchema:            opts.ProtoSchema,
 	}, nil
 }
 
@@ -208,34 +237,49 @@ func (c *Conn) createSingleStationProducer(stationName, name, nameWithoutSuffix
 	}
 
 	p := Producer{
-		Name:        name,
-		stationName: stationName,
-		conn:        c,
-		realName:    nameWithoutSuffix,
+		Name:             name,
+		stationName:      stationName,
+		conn:             c,
+		realName:         nameWithoutSuffix,
+		publishTimestamp: opts.PublishTimestamp,
+		enricher:         opts.Enricher,
+		schemaChanged:    opts.SchemaChanged,
+		strictOrdering:   opts.StrictOrdering,
+		protoSchema:      opts.ProtoSchema,
 	}
-
-	sn := getInternalName(stationName)
-	_, ok := c.stationUpdatesSubs[sn]
-	if !ok {
-		c.stationUpdatesSubs[sn] = &stationUpdateSub{
-			refCount:       1,
-			schemaUpdateCh: make(chan SchemaUpdate),
-			schemaDetails:  schemaDetails{},
+	if opts.BufferStore != nil {
+		buffer, err := newProducerBuffer(c, opts.BufferStore, opts.BufferOpts)
+		if err != nil {
+			return nil, memphisError(err)
 		}
+		p.buffer = buffer
 	}
 
-	if err := c.create(&p, TimeoutRetry(opts.TimeoutRetry)); err != nil {
+	sn := getInternalName(stationName)
+	c.ensureStationUpdatesSub(sn)
+
+	if err := c.create(&p, append([]RequestOpt{TimeoutRetry(opts.TimeoutRetry)}, opts.RequestOpts...)...); err != nil {
 		if err := c.removeSchemaUpdatesListener(stationName); err != nil {
 			return nil, memphisError(err)
 		}
 		return nil, memphisError(err)
 	}
 	c.cacheProducer(&p)
+	if len(c.getStationPartitions(sn).PartitionsList) > 0 {
+		if err := c.watchPartitions(); err != nil {
+			return nil, memphisError(err)
+		}
+	}
 
 	err := c.listenToSchemaUpdates(stationName)
 	if err != nil {
 		return nil, memphisError(err)
 	}
+	p.schemaChangedId = c.addSchemaChangedHandler(stationName, p.schemaChanged)
+	if p.buffer != nil {
+		p.buffer.start(&p)
+	}
+	c.emit(Event{Type: EventProducerCreated, Station: stationName, Producer: p.Name})
 
 	return &p, nil
 }
@@ -305,7 +349,12 @@ func (c *Conn) getProducerFromCache(stationName, name string) (*Producer, error)
 
 // Station.CreateProducer - creates a producer attached to this station.
 func (s *Station) CreateProducer(name string, opts ...ProducerOpt) (*Producer, error) {
-	return s.conn.CreateProducer(s.Name, name, opts...)
+	producer, err := s.conn.CreateProducer(s.Name, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.learnPartitions()
+	return producer, nil
 }
 
 func (p *Producer) getCreationSubject() string {
@@ -318,10 +367,11 @@ func (p *Producer) getCreationReq() any {
 		StationName:    p.stationName.(string),
 		ConnectionId:   p.conn.ConnId,
 		ProducerType:   "application",
-		RequestVersion: lastProducerCreationReqVersion,
+		RequestVersion: p.conn.producerRequestVersion(),
 		Username:       p.conn.username,
-		AppId:          applicationId,
-		SdkLang:        "go",
+		AppId:          p.conn.appId(),
+		SdkLang:        p.conn.sdkLang(),
+		ClientMetadata: p.conn.opts.ClientMetadata,
 	}
 }
 
@@ -342,15 +392,14 @@ func (p *Producer) handleCreationResp(resp []byte) error {
 	p.conn.stationUpdatesMu.Lock()
 	sd := &p.conn.stationUpdatesSubs[sn].schemaDetails
 	sd.handleSchemaUpdateInit(cr.SchemaUpdateInit)
+	p.conn.schemaUpdated()
 	p.conn.stationUpdatesMu.Unlock()
 
-	p.conn.stationPartitions[sn] = &cr.PartitionsUpdate // length is 0 if its an old station
-	if len(p.conn.stationPartitions[sn].PartitionsList) != 0 {
-		pg := newRoundRobinGenerator(p.conn.stationPartitions[sn].PartitionsList)
-		p.PartitionGenerator = pg
-	}
+	p.conn.setStationPartitions(sn, &cr.PartitionsUpdate) // length is 0 if its an old station
+	p.setPartitions(cr.PartitionsUpdate.PartitionsList)
 
 	if cr.StationVersion >= 2 {
+		p.conn.observeFunctions()
 		err = p.conn.listenToFunctionsUpdates(p.stationName.(string), cr.StationPartitionsFirstFunctions)
 		if err != nil {
 			return memphisError(err)
@@ -384,6 +433,11 @@ func (p *Producer) Destroy(options ...RequestOpt) error {
 }
 
 func (p *Producer) destroySingleStationProducer(options ...RequestOpt) error {
+	if p.buffer != nil {
+		// messages still buffered stay in the store, they are replayed by the next producer using it
+		p.buffer.stop()
+	}
+	p.conn.removeSchemaChangedHandler(p.stationName.(string), p.schemaChangedId)
 	if err := p.conn.removeSchemaUpdatesListener(p.stationName.(string)); err != nil {
 		return memphisError(err)
 	}
@@ -438,11 +492,21 @@ type ProduceOpts struct {
 	AsyncProduce            bool
 	ProducerPartitionKey    string
 	ProducerPartitionNumber int
+	VerifyLatestSchema      bool
+	SkipSchemaValidation    bool
+	FillSchemaDefaults      bool
+	Context                 context.Context
+	TTL                     time.Duration
 }
 
 // ProduceOpt - a function on the options for produce operations.
 type ProduceOpt func(*ProduceOpts) error
 
+// GetProduceDefaultOptions - returns default configuration options for produce operations.
+func GetProduceDefaultOptions() ProduceOpts {
+	return getDefaultProduceOpts()
+}
+
 // getDefaultProduceOpts - returns default configuration options for produce operations.
 func getDefaultProduceOpts() ProduceOpts {
 	msgHeaders := make(map[string][]string)
@@ -458,11 +522,81 @@ func (p *Producer) Produce(message any, opts ...ProduceOpt) error {
 	return p.produceToSingleStation(message, opts...)
 }
 
+// Producer.ProduceWithContext - produces a message like Produce, ctx bounds the wait for room in the pending
+// acks buffer and, for sync produce, the wait for the broker's acknowledgement.
+func (p *Producer) ProduceWithContext(ctx context.Context, message any, opts ...ProduceOpt) error {
+	return p.Produce(message, append(opts, ProduceContext(ctx))...)
+}
+
+// ProduceAck - the broker's acknowledgement of a produced message.
+type ProduceAck struct {
+	Sequence  uint64
+	Stream    string
+	Partition int
+	// Timestamp - the time the acknowledgement was received, the broker doesn't return the stored time
+	Timestamp time.Time
+	Duplicate bool
+}
+
+func newProduceAck(ack *jetstream.PubAck, streamName string, receivedAt time.Time) *ProduceAck {
+	produceAck := &ProduceAck{
+		Sequence:  ack.Sequence,
+		Stream:    ack.Stream,
+		Partition: 1,
+		Timestamp: receivedAt,
+		Duplicate: ack.Duplicate,
+	}
+	if i := strings.LastIndex(streamName, "$"); i >= 0 {
+		if partition, err := strconv.Atoi(streamName[i+1:]); err == nil {
+			produceAck.Partition = partition
+		}
+	}
+	return produceAck
+}
+
+// Producer.ProduceWithAck - produces a message like Produce and returns the broker's acknowledgement,
+// carrying the sequence the message was stored with. The message is always produced synchronously, AsyncProduce is
+// ignored. Not supported for multi station producers.
+func (p *Producer) ProduceWithAck(message any, opts ...ProduceOpt) (*ProduceAck, error) {
+	if p.isMultiStationProducer {
+		return nil, memphisError(errors.New("ProduceWithAck is not supported for multi station producers"))
+	}
+	defaultOpts := getDefaultProduceOpts()
+	defaultOpts.Message = message
+
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	defaultOpts.AsyncProduce = false
+
+	return defaultOpts.publish(p)
+}
+
 func (p *Producer) produceToMultiStation(message any, opts ...ProduceOpt) error {
 	stationNames := p.stationName.([]string)
 
+	var producerOpts []ProducerOpt
+	if p.publishTimestamp {
+		producerOpts = append(producerOpts, ProducerPublishTimestamp())
+	}
+	if p.enricher != nil {
+		producerOpts = append(producerOpts, Enricher(p.enricher))
+	}
+	if p.schemaChanged != nil {
+		producerOpts = append(producerOpts, ProducerSchemaChanged(p.schemaChanged))
+	}
+	if p.strictOrdering {
+		producerOpts = append(producerOpts, StrictOrdering())
+	}
+	if p.protoSchema != nil {
+		producerOpts = append(producerOpts, ProducerProtoSchema(p.protoSchema))
+	}
 	for _, station := range stationNames {
-		err := p.conn.Produce(station, p.Name, message, nil, opts)
+		err := p.conn.Produce(station, p.Name, message, producerOpts, opts)
 		if err != nil {
 			return memphisError(err)
 		}
@@ -482,6 +616,9 @@ func (p *Producer) produceToSingleStation(message any, opts ...ProduceOpt) error
 			}
 		}
 	}
+	if p.buffer != nil {
+		return p.buffer.produce(p, &defaultOpts)
+	}
 
 	return defaultOpts.produce(p)
 }
@@ -507,87 +644,225 @@ func (hdr *Headers) Add(key, value string) error {
 	return nil
 }
 
+// PartitionHeader - a message header overriding the partition the message is produced to, e.g. set by an Enricher
+// for applications doing their own sharding. It takes precedence over ProducerPartitionKey and ProducerPartitionNumber
+// and is removed before the message is produced.
+const PartitionHeader = "memphis-partition"
+
+// Producer.partitionStream - the stream of the partition a message is produced to, chosen by the PartitionHeader,
+// then the partition key, then the partition number and round robin otherwise.
+func (p *Producer) partitionStream(opts *ProduceOpts, sn string) (string, error) {
+	if values, ok := opts.MsgHeaders.MsgHeaders[PartitionHeader]; ok {
+		delete(opts.MsgHeaders.MsgHeaders, PartitionHeader)
+		partitionNumber, err := strconv.Atoi(strings.Join(values, ""))
+		if err != nil {
+			return "", fmt.Errorf("invalid %v header %q", PartitionHeader, strings.Join(values, ""))
+		}
+		opts.ProducerPartitionKey = ""
+		opts.ProducerPartitionNumber = partitionNumber
+	}
+	if opts.ProducerPartitionNumber > 0 && opts.ProducerPartitionKey != "" {
+		return "", fmt.Errorf("Can not use both partition number and partition key")
+	}
+
+	partitionsList := p.conn.getStationPartitions(sn).PartitionsList
+	if len(partitionsList) == 0 {
+		// stations created before partitions were introduced have a single stream which is partition 1
+		if opts.ProducerPartitionNumber > 1 {
+			return "", fmt.Errorf("Partition %v does not exist in station %v", opts.ProducerPartitionNumber, sn)
+		}
+		return sn, nil
+	}
+	if opts.ProducerPartitionKey != "" {
+		partitionNumber, err := p.conn.GetPartitionFromKey(opts.ProducerPartitionKey, sn)
+		if err != nil {
+			return "", fmt.Errorf("failed to get partition from key")
+		}
+		return fmt.Sprintf("%v$%v", sn, partitionNumber), nil
+	}
+	if opts.ProducerPartitionNumber > 0 {
+		if err := p.conn.ValidatePartitionNumber(opts.ProducerPartitionNumber, sn); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v$%v", sn, opts.ProducerPartitionNumber), nil
+	}
+	if len(partitionsList) == 1 {
+		return fmt.Sprintf("%v$%v", sn, partitionsList[0]), nil
+	}
+	return fmt.Sprintf("%v$%v", sn, p.partitionGenerator().Next()), nil
+}
+
+// Producer.setPartitions - round robins over partitionsList from now on, an empty list keeps the current partitions.
+func (p *Producer) setPartitions(partitionsList []int) {
+	if len(partitionsList) == 0 {
+		return
+	}
+	pg := newRoundRobinGenerator(partitionsList)
+	p.partitionsMu.Lock()
+	p.PartitionGenerator = pg
+	p.partitionsMu.Unlock()
+}
+
+func (p *Producer) partitionGenerator() *RoundRobinProducerConsumerGenerator {
+	p.partitionsMu.RLock()
+	defer p.partitionsMu.RUnlock()
+	return p.PartitionGenerator
+}
+
 // ProducerOpts.produce - produces a message into a station using a configuration struct.
 func (opts *ProduceOpts) produce(p *Producer) error {
-	opts.MsgHeaders.MsgHeaders["$memphis_connectionId"] = []string{p.conn.ConnId}
-	opts.MsgHeaders.MsgHeaders["$memphis_producedBy"] = []string{p.Name}
+	_, err := opts.publish(p)
+	return err
+}
 
-	data, err := p.validateMsg(opts.Message, opts.MsgHeaders.MsgHeaders)
+// ProducerOpts.publish - produces a message into a station using a configuration struct, returns the broker's
+// acknowledgement unless the produce is async.
+func (opts *ProduceOpts) publish(p *Producer) (ack *ProduceAck, err error) {
+	if len(p.conn.opts.Hooks) > 0 {
+		info := p.produceInfo(opts)
+		ctx := p.conn.beforeProduce(opts.Context, info)
+		defer func() { p.conn.afterProduce(ctx, info, ack, err) }()
+	}
+	natsMessage, streamName, err := opts.prepare(p)
 	if err != nil {
-		return memphisError(err)
+		return nil, err
 	}
-
-	var streamName string
-	sn := getInternalName(p.stationName.(string))
-
-	if len(p.conn.stationPartitions[sn].PartitionsList) == 1 {
-		streamName = fmt.Sprintf("%v$%v", sn, p.conn.stationPartitions[sn].PartitionsList[0])
-	} else if len(p.conn.stationPartitions[sn].PartitionsList) > 1 {
-		if opts.ProducerPartitionNumber > 0 && opts.ProducerPartitionKey != "" {
-			return memphisError(fmt.Errorf("Can not use both partition number and partition key"))
-		}
-		if opts.ProducerPartitionKey != "" {
-			partitionNumber, err := p.conn.GetPartitionFromKey(opts.ProducerPartitionKey, sn)
-			if err != nil {
-				return memphisError(fmt.Errorf("failed to get partition from key"))
-			}
-			streamName = fmt.Sprintf("%v$%v", sn, partitionNumber)
-		} else if opts.ProducerPartitionNumber > 0 {
-			err := p.conn.ValidatePartitionNumber(opts.ProducerPartitionNumber, sn)
-			if err != nil {
-				return memphisError(err)
-			}
-			streamName = fmt.Sprintf("%v$%v", sn, opts.ProducerPartitionNumber)
-		} else {
-			partitionNumber := p.PartitionGenerator.Next()
-			streamName = fmt.Sprintf("%v$%v", sn, partitionNumber)
-		}
-	} else {
-		streamName = sn
+	if p.strictOrdering {
+		unlock := p.ordering.lock(opts.orderingKey(streamName))
+		defer unlock()
+		opts.AsyncProduce = false
 	}
 
-	var fullSubjectName string
-	if functionsMap, ok := p.conn.stationFunctionSubs[sn]; ok {
-		partitionNumber, err := strconv.Atoi(strings.Split(streamName, "$")[1])
+	publishedAt := p.conn.clock().Now()
+	paf, err := opts.send(p, natsMessage)
+	if err != nil {
+		return nil, err
+	}
+	if opts.AsyncProduce {
+		return nil, nil
+	}
+	ack, err = opts.awaitAck(p, paf, streamName)
+	if err == nil {
+		p.conn.observePublishLatency(p.stationName.(string), publishedAt)
+	}
+	return ack, err
+}
 
-		functionsMap.StationFunctionsMu.RLock()
+// ProducerOpts.prepare - builds the message to publish and the stream of the partition it is produced to.
+func (opts *ProduceOpts) prepare(p *Producer) (*nats.Msg, string, error) {
+	if err := p.enrich(&opts.MsgHeaders); err != nil {
+		return nil, "", err
+	}
+	opts.MsgHeaders.MsgHeaders["$memphis_connectionId"] = []string{p.conn.ConnId}
+	opts.MsgHeaders.MsgHeaders["$memphis_producedBy"] = []string{p.Name}
+	if p.publishTimestamp {
+		opts.MsgHeaders.MsgHeaders[publishedAtHeader] = []string{strconv.FormatInt(publishStamp(), 10)}
+	}
+	opts.stampExpiry(p.conn.clock().Now())
 
-		if err != nil {
-			return memphisError(err)
+	if opts.VerifyLatestSchema {
+		timeout := p.conn.operationTimeout(RequestOpts{}, time.Second*time.Duration(opts.AckWaitSec))
+		if err := p.conn.awaitSchemaUpdates(p.stationName.(string), timeout); err != nil {
+			return nil, "", err
 		}
-		if funcID, ok := functionsMap.FunctionsDetails.PartitionsFunctions[partitionNumber]; ok {
-			fullSubjectName = fmt.Sprintf("%v.functions.%v", streamName, funcID)
-		} else {
-			fullSubjectName = streamName + ".final"
+	}
+
+	if opts.FillSchemaDefaults {
+		var err error
+		if opts.Message, err = p.fillSchemaDefaults(opts.Message); err != nil {
+			return nil, "", err
 		}
+	}
+	data, err := p.validateMsg(opts.Message, opts.MsgHeaders.MsgHeaders, opts.SkipSchemaValidation)
+	if err != nil {
+		return nil, "", memphisError(err)
+	}
 
-		functionsMap.StationFunctionsMu.RUnlock()
-	} else {
-		fullSubjectName = streamName + ".final"
+	sn := getInternalName(p.stationName.(string))
+	streamName, err := p.partitionStream(opts, sn)
+	if err != nil {
+		return nil, "", memphisError(err)
+	}
+
+	fullSubjectName, err := p.conn.produceSubject(sn, streamName)
+	if err != nil {
+		return nil, "", memphisError(err)
 	}
 
-	natsMessage := nats.Msg{
+	natsMessage := &nats.Msg{
 		Header:  opts.MsgHeaders.MsgHeaders,
 		Subject: fullSubjectName,
 		Data:    data,
 	}
+	return natsMessage, streamName, nil
+}
 
-	stallWaitDuration := time.Second * time.Duration(opts.AckWaitSec)
-	paf, err := p.conn.brokerPublish(&natsMessage, jetstream.WithStallWait(stallWaitDuration))
+// Conn.produceSubject - the subject messages to the stream of a station partition are published to, the subject
+// of the partition's function when one is attached.
+func (c *Conn) produceSubject(sn, streamName string) (string, error) {
+	stationFunctionsSubsLock.Lock()
+	functionsMap, ok := c.stationFunctionSubs[sn]
+	stationFunctionsSubsLock.Unlock()
+	if !ok {
+		return streamName + ".final", nil
+	}
+	partitionNumber, err := strconv.Atoi(strings.Split(streamName, "$")[1])
 	if err != nil {
-		return memphisError(err)
+		return "", err
 	}
 
-	if opts.AsyncProduce {
-		return nil
+	functionsMap.StationFunctionsMu.RLock()
+	defer functionsMap.StationFunctionsMu.RUnlock()
+	if funcID, ok := functionsMap.FunctionsDetails.PartitionsFunctions[partitionNumber]; ok {
+		return fmt.Sprintf("%v.functions.%v", streamName, funcID), nil
 	}
+	return streamName + ".final", nil
+}
+
+// ProducerOpts.send - publishes the message without waiting for its acknowledgement, bounded by the context
+// while the pending acks buffer is full.
+func (opts *ProduceOpts) send(p *Producer, natsMessage *nats.Msg) (jetstream.PubAckFuture, error) {
+	ctx := opts.context()
+	if err := ctx.Err(); err != nil {
+		return nil, memphisError(err)
+	}
+	stallWaitDuration := time.Second * time.Duration(opts.AckWaitSec)
+	if deadline, ok := ctx.Deadline(); ok {
+		untilDeadline := time.Until(deadline)
+		if untilDeadline <= 0 {
+			return nil, memphisError(context.DeadlineExceeded)
+		}
+		if untilDeadline < stallWaitDuration {
+			stallWaitDuration = untilDeadline
+		}
+	}
+	paf, err := p.conn.brokerPublish(natsMessage, jetstream.WithStallWait(stallWaitDuration))
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return paf, nil
+}
 
+// ProducerOpts.awaitAck - waits for the broker's acknowledgement of a published message.
+func (opts *ProduceOpts) awaitAck(p *Producer, paf jetstream.PubAckFuture, streamName string) (*ProduceAck, error) {
+	ctx := opts.context()
 	select {
-	case <-paf.Ok():
-		return nil
-	case err = <-paf.Err():
-		return memphisError(err)
+	case ack := <-paf.Ok():
+		return newProduceAck(ack, streamName, p.conn.clock().Now()), nil
+	case err := <-paf.Err():
+		return nil, memphisError(err)
+	case <-ctx.Done():
+		// the message may still be stored, use MsgId to deduplicate a retry
+		return nil, memphisError(ctx.Err())
+	}
+}
+
+// ProduceOpts.context - the context bounding the produce, the background context when it is not set.
+func (opts *ProduceOpts) context() context.Context {
+	if opts.Context == nil {
+		return context.Background()
 	}
+	return opts.Context
 }
 
 func (p *Producer) sendNotification(title string, msg string, code string, msgType string) {
@@ -616,7 +891,11 @@ func (p *Producer) msgToString(msg any) string {
 
 func (p *Producer) sendMsgToDls(msg any, headers map[string][]string, err error) {
 	internStation := getInternalName(p.stationName.(string))
-	if p.conn.clientsUpdatesSub.StationSchemaverseToDlsMap[internStation] {
+	p.conn.sdkClientsUpdatesMu.RLock()
+	toDls := p.conn.clientsUpdatesSub.StationSchemaverseToDlsMap[internStation]
+	sendNotification := p.conn.clientsUpdatesSub.ClusterConfigurations["send_notification"]
+	p.conn.sdkClientsUpdatesMu.RUnlock()
+	if toDls {
 		msgToSend := p.msgToString(msg)
 		headersForDls := make(map[string]string)
 		for k, v := range headers {
@@ -638,13 +917,13 @@ func (p *Producer) sendMsgToDls(msg any, headers map[string][]string, err error)
 		msgToPublish, _ := json.Marshal(schemaFailMsg)
 		_ = p.conn.brokerConn.Publish(schemaVerseDlsSubject, msgToPublish)
 
-		if p.conn.clientsUpdatesSub.ClusterConfigurations["send_notification"] {
+		if sendNotification {
 			p.sendNotification("Schema validation has failed", "Station: "+p.stationName.(string)+"\nProducer: "+p.Name+"\nError: "+err.Error(), msgToSend, schemaVFailAlertType)
 		}
 	}
 }
 
-func (p *Producer) validateMsg(msg any, headers map[string][]string) ([]byte, error) {
+func (p *Producer) validateMsg(msg any, headers map[string][]string, skipValidation bool) ([]byte, error) {
 	sd, err := p.getSchemaDetails()
 	if err != nil {
 		return nil, memphisError(errors.New("Schema validation has failed: " + err.Error()))
@@ -682,8 +961,12 @@ func (p *Producer) validateMsg(msg any, headers map[string][]string) ([]byte, er
 	}
 
 	// empty schema type means there is no schema and validation is not needed
-	if sd.schemaType != "" {
+	if sd.schemaType != "" && !skipValidation {
 		msgBytes, err := sd.validateMsg(msg)
+		if err != nil && p.conn.opts.DryRunValidation {
+			p.reportSchemaViolation(sd.name, err)
+			return originalMsgBytes, nil
+		}
 		if err != nil {
 			msgToSend := originalMsgBytes
 			if msgBytes != nil {
@@ -691,7 +974,7 @@ func (p *Producer) validateMsg(msg any, headers map[string][]string) ([]byte, er
 			}
 
 			p.sendMsgToDls(msgToSend, headers, err)
-			return nil, memphisError(errors.New("Schema validation has failed: " + err.Error()))
+			return nil, memphisError(newSchemaViolationError(sd, err))
 		}
 		originalMsgBytes = msgBytes
 	}
@@ -700,7 +983,7 @@ func (p *Producer) validateMsg(msg any, headers map[string][]string) ([]byte, er
 }
 
 func (p *Producer) getSchemaDetails() (schemaDetails, error) {
-	return p.conn.getSchemaDetails(p.stationName.(string))
+	return p.protoSchema.resolve(p.conn.getSchemaDetails(p.stationName.(string)))
 }
 
 // Deprecated: will be stopped to be supported after November 1'st, 2023.
@@ -721,7 +1004,7 @@ func AckWaitSec(ackWaitSec int) ProduceOpt {
 	}
 }
 
-// ProducerPartitionKey - set a partition key for a message
+// ProducerPartitionKey - set a partition key for a message, messages with the same key land on the same partition.
 func ProducerPartitionKey(partitionKey string) ProduceOpt {
 	return func(opts *ProduceOpts) error {
 		opts.ProducerPartitionKey = partitionKey
@@ -729,14 +1012,29 @@ func ProducerPartitionKey(partitionKey string) ProduceOpt {
 	}
 }
 
-// ProducerPartitionNumber - set a specific partition number for a message
+// ProducerPartitionNumber - set a specific partition number for a message, the partition has to exist in the station.
+// The partition the message landed on is returned in ProduceAck.Partition.
 func ProducerPartitionNumber(partitionNumber int) ProduceOpt {
 	return func(opts *ProduceOpts) error {
+		if partitionNumber < 1 {
+			return errors.New("Partition number is out of range")
+		}
 		opts.ProducerPartitionNumber = partitionNumber
 		return nil
 	}
 }
 
+// ProduceContext - bounds the produce by ctx, see Producer.ProduceWithContext.
+func ProduceContext(ctx context.Context) ProduceOpt {
+	return func(opts *ProduceOpts) error {
+		if ctx == nil {
+			return errors.New("context can not be nil")
+		}
+		opts.Context = ctx
+		return nil
+	}
+}
+
 // MsgHeaders - set headers to a message
 func MsgHeaders(hdrs Headers) ProduceOpt {
 	return func(opts *ProduceOpts) error {
@@ -772,6 +1070,14 @@ func MsgId(id string) ProduceOpt {
 	}
 }
 
+// ProducerRequestOpts - request options, e.g. RequestTimeout or RequestContext, for the request creating the producer.
+func ProducerRequestOpts(requestOpts ...RequestOpt) ProducerOpt {
+	return func(opts *ProducerOpts) error {
+		opts.RequestOpts = append(opts.RequestOpts, requestOpts...)
+		return nil
+	}
+}
+
 // ProducerTimeoutRetry - set the number of retries for timeout requests
 func ProducerTimeoutRetry(timeoutRetry int) ProducerOpt {
 	return func(opts *ProducerOpts) error {
@@ -2,8 +2,13 @@ package memphis
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 func TestCreateProducer(t *testing.T) {
@@ -361,3 +366,184 @@ func TestFullFlow(t *testing.T) {
 		t.Errorf("Consumer destruction failed: %v\n", err)
 	}
 }
+
+func TestNewProduceAck(t *testing.T) {
+	now := time.Now()
+	ack := newProduceAck(&jetstream.PubAck{Stream: "orders$3", Sequence: 42, Duplicate: true}, "orders$3", now)
+	if ack.Sequence != 42 || ack.Stream != "orders$3" || ack.Partition != 3 || !ack.Duplicate || !ack.Timestamp.Equal(now) {
+		t.Errorf("unexpected ack %+v", ack)
+	}
+	if ack := newProduceAck(&jetstream.PubAck{Stream: "orders", Sequence: 1}, "orders", now); ack.Partition != 1 {
+		t.Errorf("expected partition 1 for a station without partitions, got %v", ack.Partition)
+	}
+}
+
+func TestProduceWithAckDefaultOptions(t *testing.T) {
+	js := &ackingJetStream{released: make(chan struct{})}
+	close(js.released)
+	clock := &manualClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	c := &Conn{
+		js:                 js,
+		opts:               Options{Clock: clock},
+		stationPartitions:  map[string]*PartitionsUpdate{},
+		stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {}},
+	}
+	p := &Producer{conn: c, Name: "checkout", stationName: "orders"}
+
+	ack, err := p.ProduceWithAck([]byte("a"))
+	if err != nil {
+		t.Fatalf("produce with the default options: %v", err)
+	}
+	if ack == nil || ack.Sequence != 1 || !ack.Timestamp.Equal(clock.Now()) {
+		t.Fatalf("unexpected ack %+v", ack)
+	}
+	if ack, err := p.ProduceWithAck([]byte("b"), AsyncProduce()); err != nil || ack == nil || ack.Sequence != 2 {
+		t.Fatalf("AsyncProduce should be ignored, got %+v %v", ack, err)
+	}
+}
+
+func TestProducerEnrich(t *testing.T) {
+	p := &Producer{
+		conn: &Conn{opts: Options{DefaultHeaders: map[string]string{"service": "billing", "env": "prod"}}},
+		enricher: func(hdrs *Headers) error {
+			return hdrs.Add("trace-id", "abc")
+		},
+	}
+	hdrs := Headers{}
+	hdrs.New()
+	hdrs.Add("env", "staging")
+	if err := p.enrich(&hdrs); err != nil {
+		t.Fatal(err)
+	}
+	if got := hdrs.MsgHeaders["service"]; len(got) != 1 || got[0] != "billing" {
+		t.Errorf("default header service = %v", got)
+	}
+	if got := hdrs.MsgHeaders["env"]; got[0] != "staging" {
+		t.Errorf("message header was overridden by the default, env = %v", got)
+	}
+	if got := hdrs.MsgHeaders["trace-id"]; len(got) != 1 || got[0] != "abc" {
+		t.Errorf("enriched header trace-id = %v", got)
+	}
+
+	p.enricher = func(hdrs *Headers) error {
+		hdrs.MsgHeaders["$memphis_producedBy"] = []string{"spoofed"}
+		return nil
+	}
+	if err := p.enrich(&Headers{}); err == nil {
+		t.Error("expected an enricher setting $memphis headers to fail")
+	}
+	if err := DefaultHeaders(map[string]string{"$memphis_x": "y"})(&Options{}); err == nil {
+		t.Error("expected $memphis default headers to be rejected")
+	}
+}
+
+func TestProducerPartitionStream(t *testing.T) {
+	c := &Conn{stationPartitions: map[string]*PartitionsUpdate{
+		"orders": {PartitionsList: []int{1, 2, 3}},
+		"single": {PartitionsList: []int{1}},
+	}}
+	p := &Producer{conn: c, PartitionGenerator: newRoundRobinGenerator([]int{1, 2, 3})}
+
+	produceOpts := func(opts ...ProduceOpt) *ProduceOpts {
+		o := getDefaultProduceOpts()
+		for _, opt := range opts {
+			if err := opt(&o); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &o
+	}
+	header := func(value string) ProduceOpt {
+		hdrs := Headers{}
+		hdrs.New()
+		hdrs.Add(PartitionHeader, value)
+		return MsgHeaders(hdrs)
+	}
+
+	tests := []struct {
+		name    string
+		station string
+		opts    *ProduceOpts
+		stream  string
+		fails   bool
+	}{
+		{"number", "orders", produceOpts(ProducerPartitionNumber(2)), "orders$2", false},
+		{"missing partition", "orders", produceOpts(ProducerPartitionNumber(4)), "", true},
+		{"number and key", "orders", produceOpts(ProducerPartitionNumber(2), ProducerPartitionKey("k")), "", true},
+		{"header overrides the key", "orders", produceOpts(ProducerPartitionKey("k"), header("3")), "orders$3", false},
+		{"invalid header", "orders", produceOpts(header("three")), "", true},
+		{"single partition", "single", produceOpts(ProducerPartitionNumber(2)), "", true},
+		{"no partitions", "legacy", produceOpts(ProducerPartitionNumber(1)), "legacy", false},
+		{"no partitions out of range", "legacy", produceOpts(ProducerPartitionNumber(2)), "", true},
+	}
+	for _, tt := range tests {
+		stream, err := p.partitionStream(tt.opts, tt.station)
+		if (err != nil) != tt.fails || stream != tt.stream {
+			t.Errorf("%v: stream = %q, err = %v", tt.name, stream, err)
+		}
+		if _, ok := tt.opts.MsgHeaders.MsgHeaders[PartitionHeader]; ok {
+			t.Errorf("%v: the partition header should not be produced", tt.name)
+		}
+	}
+
+	if stream, err := p.partitionStream(produceOpts(ProducerPartitionKey("k")), "orders"); err != nil || stream == "" {
+		t.Errorf("key: stream = %q, err = %v", stream, err)
+	}
+	if err := ProducerPartitionNumber(0)(&ProduceOpts{}); err == nil {
+		t.Error("expected partition number 0 to be rejected")
+	}
+}
+
+// stalledJetStream - a broker which never acknowledges published messages.
+type stalledJetStream struct {
+	jetstream.JetStream
+	published int32
+}
+
+type pendingAck struct {
+	jetstream.PubAckFuture
+}
+
+func (pendingAck) Ok() <-chan *jetstream.PubAck { return nil }
+func (pendingAck) Err() <-chan error            { return nil }
+
+func (js *stalledJetStream) PublishMsgAsync(*nats.Msg, ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	atomic.AddInt32(&js.published, 1)
+	return pendingAck{}, nil
+}
+
+func TestProduceWithContext(t *testing.T) {
+	js := &stalledJetStream{}
+	c := &Conn{
+		js:                 js,
+		stationPartitions:  map[string]*PartitionsUpdate{},
+		stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {}},
+	}
+	p := &Producer{conn: c, stationName: "orders"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := p.ProduceWithContext(ctx, []byte("msg"), SyncProduce())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("waited %v for the ack", waited)
+	}
+
+	// async produce doesn't wait for the ack, a done context fails before publishing
+	if err := p.ProduceWithContext(context.Background(), []byte("msg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ProduceWithContext(ctx, []byte("msg")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if published := atomic.LoadInt32(&js.published); published != 2 {
+		t.Fatalf("published %d messages, want 2", published)
+	}
+
+	if err := p.Produce([]byte("msg"), ProduceContext(nil)); err == nil {
+		t.Fatalf("a nil context was accepted")
+	}
+}
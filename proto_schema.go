@@ -0,0 +1,144 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProtoSchema - a protobuf message type loaded from a compiled FileDescriptorSet, e.g. the output of
+// protoc --include_imports --descriptor_set_out, to validate and serialize messages while the broker provides
+// no schema for the station, e.g. when it can't be reached or in air-gapped test environments.
+type ProtoSchema struct {
+	descriptor   protoreflect.MessageDescriptor
+	mismatchOnce sync.Once
+}
+
+// LoadProtoSchema - loads the message type named messageName, fully qualified, from the descriptor set file at path.
+func LoadProtoSchema(path, messageName string) (*ProtoSchema, error) {
+	descriptorSet, err := os.ReadFile(path)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	return ParseProtoSchema(descriptorSet, messageName)
+}
+
+// ParseProtoSchema - loads the message type named messageName, fully qualified, from a serialized descriptor set,
+// e.g. one embedded with go:embed.
+func ParseProtoSchema(descriptorSet []byte, messageName string) (*ProtoSchema, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &set); err != nil {
+		return nil, memphisError(fmt.Errorf("invalid descriptor set: %w", err))
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, memphisError(fmt.Errorf("invalid descriptor set: %w", err))
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(messageName))
+	if err != nil {
+		return nil, memphisError(fmt.Errorf("message %v: %w", messageName, err))
+	}
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, memphisError(fmt.Errorf("%v is not a message", messageName))
+	}
+	return &ProtoSchema{descriptor: msgDesc}, nil
+}
+
+// ProtoSchema.Descriptor - the descriptor of the message type.
+func (s *ProtoSchema) Descriptor() protoreflect.MessageDescriptor {
+	return s.descriptor
+}
+
+// ProtoSchema.Validate - serializes message, a proto.Message, the json of one as a map[string]interface{}
+// or its wire format as []byte, and validates it against the message type.
+func (s *ProtoSchema) Validate(message any) ([]byte, error) {
+	sd := s.details()
+	return sd.validateProtoMsg(message)
+}
+
+func (s *ProtoSchema) details() schemaDetails {
+	return schemaDetails{
+		name:          string(s.descriptor.FullName()),
+		schemaType:    "protobuf",
+		msgDescriptor: s.descriptor,
+	}
+}
+
+// ProtoSchema.resolve - the broker's schema details, or the local schema's while the broker provides none.
+// A broker protobuf schema differing from the local one is reported once and takes precedence.
+func (s *ProtoSchema) resolve(sd schemaDetails, err error) (schemaDetails, error) {
+	if s == nil {
+		return sd, err
+	}
+	if err != nil || sd.schemaType == "" || (sd.schemaType == "protobuf" && sd.msgDescriptor == nil) {
+		return s.details(), nil
+	}
+	if sd.schemaType != "protobuf" || !sameMessage(sd.msgDescriptor, s.descriptor) {
+		s.mismatchOnce.Do(func() {
+			log.Printf("Warning: the %v schema %v of the station differs from the local schema %v, the station's schema is used",
+				sd.schemaType, sd.name, s.descriptor.FullName())
+		})
+	}
+	return sd, nil
+}
+
+// sameMessage - whether two message types have the same fields and nested types, regardless of the file they are in.
+func sameMessage(a, b protoreflect.MessageDescriptor) bool {
+	if a.Name() != b.Name() {
+		return false
+	}
+	return proto.Equal(protodesc.ToDescriptorProto(a), protodesc.ToDescriptorProto(b))
+}
+
+// ProducerProtoSchema - validates and serializes the produced messages with schema while the broker provides no
+// schema for the station.
+func ProducerProtoSchema(schema *ProtoSchema) ProducerOpt {
+	return func(opts *ProducerOpts) error {
+		if schema == nil {
+			return errors.New("proto schema can not be nil")
+		}
+		opts.ProtoSchema = schema
+		return nil
+	}
+}
+
+// ConsumerProtoSchema - validates and deserializes the consumed messages with schema while the broker provides no
+// schema for the station.
+func ConsumerProtoSchema(schema *ProtoSchema) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if schema == nil {
+			return errors.New("proto schema can not be nil")
+		}
+		opts.ProtoSchema = schema
+		return nil
+	}
+}
+
+// Msg.schemaDetails - the schema the message is validated and deserialized with.
+func (m *Msg) schemaDetails() (schemaDetails, error) {
+	if m.schemaCache != nil {
+		return m.schemaCache.get(m.conn, m.internalStationName, m.protoSchema)
+	}
+	return m.protoSchema.resolve(m.conn.getSchemaDetails(m.internalStationName))
+}
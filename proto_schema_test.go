@@ -0,0 +1,131 @@
+package memphis
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// orderDescriptorSet - a descriptor set of the test.Order message, the way protoc compiles it.
+func orderDescriptorSet(file string) *descriptorpb.FileDescriptorSet {
+	field := func(name string, number int32, fieldType descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     fieldType.Enum(),
+		}
+	}
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String(file),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				field("item", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			},
+		}},
+	}}}
+}
+
+func TestProtoSchema(t *testing.T) {
+	set := orderDescriptorSet("order.proto")
+	data := mustMarshal(t, set)
+	path := filepath.Join(t.TempDir(), "schema.pb")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := LoadProtoSchema(path, "test.Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseProtoSchema(data, "test.Missing"); err == nil {
+		t.Error("expected a missing message to be rejected")
+	}
+	if _, err := ParseProtoSchema([]byte("not a descriptor set"), "x"); err == nil {
+		t.Error("expected an invalid descriptor set to be rejected")
+	}
+
+	encoded, err := schema.Validate(map[string]interface{}{"id": "5", "item": "book"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the field order of the wire format isn't deterministic, compare the messages
+	got := dynamicpb.NewMessage(schema.Descriptor())
+	if err := proto.Unmarshal(encoded, got); err != nil {
+		t.Fatal(err)
+	}
+	want := dynamicpb.NewMessage(schema.Descriptor())
+	want.Set(schema.Descriptor().Fields().ByName("id"), protoreflect.ValueOfInt64(5))
+	want.Set(schema.Descriptor().Fields().ByName("item"), protoreflect.ValueOfString("book"))
+	if !proto.Equal(got, want) {
+		t.Fatalf("serialized %v, want %v", got, want)
+	}
+	if _, err := schema.Validate([]byte{0xff, 0xff}); err == nil {
+		t.Error("expected invalid wire format to fail")
+	}
+
+	// the local schema applies while the broker provides none
+	c := &Conn{stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {}}}
+	p := &Producer{conn: c, stationName: "orders", protoSchema: schema}
+	if sd, err := p.getSchemaDetails(); err != nil || sd.schemaType != "protobuf" || sd.msgDescriptor != schema.Descriptor() {
+		t.Fatalf("schema details %+v, err = %v", sd, err)
+	}
+	p.stationName = "unknown"
+	if _, err := p.validateMsg(map[string]interface{}{"id": "x"}, nil, false); err == nil {
+		t.Error("expected an invalid message to fail validation against the local schema")
+	}
+
+	msg := newTestMsg(string(encoded), nil)
+	msg.conn, msg.internalStationName, msg.protoSchema = c, "orders", schema
+	deserialized, err := msg.DataDeserialized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields, ok := deserialized.(map[string]interface{}); !ok || fields["id"] != "5" || fields["item"] != "book" {
+		t.Fatalf("deserialized %v", deserialized)
+	}
+
+	// a broker schema takes precedence, a different one is reported once
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	brokerSchema, err := ParseProtoSchema(mustMarshal(t, orderDescriptorSet("orders_1.proto")), "test.Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	same := schemaDetails{name: "orders", schemaType: "protobuf", msgDescriptor: brokerSchema.Descriptor()}
+	if sd, _ := schema.resolve(same, nil); sd.name != "orders" || logs.Len() != 0 {
+		t.Fatalf("resolved %v, logged %q", sd.name, logs.String())
+	}
+	other := schemaDetails{name: "timestamps", schemaType: "protobuf", msgDescriptor: (&timestamppb.Timestamp{}).ProtoReflect().Descriptor()}
+	schema.resolve(other, nil)
+	if sd, _ := schema.resolve(other, nil); sd.name != "timestamps" {
+		t.Fatalf("resolved %v, want the broker's schema", sd.name)
+	}
+	if strings.Count(logs.String(), "differs from the local schema") != 1 {
+		t.Errorf("logged %q", logs.String())
+	}
+}
+
+func mustMarshal(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+	data, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
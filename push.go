@@ -0,0 +1,166 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ConsumerErrPullConsumerGroup - ConsumeModePush was requested for a consumer group whose JetStream consumer
+// was created by the broker as a pull consumer.
+var ConsumerErrPullConsumerGroup = errors.New("the consumer group's consumer is a pull consumer, push mode is not available")
+
+// pushDelivery - checks that the consumer group's consumer of partition, described by info, is a push
+// consumer the SDK can subscribe to.
+func pushDelivery(partition int, info *nats.ConsumerInfo) error {
+	if info.Config.DeliverSubject == "" {
+		return fmt.Errorf("partition %d: %w", partition, ConsumerErrPullConsumerGroup)
+	}
+	return nil
+}
+
+// subscribePush - subscribes to the deliveries of the consumer group's own push consumer of every partition,
+// as a member of its deliver group when it has one. Nothing is subscribed unless all of them are push consumers.
+func (c *Consumer) subscribePush(jsConsumers map[int]jetstream.Consumer) ([]*nats.Subscription, error) {
+	js, err := c.conn.brokerConn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[int]*nats.ConsumerInfo, len(jsConsumers))
+	for partition, jsCons := range jsConsumers {
+		cached := jsCons.CachedInfo()
+		if cached == nil {
+			return nil, fmt.Errorf("partition %d has no consumer info", partition)
+		}
+		info, err := js.ConsumerInfo(cached.Stream, cached.Name)
+		if err != nil {
+			return nil, fmt.Errorf("consumer of partition %d: %w", partition, err)
+		}
+		if err := pushDelivery(partition, info); err != nil {
+			return nil, err
+		}
+		infos[partition] = info
+	}
+	subs := make([]*nats.Subscription, 0, len(infos))
+	for partition, info := range infos {
+		var sub *nats.Subscription
+		if info.Config.DeliverGroup != "" {
+			sub, err = js.QueueSubscribeSync("", info.Config.DeliverGroup, nats.Bind(info.Stream, info.Name), nats.ManualAck())
+		} else {
+			sub, err = js.SubscribeSync("", nats.Bind(info.Stream, info.Name), nats.ManualAck())
+		}
+		if err != nil {
+			unsubscribePush(subs)
+			return nil, fmt.Errorf("push subscription of partition %d: %w", partition, err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func unsubscribePush(subs []*nats.Subscription) {
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+}
+
+// consumePush - Consume in ConsumeModePush: the broker pushes messages to the consumer as they are stored
+// instead of the consumer polling for them. Only consumer groups the broker created as push consumers can be
+// consumed this way, the others fail with ConsumerErrPullConsumerGroup.
+func (c *Consumer) consumePush(handlerFunc ConsumeHandler, opts ConsumingOpts) error {
+	if !c.isSubscriptionActive() {
+		return memphisError(ConsumerErrStationUnreachable)
+	}
+	if opts.ConsumerPartitionKey != "" || opts.ConsumerPartitionNumber > 0 || opts.MaxBytes > 0 {
+		return memphisError(errors.New("partition keys, partition numbers and MaxBytes can't be used in push mode"))
+	}
+
+	ctx, err := c.startConsume()
+	if err != nil {
+		return err
+	}
+	subs, err := c.subscribePush(c.partitionConsumers())
+	if err != nil {
+		c.stopConsume(ConsumerStateStopped)
+		return memphisError(err)
+	}
+
+	// messages wait in the subscriptions until the handler is ready for them, once their pending limits are
+	// reached flow control stops the broker
+	msgsCh := make(chan *nats.Msg, c.BatchSize)
+	for _, sub := range subs {
+		go func(sub *nats.Subscription) {
+			for {
+				msg, err := sub.NextMsgWithContext(ctx)
+				if err != nil {
+					if ctx.Err() != nil || errors.Is(err, nats.ErrBadSubscription) || errors.Is(err, nats.ErrConnectionClosed) {
+						return
+					}
+					c.callErrHandler(memphisError(err))
+					continue
+				}
+				select {
+				case msgsCh <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(sub)
+	}
+
+	c.setDlsHandlerFunc(handlerFunc)
+	go func() {
+		defer unsubscribePush(subs)
+		c.deliverPushed(ctx, msgsCh, handlerFunc, opts.Filter)
+	}()
+	return nil
+}
+
+// deliverPushed - hands the pushed messages to handlerFunc as they arrive, in batches of up to BatchSize of the
+// messages already received, until ctx is done.
+func (c *Consumer) deliverPushed(ctx context.Context, msgsCh <-chan *nats.Msg, handlerFunc ConsumeHandler, filter MsgFilter) {
+	for {
+		if c.State() == ConsumerStatePaused {
+			select {
+			case <-ctx.Done():
+				return
+			case <-after(c.clock(), c.PullInterval):
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-msgsCh:
+			msgs := make([]*Msg, 0, c.BatchSize)
+			msgs = append(msgs, c.newMsg(msg))
+		drain:
+			for len(msgs) < c.BatchSize {
+				select {
+				case msg := <-msgsCh:
+					msgs = append(msgs, c.newMsg(msg))
+				default:
+					break drain
+				}
+			}
+			handlerFunc(c.filterMsgs(msgs, filter), nil, c.getContext())
+		}
+	}
+}
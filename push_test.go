@@ -0,0 +1,56 @@
+package memphis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestPushDelivery(t *testing.T) {
+	push := &nats.ConsumerInfo{Stream: "orders$1", Name: "workers",
+		Config: nats.ConsumerConfig{DeliverSubject: "_INBOX.workers", DeliverGroup: "workers"}}
+	if err := pushDelivery(1, push); err != nil {
+		t.Fatalf("unexpected error for a push consumer: %v", err)
+	}
+	pull := &nats.ConsumerInfo{Stream: "orders$2", Name: "workers"}
+	if err := pushDelivery(2, pull); !errors.Is(err, ConsumerErrPullConsumerGroup) {
+		t.Fatalf("expected a group with a pull consumer to be rejected, got %v", err)
+	}
+}
+
+func TestDeliverPushed(t *testing.T) {
+	c := &Consumer{stationName: "orders", BatchSize: 3, PullInterval: time.Millisecond}
+	msgsCh := make(chan *nats.Msg, 10)
+	for _, data := range []string{"a", "b", "c", "d"} {
+		msgsCh <- &nats.Msg{Subject: "orders", Data: []byte(data)}
+	}
+	batches := make(chan []string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.deliverPushed(ctx, msgsCh, func(msgs []*Msg, err error, _ context.Context) {
+			var batch []string
+			for _, msg := range msgs {
+				batch = append(batch, string(msg.Data()))
+			}
+			batches <- batch
+		}, func(msg *Msg) bool { return string(msg.Data()) != "b" })
+	}()
+
+	if got := <-batches; len(got) != 2 || got[0] != "a" || got[1] != "c" {
+		t.Fatalf("first batch %v, want the available messages up to the batch size without the filtered one", got)
+	}
+	if got := <-batches; len(got) != 1 || got[0] != "d" {
+		t.Fatalf("second batch %v", got)
+	}
+	cancel()
+	<-done
+
+	if err := (&Consumer{consumeMode: ConsumeModePush, subscriptionActive: true}).Consume(nil, ConsumerPartitionNumber(1)); err == nil {
+		t.Fatal("expected a partition number to be rejected in push mode")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	quarantineErrorHeader      = "memphis-quarantine-error"
+	quarantineStationHeader    = "memphis-quarantine-station"
+	quarantineDeliveriesHeader = "memphis-quarantine-deliveries"
+	quarantineTimeHeader       = "memphis-quarantine-time"
+	quarantineStationSuffix    = "-quarantine"
+)
+
+// PoisonClassifierFunc - decides whether a message the handler failed on with err is a poison message.
+type PoisonClassifierFunc func(msg *Msg, err error) bool
+
+// PoisonClassifier - messages classified as poison by Msg.Fail are terminated and forwarded, together
+// with the failure, to the consumer's quarantine station instead of being redelivered.
+func PoisonClassifier(classifier PoisonClassifierFunc) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		opts.PoisonClassifier = classifier
+		return nil
+	}
+}
+
+// QuarantineStation - the station poison messages are forwarded to, defaults to the consumed station name suffixed with "-quarantine".
+func QuarantineStation(stationName string) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if stationName == "" {
+			return errors.New("quarantine station name can not be empty")
+		}
+		opts.QuarantineStation = stationName
+		return nil
+	}
+}
+
+// PoisonAfter - classifies a message as poison once its handling failed on the given number of deliveries.
+func PoisonAfter(deliveries int) PoisonClassifierFunc {
+	return func(msg *Msg, err error) bool {
+		count, countErr := msg.DeliveryCount()
+		return countErr == nil && count >= deliveries
+	}
+}
+
+// Msg.Fail - reports that handling the message failed with cause. Poison messages, according to the consumer's
+// PoisonClassifier, are quarantined, other messages are retried according to the consumer's RetryPolicy.
+// Without either the message is left unacked and redelivered after MaxAckTime.
+func (m *Msg) Fail(cause error) error {
+	if m.poisonClassifier != nil && m.poisonClassifier(m, cause) {
+		return m.quarantine(cause)
+	}
+	if m.retryPolicy != nil {
+		return m.Retry(cause)
+	}
+	return nil
+}
+
+func (m *Msg) quarantine(cause error) error {
+	deliveries, err := m.DeliveryCount()
+	if err != nil {
+		return memphisError(err)
+	}
+	hdrs := map[string]string{
+		quarantineStationHeader:    m.internalStationName,
+		quarantineDeliveriesHeader: strconv.Itoa(deliveries),
+		quarantineTimeHeader:       time.Now().UTC().Format(time.RFC3339),
+	}
+	if cause != nil {
+		hdrs[quarantineErrorHeader] = cause.Error()
+	}
+	if err := m.forward(m.quarantineStation, fmt.Sprintf("%s-quarantine", m.cgName), hdrs); err != nil {
+		return memphisError(err)
+	}
+	return m.term()
+}
+
+// QuarantinedMsg - a message forwarded to a quarantine station along with its failure.
+type QuarantinedMsg struct {
+	*Msg
+	OriginStation string
+	Err           string
+	Deliveries    int
+	QuarantinedAt time.Time
+}
+
+func newQuarantinedMsg(msg *Msg) *QuarantinedMsg {
+	headers := msg.GetHeaders()
+	q := &QuarantinedMsg{
+		Msg:           msg,
+		OriginStation: headers[quarantineStationHeader],
+		Err:           headers[quarantineErrorHeader],
+	}
+	q.Deliveries, _ = strconv.Atoi(headers[quarantineDeliveriesHeader])
+	q.QuarantinedAt, _ = time.Parse(time.RFC3339, headers[quarantineTimeHeader])
+	return q
+}
+
+// QuarantinedMessages - fetches a batch of quarantined messages from the quarantine station using consumerName,
+// the messages stay in the quarantine station until they are requeued or discarded.
+func (c *Conn) QuarantinedMessages(quarantineStation, consumerName string, opts ...FetchOpt) ([]*QuarantinedMsg, error) {
+	msgs, err := c.FetchMessages(quarantineStation, consumerName, opts...)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	quarantined := make([]*QuarantinedMsg, 0, len(msgs))
+	for _, msg := range msgs {
+		quarantined = append(quarantined, newQuarantinedMsg(msg))
+	}
+	return quarantined, nil
+}
+
+// QuarantinedMsg.Requeue - produces the message back to its origin station and removes it from the quarantine station.
+func (q *QuarantinedMsg) Requeue() error {
+	if q.OriginStation == "" {
+		return memphisError(errors.New("quarantined message has no origin station"))
+	}
+	if q.conn == nil {
+		return memphisError(errors.New("message is not bound to a connection"))
+	}
+	var hdrs Headers
+	hdrs.New()
+	for k, v := range q.GetHeaders() {
+		if strings.HasPrefix(k, "memphis-quarantine-") || strings.HasPrefix(k, "memphis-forwarded-") {
+			continue
+		}
+		hdrs.MsgHeaders[k] = []string{v}
+	}
+	err := q.conn.Produce(q.OriginStation, fmt.Sprintf("%s-requeue", q.cgName), q.Data(), nil, []ProduceOpt{MsgHeaders(hdrs)})
+	if err != nil {
+		return memphisError(err)
+	}
+	return q.Ack()
+}
+
+// QuarantinedMsg.Discard - removes the message from the quarantine station.
+func (q *QuarantinedMsg) Discard() error {
+	return q.Ack()
+}
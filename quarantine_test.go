@@ -0,0 +1,50 @@
+package memphis
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMsgFailClassification(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5, InitialDelay: time.Second}
+	classifier := PoisonAfter(3)
+
+	retried := &retryRecordingMsg{delivered: 2}
+	msg := &Msg{msg: retried, retryPolicy: policy, poisonClassifier: classifier, quarantineStation: "orders-quarantine"}
+	if err := msg.Fail(errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	if retried.nakDelay != 2*time.Second || retried.termed {
+		t.Errorf("expected a non poison message to be retried, got delay %v termed %v", retried.nakDelay, retried.termed)
+	}
+
+	poison := &retryRecordingMsg{delivered: 3}
+	msg = &Msg{msg: poison, retryPolicy: policy, poisonClassifier: classifier, quarantineStation: "orders-quarantine"}
+	if err := msg.Fail(errors.New("failed")); err == nil {
+		t.Fatal("expected quarantining a message without a connection to fail")
+	}
+	if poison.termed || poison.nakDelay != 0 {
+		t.Errorf("a message that could not be quarantined should not be terminated or retried")
+	}
+
+	plain := &retryRecordingMsg{delivered: 1}
+	if err := (&Msg{msg: plain}).Fail(errors.New("failed")); err != nil || plain.termed || plain.nakDelay != 0 {
+		t.Errorf("without options Fail should leave the message unacked, got err %v", err)
+	}
+}
+
+func TestNewQuarantinedMsg(t *testing.T) {
+	at := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	msg := newTestMsg("payload", map[string]string{
+		quarantineStationHeader:    "orders",
+		quarantineErrorHeader:      "invalid payload",
+		quarantineDeliveriesHeader: "3",
+		quarantineTimeHeader:       at.Format(time.RFC3339),
+	})
+
+	q := newQuarantinedMsg(msg)
+	if q.OriginStation != "orders" || q.Err != "invalid payload" || q.Deliveries != 3 || !q.QuarantinedAt.Equal(at) {
+		t.Errorf("unexpected quarantined message %+v", q)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+// RawConsumer - consume the station as a plain byte pipe: the consumer doesn't subscribe to the station's schema
+// updates, messages are never validated against a schema and DataDeserialized returns the raw payload, and the
+// consumer group's dead-letter messages are not delivered to it. Can't be combined with ConsumerSchemaChanged.
+func RawConsumer() ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		opts.Raw = true
+		return nil
+	}
+}
+
+// Consumer.IsRaw - whether the consumer was created with RawConsumer.
+func (c *Consumer) IsRaw() bool {
+	return c.raw
+}
@@ -0,0 +1,54 @@
+package memphis
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestRawConsumer(t *testing.T) {
+	sd := schemaDetails{name: "order", schemaType: "json", activeVersion: SchemaVersion{Content: `{"type": "object", "required": ["id"]}`}}
+	if err := sd.compileJsonSchema(); err != nil {
+		t.Fatal(err)
+	}
+	c := &Conn{stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {schemaDetails: sd}}}
+	invalid := nats.NewMsg("orders")
+	invalid.Data = []byte(`{"name": "no id"}`)
+
+	schemaful := &Consumer{conn: c, stationName: "orders"}
+	if _, err := schemaful.newMsg(invalid).DataDeserialized(); err == nil {
+		t.Fatal("expected the invalid message to fail deserialization")
+	}
+
+	raw := &Consumer{conn: c, stationName: "orders", raw: true}
+	if !raw.IsRaw() || schemaful.IsRaw() {
+		t.Fatal("IsRaw does not report the consumer's mode")
+	}
+	msg := raw.newMsg(invalid)
+	if data, err := msg.DataDeserialized(); err != nil || string(data.([]byte)) != string(invalid.Data) {
+		t.Fatalf("expected the raw payload, got %v, %v", data, err)
+	}
+	if err := msg.validateSchema(); err != nil {
+		t.Fatalf("a raw message was validated: %v", err)
+	}
+
+	// a raw consumer has no schema updates entry for its station
+	raw = &Consumer{conn: &Conn{stationPartitions: map[string]*PartitionsUpdate{}}, stationName: "payments", raw: true}
+	if err := raw.handleCreationResp([]byte(`{"schema_update": {"schema_name": "payment"}, "partitions_update": {"partitions_list": [1, 2]}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if raw.PartitionGenerator == nil {
+		t.Fatal("partitions were not applied")
+	}
+
+	opts := getDefaultConsumerOptions()
+	opts.Name, opts.StationName, opts.ConsumerGroup = "worker", "orders", "worker"
+	for _, opt := range []ConsumerOpt{RawConsumer(), ConsumerSchemaChanged(func(SchemaChange) {})} {
+		if err := opt(&opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := opts.createConsumer(&Conn{}); err == nil {
+		t.Fatal("expected a raw consumer with a schema changed handler to be rejected")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// ErrNotReady - returned by Conn.Ready, wrapping the failed checks.
+var ErrNotReady = errors.New("memphis connection is not ready")
+
+// ReadyOpts - options for Conn.Ready.
+type ReadyOpts struct {
+	Stations []string
+}
+
+// ReadyOpt - a function on the options for Conn.Ready.
+type ReadyOpt func(*ReadyOpts) error
+
+// ReadyStations - stations which have to exist for the connection to be ready, on top of the stations of the
+// connection's producers and consumers. Use it to probe stations before their producers and consumers are created.
+func ReadyStations(names ...string) ReadyOpt {
+	return func(opts *ReadyOpts) error {
+		for _, name := range names {
+			if err := validateName(name, "station"); err != nil {
+				return err
+			}
+		}
+		opts.Stations = append(opts.Stations, names...)
+		return nil
+	}
+}
+
+// Ready - verifies the connection is usable: the broker accepted the connection and answers, JetStream is
+// available to the account, and the stations of the connection's producers and consumers, and those given with
+// ReadyStations, exist. Every failed check is wrapped with ErrNotReady. ctx bounds the whole probe, each check is
+// also bounded by the connection's operation timeout.
+func (c *Conn) Ready(ctx context.Context, opts ...ReadyOpt) error {
+	readyOpts := ReadyOpts{}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&readyOpts); err != nil {
+				return memphisError(err)
+			}
+		}
+	}
+	if err := c.checkBroker(ctx); err != nil {
+		return memphisError(fmt.Errorf("%w: broker: %v", ErrNotReady, err))
+	}
+	if err := c.checkJetStream(ctx); err != nil {
+		return memphisError(fmt.Errorf("%w: jetstream: %v", ErrNotReady, err))
+	}
+	return c.checkStations(ctx, c.readyStations(readyOpts.Stations))
+}
+
+// ReadyHandler - an http.Handler answering 200 when Ready succeeds and 503 with the failed checks otherwise,
+// to serve Kubernetes readiness probes.
+func (c *Conn) ReadyHandler(opts ...ReadyOpt) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := c.Ready(r.Context(), opts...); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+func (c *Conn) checkBroker(ctx context.Context) error {
+	if c.brokerConn == nil || !c.brokerConn.IsConnected() {
+		if c.brokerConn != nil && c.brokerConn.LastError() != nil {
+			return c.brokerConn.LastError()
+		}
+		return errors.New("not connected")
+	}
+	flushCtx, cancel := c.jetstreamContext(RequestOpts{Context: ctx})
+	defer cancel()
+	return c.brokerConn.FlushWithContext(flushCtx)
+}
+
+func (c *Conn) checkJetStream(ctx context.Context) error {
+	if c.js == nil {
+		return errors.New("not initialized")
+	}
+	jsCtx, cancel := c.jetstreamContext(RequestOpts{Context: ctx})
+	defer cancel()
+	_, err := c.js.AccountInfo(jsCtx)
+	return err
+}
+
+func (c *Conn) checkStations(ctx context.Context, stations []string) error {
+	var errs multiError
+	for _, name := range stations {
+		if err := ctx.Err(); err != nil {
+			errs.add(fmt.Errorf("%w: station %v: %v", ErrNotReady, name, err))
+			break
+		}
+		if _, err := c.listStationPartitions(getInternalName(name), RequestContext(ctx)); err != nil {
+			errs.add(fmt.Errorf("%w: station %v: %v", ErrNotReady, name, err))
+		}
+	}
+	return memphisError(errs.err())
+}
+
+// readyStations - the given stations and those of the connection's producers and consumers, deduplicated and sorted.
+func (c *Conn) readyStations(extra []string) []string {
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name != "" {
+			seen[getInternalName(name)] = true
+		}
+	}
+	for _, name := range extra {
+		add(name)
+	}
+	lockProducersMap.Lock()
+	for _, p := range c.producersMap {
+		switch stationName := p.stationName.(type) {
+		case string:
+			add(stationName)
+		case []string:
+			for _, name := range stationName {
+				add(name)
+			}
+		}
+	}
+	lockProducersMap.Unlock()
+	lockConsumersMap.Lock()
+	for _, consumer := range c.consumersMap {
+		add(consumer.stationName)
+	}
+	lockConsumersMap.Unlock()
+
+	stations := make([]string, 0, len(seen))
+	for name := range seen {
+		stations = append(stations, name)
+	}
+	sort.Strings(stations)
+	return stations
+}
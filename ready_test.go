@@ -0,0 +1,82 @@
+package memphis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type streamsJetStream struct {
+	jetstream.JetStream
+	streams    []string
+	accountErr error
+}
+
+func (js *streamsJetStream) AccountInfo(context.Context) (*jetstream.AccountInfo, error) {
+	if js.accountErr != nil {
+		return nil, js.accountErr
+	}
+	return &jetstream.AccountInfo{}, nil
+}
+
+func (js *streamsJetStream) StreamNames(context.Context, ...jetstream.StreamListOpt) jetstream.StreamNameLister {
+	names := make(chan string, len(js.streams))
+	for _, name := range js.streams {
+		names <- name
+	}
+	close(names)
+	return streamNames(names)
+}
+
+type streamNames chan string
+
+func (s streamNames) Name() <-chan string { return s }
+func (s streamNames) Err() error          { return nil }
+
+func TestReadyStations(t *testing.T) {
+	js := &streamsJetStream{streams: []string{"orders", "payments$1", "payments$2"}}
+	c := &Conn{js: js, producersMap: ProducersMap{}, consumersMap: ConsumersMap{}}
+	c.producersMap["p"] = &Producer{stationName: []string{"orders", "payments"}}
+	c.consumersMap["c"] = &Consumer{stationName: "Orders"}
+
+	stations := c.readyStations([]string{"refunds"})
+	if strings.Join(stations, ",") != "orders,payments,refunds" {
+		t.Fatalf("stations = %v", stations)
+	}
+	if err := c.checkJetStream(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	err := c.checkStations(context.Background(), stations)
+	if !errors.Is(err, ErrNotReady) || !strings.Contains(err.Error(), "refunds") || strings.Contains(err.Error(), "orders") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := c.checkStations(context.Background(), stations[:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	js.accountErr = jetstream.ErrJetStreamNotEnabledForAccount
+	if err := c.checkJetStream(context.Background()); !errors.Is(err, jetstream.ErrJetStreamNotEnabledForAccount) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	c := &Conn{}
+	if err := c.Ready(context.Background()); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("a connection without a broker connection is ready: %v", err)
+	}
+	if err := c.Ready(context.Background(), ReadyStations("")); err == nil || errors.Is(err, ErrNotReady) {
+		t.Fatalf("expected an invalid station name, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "broker") {
+		t.Fatalf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+}
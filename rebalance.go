@@ -0,0 +1,315 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// streamAdvisoriesSubject - JetStream advisories of created, updated and deleted streams, the last token is the stream name.
+const streamAdvisoriesSubject = "$JS.EVENT.ADVISORY.STREAM.*.*"
+
+// PartitionsChange - partitions added to or removed from the consumer's station at runtime.
+type PartitionsChange struct {
+	StationName string
+	Added       []int
+	Removed     []int
+	Partitions  []int
+}
+
+// PartitionsChangedHandler - called after the consumer started or stopped consuming from partitions of its station.
+type PartitionsChangedHandler func(c *Consumer, change PartitionsChange)
+
+// PartitionsChanged - call the handler whenever the consumer is rebalanced because partitions were added to or removed
+// from its station.
+func PartitionsChanged(handler PartitionsChangedHandler) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if handler == nil {
+			return errors.New("partitions changed handler can not be nil")
+		}
+		opts.PartitionsChanged = handler
+		return nil
+	}
+}
+
+// Conn.watchPartitions - subscribes once per connection to the stream advisories to learn about partitions
+// added to or removed from stations.
+func (c *Conn) watchPartitions() error {
+	c.partitionsWatchMu.Lock()
+	defer c.partitionsWatchMu.Unlock()
+	if c.partitionsWatchSub != nil {
+		return nil
+	}
+	sub, err := c.brokerConn.Subscribe(streamAdvisoriesSubject, c.handleStreamAdvisory)
+	if err != nil {
+		return memphisError(err)
+	}
+	c.partitionsWatchSub = sub
+	return nil
+}
+
+// Conn.unwatchPartitions - removes the stream advisories subscription.
+func (c *Conn) unwatchPartitions() error {
+	c.partitionsWatchMu.Lock()
+	defer c.partitionsWatchMu.Unlock()
+	if c.partitionsWatchSub == nil {
+		return nil
+	}
+	err := c.partitionsWatchSub.Unsubscribe()
+	c.partitionsWatchSub = nil
+	return memphisError(err)
+}
+
+func (c *Conn) handleStreamAdvisory(msg *nats.Msg) {
+	tokens := strings.Split(msg.Subject, ".")
+	if len(tokens) != 6 {
+		return
+	}
+	action, streamName := tokens[4], tokens[5]
+	if action != "CREATED" && action != "DELETED" {
+		return
+	}
+	i := strings.LastIndex(streamName, "$")
+	if i < 0 {
+		return
+	}
+	partition, err := strconv.Atoi(streamName[i+1:])
+	if err != nil {
+		return
+	}
+	c.applyPartitionUpdate(streamName[:i], partition, action == "CREATED")
+}
+
+// Conn.applyPartitionUpdate - records a partition added to or removed from a station, rebalances its consumers and
+// moves its producers' round robin to the new partitions.
+// Stations this connection has no partitions for are ignored.
+func (c *Conn) applyPartitionUpdate(internalStationName string, partition int, added bool) {
+	c.stationPartitionsMu.Lock()
+	pu := c.stationPartitions[internalStationName]
+	if pu == nil || len(pu.PartitionsList) == 0 {
+		c.stationPartitionsMu.Unlock()
+		return
+	}
+	partitionsList := make([]int, 0, len(pu.PartitionsList)+1)
+	found := false
+	for _, p := range pu.PartitionsList {
+		if p == partition {
+			found = true
+			if !added {
+				continue
+			}
+		}
+		partitionsList = append(partitionsList, p)
+	}
+	if found == added {
+		c.stationPartitionsMu.Unlock()
+		return
+	}
+	if added {
+		partitionsList = append(partitionsList, partition)
+		sort.Ints(partitionsList)
+	}
+	c.stationPartitions[internalStationName] = &PartitionsUpdate{PartitionsList: partitionsList}
+	c.stationPartitionsMu.Unlock()
+	action := "removed"
+	if added {
+		action = "added"
+	}
+	c.emit(Event{Type: EventPartitionsUpdated, Station: internalStationName, Partition: partition,
+		Details: map[string]string{"action": action, "partitions": fmt.Sprint(partitionsList)}})
+
+	lockConsumersMap.Lock()
+	var consumers []*Consumer
+	for _, consumer := range c.consumersMap {
+		if getInternalName(consumer.stationName) == internalStationName {
+			consumers = append(consumers, consumer)
+		}
+	}
+	lockConsumersMap.Unlock()
+	for _, consumer := range consumers {
+		consumer.rebalance(partitionsList)
+	}
+
+	lockProducersMap.Lock()
+	var producers []*Producer
+	for _, producer := range c.producersMap {
+		if sn, ok := producer.stationName.(string); ok && getInternalName(sn) == internalStationName {
+			producers = append(producers, producer)
+		}
+	}
+	lockProducersMap.Unlock()
+	for _, producer := range producers {
+		producer.setPartitions(partitionsList)
+	}
+}
+
+// Consumer.rebalance - starts consuming from the partitions the consumer doesn't have a JetStream consumer for and
+// stops consuming from the ones no longer in the list. The new JetStream consumers are looked up, and brought in line
+// with the consumer's settings, before partitionsMu is taken so fetches on the other partitions aren't blocked by the
+// broker round trips.
+func (c *Consumer) rebalance(partitionsList []int) {
+	if c.partition > 0 || !c.isSubscriptionActive() {
+		return
+	}
+	sn := getInternalName(c.stationName)
+	durable := getInternalName(c.ConsumerGroup)
+	change := PartitionsChange{StationName: c.stationName}
+	var errs []error
+
+	current := c.partitionConsumers()
+	added := make(map[int]jetstream.Consumer)
+	registered := false
+	for _, p := range partitionsList {
+		if _, ok := current[p]; ok {
+			continue
+		}
+		streamName := fmt.Sprintf("%s$%d", sn, p)
+		jsCons, err := c.conn.jetstreamConsumer(streamName, durable)
+		if errors.Is(err, jetstream.ErrConsumerNotFound) && !registered {
+			registered = true
+			if err = c.register(); err == nil {
+				jsCons, err = c.conn.jetstreamConsumer(streamName, durable)
+			}
+		}
+		if err != nil {
+			errs = append(errs, memphisError(fmt.Errorf("failed to consume from partition %d: %w", p, err)))
+			continue
+		}
+		added[p] = jsCons
+	}
+	if err := c.applyMaxAckPending(added); err != nil {
+		errs = append(errs, memphisError(fmt.Errorf("failed to apply max ack pending to the added partitions: %w", err)))
+	}
+	if err := c.applyInactiveThreshold(added); err != nil {
+		errs = append(errs, memphisError(fmt.Errorf("failed to apply the inactive threshold to the added partitions: %w", err)))
+	}
+
+	wanted := make(map[int]bool, len(partitionsList))
+	for _, p := range partitionsList {
+		wanted[p] = true
+	}
+	c.partitionsMu.Lock()
+	for p, jsCons := range added {
+		if _, ok := c.jsConsumers[p]; !ok {
+			c.jsConsumers[p] = jsCons
+			change.Added = append(change.Added, p)
+		}
+	}
+	for p := range c.jsConsumers {
+		if !wanted[p] {
+			delete(c.jsConsumers, p)
+			change.Removed = append(change.Removed, p)
+		}
+	}
+	for p := range c.jsConsumers {
+		change.Partitions = append(change.Partitions, p)
+	}
+	sort.Ints(change.Partitions)
+	if len(change.Partitions) > 0 {
+		c.PartitionGenerator = newRoundRobinGenerator(change.Partitions)
+	}
+	c.partitionsMu.Unlock()
+
+	for _, err := range errs {
+		c.callErrHandler(err)
+	}
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return
+	}
+	sort.Ints(change.Added)
+	sort.Ints(change.Removed)
+	c.notifyPartitionsUpdated()
+	if c.partitionsChanged != nil {
+		c.partitionsChanged(c, change)
+	}
+}
+
+// Consumer.register - sends the consumer's creation request to the broker again, the broker creates the consumer
+// group's JetStream consumers on the partitions added to the station since the group was created.
+func (c *Consumer) register() error {
+	b, err := json.Marshal(c.getCreationReq())
+	if err != nil {
+		return err
+	}
+	msg, err := c.conn.request(c.getCreationSubject(), b)
+	if err != nil {
+		return err
+	}
+	cr := &createConsumerResp{}
+	if err := json.Unmarshal(msg.Data, cr); err != nil {
+		return defaultHandleCreationResp(msg.Data)
+	}
+	if cr.Err != "" {
+		return errors.New(cr.Err)
+	}
+	return nil
+}
+
+// Consumer.jsConsumer - the JetStream consumer of a partition.
+func (c *Consumer) jsConsumer(partition int) (jetstream.Consumer, bool) {
+	c.partitionsMu.RLock()
+	defer c.partitionsMu.RUnlock()
+	jsCons, ok := c.jsConsumers[partition]
+	return jsCons, ok
+}
+
+// Consumer.partitionConsumers - a copy of the JetStream consumers by partition.
+func (c *Consumer) partitionConsumers() map[int]jetstream.Consumer {
+	c.partitionsMu.RLock()
+	defer c.partitionsMu.RUnlock()
+	jsConsumers := make(map[int]jetstream.Consumer, len(c.jsConsumers))
+	for p, jsCons := range c.jsConsumers {
+		jsConsumers[p] = jsCons
+	}
+	return jsConsumers
+}
+
+// Consumer.reportPending - lets the partition generator skip partitions without pending messages.
+func (c *Consumer) reportPending(partition int, pending uint64) {
+	if pg := c.partitionGenerator(); pg != nil {
+		pg.reportPending(partition, pending)
+	}
+}
+
+// Consumer.reportFetched - reports the messages still pending on a partition after a fetch, according to the
+// metadata of the last message fetched.
+func (c *Consumer) reportFetched(partition int, msgs []*Msg) {
+	pg := c.partitionGenerator()
+	if pg == nil {
+		return
+	}
+	var pending uint64
+	if len(msgs) > 0 {
+		md, err := msgs[len(msgs)-1].metadata()
+		if err != nil {
+			return
+		}
+		pending = md.NumPending
+	}
+	pg.reportPending(partition, pending)
+}
+
+func (c *Consumer) partitionGenerator() *RoundRobinProducerConsumerGenerator {
+	c.partitionsMu.RLock()
+	defer c.partitionsMu.RUnlock()
+	return c.PartitionGenerator
+}
@@ -0,0 +1,195 @@
+package memphis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type consumersJetStream struct {
+	jetstream.JetStream
+	streams  []string
+	onLookup func()
+}
+
+func (js *consumersJetStream) Consumer(_ context.Context, stream, _ string) (jetstream.Consumer, error) {
+	js.streams = append(js.streams, stream)
+	if js.onLookup != nil {
+		js.onLookup()
+	}
+	return &infoJsConsumer{info: &jetstream.ConsumerInfo{Stream: stream}}, nil
+}
+
+func TestRebalanceOnPartitionAdvisories(t *testing.T) {
+	js := &consumersJetStream{}
+	c := &Conn{js: js, stationPartitions: map[string]*PartitionsUpdate{}, consumersMap: ConsumersMap{}, producersMap: ProducersMap{}}
+	c.setStationPartitions("orders", &PartitionsUpdate{PartitionsList: []int{1, 2}})
+	producer := &Producer{conn: c, stationName: "orders", realName: "p", PartitionGenerator: newRoundRobinGenerator([]int{1, 2})}
+	c.producersMap.setProducer(producer)
+	var changes []PartitionsChange
+	consumer := &Consumer{
+		conn:               c,
+		stationName:        "orders",
+		ConsumerGroup:      "cg",
+		subscriptionActive: true,
+		jsConsumers:        map[int]jetstream.Consumer{1: &infoJsConsumer{}, 2: &infoJsConsumer{}},
+		PartitionGenerator: newRoundRobinGenerator([]int{1, 2}),
+		partitionsChanged: func(_ *Consumer, change PartitionsChange) {
+			changes = append(changes, change)
+		},
+	}
+	c.consumersMap.setConsumer(consumer)
+	js.onLookup = func() {
+		// fetches on the current partitions go on while the new partition's consumer is looked up
+		done := make(chan struct{})
+		go func() {
+			consumer.jsConsumer(2)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("partitions lock held during the JetStream consumer lookup")
+		}
+	}
+
+	c.handleStreamAdvisory(&nats.Msg{Subject: "$JS.EVENT.ADVISORY.STREAM.CREATED.orders$3"})
+	c.handleStreamAdvisory(&nats.Msg{Subject: "$JS.EVENT.ADVISORY.STREAM.CREATED.orders$3"})
+	c.handleStreamAdvisory(&nats.Msg{Subject: "$JS.EVENT.ADVISORY.STREAM.CREATED.payments$1"})
+	c.handleStreamAdvisory(&nats.Msg{Subject: "$JS.EVENT.ADVISORY.STREAM.DELETED.orders$1"})
+
+	if len(js.streams) != 1 || js.streams[0] != "orders$3" {
+		t.Fatalf("unexpected JetStream consumer lookups %v", js.streams)
+	}
+	if got := c.getStationPartitions("orders").PartitionsList; len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("station partitions = %v", got)
+	}
+	if len(changes) != 2 || changes[0].Added[0] != 3 || changes[1].Removed[0] != 1 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if got := changes[1].Partitions; len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("partitions after the change = %v", got)
+	}
+	seen := map[int]bool{}
+	for i := 0; i < 4; i++ {
+		p, err := consumer.resolvePartition("", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[p] = true
+	}
+	if len(seen) != 2 || !seen[2] || !seen[3] {
+		t.Errorf("round robin over %v, want partitions 2 and 3", seen)
+	}
+	produced := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		stream, err := producer.partitionStream(&ProduceOpts{MsgHeaders: Headers{MsgHeaders: map[string][]string{}}}, "orders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		produced[stream] = true
+	}
+	if len(produced) != 2 || !produced["orders$2"] || !produced["orders$3"] {
+		t.Errorf("producer round robin over %v, want partitions 2 and 3", produced)
+	}
+}
+
+// updatingConsumersJetStream - a broker looking up consumers with the broker's default config and recording
+// the consumer updates.
+type updatingConsumersJetStream struct {
+	consumerConfigJetStream
+}
+
+func (js *updatingConsumersJetStream) Consumer(_ context.Context, stream, durable string) (jetstream.Consumer, error) {
+	cfg := jetstream.ConsumerConfig{Durable: durable, MaxAckPending: 1000}
+	return &cachedInfoConsumer{info: &jetstream.ConsumerInfo{Stream: stream, Config: cfg}}, nil
+}
+
+func TestRebalanceAppliesMaxAckPending(t *testing.T) {
+	js := &updatingConsumersJetStream{}
+	consumer := &Consumer{
+		conn:               &Conn{js: js},
+		stationName:        "orders",
+		ConsumerGroup:      "cg",
+		subscriptionActive: true,
+		maxAckPending:      10,
+		jsConsumers:        map[int]jetstream.Consumer{1: &infoJsConsumer{}},
+	}
+	consumer.rebalance([]int{1, 2})
+
+	if len(js.updates) != 1 || js.updates[0].MaxAckPending != 10 || js.updates[0].Durable != "cg" {
+		t.Fatalf("expected only the added partition to be updated, got %+v", js.updates)
+	}
+	jsCons, ok := consumer.jsConsumer(2)
+	if !ok || jsCons.CachedInfo().Config.MaxAckPending != 10 {
+		t.Error("expected the added partition to be consumed with the updated consumer")
+	}
+}
+
+func TestRebalanceAppliesInactiveThreshold(t *testing.T) {
+	js := &updatingConsumersJetStream{}
+	consumer := &Consumer{
+		conn:               &Conn{js: js},
+		stationName:        "orders",
+		ConsumerGroup:      "cg",
+		subscriptionActive: true,
+		inactiveThreshold:  ephemeralInactiveThreshold,
+		jsConsumers:        map[int]jetstream.Consumer{1: &infoJsConsumer{}},
+	}
+	consumer.rebalance([]int{1, 2})
+
+	if len(js.updates) != 1 || js.updates[0].InactiveThreshold != ephemeralInactiveThreshold {
+		t.Fatalf("expected the added partition's durable to expire like the others, got %+v", js.updates)
+	}
+	jsCons, ok := consumer.jsConsumer(2)
+	if !ok || jsCons.CachedInfo().Config.InactiveThreshold != ephemeralInactiveThreshold {
+		t.Error("expected the added partition to be consumed with the updated consumer")
+	}
+}
+
+// pendingJsMsg - a message with the given number of messages pending after it.
+type pendingJsMsg struct {
+	jetstream.Msg
+	pending uint64
+}
+
+func (m *pendingJsMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumPending: m.pending}, nil
+}
+
+func TestPartitionGeneratorSkipsEmptyPartitions(t *testing.T) {
+	c := &Consumer{PartitionGenerator: newRoundRobinGenerator([]int{1, 2, 3})}
+	next := func(n int) []int {
+		var got []int
+		for i := 0; i < n; i++ {
+			got = append(got, c.PartitionGenerator.Next())
+		}
+		return got
+	}
+
+	c.reportFetched(2, nil)
+	c.reportPending(3, 0)
+	// empty partitions are polled again after partitionEmptySkips turns
+	if got := fmt.Sprint(next(5)); got != "[1 1 1 1 2]" {
+		t.Fatalf("partitions %v", got)
+	}
+
+	c.reportFetched(1, []*Msg{{msg: &pendingJsMsg{pending: 0}}})
+	c.reportFetched(2, []*Msg{{msg: &pendingJsMsg{pending: 5}}})
+	c.reportPending(3, 0)
+	if got := fmt.Sprint(next(3)); got != "[2 2 2]" {
+		t.Fatalf("partitions %v", got)
+	}
+
+	// with every partition empty the generator falls back to plain round robin
+	for _, p := range []int{1, 2, 3} {
+		c.reportPending(p, 0)
+	}
+	if got := fmt.Sprint(next(3)); got != "[3 1 2]" {
+		t.Fatalf("partitions %v", got)
+	}
+}
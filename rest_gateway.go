@@ -0,0 +1,375 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	restGatewayTimeout       = 30 * time.Second
+	restGatewayRefreshAhead  = time.Minute
+	defaultRestTokenExpiry   = 100 * time.Minute
+	defaultRestRefreshExpiry = 10000 * time.Minute
+	restGatewayAuthPath      = "/auth/authenticate"
+	restGatewayRefreshPath   = "/auth/refreshToken"
+	restGatewayProducePath   = "/stations/%s/produce/single"
+	restGatewayBatchPath     = "/stations/%s/produce/batch"
+)
+
+// RESTGatewayOpts - configuration options for the REST gateway transport.
+type RESTGatewayOpts struct {
+	URL                string
+	Username           string
+	Password           string
+	ConnectionToken    string
+	AccountId          int
+	TokenExpiry        time.Duration
+	RefreshTokenExpiry time.Duration
+	HTTPClient         *http.Client
+}
+
+// RESTGatewayOpt - a function on the options for the REST gateway transport.
+type RESTGatewayOpt func(*RESTGatewayOpts) error
+
+// RESTGatewayPassword - password of the application type user.
+func RESTGatewayPassword(password string) RESTGatewayOpt {
+	return func(opts *RESTGatewayOpts) error {
+		opts.Password = password
+		return nil
+	}
+}
+
+// RESTGatewayConnectionToken - connection token of the application type user.
+func RESTGatewayConnectionToken(token string) RESTGatewayOpt {
+	return func(opts *RESTGatewayOpts) error {
+		opts.ConnectionToken = token
+		return nil
+	}
+}
+
+// RESTGatewayAccountId - account id, cloud only.
+func RESTGatewayAccountId(accountId int) RESTGatewayOpt {
+	return func(opts *RESTGatewayOpts) error {
+		opts.AccountId = accountId
+		return nil
+	}
+}
+
+// RESTGatewayTokenExpiry - lifetime of the gateway's access and refresh tokens, defaults to 100 minutes and 10000 minutes.
+func RESTGatewayTokenExpiry(token, refreshToken time.Duration) RESTGatewayOpt {
+	return func(opts *RESTGatewayOpts) error {
+		if token < time.Minute || refreshToken < token {
+			return errors.New("token expiry has to be at least a minute and not greater than the refresh token expiry")
+		}
+		opts.TokenExpiry = token
+		opts.RefreshTokenExpiry = refreshToken
+		return nil
+	}
+}
+
+// RESTGatewayHTTPClient - the HTTP client used to call the gateway, defaults to a client with a 30 seconds timeout.
+func RESTGatewayHTTPClient(client *http.Client) RESTGatewayOpt {
+	return func(opts *RESTGatewayOpts) error {
+		opts.HTTPClient = client
+		return nil
+	}
+}
+
+// RESTGateway - a producer transport publishing through the memphis REST gateway over HTTP instead of a broker
+// connection, for environments where long lived connections are impractical. Safe for concurrent use.
+type RESTGateway struct {
+	opts               RESTGatewayOpts
+	mu                 sync.Mutex
+	jwt                string
+	jwtExpiresAt       time.Time
+	refreshToken       string
+	refreshTokenExpiry time.Time
+}
+
+type restGatewayAuthReq struct {
+	Username                    string `json:"username"`
+	Password                    string `json:"password,omitempty"`
+	ConnectionToken             string `json:"connection_token,omitempty"`
+	AccountId                   int    `json:"account_id,omitempty"`
+	TokenExpiryInMinutes        int    `json:"token_expiry_in_minutes"`
+	RefreshTokenExpiryInMinutes int    `json:"refresh_token_expiry_in_minutes"`
+}
+
+type restGatewayRefreshReq struct {
+	RefreshToken                string `json:"jwt_refresh_token"`
+	TokenExpiryInMinutes        int    `json:"token_expiry_in_minutes"`
+	RefreshTokenExpiryInMinutes int    `json:"refresh_token_expiry_in_minutes"`
+}
+
+type restGatewayAuthResp struct {
+	Jwt          string `json:"jwt"`
+	RefreshToken string `json:"jwt_refresh_token"`
+	Error        string `json:"message"`
+}
+
+type restGatewayProduceResp struct {
+	Success      bool     `json:"success"`
+	Error        string   `json:"error"`
+	SentMessages int      `json:"sent_messages"`
+	FailedMsgs   []string `json:"fail_messages_and_errors"`
+}
+
+// NewRESTGateway - creates a REST gateway transport, gatewayURL is the gateway's base url e.g. http://localhost:4444.
+func NewRESTGateway(gatewayURL, username string, opts ...RESTGatewayOpt) (*RESTGateway, error) {
+	u, err := url.Parse(gatewayURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, memphisError(fmt.Errorf("invalid REST gateway url %q", gatewayURL))
+	}
+	defaultOpts := RESTGatewayOpts{
+		URL:                strings.TrimSuffix(gatewayURL, "/"),
+		Username:           username,
+		TokenExpiry:        defaultRestTokenExpiry,
+		RefreshTokenExpiry: defaultRestRefreshExpiry,
+		HTTPClient:         &http.Client{Timeout: restGatewayTimeout},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	if (defaultOpts.Password == "") == (defaultOpts.ConnectionToken == "") {
+		return nil, memphisError(errors.New("you have to connect with one of the following methods: connection token / password"))
+	}
+	return &RESTGateway{opts: defaultOpts}, nil
+}
+
+// token - a valid access token, refreshed or re-authenticated when about to expire.
+func (g *RESTGateway) token(ctx context.Context, forceAuth bool) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	if !forceAuth && g.jwt != "" && now.Add(restGatewayRefreshAhead).Before(g.jwtExpiresAt) {
+		return g.jwt, nil
+	}
+	var resp restGatewayAuthResp
+	var err error
+	if !forceAuth && g.refreshToken != "" && now.Before(g.refreshTokenExpiry) {
+		err = g.post(ctx, restGatewayRefreshPath, "", restGatewayRefreshReq{
+			RefreshToken:                g.refreshToken,
+			TokenExpiryInMinutes:        int(g.opts.TokenExpiry / time.Minute),
+			RefreshTokenExpiryInMinutes: int(g.opts.RefreshTokenExpiry / time.Minute),
+		}, &resp)
+	}
+	if forceAuth || g.refreshToken == "" || !now.Before(g.refreshTokenExpiry) || err != nil {
+		err = g.post(ctx, restGatewayAuthPath, "", restGatewayAuthReq{
+			Username:                    g.opts.Username,
+			Password:                    g.opts.Password,
+			ConnectionToken:             g.opts.ConnectionToken,
+			AccountId:                   g.opts.AccountId,
+			TokenExpiryInMinutes:        int(g.opts.TokenExpiry / time.Minute),
+			RefreshTokenExpiryInMinutes: int(g.opts.RefreshTokenExpiry / time.Minute),
+		}, &resp)
+	}
+	if err != nil {
+		return "", fmt.Errorf("REST gateway authentication failed: %w", err)
+	}
+	if resp.Jwt == "" {
+		return "", errors.New("REST gateway authentication failed: no token returned")
+	}
+	g.jwt = resp.Jwt
+	g.jwtExpiresAt = now.Add(g.opts.TokenExpiry)
+	g.refreshToken = resp.RefreshToken
+	g.refreshTokenExpiry = now.Add(g.opts.RefreshTokenExpiry)
+	return g.jwt, nil
+}
+
+func (g *RESTGateway) post(ctx context.Context, path, jwt string, body any, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	res, err := g.do(ctx, path, jwt, "application/json", nil, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return decodeRESTGatewayResp(res, out)
+}
+
+func (g *RESTGateway) do(ctx context.Context, path, jwt, contentType string, headers map[string]string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.opts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
+	}
+	return g.opts.HTTPClient.Do(req)
+}
+
+func decodeRESTGatewayResp(res *http.Response, out any) error {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("REST gateway returned status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// produce - posts to a produce endpoint, authenticating again once if the token was rejected.
+func (g *RESTGateway) produce(ctx context.Context, path, contentType string, headers map[string]string, body []byte) (restGatewayProduceResp, error) {
+	var resp restGatewayProduceResp
+	for attempt := 0; attempt < 2; attempt++ {
+		jwt, err := g.token(ctx, attempt > 0)
+		if err != nil {
+			return resp, err
+		}
+		res, err := g.do(ctx, path, jwt, contentType, headers, body)
+		if err != nil {
+			return resp, err
+		}
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			res.Body.Close()
+			continue
+		}
+		err = decodeRESTGatewayResp(res, &resp)
+		res.Body.Close()
+		if err != nil {
+			return resp, err
+		}
+		if !resp.Success {
+			return resp, fmt.Errorf("REST gateway produce failed: %s", resp.Error)
+		}
+		return resp, nil
+	}
+	return resp, errors.New("REST gateway rejected the token")
+}
+
+// RESTGateway.CreateProducer - creates a producer for stationName publishing through the gateway.
+func (g *RESTGateway) CreateProducer(stationName string) *RESTProducer {
+	return &RESTProducer{gateway: g, stationName: stationName}
+}
+
+// RESTProducer - a producer publishing through the REST gateway, implements MessageProducer.
+// Only the MsgHeaders and MsgId produce options apply.
+type RESTProducer struct {
+	gateway     *RESTGateway
+	stationName string
+}
+
+// RESTProducer.Produce - produces a single message, []byte and string messages are sent as is, others as json.
+func (p *RESTProducer) Produce(message any, opts ...ProduceOpt) error {
+	return p.ProduceWithContext(context.Background(), message, opts...)
+}
+
+// RESTProducer.ProduceWithContext - produces a single message, the context bounds the HTTP calls.
+func (p *RESTProducer) ProduceWithContext(ctx context.Context, message any, opts ...ProduceOpt) error {
+	headers, err := restGatewayHeaders(opts)
+	if err != nil {
+		return memphisError(err)
+	}
+	contentType, body, err := restGatewayPayload(message)
+	if err != nil {
+		return memphisError(err)
+	}
+	_, err = p.gateway.produce(ctx, fmt.Sprintf(restGatewayProducePath, url.PathEscape(p.stationName)), contentType, headers, body)
+	return memphisError(err)
+}
+
+// RESTProducer.ProduceBatch - produces messages with a single HTTP call, the headers apply to all of them.
+// Messages are sent as json, []byte and string messages have to hold json documents.
+func (p *RESTProducer) ProduceBatch(ctx context.Context, messages []any, opts ...ProduceOpt) error {
+	headers, err := restGatewayHeaders(opts)
+	if err != nil {
+		return memphisError(err)
+	}
+	batch := make([]json.RawMessage, 0, len(messages))
+	for _, message := range messages {
+		switch m := message.(type) {
+		case []byte:
+			batch = append(batch, m)
+		case string:
+			batch = append(batch, json.RawMessage(m))
+		default:
+			data, err := json.Marshal(m)
+			if err != nil {
+				return memphisError(err)
+			}
+			batch = append(batch, data)
+		}
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return memphisError(err)
+	}
+	resp, err := p.gateway.produce(ctx, fmt.Sprintf(restGatewayBatchPath, url.PathEscape(p.stationName)), "application/json", headers, body)
+	if err != nil {
+		if len(resp.FailedMsgs) > 0 {
+			err = fmt.Errorf("%w: %d messages sent, failures: %s", err, resp.SentMessages, strings.Join(resp.FailedMsgs, "; "))
+		}
+		return memphisError(err)
+	}
+	return nil
+}
+
+// RESTProducer.Destroy - nothing to release, the gateway holds no per producer state.
+func (p *RESTProducer) Destroy(options ...RequestOpt) error {
+	return nil
+}
+
+func restGatewayHeaders(opts []ProduceOpt) (map[string]string, error) {
+	produceOpts := getDefaultProduceOpts()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&produceOpts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	headers := make(map[string]string, len(produceOpts.MsgHeaders.MsgHeaders))
+	for k, v := range produceOpts.MsgHeaders.MsgHeaders {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+	return headers, nil
+}
+
+func restGatewayPayload(message any) (string, []byte, error) {
+	switch m := message.(type) {
+	case []byte:
+		return "text/plain", m, nil
+	case string:
+		return "text/plain", []byte(m), nil
+	default:
+		data, err := json.Marshal(m)
+		return "application/json", data, err
+	}
+}
+
+var _ MessageProducer = (*RESTProducer)(nil)
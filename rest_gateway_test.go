@@ -0,0 +1,104 @@
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type fakeRESTGateway struct {
+	mu       sync.Mutex
+	auths    int
+	tokens   int
+	valid    string
+	produced []string
+	headers  []http.Header
+}
+
+func (f *fakeRESTGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case restGatewayAuthPath:
+		var req restGatewayAuthReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username != "app" || req.Password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.auths++
+		f.tokens++
+		f.valid = fmt.Sprintf("jwt-%d", f.tokens)
+		json.NewEncoder(w).Encode(map[string]string{"jwt": f.valid, "jwt_refresh_token": "refresh"})
+	case "/stations/orders/produce/single", "/stations/orders/produce/batch":
+		if r.Header.Get("Authorization") != "Bearer "+f.valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.produced = append(f.produced, string(body))
+		f.headers = append(f.headers, r.Header.Clone())
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRESTGatewayProduce(t *testing.T) {
+	fake := &fakeRESTGateway{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	gw, err := NewRESTGateway(srv.URL, "app", RESTGatewayPassword("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gw.CreateProducer("orders")
+
+	var hdrs Headers
+	hdrs.New()
+	hdrs.Add("source", "lambda")
+	if err := p.Produce("hello", MsgHeaders(hdrs), MsgId("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Produce(map[string]int{"id": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a token rejected by the gateway triggers a single re-authentication
+	fake.mu.Lock()
+	fake.valid = "rotated"
+	fake.mu.Unlock()
+	if err := p.ProduceBatch(context.Background(), []any{map[string]int{"id": 3}, `{"id":4}`}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.auths != 2 {
+		t.Errorf("expected 2 authentications, got %d", fake.auths)
+	}
+	expected := []string{"hello", `{"id":2}`, `[{"id":3},{"id":4}]`}
+	if len(fake.produced) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, fake.produced)
+	}
+	for i := range expected {
+		if fake.produced[i] != expected[i] {
+			t.Errorf("expected body %v, got %v", expected[i], fake.produced[i])
+		}
+	}
+	if fake.headers[0].Get("source") != "lambda" || fake.headers[0].Get("msg-id") != "1" || fake.headers[0].Get("Content-Type") != "text/plain" {
+		t.Errorf("unexpected headers %v", fake.headers[0])
+	}
+	if fake.headers[1].Get("Content-Type") != "application/json" {
+		t.Errorf("expected a json payload, got %v", fake.headers[1].Get("Content-Type"))
+	}
+
+	if _, err := NewRESTGateway(srv.URL, "app"); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDiscard - returned, or wrapped, by a result handler to terminate the message instead of redelivering it.
+var ErrDiscard = errors.New("discard message")
+
+// ResultHandler - handles a consumed batch, its result settles every message of the batch.
+type ResultHandler func(ctx context.Context, msgs []*Msg) error
+
+// MsgResultHandler - handles a single consumed message, its result settles the message.
+type MsgResultHandler func(ctx context.Context, msg *Msg) error
+
+// NakDelay - the delay before a message whose handler returned an error is redelivered, used by
+// ConsumeWithResult and ConsumeEachWithResult. By default it is redelivered right away.
+func NakDelay(delay time.Duration) ConsumingOpt {
+	return func(opts *ConsumingOpts) error {
+		if delay < 0 {
+			return errors.New("nak delay can not be negative")
+		}
+		opts.NakDelay = delay
+		return nil
+	}
+}
+
+// Msg.Settle - settles the message according to the result of handling it: it is acked when result is nil
+// and terminated when result is ErrDiscard. Other errors are handed to Msg.Fail when the consumer has a
+// RetryPolicy or a PoisonClassifier, otherwise the message is redelivered after nakDelay.
+func (m *Msg) Settle(result error, nakDelay time.Duration) error {
+	switch {
+	case result == nil:
+		return m.Ack()
+	case errors.Is(result, ErrDiscard):
+		return m.term()
+	case m.retryPolicy != nil || m.poisonClassifier != nil:
+		return m.Fail(result)
+	}
+	err := m.Delay(nakDelay)
+	if errors.Is(err, ConsumerErrDelayDlsMsg) {
+		// dead-letter messages can't be delayed, they are resent according to the station's dls policy
+		return nil
+	}
+	return err
+}
+
+// Consumer.ConsumeWithResult - like Consume, the messages of each batch are acked when handler returns nil,
+// terminated when it returns ErrDiscard and redelivered after NakDelay on any other error.
+// Empty batches are not handed to handler, fetch and settle errors are reported to the consumer's error handler.
+func (c *Consumer) ConsumeWithResult(handler ResultHandler, opts ...ConsumingOpt) error {
+	nakDelay, err := resultNakDelay(opts)
+	if err != nil {
+		return err
+	}
+	return c.Consume(func(msgs []*Msg, err error, ctx context.Context) {
+		if err != nil {
+			c.callErrHandler(err)
+		}
+		if len(msgs) == 0 {
+			return
+		}
+		result := handler(resultContext(ctx), msgs)
+		for _, msg := range msgs {
+			c.settle(msg, result, nakDelay)
+		}
+	}, opts...)
+}
+
+// Consumer.ConsumeEachWithResult - like ConsumeWithResult, calling handler for every message of the batch
+// in order and settling each message according to its own result.
+func (c *Consumer) ConsumeEachWithResult(handler MsgResultHandler, opts ...ConsumingOpt) error {
+	nakDelay, err := resultNakDelay(opts)
+	if err != nil {
+		return err
+	}
+	return c.Consume(func(msgs []*Msg, err error, ctx context.Context) {
+		if err != nil {
+			c.callErrHandler(err)
+		}
+		ctx = resultContext(ctx)
+		for _, msg := range msgs {
+			c.settle(msg, handler(ctx, msg), nakDelay)
+		}
+	}, opts...)
+}
+
+func (c *Consumer) settle(msg *Msg, result error, nakDelay time.Duration) {
+	if err := msg.Settle(result, nakDelay); err != nil {
+		c.callErrHandler(memphisError(fmt.Errorf("settle message: %w", err)))
+	}
+}
+
+// resultNakDelay - validates the consuming options and returns their nak delay.
+func resultNakDelay(opts []ConsumingOpt) (time.Duration, error) {
+	defaultOpts := getDefaultConsumingOptions()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return 0, memphisError(err)
+			}
+		}
+	}
+	return defaultOpts.NakDelay, nil
+}
+
+func resultContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
@@ -0,0 +1,159 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// settleRecordingMsg - records how a message was settled.
+type settleRecordingMsg struct {
+	jetstream.Msg
+	data    string
+	settled chan string
+}
+
+func (m *settleRecordingMsg) Data() []byte         { return []byte(m.data) }
+func (m *settleRecordingMsg) Headers() nats.Header { return nats.Header{} }
+func (m *settleRecordingMsg) Ack() error           { m.settled <- m.data + ":ack"; return nil }
+func (m *settleRecordingMsg) Term() error          { m.settled <- m.data + ":term"; return nil }
+func (m *settleRecordingMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: 1}, nil
+}
+func (m *settleRecordingMsg) NakWithDelay(d time.Duration) error {
+	m.settled <- fmt.Sprintf("%s:nak %v", m.data, d)
+	return nil
+}
+
+// onceJsConsumer - hands out its messages on the first fetch and nothing afterwards.
+type onceJsConsumer struct {
+	jetstream.Consumer
+	mu   sync.Mutex
+	msgs []jetstream.Msg
+}
+
+func (f *onceJsConsumer) Fetch(int, ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan jetstream.Msg, len(f.msgs))
+	for _, msg := range f.msgs {
+		ch <- msg
+	}
+	close(ch)
+	f.msgs = nil
+	return fakeBatch{msgs: ch}, nil
+}
+
+func newResultConsumer(settled chan string, data ...string) *Consumer {
+	js := &onceJsConsumer{}
+	for _, d := range data {
+		js.msgs = append(js.msgs, &settleRecordingMsg{data: d, settled: settled})
+	}
+	return &Consumer{
+		stationName:        "station",
+		BatchSize:          10,
+		PullInterval:       time.Millisecond,
+		subscriptionActive: true,
+		jsConsumers:        map[int]jetstream.Consumer{1: js},
+	}
+}
+
+func collectSettled(t *testing.T, settled chan string, n int) []string {
+	t.Helper()
+	var got []string
+	for len(got) < n {
+		select {
+		case s := <-settled:
+			got = append(got, s)
+		case <-time.After(time.Second):
+			t.Fatalf("settled %v, want %d messages", got, n)
+		}
+	}
+	return got
+}
+
+func TestConsumeEachWithResult(t *testing.T) {
+	settled := make(chan string, 10)
+	c := newResultConsumer(settled, "ok", "fail", "poison")
+	err := c.ConsumeEachWithResult(func(ctx context.Context, msg *Msg) error {
+		switch string(msg.Data()) {
+		case "fail":
+			return errors.New("temporary failure")
+		case "poison":
+			return fmt.Errorf("bad payload: %w", ErrDiscard)
+		}
+		return nil
+	}, NakDelay(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopConsume()
+
+	want := []string{"ok:ack", "fail:nak 1m0s", "poison:term"}
+	if got := collectSettled(t, settled, 3); !reflect.DeepEqual(got, want) {
+		t.Fatalf("settled %v, want %v", got, want)
+	}
+}
+
+func TestConsumeWithResult(t *testing.T) {
+	settled := make(chan string, 10)
+	c := newResultConsumer(settled, "a", "b")
+	calls := make(chan int, 10)
+	err := c.ConsumeWithResult(func(ctx context.Context, msgs []*Msg) error {
+		calls <- len(msgs)
+		return errors.New("batch failed")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopConsume()
+
+	want := []string{"a:nak 0s", "b:nak 0s"}
+	if got := collectSettled(t, settled, 2); !reflect.DeepEqual(got, want) {
+		t.Fatalf("settled %v, want %v", got, want)
+	}
+	if n := <-calls; n != 2 {
+		t.Fatalf("handler got %d msgs, want 2", n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(calls) != 0 {
+		t.Fatalf("the handler was called with empty batches")
+	}
+
+	if err := c.ConsumeWithResult(nil, NakDelay(-time.Second)); err == nil {
+		t.Fatalf("a negative nak delay was accepted")
+	}
+}
+
+func TestSettleWithRetryPolicy(t *testing.T) {
+	settled := make(chan string, 1)
+	raw := &settleRecordingMsg{data: "m", settled: settled}
+	msg := &Msg{msg: raw, retryPolicy: &RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second, Multiplier: 2}}
+	if err := msg.Settle(errors.New("failed"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// the retry policy's delay takes precedence over the nak delay
+	if got := <-settled; got != "m:nak 1s" {
+		t.Fatalf("settled %q, want m:nak 1s", got)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ResumeFromLastAck - when the consumer group already exists, resume precisely from the broker's last acked
+// position and ignore StartConsumeFromSequence, LastMessages and StartConsumeFromNow, which then only apply
+// to a new group. The resolved position is available with Consumer.StartSequences.
+func ResumeFromLastAck() ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		opts.ResumeFromLastAck = true
+		return nil
+	}
+}
+
+// Conn.consumerGroupExists - whether the broker holds a durable for the consumer group on the station.
+func (c *Conn) consumerGroupExists(stationName, consumerGroup string, options ...RequestOpt) (bool, error) {
+	partitions, err := c.GetStationPartitions(stationName, options...)
+	if errors.Is(err, errStationNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = c.jetstreamConsumer(partitions[0].StreamName, getInternalName(consumerGroup), options...)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) || errors.Is(err, jetstream.ErrStreamNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// startSequences - the stream sequence every partition's consumer starts from, the one after its ack floor.
+// The broker sets the ack floor of a new consumer right before its start position.
+func startSequences(jsConsumers map[int]jetstream.Consumer) map[int]uint64 {
+	sequences := make(map[int]uint64, len(jsConsumers))
+	for partition, jsConsumer := range jsConsumers {
+		if info := jsConsumer.CachedInfo(); info != nil {
+			sequences[partition] = info.AckFloor.Stream + 1
+		}
+	}
+	return sequences
+}
+
+// Consumer.StartSequences - the stream sequence the consumer started from on every partition, resolved from the
+// broker when the consumer was created, e.g. for logging or audit.
+func (c *Consumer) StartSequences() map[int]uint64 {
+	sequences := make(map[int]uint64, len(c.startSequences))
+	for partition, seq := range c.startSequences {
+		sequences[partition] = seq
+	}
+	return sequences
+}
+
+// Consumer.Resumed - whether the consumer was created with ResumeFromLastAck and resumed an existing group.
+func (c *Consumer) Resumed() bool {
+	return c.resumed
+}
@@ -0,0 +1,169 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	retryErrorHeader   = "memphis-retry-error"
+	retryAttemptHeader = "memphis-retry-attempts"
+	retryStationHeader = "memphis-retry-station"
+)
+
+var (
+	ConsumerErrNoRetryPolicy = errors.New("consumer has no retry policy")
+)
+
+// RetryPolicy - application level retries of messages whose handling failed. Failed messages are
+// redelivered with an exponentially growing delay, without blocking the rest of the station, and after
+// MaxAttempts deliveries they are forwarded to DeadLetterStation, if set, and terminated.
+type RetryPolicy struct {
+	MaxAttempts       int
+	InitialDelay      time.Duration
+	MaxDelay          time.Duration
+	Multiplier        float64
+	DeadLetterStation string
+}
+
+func (p *RetryPolicy) validate() error {
+	if p.MaxAttempts < 1 {
+		return errors.New("retry policy MaxAttempts has to be at least 1")
+	}
+	if p.InitialDelay <= 0 {
+		return errors.New("retry policy InitialDelay has to be positive")
+	}
+	if p.MaxDelay != 0 && p.MaxDelay < p.InitialDelay {
+		return errors.New("retry policy MaxDelay can not be lower than InitialDelay")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return errors.New("retry policy Multiplier can not be lower than 1")
+	}
+	return nil
+}
+
+// delay - the redelivery delay after the given failed delivery, starting from 1.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	d := float64(p.InitialDelay)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxDelay != 0 && d >= float64(p.MaxDelay) {
+			return p.MaxDelay
+		}
+	}
+	return time.Duration(d)
+}
+
+// ConsumerRetryPolicy - retry failed messages according to the policy, see Msg.Retry.
+// MaxMsgDeliveries is raised to MaxAttempts if lower.
+func ConsumerRetryPolicy(policy RetryPolicy) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		opts.RetryPolicy = &policy
+		return nil
+	}
+}
+
+// Msg.Retry - marks the handling of the message as failed with cause. The message is redelivered after
+// the consumer's retry policy delay, or forwarded to the policy's dead-letter station and terminated once
+// all attempts are used.
+func (m *Msg) Retry(cause error) error {
+	policy := m.retryPolicy
+	if policy == nil {
+		return memphisError(ConsumerErrNoRetryPolicy)
+	}
+	attempt, err := m.DeliveryCount()
+	if err != nil {
+		return memphisError(err)
+	}
+	if attempt < policy.MaxAttempts {
+		return m.Delay(policy.delay(attempt))
+	}
+	if policy.DeadLetterStation != "" {
+		if err := m.forwardToDeadLetter(policy.DeadLetterStation, attempt, cause); err != nil {
+			return memphisError(err)
+		}
+	}
+	return m.term()
+}
+
+// Msg.DeliveryCount - the number of times the message was delivered, including this delivery.
+func (m *Msg) DeliveryCount() (int, error) {
+	if msg, ok := m.msg.(*nats.Msg); ok {
+		md, err := msg.Metadata()
+		if err != nil {
+			return 0, err
+		}
+		return int(md.NumDelivered), nil
+	} else if jsMsg, ok := m.msg.(jetstream.Msg); ok {
+		md, err := jsMsg.Metadata()
+		if err != nil {
+			return 0, err
+		}
+		return int(md.NumDelivered), nil
+	}
+	return 0, errors.New("Message format is not supported")
+}
+
+func (m *Msg) term() error {
+	if msg, ok := m.msg.(*nats.Msg); ok {
+		return msg.Term()
+	} else if jsMsg, ok := m.msg.(jetstream.Msg); ok {
+		return jsMsg.Term()
+	}
+	return errors.New("Message format is not supported")
+}
+
+func (m *Msg) forwardToDeadLetter(station string, attempts int, cause error) error {
+	hdrs := map[string]string{
+		retryAttemptHeader: strconv.Itoa(attempts),
+		retryStationHeader: m.internalStationName,
+	}
+	if cause != nil {
+		hdrs[retryErrorHeader] = cause.Error()
+	}
+	return m.forward(station, fmt.Sprintf("%s-retry", m.cgName), hdrs)
+}
+
+// forward - produces the message's payload and headers, extended with extra, to station.
+func (m *Msg) forward(station, producerName string, extra map[string]string) error {
+	if m.conn == nil {
+		return errors.New("message is not bound to a connection")
+	}
+	var hdrs Headers
+	hdrs.New()
+	for k, v := range m.GetHeaders() {
+		hdrs.MsgHeaders[k] = []string{v}
+	}
+	for k, v := range m.forwardedHeaders() {
+		hdrs.MsgHeaders[k] = []string{v}
+	}
+	for k, v := range extra {
+		hdrs.MsgHeaders[k] = []string{v}
+	}
+	return m.conn.Produce(station, producerName, m.Data(), nil, []ProduceOpt{MsgHeaders(hdrs)})
+}
@@ -0,0 +1,76 @@
+package memphis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type retryRecordingMsg struct {
+	jetstream.Msg
+	delivered uint64
+	nakDelay  time.Duration
+	termed    bool
+}
+
+func (m *retryRecordingMsg) Headers() nats.Header { return nats.Header{} }
+func (m *retryRecordingMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: m.delivered}, nil
+}
+func (m *retryRecordingMsg) NakWithDelay(d time.Duration) error {
+	m.nakDelay = d
+	return nil
+}
+func (m *retryRecordingMsg) Term() error {
+	m.termed = true
+	return nil
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialDelay: time.Second, MaxDelay: 5 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, e := range expected {
+		if d := p.delay(i + 1); d != e {
+			t.Errorf("attempt %d: expected delay %v, got %v", i+1, e, d)
+		}
+	}
+
+	invalid := []RetryPolicy{
+		{MaxAttempts: 0, InitialDelay: time.Second},
+		{MaxAttempts: 1},
+		{MaxAttempts: 1, InitialDelay: time.Second, MaxDelay: time.Millisecond},
+		{MaxAttempts: 1, InitialDelay: time.Second, Multiplier: 0.5},
+	}
+	for _, p := range invalid {
+		if err := ConsumerRetryPolicy(p)(&ConsumerOpts{}); err == nil {
+			t.Errorf("expected policy %+v to be rejected", p)
+		}
+	}
+}
+
+func TestMsgRetry(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, InitialDelay: 100 * time.Millisecond}
+
+	first := &retryRecordingMsg{delivered: 2}
+	if err := (&Msg{msg: first, retryPolicy: policy}).Retry(errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	if first.nakDelay != 200*time.Millisecond || first.termed {
+		t.Errorf("expected a nak with 200ms delay, got %v (termed %v)", first.nakDelay, first.termed)
+	}
+
+	last := &retryRecordingMsg{delivered: 3}
+	if err := (&Msg{msg: last, retryPolicy: policy}).Retry(errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	if !last.termed || last.nakDelay != 0 {
+		t.Errorf("expected the message to be terminated after the last attempt")
+	}
+
+	if err := (&Msg{msg: last}).Retry(nil); !errors.Is(err, ConsumerErrNoRetryPolicy) {
+		t.Errorf("expected ConsumerErrNoRetryPolicy, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Router - dispatches every message of a consumer to the handler of the first route matching its headers, so
+// a station carrying several event types is multiplexed without a switch in every handler. Messages are settled
+// from the handler's result like with Consumer.ConsumeEachWithResult.
+type Router struct {
+	consumer *Consumer
+	routes   []route
+	fallback MsgResultHandler
+	err      error
+}
+
+type route struct {
+	header  string
+	value   string
+	handler MsgResultHandler
+}
+
+// Consumer.Route - a router for the consumer's messages, routes are added with On and Default.
+func (c *Consumer) Route() *Router {
+	return &Router{consumer: c}
+}
+
+// Router.On - routes messages whose header has value to handler, routes are matched in the order they were added.
+func (r *Router) On(header, value string, handler MsgResultHandler) *Router {
+	if handler == nil && r.err == nil {
+		r.err = fmt.Errorf("route %v=%v has no handler", header, value)
+	}
+	r.routes = append(r.routes, route{header: header, value: value, handler: handler})
+	return r
+}
+
+// Router.Default - handles the messages no route matches, without it they are acked.
+func (r *Router) Default(handler MsgResultHandler) *Router {
+	if handler == nil && r.err == nil {
+		r.err = errors.New("the default route has no handler")
+	}
+	r.fallback = handler
+	return r
+}
+
+// Router.Handle - routes a single message and returns the result of its handler, it is a MsgResultHandler
+// so a router can also be used with a KeyedDispatcher.
+func (r *Router) Handle(ctx context.Context, msg *Msg) error {
+	headers := msg.GetHeaders()
+	for _, route := range r.routes {
+		if value, ok := headers[route.header]; ok && value == route.value {
+			return route.handler(ctx, msg)
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback(ctx, msg)
+	}
+	return nil
+}
+
+// Router.Consume - starts consuming, every message is routed and settled according to its handler's result.
+func (r *Router) Consume(opts ...ConsumingOpt) error {
+	if r.err != nil {
+		return memphisError(r.err)
+	}
+	return r.consumer.ConsumeEachWithResult(r.Handle, opts...)
+}
+
+// Router.StopConsume - stops consuming, the batch being handled completes.
+func (r *Router) StopConsume() {
+	r.consumer.StopConsume()
+}
@@ -0,0 +1,79 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	var routed []string
+	handler := func(name string, result error) MsgResultHandler {
+		return func(ctx context.Context, msg *Msg) error {
+			routed = append(routed, name+":"+string(msg.Data()))
+			return result
+		}
+	}
+	r := (&Consumer{}).Route().
+		On("type", "order.created", handler("created", nil)).
+		On("type", "order.deleted", handler("deleted", errors.New("retry"))).
+		On("priority", "high", handler("urgent", nil))
+
+	msgs := []*Msg{
+		newTestMsg("a", map[string]string{"type": "order.created", "priority": "high"}),
+		newTestMsg("b", map[string]string{"type": "order.deleted"}),
+		newTestMsg("c", map[string]string{"priority": "high"}),
+		newTestMsg("d", map[string]string{"type": "order.updated"}),
+	}
+	var results []error
+	for _, msg := range msgs {
+		results = append(results, r.Handle(context.Background(), msg))
+	}
+	if want := []string{"created:a", "deleted:b", "urgent:c"}; !reflect.DeepEqual(routed, want) {
+		t.Fatalf("routed %v, want %v", routed, want)
+	}
+	if results[1] == nil || results[3] != nil {
+		t.Fatalf("unexpected results %v", results)
+	}
+
+	r.Default(handler("other", ErrDiscard))
+	if err := r.Handle(context.Background(), msgs[3]); !errors.Is(err, ErrDiscard) || routed[len(routed)-1] != "other:d" {
+		t.Fatalf("the default route wasn't used, err=%v routed=%v", err, routed)
+	}
+
+	if err := (&Consumer{}).Route().On("type", "x", nil).Consume(); err == nil {
+		t.Fatalf("a route without a handler was accepted")
+	}
+}
+
+func TestRouterConsume(t *testing.T) {
+	settled := make(chan string, 10)
+	c := newResultConsumer(settled, "a", "b")
+	err := c.Route().Default(func(ctx context.Context, msg *Msg) error {
+		if string(msg.Data()) == "b" {
+			return ErrDiscard
+		}
+		return nil
+	}).Consume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.StopConsume()
+	if got, want := collectSettled(t, settled, 2), []string{"a:ack", "b:term"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("settled %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// RouteFunc - chooses the station a message is produced to from the message and its headers.
+type RouteFunc func(message any, headers map[string]string) (string, error)
+
+// HeaderRoute - routes messages by the value of a header, stations maps header values to stations. Messages with
+// another value, or without the header, are produced to fallback, they fail when it is empty.
+func HeaderRoute(header string, stations map[string]string, fallback string) RouteFunc {
+	return func(message any, headers map[string]string) (string, error) {
+		if station, ok := stations[headers[header]]; ok {
+			return station, nil
+		}
+		if fallback == "" {
+			return "", fmt.Errorf("no station for %v=%q", header, headers[header])
+		}
+		return fallback, nil
+	}
+}
+
+// routedProducer - the producer of a single station used by a RoutingProducer, implemented by *Producer.
+type routedProducer interface {
+	ProduceWithContext(ctx context.Context, message any, opts ...ProduceOpt) error
+	Destroy(options ...RequestOpt) error
+}
+
+// RoutingProducer - produces every message to the station chosen by a RouteFunc, the producers of the stations
+// are created on first use and cached. It is the producer side counterpart of a consumer Router for fan-out
+// topologies.
+type RoutingProducer struct {
+	name   string
+	route  RouteFunc
+	create func(station string) (routedProducer, error)
+
+	mu        sync.Mutex
+	producers map[string]routedProducer
+	destroyed bool
+}
+
+// Conn.CreateRoutingProducer - creates a routing producer, the producers it creates for the stations are named name
+// and created with opts.
+func (c *Conn) CreateRoutingProducer(name string, route RouteFunc, opts ...ProducerOpt) (*RoutingProducer, error) {
+	if route == nil {
+		return nil, memphisError(errors.New("a routing producer requires a route function"))
+	}
+	return &RoutingProducer{
+		name:  name,
+		route: route,
+		create: func(station string) (routedProducer, error) {
+			return c.CreateProducer(station, name, opts...)
+		},
+		producers: map[string]routedProducer{},
+	}, nil
+}
+
+// RoutingProducer.Produce - produces message to the station chosen for it.
+func (r *RoutingProducer) Produce(message any, opts ...ProduceOpt) error {
+	return r.ProduceWithContext(context.Background(), message, opts...)
+}
+
+// RoutingProducer.ProduceWithContext - produces message to the station chosen for it like Producer.ProduceWithContext.
+func (r *RoutingProducer) ProduceWithContext(ctx context.Context, message any, opts ...ProduceOpt) error {
+	produceOpts := getDefaultProduceOpts()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&produceOpts); err != nil {
+				return memphisError(err)
+			}
+		}
+	}
+	headers := make(map[string]string, len(produceOpts.MsgHeaders.MsgHeaders))
+	for key, values := range produceOpts.MsgHeaders.MsgHeaders {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+	station, err := r.route(message, headers)
+	if err != nil {
+		return memphisError(fmt.Errorf("route message: %w", err))
+	}
+	p, err := r.producer(station)
+	if err != nil {
+		return err
+	}
+	return p.ProduceWithContext(ctx, message, opts...)
+}
+
+// RoutingProducer.Stations - the stations a producer was created for.
+func (r *RoutingProducer) Stations() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stations := make([]string, 0, len(r.producers))
+	for station := range r.producers {
+		stations = append(stations, station)
+	}
+	return stations
+}
+
+// RoutingProducer.Destroy - destroys the producers of every station, returns the first error.
+func (r *RoutingProducer) Destroy(options ...RequestOpt) error {
+	r.mu.Lock()
+	producers := r.producers
+	r.producers = map[string]routedProducer{}
+	r.destroyed = true
+	r.mu.Unlock()
+	var firstErr error
+	for _, p := range producers {
+		if err := p.Destroy(options...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// producer - the cached producer of station, created on first use.
+func (r *RoutingProducer) producer(station string) (routedProducer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.destroyed {
+		return nil, memphisError(errors.New("routing producer is destroyed"))
+	}
+	if p, ok := r.producers[station]; ok {
+		return p, nil
+	}
+	p, err := r.create(station)
+	if err != nil {
+		return nil, memphisError(fmt.Errorf("create producer for %v: %w", station, err))
+	}
+	r.producers[station] = p
+	return p, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type recordingRoutedProducer struct {
+	station   string
+	produced  *[]string
+	destroyed bool
+}
+
+func (p *recordingRoutedProducer) ProduceWithContext(ctx context.Context, message any, opts ...ProduceOpt) error {
+	*p.produced = append(*p.produced, p.station+":"+string(message.([]byte)))
+	return nil
+}
+
+func (p *recordingRoutedProducer) Destroy(...RequestOpt) error {
+	p.destroyed = true
+	return nil
+}
+
+func TestRoutingProducer(t *testing.T) {
+	r, err := (&Conn{}).CreateRoutingProducer("router", HeaderRoute("region", map[string]string{"eu": "orders-eu", "us": "orders-us"}, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var produced []string
+	created := map[string]*recordingRoutedProducer{}
+	r.create = func(station string) (routedProducer, error) {
+		p := &recordingRoutedProducer{station: station, produced: &produced}
+		created[station] = p
+		return p, nil
+	}
+
+	for _, m := range []struct{ region, data string }{{"eu", "a"}, {"us", "b"}, {"eu", "c"}} {
+		hdrs := Headers{}
+		hdrs.New()
+		hdrs.Add("region", m.region)
+		if err := r.Produce([]byte(m.data), MsgHeaders(hdrs)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"orders-eu:a", "orders-us:b", "orders-eu:c"}; !reflect.DeepEqual(produced, want) {
+		t.Fatalf("produced %v, want %v", produced, want)
+	}
+	stations := r.Stations()
+	sort.Strings(stations)
+	if !reflect.DeepEqual(stations, []string{"orders-eu", "orders-us"}) {
+		t.Fatalf("created producers for %v", stations)
+	}
+	if err := r.Produce([]byte("d")); err == nil {
+		t.Fatalf("a message without a route was produced")
+	}
+
+	if err := r.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if !created["orders-eu"].destroyed || !created["orders-us"].destroyed {
+		t.Fatalf("the station producers weren't destroyed")
+	}
+	if err := r.Produce([]byte("e")); err == nil {
+		t.Fatalf("a destroyed routing producer produced")
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CorrelationIDHeader - the header correlating the messages of a saga across stations.
+const CorrelationIDHeader = "memphis-correlation-id"
+
+// ErrSagaAbort - returned, or wrapped, by a step handler to abort the saga, the compensations of the steps completed
+// before run in reverse order and the message is acked.
+var ErrSagaAbort = errors.New("abort saga")
+
+// CorrelationID - sets the correlation id of a produced message, apply it after MsgHeaders.
+func CorrelationID(id string) ProduceOpt {
+	return func(opts *ProduceOpts) error {
+		if id == "" {
+			return errors.New("correlation id can not be empty")
+		}
+		if opts.MsgHeaders.MsgHeaders == nil {
+			opts.MsgHeaders.New()
+		}
+		opts.MsgHeaders.MsgHeaders[CorrelationIDHeader] = []string{id}
+		return nil
+	}
+}
+
+// SagaStatus - the status of a saga instance.
+type SagaStatus string
+
+const (
+	SagaRunning   SagaStatus = "running"
+	SagaCompleted SagaStatus = "completed"
+	SagaAborted   SagaStatus = "aborted"
+	SagaTimedOut  SagaStatus = "timed_out"
+)
+
+// SagaState - the persisted state of a saga instance, it is JSON serializable.
+type SagaState struct {
+	ID     string     `json:"id"`
+	Status SagaStatus `json:"status"`
+	// Steps - the completed steps, in order.
+	Steps []string `json:"steps"`
+	// Data - the state step handlers share, it has to be JSON serializable for persistent stores.
+	Data      map[string]any `json:"data,omitempty"`
+	StartedAt time.Time      `json:"started_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	// Deadline - when the saga times out, zero without a SagaTimeout.
+	Deadline time.Time `json:"deadline,omitempty"`
+	Err      string    `json:"err,omitempty"`
+}
+
+// SagaState.Complete - marks the saga completed once the current step succeeds.
+func (s *SagaState) Complete() {
+	s.Status = SagaCompleted
+}
+
+// SagaStore - persists saga states, e.g. in a database or a key value bucket.
+type SagaStore interface {
+	// Load - the state of the saga, nil when it doesn't exist.
+	Load(ctx context.Context, id string) (*SagaState, error)
+	Save(ctx context.Context, state *SagaState) error
+	// Expired - the running sagas whose deadline is before now.
+	Expired(ctx context.Context, now time.Time) ([]*SagaState, error)
+}
+
+// MemorySagaStore - an in-memory saga store, for tests and sagas which don't need to survive a restart.
+type MemorySagaStore struct {
+	mu     sync.Mutex
+	states map[string]SagaState
+}
+
+// NewMemorySagaStore - creates an empty in-memory saga store.
+func NewMemorySagaStore() *MemorySagaStore {
+	return &MemorySagaStore{states: map[string]SagaState{}}
+}
+
+func (m *MemorySagaStore) Load(ctx context.Context, id string) (*SagaState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.states[id]
+	if !ok {
+		return nil, nil
+	}
+	return copySagaState(state), nil
+}
+
+func (m *MemorySagaStore) Save(ctx context.Context, state *SagaState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[state.ID] = *copySagaState(*state)
+	return nil
+}
+
+func (m *MemorySagaStore) Expired(ctx context.Context, now time.Time) ([]*SagaState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired []*SagaState
+	for _, state := range m.states {
+		if state.Status == SagaRunning && !state.Deadline.IsZero() && state.Deadline.Before(now) {
+			expired = append(expired, copySagaState(state))
+		}
+	}
+	return expired, nil
+}
+
+func copySagaState(state SagaState) *SagaState {
+	state.Steps = append([]string(nil), state.Steps...)
+	data := make(map[string]any, len(state.Data))
+	for k, v := range state.Data {
+		data[k] = v
+	}
+	state.Data = data
+	return &state
+}
+
+// StepHandler - handles a message of a saga step, it can read and update saga.Data and call saga.Complete.
+// The message is settled from its result like with Consumer.ConsumeEachWithResult, ErrSagaAbort aborts the saga.
+type StepHandler func(ctx context.Context, saga *SagaState, msg *Msg) error
+
+// CompensateFunc - undoes a completed step when its saga is aborted or times out.
+type CompensateFunc func(ctx context.Context, saga *SagaState) error
+
+// SagaOpts - configuration options for a saga.
+type SagaOpts struct {
+	Timeout   time.Duration
+	OnTimeout func(ctx context.Context, saga *SagaState)
+	Clock     Clock
+}
+
+// SagaOpt - a function on the options for a saga.
+type SagaOpt func(*SagaOpts) error
+
+// SagaTimeout - the time a saga instance has to complete from its first step, by default it never times out.
+func SagaTimeout(timeout time.Duration) SagaOpt {
+	return func(opts *SagaOpts) error {
+		if timeout <= 0 {
+			return errors.New("saga timeout has to be positive")
+		}
+		opts.Timeout = timeout
+		return nil
+	}
+}
+
+// OnSagaTimeout - called for every saga which timed out, after its compensations ran.
+func OnSagaTimeout(handler func(ctx context.Context, saga *SagaState)) SagaOpt {
+	return func(opts *SagaOpts) error {
+		opts.OnTimeout = handler
+		return nil
+	}
+}
+
+// SagaClock - the time source of the saga's deadlines, default is the system clock.
+func SagaClock(clock Clock) SagaOpt {
+	return func(opts *SagaOpts) error {
+		if clock == nil {
+			return errors.New("clock can not be nil")
+		}
+		opts.Clock = clock
+		return nil
+	}
+}
+
+type sagaStep struct {
+	handler    StepHandler
+	compensate CompensateFunc
+}
+
+// Saga - orchestrates a workflow spanning several stations: messages are correlated by their CorrelationIDHeader,
+// every step's handler runs with the state of its saga instance, which is persisted in a SagaStore after each step.
+// A saga instance is started by the first message of its correlation id. Messages of the same instance are handled
+// one at a time within a process, sagas consumed by several processes should be partitioned by correlation id,
+// e.g. with ProducerPartitionKey.
+type Saga struct {
+	name  string
+	store SagaStore
+	opts  SagaOpts
+
+	mu    sync.Mutex
+	steps map[string]sagaStep
+	locks map[string]*sagaLock
+}
+
+type sagaLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewSaga - creates a saga persisting its instances in store.
+func NewSaga(name string, store SagaStore, opts ...SagaOpt) (*Saga, error) {
+	if store == nil {
+		return nil, memphisError(errors.New("a saga requires a store"))
+	}
+	defaultOpts := SagaOpts{Clock: SystemClock()}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	return &Saga{name: name, store: store, opts: defaultOpts, steps: map[string]sagaStep{}, locks: map[string]*sagaLock{}}, nil
+}
+
+// Saga.OnStep - sets the handler of a step and the compensation undoing it, compensate may be nil.
+func (s *Saga) OnStep(step string, handler StepHandler, compensate CompensateFunc) *Saga {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps[step] = sagaStep{handler: handler, compensate: compensate}
+	return s
+}
+
+// Saga.Consume - handles the consumer's messages as the given step.
+func (s *Saga) Consume(step string, consumer *Consumer, opts ...ConsumingOpt) error {
+	return consumer.ConsumeEachWithResult(func(ctx context.Context, msg *Msg) error {
+		return s.Handle(ctx, step, msg)
+	}, opts...)
+}
+
+// Saga.Handle - handles a message as the given step of the saga instance it is correlated with. Messages without
+// a correlation id and messages of instances which are no longer running are discarded.
+func (s *Saga) Handle(ctx context.Context, step string, msg *Msg) error {
+	s.mu.Lock()
+	def, ok := s.steps[step]
+	s.mu.Unlock()
+	if !ok || def.handler == nil {
+		return fmt.Errorf("saga %v has no step %v", s.name, step)
+	}
+	id := msg.GetHeaders()[CorrelationIDHeader]
+	if id == "" {
+		return fmt.Errorf("message without a correlation id: %w", ErrDiscard)
+	}
+	unlock := s.lock(id)
+	defer unlock()
+
+	state, err := s.store.Load(ctx, id)
+	if err != nil {
+		return fmt.Errorf("load saga %v: %w", id, err)
+	}
+	now := s.opts.Clock.Now()
+	if state == nil {
+		state = &SagaState{ID: id, Status: SagaRunning, Data: map[string]any{}, StartedAt: now}
+		if s.opts.Timeout > 0 {
+			state.Deadline = now.Add(s.opts.Timeout)
+		}
+	}
+	if state.Status != SagaRunning {
+		return fmt.Errorf("saga %v is %v: %w", id, state.Status, ErrDiscard)
+	}
+
+	result := def.handler(ctx, state, msg)
+	switch {
+	case errors.Is(result, ErrSagaAbort):
+		return s.abort(ctx, state, SagaAborted, result)
+	case result != nil:
+		// the step is retried with the state it started from
+		return result
+	}
+	state.Steps = append(state.Steps, step)
+	state.UpdatedAt = now
+	if err := s.store.Save(ctx, state); err != nil {
+		return fmt.Errorf("save saga %v: %w", id, err)
+	}
+	return nil
+}
+
+// Saga.CheckTimeouts - aborts the running sagas past their deadline, compensating their steps and calling the
+// OnSagaTimeout handler. Returns the first error, the other sagas are still checked.
+func (s *Saga) CheckTimeouts(ctx context.Context) error {
+	expired, err := s.store.Expired(ctx, s.opts.Clock.Now())
+	if err != nil {
+		return memphisError(err)
+	}
+	var firstErr error
+	for _, candidate := range expired {
+		if err := s.timeout(ctx, candidate.ID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Saga.WatchTimeouts - calls CheckTimeouts every interval until ctx is done, errors are passed to errHandler
+// when it isn't nil.
+func (s *Saga) WatchTimeouts(ctx context.Context, interval time.Duration, errHandler func(error)) {
+	ticker := s.opts.Clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		if err := s.CheckTimeouts(ctx); err != nil && errHandler != nil {
+			errHandler(err)
+		}
+	}
+}
+
+// timeout - aborts a saga which expired, unless a step completed it meanwhile.
+func (s *Saga) timeout(ctx context.Context, id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+	state, err := s.store.Load(ctx, id)
+	if err != nil || state == nil || state.Status != SagaRunning {
+		return err
+	}
+	if err := s.abort(ctx, state, SagaTimedOut, errors.New("saga timed out")); err != nil {
+		return err
+	}
+	if s.opts.OnTimeout != nil {
+		s.opts.OnTimeout(ctx, state)
+	}
+	return nil
+}
+
+// abort - runs the compensations of the saga's completed steps in reverse order and saves it with status.
+// A failing compensation leaves the saga running so it is compensated again.
+func (s *Saga) abort(ctx context.Context, state *SagaState, status SagaStatus, cause error) error {
+	for i := len(state.Steps) - 1; i >= 0; i-- {
+		s.mu.Lock()
+		compensate := s.steps[state.Steps[i]].compensate
+		s.mu.Unlock()
+		if compensate != nil {
+			if err := compensate(ctx, state); err != nil {
+				return fmt.Errorf("compensate step %v of saga %v: %w", state.Steps[i], state.ID, err)
+			}
+		}
+	}
+	state.Status = status
+	state.Err = cause.Error()
+	state.UpdatedAt = s.opts.Clock.Now()
+	if err := s.store.Save(ctx, state); err != nil {
+		return fmt.Errorf("save saga %v: %w", state.ID, err)
+	}
+	return nil
+}
+
+// lock - serializes the handling of a saga instance, returns the unlock function.
+func (s *Saga) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sagaLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
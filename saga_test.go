@@ -0,0 +1,116 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaga(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	store := NewMemorySagaStore()
+	var compensated []string
+	var timedOut []string
+	saga, err := NewSaga("checkout", store, SagaTimeout(time.Minute), SagaClock(clock),
+		OnSagaTimeout(func(ctx context.Context, s *SagaState) { timedOut = append(timedOut, s.ID) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saga.OnStep("order", func(ctx context.Context, s *SagaState, msg *Msg) error {
+		s.Data["order"] = string(msg.Data())
+		return nil
+	}, func(ctx context.Context, s *SagaState) error {
+		compensated = append(compensated, "cancel "+s.Data["order"].(string))
+		return nil
+	}).OnStep("payment", func(ctx context.Context, s *SagaState, msg *Msg) error {
+		switch string(msg.Data()) {
+		case "declined":
+			return fmt.Errorf("card declined: %w", ErrSagaAbort)
+		case "flaky":
+			s.Data["order"] = "changed by a failed attempt"
+			return errors.New("gateway unavailable")
+		}
+		s.Complete()
+		return nil
+	}, nil)
+
+	ctx := context.Background()
+	msg := func(id, data string) *Msg {
+		return newTestMsg(data, map[string]string{CorrelationIDHeader: id})
+	}
+	if err := saga.Handle(ctx, "order", msg("1", "book")); err != nil {
+		t.Fatal(err)
+	}
+	if err := saga.Handle(ctx, "payment", msg("1", "flaky")); err == nil || errors.Is(err, ErrDiscard) {
+		t.Fatalf("a failed step returned %v", err)
+	}
+	if err := saga.Handle(ctx, "payment", msg("1", "paid")); err != nil {
+		t.Fatal(err)
+	}
+	state, _ := store.Load(ctx, "1")
+	if state.Status != SagaCompleted || !reflect.DeepEqual(state.Steps, []string{"order", "payment"}) || state.Data["order"] != "book" {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if err := saga.Handle(ctx, "payment", msg("1", "paid")); !errors.Is(err, ErrDiscard) {
+		t.Fatalf("a message of a completed saga returned %v", err)
+	}
+
+	// an aborted saga compensates the steps completed before
+	saga.Handle(ctx, "order", msg("2", "lamp"))
+	if err := saga.Handle(ctx, "payment", msg("2", "declined")); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := store.Load(ctx, "2"); state.Status != SagaAborted || state.Err != "card declined: abort saga" {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	// a saga past its deadline times out
+	saga.Handle(ctx, "order", msg("3", "desk"))
+	clock.advance(30 * time.Second)
+	if err := saga.CheckTimeouts(ctx); err != nil || len(timedOut) != 0 {
+		t.Fatalf("timed out %v early, err=%v", timedOut, err)
+	}
+	clock.advance(31 * time.Second)
+	if err := saga.CheckTimeouts(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := store.Load(ctx, "3"); state.Status != SagaTimedOut || !reflect.DeepEqual(timedOut, []string{"3"}) {
+		t.Fatalf("unexpected state %+v, timed out %v", state, timedOut)
+	}
+	if want := []string{"cancel lamp", "cancel desk"}; !reflect.DeepEqual(compensated, want) {
+		t.Fatalf("compensated %v, want %v", compensated, want)
+	}
+
+	if err := saga.Handle(ctx, "order", newTestMsg("x", nil)); !errors.Is(err, ErrDiscard) {
+		t.Fatalf("a message without a correlation id returned %v", err)
+	}
+	if err := saga.Handle(ctx, "shipping", msg("4", "x")); err == nil {
+		t.Fatalf("a message of an unknown step was handled")
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	opts := getDefaultProduceOpts()
+	if err := CorrelationID("abc")(&opts); err != nil || opts.MsgHeaders.MsgHeaders[CorrelationIDHeader][0] != "abc" {
+		t.Fatalf("correlation id not set, err=%v", err)
+	}
+	if err := CorrelationID("")(&opts); err == nil {
+		t.Fatalf("an empty correlation id was accepted")
+	}
+}
@@ -78,16 +78,20 @@ func (c *Conn) CreateSchema(name, schemaType, path string, options ...RequestOpt
 		return memphisError(err)
 	}
 
-	schemaContent := string(data)
+	_, err = c.createSchema(name, schemaType, string(data), options...)
+	return err
+}
 
-	err = validateSchemaName(name)
+// createSchema - uploads the schema content, reports whether the broker already had it.
+func (c *Conn) createSchema(name, schemaType, schemaContent string, options ...RequestOpt) (bool, error) {
+	err := validateSchemaName(name)
 	if err != nil {
-		return memphisError(err)
+		return false, memphisError(err)
 	}
 
 	err = validateSchemaType(schemaType)
 	if err != nil {
-		return memphisError(err)
+		return false, memphisError(err)
 	}
 
 	s := Schema{
@@ -98,11 +102,14 @@ func (c *Conn) CreateSchema(name, schemaType, path string, options ...RequestOpt
 		MessageStructName: "",
 	}
 
-	if err = c.create(&s, options...); err != nil && !strings.Contains(err.Error(), "already exists") {
-		return memphisError(err)
+	if err = c.create(&s, options...); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return true, nil
+		}
+		return false, memphisError(err)
 	}
 
-	return nil
+	return false, nil
 }
 
 func validateSchemaName(schemaName string) error {
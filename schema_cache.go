@@ -0,0 +1,50 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"sync/atomic"
+)
+
+// schemaDetailsCache - the schema details of a consumer's station, resolved once per schema generation of the
+// connection, so deserializing every message doesn't take the schema lock and look the station up each time.
+type schemaDetailsCache struct {
+	cached atomic.Value // *cachedSchemaDetails
+}
+
+type cachedSchemaDetails struct {
+	generation uint64
+	sd         schemaDetails
+}
+
+// Conn.schemaUpdated - invalidates the cached schema details, called whenever the schema details of a station
+// change or a station's listener is removed.
+func (c *Conn) schemaUpdated() {
+	atomic.AddUint64(&c.schemaGeneration, 1)
+}
+
+// schemaDetailsCache.get - the schema the messages of the station are validated and deserialized with.
+func (cache *schemaDetailsCache) get(c *Conn, internalStationName string, protoSchema *ProtoSchema) (schemaDetails, error) {
+	// loaded before the lookup, so an update during it invalidates what is stored
+	generation := atomic.LoadUint64(&c.schemaGeneration)
+	if cached, ok := cache.cached.Load().(*cachedSchemaDetails); ok && cached.generation == generation {
+		return cached.sd, nil
+	}
+	sd, err := protoSchema.resolve(c.getSchemaDetails(internalStationName))
+	if err != nil {
+		return sd, err
+	}
+	cache.cached.Store(&cachedSchemaDetails{generation: generation, sd: sd})
+	return sd, nil
+}
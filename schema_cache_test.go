@@ -0,0 +1,71 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestSchemaDetailsCache(t *testing.T) {
+	sd := schemaDetails{name: "order", schemaType: "json", activeVersion: SchemaVersion{VersionNumber: 1, Content: `{"type": "object", "required": ["id"]}`}}
+	if err := sd.compileJsonSchema(); err != nil {
+		t.Fatal(err)
+	}
+	sus := &stationUpdateSub{schemaDetails: sd}
+	c := &Conn{stationUpdatesSubs: map[string]*stationUpdateSub{"orders": sus}}
+	var cache schemaDetailsCache
+	msg := func(data string) *Msg {
+		m := newTestMsg(data, nil)
+		m.conn, m.internalStationName, m.schemaCache = c, "orders", &cache
+		return m
+	}
+
+	if _, err := msg(`{"id": 1}`).DataDeserialized(); err != nil {
+		t.Fatal(err)
+	}
+	// changed without an update event, the cached schema is still used
+	relaxed := schemaDetails{name: "order", schemaType: "json", activeVersion: SchemaVersion{VersionNumber: 2, Content: `{"type": "object"}`}}
+	if err := relaxed.compileJsonSchema(); err != nil {
+		t.Fatal(err)
+	}
+	sus.schemaDetails = relaxed
+	if _, err := msg(`{}`).DataDeserialized(); err == nil {
+		t.Fatal("the cached schema was not used")
+	}
+
+	c.schemaUpdated()
+	if _, err := msg(`{}`).DataDeserialized(); err != nil {
+		t.Fatalf("the updated schema was not used: %v", err)
+	}
+	delete(c.stationUpdatesSubs, "orders")
+	c.schemaUpdated()
+	if _, err := msg(`{}`).DataDeserialized(); err == nil {
+		t.Fatal("the schema of a removed station was used")
+	}
+}
+
+// run with GOARCH=386 too, 64-bit atomic operations panic there unless their word is 8-byte aligned
+func TestSchemaGenerationAlignment(t *testing.T) {
+	c := &Conn{}
+	// only the first word of an allocated struct is guaranteed to be 64-bit aligned on 32-bit platforms
+	if offset := unsafe.Offsetof(c.schemaGeneration); offset != 0 {
+		t.Fatalf("schemaGeneration is at offset %v, it has to be the first field of Conn", offset)
+	}
+	c.schemaUpdated()
+	var cache schemaDetailsCache
+	if _, err := cache.get(c, "orders", nil); err == nil {
+		t.Fatal("expected a missing station to fail")
+	}
+}
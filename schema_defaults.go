@@ -0,0 +1,201 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hamba/avro/v2"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// MissingFieldsError - returned when producing with FillSchemaDefaults a message missing required fields which
+// have no default in the station's schema.
+type MissingFieldsError struct {
+	Schema string
+	// Fields - the paths of the missing fields, e.g. "customer.id".
+	Fields []string
+}
+
+func (e *MissingFieldsError) Error() string {
+	return fmt.Sprintf("message is missing required fields of schema %v: %v", e.Schema, strings.Join(e.Fields, ", "))
+}
+
+// FillSchemaDefaults - populate the fields missing from a JSON or Avro message with the defaults of the station's
+// schema before it is validated. Messages missing required fields without a default are not produced and a
+// *MissingFieldsError listing them is returned. Applies to []byte and map[string]interface{} messages, structs
+// always contain all of their fields.
+func FillSchemaDefaults() ProduceOpt {
+	return func(opts *ProduceOpts) error {
+		opts.FillSchemaDefaults = true
+		return nil
+	}
+}
+
+// Producer.fillSchemaDefaults - the message with the defaults of the station's schema.
+func (p *Producer) fillSchemaDefaults(msg any) (any, error) {
+	sd, err := p.getSchemaDetails()
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	var fill func(map[string]interface{}, string, *[]string) map[string]interface{}
+	switch {
+	case sd.schemaType == "json" && sd.jsonSchema != nil:
+		fill = func(obj map[string]interface{}, path string, missing *[]string) map[string]interface{} {
+			return fillJsonDefaults(sd.jsonSchema, obj, path, missing)
+		}
+	case sd.schemaType == "avro" && sd.avroSchema != nil:
+		fill = func(obj map[string]interface{}, path string, missing *[]string) map[string]interface{} {
+			return fillAvroDefaults(sd.avroSchema, obj, path, missing)
+		}
+	default:
+		return msg, nil
+	}
+
+	var obj map[string]interface{}
+	switch m := msg.(type) {
+	case []byte:
+		if err := json.Unmarshal(m, &obj); err != nil {
+			// left to the validation to report
+			return msg, nil
+		}
+	case map[string]interface{}:
+		obj = m
+	default:
+		return msg, nil
+	}
+
+	var missing []string
+	filled := fill(obj, "", &missing)
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		err := &MissingFieldsError{Schema: sd.name, Fields: missing}
+		if p.conn.opts.DryRunValidation {
+			p.reportSchemaViolation(sd.name, err)
+			return msg, nil
+		}
+		return nil, memphisError(err)
+	}
+	if _, ok := msg.([]byte); ok {
+		data, err := json.Marshal(filled)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+		return data, nil
+	}
+	return filled, nil
+}
+
+// fieldPath - the path of a field of the object at path.
+func fieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// fillJsonDefaults - a copy of obj with the defaults of the properties of sch, recording the missing required ones.
+func fillJsonDefaults(sch *jsonschema.Schema, obj map[string]interface{}, path string, missing *[]string) map[string]interface{} {
+	for sch.Ref != nil && len(sch.Properties) == 0 {
+		sch = sch.Ref
+	}
+	filled := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		filled[k] = v
+	}
+	for name, prop := range sch.Properties {
+		value, ok := filled[name]
+		if !ok {
+			if prop.Default == nil {
+				continue
+			}
+			value = copyDefault(prop.Default)
+			filled[name] = value
+		}
+		if nested, isObj := value.(map[string]interface{}); isObj {
+			filled[name] = fillJsonDefaults(prop, nested, fieldPath(path, name), missing)
+		}
+	}
+	for _, name := range sch.Required {
+		if _, ok := filled[name]; !ok {
+			*missing = append(*missing, fieldPath(path, name))
+		}
+	}
+	return filled
+}
+
+// fillAvroDefaults - a copy of obj with the defaults of the fields of the record sch, recording the missing fields
+// without a default.
+func fillAvroDefaults(sch avro.Schema, obj map[string]interface{}, path string, missing *[]string) map[string]interface{} {
+	record := avroRecord(sch)
+	if record == nil {
+		return obj
+	}
+	filled := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		filled[k] = v
+	}
+	for _, field := range record.Fields() {
+		value, ok := filled[field.Name()]
+		if !ok {
+			if !field.HasDefault() {
+				*missing = append(*missing, fieldPath(path, field.Name()))
+				continue
+			}
+			value = copyDefault(field.Default())
+			filled[field.Name()] = value
+		}
+		if nested, isObj := value.(map[string]interface{}); isObj {
+			filled[field.Name()] = fillAvroDefaults(field.Type(), nested, fieldPath(path, field.Name()), missing)
+		}
+	}
+	return filled
+}
+
+// avroRecord - the record of sch, following references and nullable unions.
+func avroRecord(sch avro.Schema) *avro.RecordSchema {
+	switch s := sch.(type) {
+	case *avro.RecordSchema:
+		return s
+	case *avro.RefSchema:
+		return avroRecord(s.Schema())
+	case *avro.UnionSchema:
+		if _, typ := s.Indices(); s.Nullable() {
+			return avroRecord(s.Types()[typ])
+		}
+	}
+	return nil
+}
+
+// copyDefault - a copy of a schema default, so filled messages never share it.
+func copyDefault(v interface{}) interface{} {
+	switch d := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(d))
+		for k, v := range d {
+			c[k] = copyDefault(v)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(d))
+		for i, v := range d {
+			c[i] = copyDefault(v)
+		}
+		return c
+	}
+	return v
+}
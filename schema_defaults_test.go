@@ -0,0 +1,89 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFillSchemaDefaults(t *testing.T) {
+	jsonSd := schemaDetails{name: "order", schemaType: "json", activeVersion: SchemaVersion{Content: `{
+		"type": "object",
+		"required": ["id", "currency", "customer"],
+		"properties": {
+			"id": {"type": "integer"},
+			"currency": {"type": "string", "default": "EUR"},
+			"customer": {"type": "object", "required": ["name"], "properties": {
+				"name": {"type": "string"},
+				"tier": {"type": "string", "default": "basic"}
+			}}
+		}
+	}`}}
+	if err := jsonSd.compileJsonSchema(); err != nil {
+		t.Fatal(err)
+	}
+	avroSd := schemaDetails{name: "payment", schemaType: "avro", activeVersion: SchemaVersion{Content: `{
+		"type": "record", "name": "payment", "fields": [
+			{"name": "id", "type": "long"},
+			{"name": "method", "type": "string", "default": "card"},
+			{"name": "note", "type": ["null", "string"], "default": null}
+		]
+	}`}}
+	if err := avroSd.compileAvroSchema(); err != nil {
+		t.Fatal(err)
+	}
+	c := &Conn{stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {schemaDetails: jsonSd}, "payments": {schemaDetails: avroSd}}}
+	orders := &Producer{Name: "svc", stationName: "orders", conn: c}
+	payments := &Producer{Name: "svc", stationName: "payments", conn: c}
+
+	filled, err := orders.fillSchemaDefaults([]byte(`{"id": 1, "customer": {"name": "ada"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(filled.([]byte), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"id": float64(1), "currency": "EUR", "customer": map[string]interface{}{"name": "ada", "tier": "basic"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("filled %v, want %v", got, want)
+	}
+	if _, err := orders.validateMsg(filled, map[string][]string{}, false); err != nil {
+		t.Fatalf("the filled message is invalid: %v", err)
+	}
+
+	msg := map[string]interface{}{"customer": map[string]interface{}{}}
+	_, err = orders.fillSchemaDefaults(msg)
+	var missing *MissingFieldsError
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Fields, []string{"customer.name", "id"}) {
+		t.Fatalf("expected the missing fields, got %v", err)
+	}
+	if len(msg["customer"].(map[string]interface{})) != 0 {
+		t.Fatalf("the produced message was modified: %v", msg)
+	}
+
+	filled, err = payments.fillSchemaDefaults(map[string]interface{}{"id": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (map[string]interface{}{"id": 7, "method": "card", "note": nil}); !reflect.DeepEqual(filled, want) {
+		t.Fatalf("filled %v, want %v", filled, want)
+	}
+	if _, err := payments.fillSchemaDefaults(map[string]interface{}{}); !errors.As(err, &missing) || !reflect.DeepEqual(missing.Fields, []string{"id"}) {
+		t.Fatalf("expected the missing avro field, got %v", err)
+	}
+}
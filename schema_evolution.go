@@ -0,0 +1,130 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// SchemaChange - a schema update received for a station, versions are 0 when no schema is attached.
+type SchemaChange struct {
+	StationName        string
+	PreviousSchemaName string
+	PreviousVersion    int
+	SchemaName         string
+	SchemaType         string
+	Version            int
+}
+
+// Detached - whether the station's schema was detached.
+func (sc SchemaChange) Detached() bool {
+	return sc.SchemaName == ""
+}
+
+// SchemaChangedHandler - called after a station's schema was updated, e.g. to reload generated types.
+// Handlers are called one at a time in the order the updates arrive and should not block.
+type SchemaChangedHandler func(change SchemaChange)
+
+// ProducerSchemaChanged - call the handler whenever the schema of the producer's station changes.
+func ProducerSchemaChanged(handler SchemaChangedHandler) ProducerOpt {
+	return func(opts *ProducerOpts) error {
+		if handler == nil {
+			return errors.New("schema changed handler can not be nil")
+		}
+		opts.SchemaChanged = handler
+		return nil
+	}
+}
+
+// ConsumerSchemaChanged - call the handler whenever the schema of the consumer's station changes.
+func ConsumerSchemaChanged(handler SchemaChangedHandler) ConsumerOpt {
+	return func(opts *ConsumerOpts) error {
+		if handler == nil {
+			return errors.New("schema changed handler can not be nil")
+		}
+		opts.SchemaChanged = handler
+		return nil
+	}
+}
+
+// VerifyLatestSchema - before validating the message, wait for the schema updates the broker already sent
+// to be applied, so the message is checked against the newest schema version rather than a stale one.
+func VerifyLatestSchema() ProduceOpt {
+	return func(opts *ProduceOpts) error {
+		opts.VerifyLatestSchema = true
+		return nil
+	}
+}
+
+// Conn.addSchemaChangedHandler - registers the handler for the station's schema updates, returns its id or 0 for a nil handler.
+func (c *Conn) addSchemaChangedHandler(stationName string, handler SchemaChangedHandler) int {
+	if handler == nil {
+		return 0
+	}
+	sn := getInternalName(stationName)
+	c.stationUpdatesMu.Lock()
+	defer c.stationUpdatesMu.Unlock()
+	sus, ok := c.stationUpdatesSubs[sn]
+	if !ok {
+		return 0
+	}
+	if sus.schemaChangedHandlers == nil {
+		sus.schemaChangedHandlers = make(map[int]SchemaChangedHandler)
+	}
+	sus.lastHandlerId++
+	sus.schemaChangedHandlers[sus.lastHandlerId] = handler
+	return sus.lastHandlerId
+}
+
+// Conn.removeSchemaChangedHandler - unregisters a handler added with addSchemaChangedHandler.
+func (c *Conn) removeSchemaChangedHandler(stationName string, id int) {
+	if id == 0 {
+		return
+	}
+	c.stationUpdatesMu.Lock()
+	defer c.stationUpdatesMu.Unlock()
+	if sus, ok := c.stationUpdatesSubs[getInternalName(stationName)]; ok {
+		delete(sus.schemaChangedHandlers, id)
+	}
+}
+
+// Conn.awaitSchemaUpdates - flushes the connection so every schema update the broker sent before is received,
+// then waits until the station's updates handler applied them.
+func (c *Conn) awaitSchemaUpdates(stationName string, timeout time.Duration) error {
+	if err := c.brokerConn.FlushTimeout(timeout); err != nil {
+		return memphisError(err)
+	}
+	stationUpdatesSubsLock.Lock()
+	sus, ok := c.stationUpdatesSubs[getInternalName(stationName)]
+	var sub *nats.Subscription
+	if ok {
+		sub = sus.schemaUpdateSub
+	}
+	stationUpdatesSubsLock.Unlock()
+	if sub == nil {
+		return nil
+	}
+	delivered, err := sub.Delivered()
+	if err != nil {
+		return memphisError(err)
+	}
+	pending, _, err := sub.Pending()
+	if err != nil {
+		return memphisError(err)
+	}
+	return memphisError(sus.awaitHandled(c.clock(), delivered+int64(pending), timeout))
+}
@@ -0,0 +1,83 @@
+package memphis
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchemaChangedHandlers(t *testing.T) {
+	c := &Conn{stationUpdatesSubs: map[string]*stationUpdateSub{}}
+	c.ensureStationUpdatesSub("orders")
+	sus := c.stationUpdatesSubs["orders"]
+	go sus.schemaUpdatesHandler(c, "orders")
+	defer close(sus.schemaUpdateCh)
+
+	var mu sync.Mutex
+	var changes []SchemaChange
+	id := c.addSchemaChangedHandler("orders", func(change SchemaChange) {
+		mu.Lock()
+		changes = append(changes, change)
+		mu.Unlock()
+	})
+	if id == 0 {
+		t.Fatal("handler was not registered")
+	}
+
+	init := func(version int) SchemaUpdate {
+		return SchemaUpdate{UpdateType: SchemaUpdateTypeInit, Init: SchemaUpdateInit{
+			SchemaName:    "order",
+			SchemaType:    "json",
+			ActiveVersion: SchemaVersion{VersionNumber: version, Content: `{"type": "object"}`},
+		}}
+	}
+	sus.schemaUpdateCh <- init(1)
+	sus.schemaUpdateCh <- init(1)
+	sus.schemaUpdateCh <- init(2)
+	sus.schemaUpdateCh <- SchemaUpdate{UpdateType: SchemaUpdateTypeDrop}
+	waitHandled := func(n int64) {
+		if err := sus.awaitHandled(SystemClock(), n, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitHandled(4)
+	c.removeSchemaChangedHandler("orders", id)
+	sus.schemaUpdateCh <- init(3)
+	waitHandled(5)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes, want 3: %+v", len(changes), changes)
+	}
+	if changes[0].PreviousVersion != 0 || changes[0].Version != 1 || changes[0].StationName != "orders" || changes[0].SchemaType != "json" {
+		t.Errorf("unexpected attach change %+v", changes[0])
+	}
+	if changes[1].PreviousVersion != 1 || changes[1].Version != 2 || changes[1].Detached() {
+		t.Errorf("unexpected version change %+v", changes[1])
+	}
+	if !changes[2].Detached() || changes[2].PreviousSchemaName != "order" || changes[2].PreviousVersion != 2 {
+		t.Errorf("unexpected detach change %+v", changes[2])
+	}
+}
+
+func TestAwaitHandledSchemaUpdates(t *testing.T) {
+	sus := &stationUpdateSub{}
+	clock := &manualClock{now: time.Now(), timers: make(chan *manualTimer, 1)}
+
+	done := make(chan error, 1)
+	go func() { done <- sus.awaitHandled(clock, 2, time.Minute) }()
+	<-clock.timers
+	sus.updateHandled()
+	sus.updateHandled()
+	if err := <-done; err != nil {
+		t.Fatalf("waiting for handled updates failed: %v", err)
+	}
+
+	go func() { done <- sus.awaitHandled(clock, 3, time.Minute) }()
+	timer := <-clock.timers
+	timer.c <- clock.Now().Add(time.Minute)
+	if err := <-done; err == nil {
+		t.Fatal("expected the wait to time out on the connection's clock")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const schemaViolationsMetric = "memphis_producer_schema_violations_total"
+
+// SkipSchemaValidation - produce the message without validating it against the station's schema, for trusted
+// pipelines producing messages that were already validated. The message has to be encoded in the schema's format.
+func SkipSchemaValidation() ProduceOpt {
+	return func(opts *ProduceOpts) error {
+		opts.SkipSchemaValidation = true
+		return nil
+	}
+}
+
+// DryRunValidation - validate produced messages against the station's schema without ever blocking them.
+// Violations are logged and counted in the memphis_producer_schema_violations_total metric and the messages are
+// produced as is, so schemas can be introduced gradually to stations with existing producers.
+func DryRunValidation() Option {
+	return func(o *Options) error {
+		o.DryRunValidation = true
+		return nil
+	}
+}
+
+// Producer.reportSchemaViolation - records a message which failed the schema validation of a dry run.
+func (p *Producer) reportSchemaViolation(schemaName string, err error) {
+	log.Printf("Producer %v: dry run schema validation of station %v has failed: %v", p.Name, p.stationName, err)
+	p.conn.addCounter(schemaViolationsMetric, map[string]string{
+		metricsStationLabel: p.stationName.(string),
+		"schema":            schemaName,
+	}, 1)
+}
+
+// FieldError - a violation of the station's schema by a field of a message.
+type FieldError struct {
+	// Path - the JSON pointer of the field, e.g. "/customer/id", empty for the message itself or when the schema
+	// type doesn't report it.
+	Path string
+	// Keyword - the schema keyword the field violates, e.g. "required" or "type" for JSON schemas and the
+	// validation rule for GraphQL schemas, empty when the schema type doesn't report it.
+	Keyword string
+	Message string
+}
+
+// SchemaViolationError - returned when a produced message fails the validation of the station's schema, Fields
+// lists the violations so they can be mapped back to form fields or source columns.
+type SchemaViolationError struct {
+	Schema     string
+	SchemaType string
+	Fields     []FieldError
+	err        error
+}
+
+func (e *SchemaViolationError) Error() string {
+	return "Schema validation has failed: " + e.err.Error()
+}
+
+func (e *SchemaViolationError) Unwrap() error {
+	return e.err
+}
+
+// graphQlErrors - the errors of a GraphQL validation.
+type graphQlErrors []*gqlerrors.QueryError
+
+func (errs graphQlErrors) Error() string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "")
+}
+
+var missingPropertiesRegex = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'`)
+
+// newSchemaViolationError - the violation of the schema of sd reported by err.
+func newSchemaViolationError(sd schemaDetails, err error) *SchemaViolationError {
+	violation := &SchemaViolationError{Schema: sd.name, SchemaType: sd.schemaType, err: err}
+	var jsonErr *jsonschema.ValidationError
+	var gqlErrs graphQlErrors
+	switch {
+	case errors.As(err, &jsonErr):
+		violation.Fields = jsonFieldErrors(jsonErr, nil)
+	case errors.As(err, &gqlErrs):
+		for _, qe := range gqlErrs {
+			path := ""
+			for _, segment := range qe.Path {
+				path += "/" + escapePointer(fmt.Sprint(segment))
+			}
+			violation.Fields = append(violation.Fields, FieldError{Path: path, Keyword: qe.Rule, Message: qe.Message})
+		}
+	default:
+		violation.Fields = []FieldError{{Message: err.Error()}}
+	}
+	return violation
+}
+
+// jsonFieldErrors - the leaf violations of a JSON schema validation error, a missing required property is
+// reported at its own path.
+func jsonFieldErrors(ve *jsonschema.ValidationError, fields []FieldError) []FieldError {
+	if len(ve.Causes) > 0 {
+		for _, cause := range ve.Causes {
+			fields = jsonFieldErrors(cause, fields)
+		}
+		return fields
+	}
+	keyword := ve.KeywordLocation[strings.LastIndex(ve.KeywordLocation, "/")+1:]
+	if keyword == "required" && strings.HasPrefix(ve.Message, "missing propert") {
+		for _, match := range missingPropertiesRegex.FindAllStringSubmatch(ve.Message, -1) {
+			fields = append(fields, FieldError{
+				Path:    ve.InstanceLocation + "/" + escapePointer(match[1]),
+				Keyword: keyword,
+				Message: "missing property",
+			})
+		}
+		return fields
+	}
+	return append(fields, FieldError{Path: ve.InstanceLocation, Keyword: keyword, Message: ve.Message})
+}
+
+// escapePointer - a JSON pointer reference token.
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
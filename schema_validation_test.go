@@ -0,0 +1,88 @@
+package memphis
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidationModes(t *testing.T) {
+	sd := schemaDetails{name: "order", schemaType: "json", activeVersion: SchemaVersion{Content: `{"type": "object", "required": ["id"]}`}}
+	if err := sd.compileJsonSchema(); err != nil {
+		t.Fatal(err)
+	}
+	metrics := NewInMemoryMetrics()
+	c := &Conn{stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {schemaDetails: sd}}}
+	p := &Producer{Name: "svc", stationName: "orders", conn: c}
+	invalid := []byte(`{"name": "no id"}`)
+
+	if _, err := p.validateMsg(invalid, map[string][]string{}, false); err == nil {
+		t.Fatal("expected the invalid message to be rejected")
+	}
+	if data, err := p.validateMsg(invalid, map[string][]string{}, true); err != nil || string(data) != string(invalid) {
+		t.Fatalf("expected validation to be skipped, got %q, %v", data, err)
+	}
+
+	c.opts = Options{DryRunValidation: true, Metrics: metrics}
+	if data, err := p.validateMsg(invalid, map[string][]string{}, false); err != nil || string(data) != string(invalid) {
+		t.Fatalf("expected a dry run to produce the message as is, got %q, %v", data, err)
+	}
+	if got := metrics.Counter(schemaViolationsMetric, map[string]string{"station": "orders", "schema": "order"}); got != 1 {
+		t.Errorf("schema violations = %v, want 1", got)
+	}
+	if _, err := p.validateMsg([]byte(`{"id": 1}`), map[string][]string{}, false); err != nil {
+		t.Errorf("valid message: %v", err)
+	}
+	if got := metrics.Counter(schemaViolationsMetric, map[string]string{"station": "orders", "schema": "order"}); got != 1 {
+		t.Errorf("a valid message was counted as a violation, violations = %v", got)
+	}
+}
+
+func TestSchemaViolationError(t *testing.T) {
+	sd := schemaDetails{name: "order", schemaType: "json", activeVersion: SchemaVersion{Content: `{
+		"type": "object",
+		"required": ["id", "customer"],
+		"properties": {
+			"id": {"type": "integer"},
+			"customer": {"type": "object", "required": ["name"], "properties": {"age": {"minimum": 0}}}
+		}
+	}`}}
+	if err := sd.compileJsonSchema(); err != nil {
+		t.Fatal(err)
+	}
+	c := &Conn{stationUpdatesSubs: map[string]*stationUpdateSub{"orders": {schemaDetails: sd}}}
+	p := &Producer{Name: "svc", stationName: "orders", conn: c}
+
+	_, err := p.validateMsg([]byte(`{"id": "1", "customer": {"age": -1}}`), map[string][]string{}, false)
+	var violation *SchemaViolationError
+	if !errors.As(err, &violation) {
+		t.Fatalf("expected a schema violation, got %v", err)
+	}
+	want := []FieldError{
+		{Path: "/id", Keyword: "type", Message: "expected integer, but got string"},
+		{Path: "/customer/name", Keyword: "required", Message: "missing property"},
+		{Path: "/customer/age", Keyword: "minimum", Message: "must be >= 0 but found -1"},
+	}
+	if violation.Schema != "order" || !sameFieldErrors(violation.Fields, want) {
+		t.Fatalf("violations %+v, want %+v", violation.Fields, want)
+	}
+}
+
+// sameFieldErrors - whether the field errors are equal regardless of order.
+func sameFieldErrors(got, want []FieldError) bool {
+	remaining := append([]FieldError(nil), want...)
+	for _, fe := range got {
+		found := false
+		for i, w := range remaining {
+			if reflect.DeepEqual(fe, w) {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return len(remaining) == 0
+}
@@ -0,0 +1,406 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+// Package schemaregistry reads and writes messages framed for a Confluent compatible schema registry: a zero
+// magic byte and the big endian id of the schema, followed by the payload. Consumers can read stations mirrored
+// from Kafka topics and producers can publish registry framed messages, validated against avro and json schemas.
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	memphis "github.com/memphisdev/memphis.go"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	magicByte   = 0
+	headerSize  = 5
+	contentType = "application/vnd.schemaregistry.v1+json"
+)
+
+// Schema types, as named by the registry.
+const (
+	Avro     = "AVRO"
+	JSON     = "JSON"
+	Protobuf = "PROTOBUF"
+)
+
+var (
+	ErrNotFramed   = errors.New("schemaregistry: message is not framed with a schema id")
+	ErrUnsupported = errors.New("schemaregistry: unsupported schema type")
+)
+
+// Frame - prefixes payload with the magic byte and the schema id.
+func Frame(schemaID int, payload []byte) []byte {
+	framed := make([]byte, headerSize+len(payload))
+	framed[0] = magicByte
+	binary.BigEndian.PutUint32(framed[1:], uint32(schemaID))
+	copy(framed[headerSize:], payload)
+	return framed
+}
+
+// Unframe - returns the schema id and the payload of a framed message. The payload of a protobuf message
+// starts with the indexes of its message type.
+func Unframe(data []byte) (int, []byte, error) {
+	if len(data) < headerSize || data[0] != magicByte {
+		return 0, nil, ErrNotFramed
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), data[headerSize:], nil
+}
+
+// Schema - a schema of the registry.
+type Schema struct {
+	ID      int
+	Subject string
+	Version int
+	// Type - Avro, JSON or Protobuf
+	Type   string
+	Schema string
+
+	once       sync.Once
+	avro       avro.Schema
+	json       *jsonschema.Schema
+	compileErr error
+}
+
+// compile - parses the schema once, protobuf schemas can't be compiled without a protobuf parser.
+func (s *Schema) compile() error {
+	s.once.Do(func() {
+		switch s.Type {
+		case Avro:
+			s.avro, s.compileErr = avro.Parse(s.Schema)
+		case JSON:
+			s.json, s.compileErr = jsonschema.CompileString(fmt.Sprintf("schema-%d.json", s.ID), s.Schema)
+		default:
+			s.compileErr = fmt.Errorf("%w %v", ErrUnsupported, s.Type)
+		}
+		if s.compileErr != nil && !errors.Is(s.compileErr, ErrUnsupported) {
+			s.compileErr = fmt.Errorf("schemaregistry: schema %d: %w", s.ID, s.compileErr)
+		}
+	})
+	return s.compileErr
+}
+
+// Schema.Encode - encodes v with the schema and frames it: avro binary for avro schemas and json, validated
+// against the schema, for json schemas.
+func (s *Schema) Encode(v any) ([]byte, error) {
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	var payload []byte
+	var err error
+	switch s.Type {
+	case Avro:
+		payload, err = avro.Marshal(s.avro, v)
+	case JSON:
+		if payload, err = json.Marshal(v); err == nil {
+			err = s.validateJSON(payload)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("schemaregistry: schema %d: %w", s.ID, err)
+	}
+	return Frame(s.ID, payload), nil
+}
+
+// Schema.Decode - validates the payload of a framed message and decodes it into v.
+func (s *Schema) Decode(payload []byte, v any) error {
+	if err := s.compile(); err != nil {
+		return err
+	}
+	var err error
+	switch s.Type {
+	case Avro:
+		err = avro.Unmarshal(s.avro, payload, v)
+	case JSON:
+		if err = s.validateJSON(payload); err == nil {
+			err = json.Unmarshal(payload, v)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("schemaregistry: schema %d: %w", s.ID, err)
+	}
+	return nil
+}
+
+func (s *Schema) validateJSON(payload []byte) error {
+	var doc any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return err
+	}
+	return s.json.Validate(doc)
+}
+
+// Options - configuration of a registry client.
+type Options struct {
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+	// SubjectTTL - how long the latest schema of a subject is cached, schemas by id never change and are cached for good
+	SubjectTTL time.Duration
+}
+
+// Option - a function on the options of a registry client.
+type Option func(*Options) error
+
+// BasicAuth - authenticates to the registry with a username and password, e.g. an api key and secret.
+func BasicAuth(username, password string) Option {
+	return func(opts *Options) error {
+		opts.Username = username
+		opts.Password = password
+		return nil
+	}
+}
+
+// HTTPClient - the client the registry is called with, defaults to a client with a 10 seconds timeout.
+func HTTPClient(client *http.Client) Option {
+	return func(opts *Options) error {
+		if client == nil {
+			return errors.New("schemaregistry: http client can not be nil")
+		}
+		opts.HTTPClient = client
+		return nil
+	}
+}
+
+// SubjectTTL - how long the latest schema of a subject is cached, defaults to 5 minutes.
+func SubjectTTL(ttl time.Duration) Option {
+	return func(opts *Options) error {
+		if ttl <= 0 {
+			return errors.New("schemaregistry: subject ttl has to be positive")
+		}
+		opts.SubjectTTL = ttl
+		return nil
+	}
+}
+
+// Client - reads schemas from a Confluent compatible schema registry.
+type Client struct {
+	url      string
+	opts     Options
+	mu       sync.Mutex
+	byID     map[int]*Schema
+	subjects map[string]cachedSubject
+}
+
+type cachedSubject struct {
+	schema    *Schema
+	fetchedAt time.Time
+}
+
+// NewClient - creates a client of the registry at registryURL.
+func NewClient(registryURL string, opts ...Option) (*Client, error) {
+	if _, err := url.Parse(registryURL); err != nil || registryURL == "" {
+		return nil, fmt.Errorf("schemaregistry: invalid registry url %q", registryURL)
+	}
+	options := Options{HTTPClient: &http.Client{Timeout: 10 * time.Second}, SubjectTTL: 5 * time.Minute}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&options); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Client{
+		url:      strings.TrimSuffix(registryURL, "/"),
+		opts:     options,
+		byID:     map[int]*Schema{},
+		subjects: map[string]cachedSubject{},
+	}, nil
+}
+
+type schemaResp struct {
+	Subject    string `json:"subject"`
+	ID         int    `json:"id"`
+	Version    int    `json:"version"`
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+type errorResp struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Client.SchemaByID - the schema with the given id.
+func (c *Client) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	c.mu.Lock()
+	schema, ok := c.byID[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+	var resp schemaResp
+	if err := c.call(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	resp.ID = id
+	return c.cache(resp), nil
+}
+
+// Client.LatestSchema - the latest version of the subject's schema.
+func (c *Client) LatestSchema(ctx context.Context, subject string) (*Schema, error) {
+	c.mu.Lock()
+	cached, ok := c.subjects[subject]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < c.opts.SubjectTTL {
+		return cached.schema, nil
+	}
+	var resp schemaResp
+	if err := c.call(ctx, http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions/latest", nil, &resp); err != nil {
+		return nil, err
+	}
+	schema := c.cache(resp)
+	c.mu.Lock()
+	c.subjects[subject] = cachedSubject{schema: schema, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// Client.Register - registers the schema under the subject, or finds it if already registered, and returns its id.
+func (c *Client) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	req := schemaResp{Schema: schema}
+	if schemaType != Avro {
+		req.SchemaType = schemaType
+	}
+	var resp schemaResp
+	if err := c.call(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", req, &resp); err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	delete(c.subjects, subject)
+	c.mu.Unlock()
+	return resp.ID, nil
+}
+
+// Client.Decode - validates a framed message against its schema and decodes it into v.
+func (c *Client) Decode(ctx context.Context, data []byte, v any) (*Schema, error) {
+	id, payload, err := Unframe(data)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := c.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return schema, schema.Decode(payload, v)
+}
+
+// Client.Encode - encodes v with the latest schema of the subject and frames it.
+func (c *Client) Encode(ctx context.Context, subject string, v any) ([]byte, error) {
+	schema, err := c.LatestSchema(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	return schema.Encode(v)
+}
+
+func (c *Client) cache(resp schemaResp) *Schema {
+	schemaType := resp.SchemaType
+	if schemaType == "" {
+		schemaType = Avro
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if schema, ok := c.byID[resp.ID]; ok {
+		return schema
+	}
+	schema := &Schema{ID: resp.ID, Subject: resp.Subject, Version: resp.Version, Type: schemaType, Schema: resp.Schema}
+	c.byID[resp.ID] = schema
+	return schema
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body, result any) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.opts.Username != "" {
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("schemaregistry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorResp
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		if errResp.Message == "" {
+			errResp.Message = resp.Status
+		}
+		return fmt.Errorf("schemaregistry: %v %v: %v", method, path, errResp.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("schemaregistry: %v %v: %w", method, path, err)
+	}
+	return nil
+}
+
+// Codec - a memphis.Codec of values framed with the latest schema of a subject, for TypedProducer and TypedConsumer.
+// Decoding uses the schema the message was framed with, so messages of older versions are read too.
+type Codec[T any] struct {
+	Client  *Client
+	Subject string
+	// Timeout - bounds the registry calls of a single Encode or Decode, defaults to 10 seconds
+	Timeout time.Duration
+}
+
+func (c Codec[T]) context() (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (c Codec[T]) Encode(v T) ([]byte, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.Client.Encode(ctx, c.Subject, v)
+}
+
+func (c Codec[T]) Decode(data []byte) (T, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	var v T
+	_, err := c.Client.Decode(ctx, data, &v)
+	return v, err
+}
+
+var _ memphis.Codec[map[string]any] = Codec[map[string]any]{}
@@ -0,0 +1,133 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+const orderSchema = `{"type":"record","name":"Order","fields":[{"name":"id","type":"long"},{"name":"item","type":"string"}]}`
+
+type order struct {
+	ID   int64  `avro:"id" json:"id"`
+	Item string `avro:"item" json:"item"`
+}
+
+func newRegistry(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/schemas/ids/1", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		json.NewEncoder(w).Encode(map[string]any{"schema": orderSchema})
+	})
+	mux.HandleFunc("/subjects/orders-value/versions/latest", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		json.NewEncoder(w).Encode(map[string]any{"subject": "orders-value", "id": 1, "version": 3, "schema": orderSchema})
+	})
+	mux.HandleFunc("/subjects/events-value/versions/latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"subject": "events-value", "id": 2, "version": 1, "schemaType": "JSON",
+			"schema": `{"type":"object","required":["id"],"properties":{"id":{"type":"integer"}}}`})
+	})
+	mux.HandleFunc("/subjects/events-value/versions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != contentType {
+			t.Errorf("register with %v %v", r.Method, r.Header.Get("Content-Type"))
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["schemaType"] != JSON {
+			t.Errorf("registered schema type %q", req["schemaType"])
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": 2})
+	})
+	mux.HandleFunc("/schemas/ids/9", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{"error_code": 40403, "message": "Schema not found"})
+	})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "key" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func TestFraming(t *testing.T) {
+	framed := Frame(258, []byte("payload"))
+	if framed[0] != 0 || framed[3] != 1 || framed[4] != 2 {
+		t.Fatalf("unexpected header %v", framed[:5])
+	}
+	id, payload, err := Unframe(framed)
+	if err != nil || id != 258 || string(payload) != "payload" {
+		t.Fatalf("unframed %d %q %v", id, payload, err)
+	}
+	for _, data := range [][]byte{[]byte("{}"), {1, 0, 0, 0, 1}} {
+		if _, _, err := Unframe(data); !errors.Is(err, ErrNotFramed) {
+			t.Errorf("Unframe(%v) err = %v", data, err)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	var calls int32
+	server := newRegistry(t, &calls)
+	defer server.Close()
+	client, err := NewClient(server.URL+"/", BasicAuth("key", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec := Codec[order]{Client: client, Subject: "orders-value"}
+	data, err := codec.Encode(order{ID: 7, Item: "book"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _, _ := Unframe(data); id != 1 {
+		t.Fatalf("framed with schema %d", id)
+	}
+	for i := 0; i < 2; i++ {
+		decoded, err := codec.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != (order{ID: 7, Item: "book"}) {
+			t.Fatalf("decoded %+v", decoded)
+		}
+	}
+	// the schema fetched for the subject is cached by id too
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("called the registry %d times, want 1", calls)
+	}
+
+	ctx := context.Background()
+	if _, err := client.Encode(ctx, "events-value", map[string]any{"name": "no id"}); err == nil {
+		t.Error("expected a value failing the json schema to be rejected")
+	}
+	event, err := client.Encode(ctx, "events-value", map[string]any{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if schema, err := client.Decode(ctx, event, &decoded); err != nil || schema.Type != JSON || decoded["id"] != 1.0 {
+		t.Fatalf("decoded %v with %+v, err = %v", decoded, schema, err)
+	}
+	if id, err := client.Register(ctx, "events-value", JSON, `{"type":"object"}`); err != nil || id != 2 {
+		t.Fatalf("registered id %d, err = %v", id, err)
+	}
+	if _, err := client.Decode(ctx, Frame(9, nil), &decoded); err == nil {
+		t.Error("expected an unknown schema id to fail")
+	}
+	protobuf := &Schema{ID: 3, Type: Protobuf}
+	if err := protobuf.Decode([]byte{0}, &decoded); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("protobuf decode err = %v", err)
+	}
+
+	unauthorized, _ := NewClient(server.URL)
+	if _, err := unauthorized.SchemaByID(ctx, 1); err == nil {
+		t.Error("expected the call without credentials to fail")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server - a broker address, servers with a lower priority are preferred.
+type Server struct {
+	Host     string
+	Port     int
+	Priority int
+}
+
+// FailoverPolicy - the order in which the brokers are tried.
+type FailoverPolicy int
+
+const (
+	// FailoverSticky - connect by priority and stay on a broker until it fails.
+	FailoverSticky FailoverPolicy = iota
+	// FailoverRoundRobin - every new connection starts from the next broker of the same priority, spreading connections
+	// across the brokers of the highest priority and moving to lower priorities only when none of them is reachable.
+	FailoverRoundRobin
+	// FailoverNearestLatency - measure the dial latency to every broker and prefer the fastest, unreachable brokers go last.
+	FailoverNearestLatency
+)
+
+const defaultPort = 6666
+
+var roundRobinOffset uint32
+
+// Servers - additional brokers to fail over to, the host passed to Connect is used with priority 0.
+func Servers(servers ...Server) Option {
+	return func(o *Options) error {
+		for _, server := range servers {
+			if server.Host == "" {
+				return errors.New("server host can not be empty")
+			}
+		}
+		o.Servers = append(o.Servers, servers...)
+		return nil
+	}
+}
+
+// FailoverPolicyOpt - default is FailoverSticky.
+func FailoverPolicyOpt(policy FailoverPolicy) Option {
+	return func(o *Options) error {
+		if policy < FailoverSticky || policy > FailoverNearestLatency {
+			return errors.New("unknown failover policy")
+		}
+		o.FailoverPolicy = policy
+		return nil
+	}
+}
+
+// withWebsocketPort - hosts prefixed with ws:// or wss:// reach the broker's websocket listener,
+// which listens on 80 or 443 unless another port was set explicitly.
+func (s Server) withWebsocketPort() Server {
+	if s.Port != defaultPort {
+		return s
+	}
+	if strings.HasPrefix(s.Host, "ws://") {
+		s.Port = 80
+	} else if strings.HasPrefix(s.Host, "wss://") {
+		s.Port = 443
+	}
+	return s
+}
+
+func (s Server) url() string {
+	return s.Host + ":" + strconv.Itoa(s.Port)
+}
+
+// dialAddress - host:port without the websocket scheme.
+func (s Server) dialAddress() string {
+	return strings.TrimPrefix(strings.TrimPrefix(s.url(), "ws://"), "wss://")
+}
+
+// servers - the host passed to Connect followed by the configured servers, with default ports filled in.
+func (opts Options) servers() []Server {
+	servers := make([]Server, 0, len(opts.Servers)+1)
+	if opts.Host != "" {
+		servers = append(servers, Server{Host: opts.Host, Port: opts.Port}.withWebsocketPort())
+	}
+	for _, server := range opts.Servers {
+		server.Host = normalizeHost(server.Host)
+		if server.Port == 0 {
+			server.Port = opts.Port
+		}
+		servers = append(servers, server.withWebsocketPort())
+	}
+	return servers
+}
+
+// serverURLs - the broker urls in the order the failover policy tries them.
+func (opts Options) serverURLs() []string {
+	measure := func(s Server) (time.Duration, error) {
+		start := time.Now()
+		var conn net.Conn
+		var err error
+		if opts.CustomDialer != nil {
+			conn, err = opts.CustomDialer.Dial("tcp", s.dialAddress())
+		} else {
+			conn, err = net.DialTimeout("tcp", s.dialAddress(), opts.Timeout)
+		}
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+		return time.Since(start), nil
+	}
+	servers := orderServers(opts.servers(), opts.FailoverPolicy, measure)
+	urls := make([]string, len(servers))
+	for i, server := range servers {
+		urls[i] = server.url()
+	}
+	return urls
+}
+
+func orderServers(servers []Server, policy FailoverPolicy, measure func(Server) (time.Duration, error)) []Server {
+	ordered := make([]Server, len(servers))
+	copy(ordered, servers)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority < ordered[j].Priority
+	})
+	if len(ordered) < 2 {
+		return ordered
+	}
+
+	switch policy {
+	case FailoverRoundRobin:
+		ordered = rotateTiers(ordered, int(atomic.AddUint32(&roundRobinOffset, 1)-1))
+	case FailoverNearestLatency:
+		latencies := make([]time.Duration, len(ordered))
+		var wg sync.WaitGroup
+		for i := range ordered {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				latency, err := measure(ordered[i])
+				if err != nil {
+					latency = -1
+				}
+				latencies[i] = latency
+			}(i)
+		}
+		wg.Wait()
+		indexes := make([]int, len(ordered))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(a, b int) bool {
+			la, lb := latencies[indexes[a]], latencies[indexes[b]]
+			if (la < 0) != (lb < 0) {
+				return lb < 0
+			}
+			return la < lb
+		})
+		byLatency := make([]Server, len(ordered))
+		for i, idx := range indexes {
+			byLatency[i] = ordered[idx]
+		}
+		ordered = byLatency
+	}
+	return ordered
+}
+
+// rotateTiers - rotates the servers of each priority tier by offset, servers sorted by priority keep their tiers in
+// order so the connection only moves to a lower priority tier once every server of the higher ones is unreachable.
+func rotateTiers(servers []Server, offset int) []Server {
+	rotated := make([]Server, 0, len(servers))
+	for start := 0; start < len(servers); {
+		end := start + 1
+		for end < len(servers) && servers[end].Priority == servers[start].Priority {
+			end++
+		}
+		tier := servers[start:end]
+		shift := offset % len(tier)
+		rotated = append(append(rotated, tier[shift:]...), tier[:shift]...)
+		start = end
+	}
+	return rotated
+}
+
+// CurrentServer - the broker the connection is currently using, empty while disconnected.
+func (c *Conn) CurrentServer() string {
+	return strings.TrimPrefix(c.brokerConn.ConnectedUrlRedacted(), "nats://")
+}
@@ -0,0 +1,83 @@
+package memphis
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func serverHosts(servers []Server) []string {
+	hosts := make([]string, len(servers))
+	for i, s := range servers {
+		hosts[i] = s.Host
+	}
+	return hosts
+}
+
+func TestOrderServers(t *testing.T) {
+	opts := getDefaultOptions()
+	opts.Host = "primary"
+	if err := Servers(Server{Host: "dr", Priority: 2}, Server{Host: "http://secondary", Port: 7777, Priority: 1})(&opts); err != nil {
+		t.Fatal(err)
+	}
+	servers := opts.servers()
+	if servers[2].Host != "secondary" || servers[2].Port != 7777 || servers[1].Port != 6666 {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+
+	noMeasure := func(Server) (time.Duration, error) { return 0, nil }
+	if got := serverHosts(orderServers(servers, FailoverSticky, noMeasure)); got[0] != "primary" || got[1] != "secondary" || got[2] != "dr" {
+		t.Errorf("sticky order = %v", got)
+	}
+
+	tiered := append(servers, Server{Host: "primary-b"}, Server{Host: "dr-b", Priority: 2})
+	first := serverHosts(orderServers(tiered, FailoverRoundRobin, noMeasure))
+	second := serverHosts(orderServers(tiered, FailoverRoundRobin, noMeasure))
+	if first[0] == second[0] {
+		t.Errorf("round robin started twice from %q", first[0])
+	}
+	for _, order := range [][]string{first, second} {
+		if order[0][:7] != "primary" || order[1][:7] != "primary" || order[2] != "secondary" || order[3][:2] != "dr" || order[4][:2] != "dr" {
+			t.Errorf("round robin order %v doesn't keep the priority tiers", order)
+		}
+	}
+
+	latencies := map[string]time.Duration{"primary": 80 * time.Millisecond, "secondary": 5 * time.Millisecond}
+	measure := func(s Server) (time.Duration, error) {
+		if latency, ok := latencies[s.Host]; ok {
+			return latency, nil
+		}
+		return 0, errors.New("unreachable")
+	}
+	if got := serverHosts(orderServers(servers, FailoverNearestLatency, measure)); got[0] != "secondary" || got[1] != "primary" || got[2] != "dr" {
+		t.Errorf("nearest latency order = %v", got)
+	}
+
+	if err := FailoverPolicyOpt(FailoverPolicy(42))(&opts); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestWebsocketServers(t *testing.T) {
+	opts := getDefaultOptions()
+	opts.Host = "wss://broker.local"
+	if err := Servers(Server{Host: "ws://dr.local", Port: 8080}, Server{Host: "ws://backup.local"}, Server{Host: "tcp.local"})(&opts); err != nil {
+		t.Fatal(err)
+	}
+	servers := opts.servers()
+	if got := servers[0].url(); got != "wss://broker.local:443" {
+		t.Errorf("primary url = %q", got)
+	}
+	if got := servers[1].url(); got != "ws://dr.local:8080" {
+		t.Errorf("explicit port url = %q", got)
+	}
+	if got := servers[2].url(); got != "ws://backup.local:80" {
+		t.Errorf("default port url = %q", got)
+	}
+	if got := servers[3].url(); got != "tcp.local:6666" {
+		t.Errorf("tcp url = %q", got)
+	}
+	if got := servers[0].dialAddress(); got != "broker.local:443" {
+		t.Errorf("dial address = %q", got)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SinkCommitFunc - writes a batch of messages to the sink, e.g. a bulk insert into a warehouse. The batch is
+// acked when it returns nil, terminated when it returns ErrDiscard and redelivered on any other error.
+type SinkCommitFunc func(ctx context.Context, msgs []*Msg) error
+
+// SinkBatcherOpts - configuration options for a sink batcher.
+type SinkBatcherOpts struct {
+	MaxBatchSize  int
+	MaxBatchDelay time.Duration
+}
+
+// SinkBatcherOpt - a function on the options for a sink batcher.
+type SinkBatcherOpt func(*SinkBatcherOpts) error
+
+// SinkMaxBatchSize - the number of messages after which a batch is committed, default is 1000.
+func SinkMaxBatchSize(size int) SinkBatcherOpt {
+	return func(opts *SinkBatcherOpts) error {
+		if size < 1 {
+			return errors.New("sink max batch size has to be positive")
+		}
+		opts.MaxBatchSize = size
+		return nil
+	}
+}
+
+// SinkMaxBatchDelay - the time after which a batch is committed even if it is not full, counted from its first
+// message, default is 1 second. It has to be shorter than the consumer's MaxAckTime, otherwise the messages
+// would be redelivered while they wait in the batch.
+func SinkMaxBatchDelay(delay time.Duration) SinkBatcherOpt {
+	return func(opts *SinkBatcherOpts) error {
+		if delay <= 0 {
+			return errors.New("sink max batch delay has to be positive")
+		}
+		opts.MaxBatchDelay = delay
+		return nil
+	}
+}
+
+// SinkBatcher - accumulates the messages of a consumer into batches bounded by size and time and hands each batch
+// to a commit function, the messages are acked only after the commit succeeds which gives the sink at-least-once
+// semantics. Commits are serialized, consuming waits while a full batch is being committed.
+type SinkBatcher struct {
+	consumer *Consumer
+	commit   SinkCommitFunc
+	maxSize  int
+	maxDelay time.Duration
+
+	mu       sync.Mutex
+	pending  []*Msg
+	nakDelay time.Duration
+	// stopTimer - closed when the pending batch is committed before its delay expires, nil while nothing is pending.
+	stopTimer chan struct{}
+}
+
+// NewSinkBatcher - creates a sink batcher committing the consumer's messages with commit.
+func NewSinkBatcher(consumer *Consumer, commit SinkCommitFunc, opts ...SinkBatcherOpt) (*SinkBatcher, error) {
+	if consumer == nil || commit == nil {
+		return nil, memphisError(errors.New("a sink batcher requires a consumer and a commit function"))
+	}
+	defaultOpts := SinkBatcherOpts{MaxBatchSize: 1000, MaxBatchDelay: time.Second}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	if consumer.MaxAckTime > 0 && defaultOpts.MaxBatchDelay >= consumer.MaxAckTime {
+		return nil, memphisError(fmt.Errorf("sink max batch delay %v has to be shorter than the consumer's max ack time %v", defaultOpts.MaxBatchDelay, consumer.MaxAckTime))
+	}
+	return &SinkBatcher{
+		consumer: consumer,
+		commit:   commit,
+		maxSize:  defaultOpts.MaxBatchSize,
+		maxDelay: defaultOpts.MaxBatchDelay,
+	}, nil
+}
+
+// SinkBatcher.Consume - starts consuming into batches, NakDelay sets the delay before the messages of a failed
+// commit are redelivered.
+func (b *SinkBatcher) Consume(opts ...ConsumingOpt) error {
+	nakDelay, err := resultNakDelay(opts)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.nakDelay = nakDelay
+	b.mu.Unlock()
+	c := b.consumer
+	return c.Consume(func(msgs []*Msg, err error, ctx context.Context) {
+		if err != nil {
+			c.callErrHandler(err)
+		}
+		if len(msgs) == 0 {
+			return
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.pending = append(b.pending, msgs...)
+		if len(b.pending) >= b.maxSize {
+			b.commitLocked(resultContext(ctx), false)
+		}
+		b.armLocked()
+	}, opts...)
+}
+
+// SinkBatcher.Flush - commits the pending messages right away, returns the error of a failed commit.
+func (b *SinkBatcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.commitLocked(resultContext(ctx), true)
+}
+
+// SinkBatcher.StopConsume - stops consuming and commits the pending messages, a failed commit is reported to
+// the consumer's error handler.
+func (b *SinkBatcher) StopConsume() {
+	b.consumer.StopConsume()
+	if err := b.Flush(context.Background()); err != nil {
+		b.consumer.callErrHandler(memphisError(fmt.Errorf("sink commit: %w", err)))
+	}
+}
+
+// armLocked - starts the delay of the pending batch when it has just received its first messages.
+func (b *SinkBatcher) armLocked() {
+	if b.stopTimer != nil || len(b.pending) == 0 {
+		return
+	}
+	stop := make(chan struct{})
+	b.stopTimer = stop
+	timer := b.consumer.clock().NewTimer(b.maxDelay)
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+		case <-stop:
+			return
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.stopTimer == stop {
+			b.commitLocked(context.Background(), true)
+		}
+	}()
+}
+
+// commitLocked - commits the pending messages in batches of at most the max batch size and settles each batch
+// according to its commit's result, returns the first commit error. Unless all is set, a partial batch is left
+// pending for its delay.
+func (b *SinkBatcher) commitLocked(ctx context.Context, all bool) error {
+	if b.stopTimer != nil {
+		close(b.stopTimer)
+		b.stopTimer = nil
+	}
+	var firstErr error
+	for len(b.pending) >= b.maxSize || (all && len(b.pending) > 0) {
+		n := b.maxSize
+		if n > len(b.pending) {
+			n = len(b.pending)
+		}
+		batch := b.pending[:n]
+		b.pending = b.pending[n:]
+		result := b.commit(ctx, batch)
+		for _, msg := range batch {
+			b.consumer.settle(msg, result, b.nakDelay)
+		}
+		if result != nil && firstErr == nil {
+			firstErr = result
+		}
+	}
+	if len(b.pending) == 0 {
+		b.pending = nil
+	}
+	return firstErr
+}
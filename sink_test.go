@@ -0,0 +1,79 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSinkBatcher(t *testing.T) {
+	settled := make(chan string, 10)
+	c := newResultConsumer(settled, "a", "b", "fail")
+	commits := make(chan string, 10)
+	b, err := NewSinkBatcher(c, func(ctx context.Context, msgs []*Msg) error {
+		var data []string
+		for _, msg := range msgs {
+			data = append(data, string(msg.Data()))
+		}
+		commits <- strings.Join(data, ",")
+		if data[0] == "fail" {
+			return errors.New("warehouse unavailable")
+		}
+		return nil
+	}, SinkMaxBatchSize(2), SinkMaxBatchDelay(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Consume(NakDelay(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopConsume()
+
+	// the full batch is committed right away, the remainder once its delay expires
+	want := []string{"a:ack", "b:ack", "fail:nak 1m0s"}
+	if got := collectSettled(t, settled, 3); !reflect.DeepEqual(got, want) {
+		t.Fatalf("settled %v, want %v", got, want)
+	}
+	if got := []string{<-commits, <-commits}; !reflect.DeepEqual(got, []string{"a,b", "fail"}) {
+		t.Fatalf("committed %v", got)
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("flushing an empty batch failed: %v", err)
+	}
+	if len(commits) != 0 {
+		t.Fatalf("an empty batch was committed")
+	}
+}
+
+func TestNewSinkBatcherValidation(t *testing.T) {
+	commit := func(context.Context, []*Msg) error { return nil }
+	if _, err := NewSinkBatcher(nil, commit); err == nil {
+		t.Fatalf("a sink batcher without a consumer was created")
+	}
+	c := &Consumer{MaxAckTime: time.Second}
+	if _, err := NewSinkBatcher(c, commit, SinkMaxBatchDelay(2*time.Second)); err == nil {
+		t.Fatalf("a batch delay longer than the max ack time was accepted")
+	}
+	if _, err := NewSinkBatcher(c, commit, SinkMaxBatchSize(0)); err == nil {
+		t.Fatalf("a zero batch size was accepted")
+	}
+	if _, err := NewSinkBatcher(c, commit, SinkMaxBatchDelay(500*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+}
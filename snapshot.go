@@ -0,0 +1,302 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ExportFormat - the format of a station snapshot written by Station.Export.
+type ExportFormat int
+
+const (
+	// ExportNDJSON - one json object per message with its partition, sequence, time, headers and base64 data.
+	ExportNDJSON ExportFormat = iota
+	// ExportLengthPrefixed - a binary format holding the data as is, more compact for binary payloads.
+	ExportLengthPrefixed
+)
+
+const exportFetchBatch = 500
+
+// lengthPrefixedMagic - starts length prefixed snapshots, every message is then a big endian uint32 length and
+// the json of its metadata followed by a uint32 length and its data.
+var lengthPrefixedMagic = []byte("MEMPHIS\x01")
+
+// ExportOpts - configuration options for exporting a station.
+type ExportOpts struct {
+	Format      ExportFormat
+	RequestOpts []RequestOpt
+}
+
+// ExportOpt - a function on the options for exporting a station.
+type ExportOpt func(*ExportOpts) error
+
+// ExportAs - the format of the snapshot, default is ExportNDJSON.
+func ExportAs(format ExportFormat) ExportOpt {
+	return func(opts *ExportOpts) error {
+		if format != ExportNDJSON && format != ExportLengthPrefixed {
+			return fmt.Errorf("unknown export format %d", format)
+		}
+		opts.Format = format
+		return nil
+	}
+}
+
+// ExportRequestOpts - options for the requests looking up the station's partitions.
+func ExportRequestOpts(requestOpts ...RequestOpt) ExportOpt {
+	return func(opts *ExportOpts) error {
+		opts.RequestOpts = requestOpts
+		return nil
+	}
+}
+
+// exportedMsg - a message of a station snapshot.
+type exportedMsg struct {
+	Partition int               `json:"partition"`
+	Sequence  uint64            `json:"sequence"`
+	Time      time.Time         `json:"time"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Data      []byte            `json:"data,omitempty"`
+}
+
+// Station.Export - writes every message stored in the station to w, partition by partition in sequence order,
+// with its headers and payload. Messages produced while exporting are not included. Meant for backups of small
+// to medium stations, the snapshot is restored with Station.Import. Returns the number of exported messages.
+func (s *Station) Export(ctx context.Context, w io.Writer, opts ...ExportOpt) (int, error) {
+	exportOpts := ExportOpts{Format: ExportNDJSON}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&exportOpts); err != nil {
+				return 0, memphisError(err)
+			}
+		}
+	}
+	partitions, err := s.conn.GetStationPartitions(s.Name, exportOpts.RequestOpts...)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	write := snapshotWriter(bw, exportOpts.Format)
+	if exportOpts.Format == ExportLengthPrefixed {
+		if _, err := bw.Write(lengthPrefixedMagic); err != nil {
+			return 0, memphisError(err)
+		}
+	}
+	exported := 0
+	for _, partition := range partitions {
+		n, err := s.conn.exportStream(ctx, partition, write)
+		exported += n
+		if err != nil {
+			return exported, memphisError(fmt.Errorf("export partition %d: %w", partition.Number, err))
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return exported, memphisError(err)
+	}
+	return exported, nil
+}
+
+// exportStream - writes the messages of a partition's stream up to its last sequence when the export started.
+func (c *Conn) exportStream(ctx context.Context, partition StationPartition, write func(exportedMsg) error) (int, error) {
+	stream, err := c.js.Stream(ctx, partition.StreamName)
+	if err != nil {
+		return 0, err
+	}
+	lastSeq := stream.CachedInfo().State.LastSeq
+	if lastSeq == 0 {
+		return 0, nil
+	}
+	cons, err := stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{})
+	if err != nil {
+		return 0, err
+	}
+	exported := 0
+	for done := false; !done; {
+		if err := ctx.Err(); err != nil {
+			return exported, err
+		}
+		batch, err := cons.Fetch(exportFetchBatch, jetstream.FetchMaxWait(time.Second))
+		if err != nil {
+			return exported, err
+		}
+		received := 0
+		for msg := range batch.Messages() {
+			received++
+			md, err := msg.Metadata()
+			if err != nil {
+				return exported, err
+			}
+			if md.Sequence.Stream > lastSeq {
+				done = true
+				continue
+			}
+			err = write(exportedMsg{
+				Partition: partition.Number,
+				Sequence:  md.Sequence.Stream,
+				Time:      md.Timestamp,
+				Headers:   userHeaders(msg.Headers()),
+				Data:      msg.Data(),
+			})
+			if err != nil {
+				return exported, err
+			}
+			exported++
+			done = done || md.Sequence.Stream >= lastSeq
+		}
+		if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+			return exported, err
+		}
+		done = done || received == 0
+	}
+	return exported, nil
+}
+
+// snapshotWriter - writes exported messages to w in format.
+func snapshotWriter(w io.Writer, format ExportFormat) func(exportedMsg) error {
+	if format == ExportNDJSON {
+		enc := json.NewEncoder(w)
+		return func(msg exportedMsg) error {
+			return enc.Encode(msg)
+		}
+	}
+	return func(msg exportedMsg) error {
+		data := msg.Data
+		msg.Data = nil
+		meta, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		for _, field := range [][]byte{meta, data} {
+			var size [4]byte
+			binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+			if _, err := w.Write(size[:]); err != nil {
+				return err
+			}
+			if _, err := w.Write(field); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// snapshotReader - reads the messages of a snapshot, its format is detected from its first bytes.
+func snapshotReader(r io.Reader) (func() (exportedMsg, error), error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(lengthPrefixedMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !bytes.Equal(magic, lengthPrefixedMagic) {
+		dec := json.NewDecoder(br)
+		return func() (exportedMsg, error) {
+			var msg exportedMsg
+			err := dec.Decode(&msg)
+			return msg, err
+		}, nil
+	}
+	br.Discard(len(lengthPrefixedMagic))
+	readField := func() ([]byte, error) {
+		var size [4]byte
+		if _, err := io.ReadFull(br, size[:]); err != nil {
+			return nil, err
+		}
+		field := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(br, field); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return field, nil
+	}
+	return func() (exportedMsg, error) {
+		var msg exportedMsg
+		meta, err := readField()
+		if err != nil {
+			return msg, err
+		}
+		if err := json.Unmarshal(meta, &msg); err != nil {
+			return msg, err
+		}
+		if msg.Data, err = readField(); errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return msg, err
+	}, nil
+}
+
+// Station.Import - produces the messages of a snapshot written by Station.Export, in either format, to the station
+// in order. A message goes back to its partition when the station has it, its original headers are restored, so a
+// message id deduplicates messages imported twice within the station's idempotency window. Sequences and times are
+// assigned anew. Returns the number of imported messages.
+func (s *Station) Import(ctx context.Context, r io.Reader) (int, error) {
+	next, err := snapshotReader(r)
+	if err != nil {
+		return 0, memphisError(err)
+	}
+	suffix, err := randomHex(4)
+	if err != nil {
+		return 0, err
+	}
+	producer, err := s.CreateProducer("import_" + suffix)
+	if err != nil {
+		return 0, err
+	}
+	defer producer.Destroy()
+	partitions := map[int]bool{}
+	for _, partition := range s.conn.getStationPartitions(s.Name).PartitionsList {
+		partitions[partition] = true
+	}
+	return importSnapshot(next, func(msg exportedMsg) error {
+		hdrs := Headers{}
+		hdrs.New()
+		for key, value := range msg.Headers {
+			if err := hdrs.Add(key, value); err != nil {
+				return err
+			}
+		}
+		opts := []ProduceOpt{MsgHeaders(hdrs)}
+		if partitions[msg.Partition] {
+			opts = append(opts, ProducerPartitionNumber(msg.Partition))
+		}
+		return producer.ProduceWithContext(ctx, msg.Data, opts...)
+	})
+}
+
+// importSnapshot - produces every message read by next.
+func importSnapshot(next func() (exportedMsg, error), produce func(exportedMsg) error) (int, error) {
+	imported := 0
+	for {
+		msg, err := next()
+		if errors.Is(err, io.EOF) {
+			return imported, nil
+		}
+		if err != nil {
+			return imported, memphisError(fmt.Errorf("read snapshot: %w", err))
+		}
+		if err := produce(msg); err != nil {
+			return imported, memphisError(fmt.Errorf("import message %d of partition %d: %w", msg.Sequence, msg.Partition, err))
+		}
+		imported++
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type storedJsMsg struct {
+	jetstream.Msg
+	seq     uint64
+	headers nats.Header
+	data    string
+}
+
+func (m *storedJsMsg) Data() []byte         { return []byte(m.data) }
+func (m *storedJsMsg) Headers() nats.Header { return m.headers }
+func (m *storedJsMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{Sequence: jetstream.SequencePair{Stream: m.seq}, Timestamp: time.Unix(int64(m.seq), 0).UTC()}, nil
+}
+
+// storedStream - a stream whose ordered consumer hands out its messages in one batch.
+type storedStream struct {
+	jetstream.Stream
+	lastSeq uint64
+	msgs    []jetstream.Msg
+}
+
+func (s *storedStream) CachedInfo() *jetstream.StreamInfo {
+	return &jetstream.StreamInfo{State: jetstream.StreamState{LastSeq: s.lastSeq}}
+}
+
+func (s *storedStream) OrderedConsumer(context.Context, jetstream.OrderedConsumerConfig) (jetstream.Consumer, error) {
+	return &onceJsConsumer{msgs: s.msgs}, nil
+}
+
+type storedStreamsJetStream struct {
+	jetstream.JetStream
+	streams map[string]*storedStream
+}
+
+func (js *storedStreamsJetStream) Stream(_ context.Context, name string) (jetstream.Stream, error) {
+	if s, ok := js.streams[name]; ok {
+		return s, nil
+	}
+	return nil, jetstream.ErrStreamNotFound
+}
+
+func TestStationExportImport(t *testing.T) {
+	js := &storedStreamsJetStream{streams: map[string]*storedStream{
+		"orders$1": {lastSeq: 2, msgs: []jetstream.Msg{
+			&storedJsMsg{seq: 1, data: "a", headers: nats.Header{"msg-id": {"1"}, "$memphis_producedBy": {"svc"}}},
+			&storedJsMsg{seq: 2, data: "\x00binary"},
+			&storedJsMsg{seq: 3, data: "produced while exporting"},
+		}},
+		"orders$2": {},
+	}}
+	conn := &Conn{js: js, stationPartitions: map[string]*PartitionsUpdate{"orders": {PartitionsList: []int{1, 2}}}}
+	station := &Station{Name: "orders", conn: conn}
+	want := []exportedMsg{
+		{Partition: 1, Sequence: 1, Time: time.Unix(1, 0).UTC(), Headers: map[string]string{"msg-id": "1"}, Data: []byte("a")},
+		{Partition: 1, Sequence: 2, Time: time.Unix(2, 0).UTC(), Headers: map[string]string{}, Data: []byte("\x00binary")},
+	}
+
+	for _, format := range []ExportFormat{ExportNDJSON, ExportLengthPrefixed} {
+		js.streams["orders$1"].msgs = append([]jetstream.Msg(nil), js.streams["orders$1"].msgs...)
+		var snapshot bytes.Buffer
+		n, err := station.Export(context.Background(), &snapshot, ExportAs(format))
+		if err != nil || n != 2 {
+			t.Fatalf("format %d: exported %d messages, err=%v", format, n, err)
+		}
+		next, err := snapshotReader(&snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []exportedMsg
+		n, err = importSnapshot(next, func(msg exportedMsg) error {
+			got = append(got, msg)
+			return nil
+		})
+		if err != nil || n != 2 {
+			t.Fatalf("format %d: imported %d messages, err=%v", format, n, err)
+		}
+		for i := range got {
+			if got[i].Headers == nil {
+				got[i].Headers = map[string]string{}
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("format %d: imported %+v, want %+v", format, got, want)
+		}
+	}
+
+	var truncated bytes.Buffer
+	write := snapshotWriter(&truncated, ExportLengthPrefixed)
+	truncated.Write(lengthPrefixedMagic)
+	write(want[0])
+	truncated.Truncate(truncated.Len() - 1)
+	next, _ := snapshotReader(&truncated)
+	if _, err := importSnapshot(next, func(exportedMsg) error { return nil }); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("a truncated snapshot was read, err=%v", err)
+	}
+	if _, err := station.Export(context.Background(), &truncated, ExportAs(ExportFormat(5))); err == nil {
+		t.Fatalf("an unknown format was accepted")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// StandbyOpts - configuration options for a standby consumer.
+type StandbyOpts struct {
+	Bucket string
+	// TTL - how long the active instance holds the lease without renewing it, it is renewed every third of it.
+	TTL      time.Duration
+	Promoted func()
+	Demoted  func()
+}
+
+// StandbyOpt - a function on the options for a standby consumer.
+type StandbyOpt func(*StandbyOpts) error
+
+// StandbyBucket - the key value bucket holding the leases, default is the bucket of locks, memphis_locks.
+func StandbyBucket(bucket string) StandbyOpt {
+	return func(opts *StandbyOpts) error {
+		opts.Bucket = bucket
+		return nil
+	}
+}
+
+// StandbyTTL - how long a failed active instance keeps the lease before a standby takes over, default is 10 seconds.
+func StandbyTTL(ttl time.Duration) StandbyOpt {
+	return func(opts *StandbyOpts) error {
+		if ttl <= 0 {
+			return errors.New("standby ttl has to be positive")
+		}
+		opts.TTL = ttl
+		return nil
+	}
+}
+
+// OnPromoted - called when the instance takes the lease and starts consuming.
+func OnPromoted(f func()) StandbyOpt {
+	return func(opts *StandbyOpts) error {
+		opts.Promoted = f
+		return nil
+	}
+}
+
+// OnDemoted - called when the instance lost the lease and stopped consuming.
+func OnDemoted(f func()) StandbyOpt {
+	return func(opts *StandbyOpts) error {
+		opts.Demoted = f
+		return nil
+	}
+}
+
+// StandbyConsumer - a consumer which only consumes while it is the leader of the election of its consumer
+// group, other instances of the group wait in standby and take over once the active instance stops renewing
+// the lease. For singleton consumers which must not run concurrently.
+type StandbyConsumer struct {
+	consumer *Consumer
+	opts     StandbyOpts
+	election *Election
+	start    func() error
+	stop     func()
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Consumer.Standby - a standby consumer of the consumer, registered but only fetching messages while it holds
+// the lease of its consumer group. The lease is the lock named <station>.<consumer group> in the bucket.
+func (c *Consumer) Standby(opts ...StandbyOpt) (*StandbyConsumer, error) {
+	defaultOpts := StandbyOpts{Bucket: defaultLocksBucket, TTL: 10 * time.Second}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&defaultOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	election, err := c.conn.NewElection(standbyLockName(c.stationName, c.ConsumerGroup), LockBucket(defaultOpts.Bucket), LockTTL(defaultOpts.TTL))
+	if err != nil {
+		return nil, err
+	}
+	return &StandbyConsumer{consumer: c, opts: defaultOpts, election: election}, nil
+}
+
+// standbyLockName - the name of the lock of the standby consumers of a consumer group.
+func standbyLockName(stationName, consumerGroup string) string {
+	return getInternalName(stationName) + "." + getInternalName(consumerGroup)
+}
+
+// StandbyConsumer.Consume - waits in standby and consumes with handlerFunc while holding the lease.
+func (s *StandbyConsumer) Consume(handlerFunc ConsumeHandler, opts ...ConsumingOpt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return memphisError(ConsumerErrConsumeActive)
+	}
+	s.start = func() error { return s.consumer.Consume(handlerFunc, opts...) }
+	s.stop = func() { s.consumer.stopConsume(ConsumerStateStopped) }
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+	go func() {
+		defer close(s.done)
+		s.election.Campaign(ctx, s.promote, s.demote, s.consumer.callErrHandler)
+	}()
+	return nil
+}
+
+// StandbyConsumer.Active - whether the instance holds the lease and consumes.
+func (s *StandbyConsumer) Active() bool {
+	return s.election.Leader()
+}
+
+// StandbyConsumer.StopConsume - stops consuming or waiting in standby, the lease is released so a standby
+// instance takes over right away.
+func (s *StandbyConsumer) StopConsume() {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel = nil
+	s.mu.Unlock()
+	if cancel == nil {
+		s.consumer.callErrHandler(ConsumerErrConsumeInactive)
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (s *StandbyConsumer) promote() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	if s.opts.Promoted != nil {
+		s.opts.Promoted()
+	}
+	return nil
+}
+
+func (s *StandbyConsumer) demote() {
+	s.stop()
+	if s.opts.Demoted != nil {
+		s.opts.Demoted()
+	}
+}
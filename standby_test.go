@@ -0,0 +1,71 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStandbyConsumer(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	js := &kvJetStream{buckets: map[string]*memKV{}}
+	var consuming []string
+	instance := func(name string) *StandbyConsumer {
+		c := &Consumer{Name: name, ConsumerGroup: "billing", stationName: "orders", conn: &Conn{ConnId: name, js: js, opts: Options{Clock: clock}}}
+		s, err := c.Standby(StandbyTTL(9*time.Second), OnDemoted(func() { consuming = append(consuming, "demoted "+name) }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.start = func() error { consuming = append(consuming, name); return nil }
+		s.stop = func() { consuming = append(consuming, "-"+name) }
+		return s
+	}
+	primary, standby := instance("primary"), instance("standby")
+	tick := func(s *StandbyConsumer) {
+		s.election.step(context.Background(), s.promote, s.demote, nil)
+	}
+
+	tick(primary)
+	tick(standby)
+	if !primary.Active() || standby.Active() {
+		t.Fatalf("primary active=%v, standby active=%v", primary.Active(), standby.Active())
+	}
+	if primary.election.lock.key != "orders.billing" {
+		t.Fatalf("the lease is held on %v", primary.election.lock.key)
+	}
+	clock.advance(3 * time.Second)
+	tick(primary) // renews
+	clock.advance(8 * time.Second)
+	tick(standby)
+	if standby.Active() {
+		t.Fatal("the standby took over a renewed lease")
+	}
+
+	// the primary stops renewing
+	clock.advance(2 * time.Second)
+	tick(standby)
+	if !standby.Active() {
+		t.Fatal("the standby didn't take over an expired lease")
+	}
+	tick(primary)
+	if primary.Active() {
+		t.Fatal("the primary kept consuming after losing the lease")
+	}
+	if want := []string{"primary", "standby", "-primary", "demoted primary"}; !reflect.DeepEqual(consuming, want) {
+		t.Fatalf("consumed %v, want %v", consuming, want)
+	}
+}
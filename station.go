@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -52,6 +54,8 @@ type Station struct {
 	TieredStorageEnabled bool
 	PartitionsNumber     int
 	DlsStation           string
+	metadataMu           sync.RWMutex
+	partitions           []StationPartition
 }
 
 // RetentionType - station's message retention type
@@ -61,13 +65,34 @@ const (
 	MaxMessageAgeSeconds RetentionType = iota
 	Messages
 	Bytes
+	// AckBased - messages are deleted once every consumer group of the station acked them, the retention value is ignored
 	AckBased
 )
 
 func (r RetentionType) String() string {
+	if r < MaxMessageAgeSeconds || r > AckBased {
+		return fmt.Sprintf("RetentionType(%d)", int(r))
+	}
 	return [...]string{"message_age_sec", "messages", "bytes", "ack_based"}[r]
 }
 
+func (r RetentionType) MarshalText() ([]byte, error) {
+	if r < MaxMessageAgeSeconds || r > AckBased {
+		return nil, fmt.Errorf("unknown retention type %d", int(r))
+	}
+	return []byte(r.String()), nil
+}
+
+func (r *RetentionType) UnmarshalText(text []byte) error {
+	for t := MaxMessageAgeSeconds; t <= AckBased; t++ {
+		if t.String() == string(text) {
+			*r = t
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown retention type %q", text)
+}
+
 // StorageType - station's message storage type
 type StorageType int
 
@@ -80,6 +105,23 @@ func (s StorageType) String() string {
 	return [...]string{"file", "memory"}[s]
 }
 
+func (s StorageType) MarshalText() ([]byte, error) {
+	if s != Disk && s != Memory {
+		return nil, fmt.Errorf("unknown storage type %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+func (s *StorageType) UnmarshalText(text []byte) error {
+	for _, t := range []StorageType{Disk, Memory} {
+		if t.String() == string(text) {
+			*s = t
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown storage type %q", text)
+}
+
 type createStationReq struct {
 	Name                    string           `json:"name"`
 	RetentionType           string           `json:"retention_type"`
@@ -115,6 +157,8 @@ type StationOpts struct {
 	PartitionsNumber         int
 	DlsStation               string
 	TimeoutRetry             int
+	RequestOpts              []RequestOpt
+	Sources                  []StationSource
 }
 
 type dlsConfiguration struct {
@@ -158,12 +202,24 @@ func (c *Conn) CreateStation(Name string, opts ...StationOpt) (*Station, error)
 
 	res, err := defaultOpts.createStation(c)
 	if err != nil && strings.Contains(err.Error(), "already exist") {
-		return res, nil
+		// the existing station may differ from the options, its metadata is loaded on first use
+		err = nil
+	} else if err == nil {
+		res.setPartitions(partitionsOf(getInternalName(res.Name), partitionNumbers(res.PartitionsNumber)))
+	}
+	if err == nil && len(defaultOpts.Sources) > 0 {
+		err = c.addStationSources(defaultOpts)
 	}
 	return res, memphisError(err)
 }
 
 func (opts *StationOpts) createStation(c *Conn) (*Station, error) {
+	s := opts.newStation(c)
+	return s, s.conn.create(s, append([]RequestOpt{TimeoutRetry(opts.TimeoutRetry)}, opts.RequestOpts...)...)
+}
+
+// StationOpts.newStation - builds the station described by the options.
+func (opts *StationOpts) newStation(c *Conn) *Station {
 	s := Station{
 		Name:              opts.Name,
 		RetentionType:     opts.RetentionType,
@@ -186,12 +242,152 @@ func (opts *StationOpts) createStation(c *Conn) (*Station, error) {
 		s.PartitionsNumber = 1
 	}
 
-	return &s, s.conn.create(&s, TimeoutRetry(opts.TimeoutRetry))
-
+	return &s
 }
 
 type StationName string
 
+var errStationNotFound = errors.New("station does not exist")
+
+// StationPartition - a partition of a station and the stream backing it.
+type StationPartition struct {
+	Number     int
+	StreamName string
+}
+
+// GetStationPartitions - returns the partitions of a station ordered by number. Stations created before
+// partitions were introduced have a single partition, number 1, backed by the station's stream.
+func (c *Conn) GetStationPartitions(stationName string, options ...RequestOpt) ([]StationPartition, error) {
+	sn := getInternalName(stationName)
+	partitionsList := c.getStationPartitions(sn).PartitionsList
+	if len(partitionsList) == 0 {
+		var err error
+		partitionsList, err = c.listStationPartitions(sn, options...)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+	}
+	return partitionsOf(sn, partitionsList), nil
+}
+
+// partitionsOf - the partitions with the given numbers ordered by number, an empty list is the single stream
+// of a station without partitions.
+func partitionsOf(internalStationName string, partitionsList []int) []StationPartition {
+	if len(partitionsList) == 0 {
+		return []StationPartition{{Number: 1, StreamName: internalStationName}}
+	}
+	partitions := make([]StationPartition, 0, len(partitionsList))
+	for _, p := range partitionsList {
+		partitions = append(partitions, StationPartition{Number: p, StreamName: fmt.Sprintf("%s$%d", internalStationName, p)})
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Number < partitions[j].Number })
+	return partitions
+}
+
+// partitionNumbers - the numbers of a station created with the given number of partitions.
+func partitionNumbers(partitionsNumber int) []int {
+	numbers := make([]int, partitionsNumber)
+	for i := range numbers {
+		numbers[i] = i + 1
+	}
+	return numbers
+}
+
+// listStationPartitions - the partition numbers of a station according to its streams, empty for a station
+// without partitions.
+func (c *Conn) listStationPartitions(internalStationName string, options ...RequestOpt) ([]int, error) {
+	requestOpts, err := getRequestOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.jetstreamContext(requestOpts)
+	defer cancel()
+
+	var partitions []int
+	found := false
+	prefix := internalStationName + "$"
+	names := c.js.StreamNames(ctx)
+	for name := range names.Name() {
+		if name == internalStationName {
+			found = true
+			continue
+		}
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if p, err := strconv.Atoi(strings.TrimPrefix(name, prefix)); err == nil {
+			found = true
+			partitions = append(partitions, p)
+		}
+	}
+	if err := names.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %v", errStationNotFound, internalStationName)
+	}
+	return partitions, nil
+}
+
+// Station.Partitions - returns the partitions of the station, see Conn.GetStationPartitions.
+// The partitions are cached on the station, use Refresh to reload them.
+func (s *Station) Partitions(options ...RequestOpt) ([]StationPartition, error) {
+	if partitions := s.cachedPartitions(); partitions != nil {
+		return partitions, nil
+	}
+	partitions, err := s.conn.GetStationPartitions(s.Name, options...)
+	if err != nil {
+		return nil, err
+	}
+	s.setPartitions(partitions)
+	return s.cachedPartitions(), nil
+}
+
+// Station.Refresh - reloads the station's partitions from the broker, and its schema name from the schema
+// updates the connection received for it, for stations changed since they were created.
+func (s *Station) Refresh(options ...RequestOpt) error {
+	sn := getInternalName(s.Name)
+	partitionsList, err := s.conn.listStationPartitions(sn, options...)
+	if err != nil {
+		return memphisError(err)
+	}
+	partitions := partitionsOf(sn, partitionsList)
+	s.setPartitions(partitions)
+
+	sd, err := s.conn.getSchemaDetails(s.Name)
+	s.metadataMu.Lock()
+	defer s.metadataMu.Unlock()
+	s.PartitionsNumber = len(partitions)
+	if err == nil {
+		s.SchemaName = sd.name
+	}
+	return nil
+}
+
+// Station.cachedPartitions - a copy of the cached partitions, nil when they were not loaded yet.
+func (s *Station) cachedPartitions() []StationPartition {
+	s.metadataMu.RLock()
+	defer s.metadataMu.RUnlock()
+	if s.partitions == nil {
+		return nil
+	}
+	return append([]StationPartition(nil), s.partitions...)
+}
+
+func (s *Station) setPartitions(partitions []StationPartition) {
+	s.metadataMu.Lock()
+	s.partitions = partitions
+	s.metadataMu.Unlock()
+}
+
+// Station.learnPartitions - caches the partitions the broker returned when a client of the station was created.
+func (s *Station) learnPartitions() {
+	sn := getInternalName(s.Name)
+	if partitionsList := s.conn.getStationPartitions(sn).PartitionsList; len(partitionsList) > 0 {
+		s.setPartitions(partitionsOf(sn, partitionsList))
+	}
+}
+
 func (s *Station) Destroy(options ...RequestOpt) error {
 	err := s.conn.destroy(s, options...)
 	if err != nil {
@@ -211,10 +407,14 @@ func (s *Station) getCreationSubject() string {
 }
 
 func (s *Station) getCreationReq() any {
+	retentionValue := s.RetentionValue
+	if s.RetentionType == AckBased {
+		retentionValue = 0
+	}
 	return createStationReq{
 		Name:                    s.Name,
 		RetentionType:           s.RetentionType.String(),
-		RetentionValue:          s.RetentionValue,
+		RetentionValue:          retentionValue,
 		StorageType:             s.StorageType.String(),
 		Replicas:                s.Replicas,
 		IdempotencyWindowMillis: int(s.IdempotencyWindow.Milliseconds()),
@@ -255,9 +455,12 @@ func SchemaName(schemaName string) StationOpt {
 	}
 }
 
-// RetentionTypeOpt - retention type, default is MaxMessageAgeSeconds.
+// RetentionTypeOpt - retention type, default is MaxMessageAgeSeconds. Use AckBased for queue-like stations.
 func RetentionTypeOpt(retentionType RetentionType) StationOpt {
 	return func(opts *StationOpts) error {
+		if _, err := retentionType.MarshalText(); err != nil {
+			return err
+		}
 		opts.RetentionType = retentionType
 		return nil
 	}
@@ -334,6 +537,14 @@ func DlsStation(name string) StationOpt {
 	}
 }
 
+// StationRequestOpts - request options, e.g. RequestTimeout or RequestContext, for the request creating the station.
+func StationRequestOpts(requestOpts ...RequestOpt) StationOpt {
+	return func(opts *StationOpts) error {
+		opts.RequestOpts = append(opts.RequestOpts, requestOpts...)
+		return nil
+	}
+}
+
 // TimeoutRetry - number of retries for timeout errors, default is 5
 func StationTimeoutRetry(timeoutRetry int) StationOpt {
 	return func(opts *StationOpts) error {
@@ -345,10 +556,53 @@ func StationTimeoutRetry(timeoutRetry int) StationOpt {
 // Station schema updates related
 
 type stationUpdateSub struct {
-	refCount        int
-	schemaUpdateCh  chan SchemaUpdate
-	schemaUpdateSub *nats.Subscription
-	schemaDetails   schemaDetails
+	refCount              int
+	schemaUpdateCh        chan SchemaUpdate
+	schemaUpdateSub       *nats.Subscription
+	schemaDetails         schemaDetails
+	schemaChangedHandlers map[int]SchemaChangedHandler
+	lastHandlerId         int
+	handledMu             sync.Mutex
+	handledUpdates        int64
+	handledCh             chan struct{}
+}
+
+// stationUpdateSub.updateHandled - counts a schema update as handled and wakes up the goroutines waiting for it.
+func (sus *stationUpdateSub) updateHandled() {
+	sus.handledMu.Lock()
+	defer sus.handledMu.Unlock()
+	sus.handledUpdates++
+	if sus.handledCh != nil {
+		close(sus.handledCh)
+		sus.handledCh = nil
+	}
+}
+
+// stationUpdateSub.handled - the number of schema updates handled so far and a channel closed once another one is.
+func (sus *stationUpdateSub) handled() (int64, <-chan struct{}) {
+	sus.handledMu.Lock()
+	defer sus.handledMu.Unlock()
+	if sus.handledCh == nil {
+		sus.handledCh = make(chan struct{})
+	}
+	return sus.handledUpdates, sus.handledCh
+}
+
+// stationUpdateSub.awaitHandled - waits until n schema updates were handled, at most timeout according to clock.
+func (sus *stationUpdateSub) awaitHandled(clock Clock, n int64, timeout time.Duration) error {
+	timer := clock.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		handled, updated := sus.handled()
+		if handled >= n {
+			return nil
+		}
+		select {
+		case <-updated:
+		case <-timer.C():
+			return errors.New("timed out waiting for schema updates")
+		}
+	}
 }
 
 type stationFunctionSub struct {
@@ -377,6 +631,21 @@ type schemaDetails struct {
 	avroSchema    avro.Schema
 }
 
+// ensureStationUpdatesSub - registers a placeholder schema updates entry for the station so the creation response can store the schema in it.
+func (c *Conn) ensureStationUpdatesSub(internalStationName string) {
+	c.stationUpdatesMu.Lock()
+	defer c.stationUpdatesMu.Unlock()
+	stationUpdatesSubsLock.Lock()
+	defer stationUpdatesSubsLock.Unlock()
+	if _, ok := c.stationUpdatesSubs[internalStationName]; !ok {
+		c.stationUpdatesSubs[internalStationName] = &stationUpdateSub{
+			refCount:       1,
+			schemaUpdateCh: make(chan SchemaUpdate),
+			schemaDetails:  schemaDetails{},
+		}
+	}
+}
+
 func (c *Conn) listenToSchemaUpdates(stationName string) error {
 	sn := getInternalName(stationName)
 	stationUpdatesSubsLock.Lock()
@@ -390,7 +659,7 @@ func (c *Conn) listenToSchemaUpdates(stationName string) error {
 		}
 		sus := c.stationUpdatesSubs[sn]
 		schemaUpdatesSubject := fmt.Sprintf(schemaUpdatesSubjectTemplate, sn)
-		go sus.schemaUpdatesHandler(&c.stationUpdatesMu)
+		go sus.schemaUpdatesHandler(c, stationName)
 		var err error
 		sus.schemaUpdateSub, err = c.brokerConn.Subscribe(schemaUpdatesSubject, sus.createMsgHandler())
 		if err != nil {
@@ -402,7 +671,7 @@ func (c *Conn) listenToSchemaUpdates(stationName string) error {
 	} else {
 		if sus.schemaUpdateSub == nil {
 			schemaUpdatesSubject := fmt.Sprintf(schemaUpdatesSubjectTemplate, sn)
-			go sus.schemaUpdatesHandler(&c.stationUpdatesMu)
+			go sus.schemaUpdatesHandler(c, stationName)
 			var err error
 			sus.schemaUpdateSub, err = c.brokerConn.Subscribe(schemaUpdatesSubject, sus.createMsgHandler())
 			if err != nil {
@@ -450,6 +719,7 @@ func (sus *stationUpdateSub) createMsgHandler() nats.MsgHandler {
 		err := json.Unmarshal(msg.Data, &update)
 		if err != nil {
 			log.Printf("schema update unmarshal error: %v\n", memphisError(err))
+			sus.updateHandled()
 			return
 		}
 		sus.schemaUpdateCh <- update
@@ -471,20 +741,22 @@ func (sfs *stationFunctionSub) createMsgHandler() nats.MsgHandler {
 func (c *Conn) removeFunctionsUpdatesListener(stationName string) error {
 	sn := getInternalName(stationName)
 
+	stationFunctionsSubsLock.Lock()
+	defer stationFunctionsSubsLock.Unlock()
 	sfs, ok := c.stationFunctionSubs[sn]
 	if !ok {
 		return memphisError(errors.New("functions listener doesn't exist"))
 	}
 
 	sfs.StationFunctionsMu.Lock()
+	defer sfs.StationFunctionsMu.Unlock()
 	sfs.RefCount--
 	if sfs.RefCount <= 0 {
 		close(sfs.FunctionsUpdateCh)
+		delete(c.stationFunctionSubs, sn)
 		if err := sfs.FunctionsUpdateSub.Unsubscribe(); err != nil {
 			return memphisError(err)
 		}
-		sfs.StationFunctionsMu.Unlock()
-		delete(c.stationFunctionSubs, sn)
 	}
 
 	return nil
@@ -509,11 +781,42 @@ func (c *Conn) removeSchemaUpdatesListener(stationName string) error {
 			return memphisError(err)
 		}
 		delete(c.stationUpdatesSubs, sn)
+		c.schemaUpdated()
 	}
 
 	return nil
 }
 
+// removeAllStationListeners - unsubscribes every schema and functions updates listener regardless of its ref count.
+func (c *Conn) removeAllStationListeners() error {
+	var errs multiError
+
+	c.stationUpdatesMu.Lock()
+	stationUpdatesSubsLock.Lock()
+	for sn, sus := range c.stationUpdatesSubs {
+		if sus.schemaUpdateSub != nil {
+			errs.add(memphisError(sus.schemaUpdateSub.Unsubscribe()))
+		}
+		close(sus.schemaUpdateCh)
+		delete(c.stationUpdatesSubs, sn)
+	}
+	c.schemaUpdated()
+	stationUpdatesSubsLock.Unlock()
+	c.stationUpdatesMu.Unlock()
+
+	stationFunctionsSubsLock.Lock()
+	for sn, sfs := range c.stationFunctionSubs {
+		if sfs.FunctionsUpdateSub != nil {
+			errs.add(memphisError(sfs.FunctionsUpdateSub.Unsubscribe()))
+		}
+		close(sfs.FunctionsUpdateCh)
+		delete(c.stationFunctionSubs, sn)
+	}
+	stationFunctionsSubsLock.Unlock()
+
+	return errs.err()
+}
+
 func (c *Conn) getSchemaDetails(stationName string) (schemaDetails, error) {
 	sn := getInternalName(stationName)
 
@@ -528,7 +831,8 @@ func (c *Conn) getSchemaDetails(stationName string) (schemaDetails, error) {
 	return sus.schemaDetails, nil
 }
 
-func (sus *stationUpdateSub) schemaUpdatesHandler(lock *sync.RWMutex) {
+func (sus *stationUpdateSub) schemaUpdatesHandler(c *Conn, stationName string) {
+	lock := &c.stationUpdatesMu
 	for {
 		update, ok := <-sus.schemaUpdateCh
 		if !ok {
@@ -537,13 +841,40 @@ func (sus *stationUpdateSub) schemaUpdatesHandler(lock *sync.RWMutex) {
 
 		lock.Lock()
 		sd := &sus.schemaDetails
+		change := SchemaChange{
+			StationName:        stationName,
+			PreviousSchemaName: sd.name,
+			PreviousVersion:    sd.activeVersion.VersionNumber,
+		}
 		switch update.UpdateType {
 		case SchemaUpdateTypeInit:
 			sd.handleSchemaUpdateInit(update.Init)
 		case SchemaUpdateTypeDrop:
 			sd.handleSchemaUpdateDrop()
 		}
+		c.schemaUpdated()
+		change.SchemaName = sd.name
+		change.SchemaType = sd.schemaType
+		change.Version = sd.activeVersion.VersionNumber
+		handlers := make([]SchemaChangedHandler, 0, len(sus.schemaChangedHandlers))
+		for _, handler := range sus.schemaChangedHandlers {
+			handlers = append(handlers, handler)
+		}
 		lock.Unlock()
+		sus.updateHandled()
+
+		if change.SchemaName == change.PreviousSchemaName && change.Version == change.PreviousVersion {
+			continue
+		}
+		c.emit(Event{Type: EventSchemaUpdated, Station: stationName, Details: map[string]string{
+			"previous_schema":  change.PreviousSchemaName,
+			"previous_version": strconv.Itoa(change.PreviousVersion),
+			"schema":           change.SchemaName,
+			"version":          strconv.Itoa(change.Version),
+		}})
+		for _, handler := range handlers {
+			handler(change)
+		}
 	}
 }
 
@@ -617,7 +948,13 @@ func (sd *schemaDetails) compileDescriptor() error {
 }
 
 func (sd *schemaDetails) compileJsonSchema() error {
-	sch, err := jsonschema.CompileString(sd.name, sd.activeVersion.Content)
+	compiler := jsonschema.NewCompiler()
+	// keeps the defaults of properties, for FillSchemaDefaults
+	compiler.ExtractAnnotations = true
+	if err := compiler.AddResource(sd.name, strings.NewReader(sd.activeVersion.Content)); err != nil {
+		return memphisError(err)
+	}
+	sch, err := compiler.Compile(sd.name)
 	if err != nil {
 		return memphisError(err)
 	}
@@ -776,7 +1113,7 @@ func (sd *schemaDetails) validateGraphQlMsg(msg any) ([]byte, error) {
 			return nil, memphisError(errors.New("invalid message format, expecting GraphQL"))
 		}
 
-		return msgBytes, memphisError(errors.New(validateErrorGql))
+		return msgBytes, memphisError(graphQlErrors(validateResult))
 	}
 	return msgBytes, nil
 }
@@ -14,6 +14,8 @@
 package memphis
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 )
@@ -76,3 +78,99 @@ func TestCreateStationWithDefaults(t *testing.T) {
 	}
 	s.Destroy()
 }
+
+func TestStationDlsConfiguration(t *testing.T) {
+	opts := GetStationDefaultOptions()
+	for _, opt := range []StationOpt{SendPoisonMsgToDls(false), SendSchemaFailedMsgToDls(true)} {
+		if err := opt(&opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := opts.newStation(&Conn{})
+	req, err := json.Marshal(s.getCreationReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(req), `"dls_configuration":{"poison":false,"schemaverse":true}`) {
+		t.Errorf("unexpected creation request %s", req)
+	}
+}
+
+func TestAckBasedRetention(t *testing.T) {
+	if err := RetentionTypeOpt(RetentionType(7))(&StationOpts{}); err == nil {
+		t.Error("expected an unknown retention type to be rejected")
+	}
+
+	opts := GetStationDefaultOptions()
+	if err := RetentionTypeOpt(AckBased)(&opts); err != nil {
+		t.Fatal(err)
+	}
+	req, err := json.Marshal(opts.newStation(&Conn{}).getCreationReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(req), `"retention_type":"ack_based","retention_value":0`) {
+		t.Errorf("unexpected creation request %s", req)
+	}
+}
+
+func TestGetStationPartitions(t *testing.T) {
+	c := &Conn{stationPartitions: make(map[string]*PartitionsUpdate)}
+	c.setStationPartitions("Orders", &PartitionsUpdate{PartitionsList: []int{3, 1, 2}})
+
+	partitions, err := c.GetStationPartitions("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []StationPartition{{1, "orders$1"}, {2, "orders$2"}, {3, "orders$3"}}
+	if len(partitions) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, partitions)
+	}
+	for i := range expected {
+		if partitions[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], partitions[i])
+		}
+	}
+
+	for _, p := range []int{1, 2, 3} {
+		if err := c.ValidatePartitionNumber(p, "orders"); err != nil {
+			t.Errorf("partition %d should be valid: %v", p, err)
+		}
+	}
+	for _, p := range []int{0, 4} {
+		if err := c.ValidatePartitionNumber(p, "orders"); err == nil {
+			t.Errorf("partition %d should be invalid", p)
+		}
+	}
+}
+
+func TestStationPartitionsCache(t *testing.T) {
+	c := &Conn{stationPartitions: make(map[string]*PartitionsUpdate)}
+	opts := GetStationDefaultOptions()
+	opts.Name = "orders"
+	opts.PartitionsNumber = 2
+	s := opts.newStation(c)
+	s.setPartitions(partitionsOf("orders", partitionNumbers(s.PartitionsNumber)))
+
+	partitions, err := s.Partitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(partitions) != 2 || partitions[1] != (StationPartition{2, "orders$2"}) {
+		t.Fatalf("unexpected cached partitions %v", partitions)
+	}
+	partitions[0].Number = 7
+	if cached := s.cachedPartitions(); cached[0].Number != 1 {
+		t.Errorf("the cache was modified through the returned partitions")
+	}
+
+	if _, err := s.CreatePartitionConsumer("worker", 3); err == nil || !strings.Contains(err.Error(), "no partition 3") {
+		t.Errorf("expected the partition to be rejected from the cache, got %v", err)
+	}
+
+	c.setStationPartitions("orders", &PartitionsUpdate{PartitionsList: []int{1, 2, 3}})
+	s.learnPartitions()
+	if partitions, _ := s.Partitions(); len(partitions) != 3 {
+		t.Errorf("expected the partitions returned by the broker to be cached, got %v", partitions)
+	}
+}
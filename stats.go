@@ -0,0 +1,131 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	rttMetric            = "memphis_connection_rtt_seconds"
+	reconnectsMetric     = "memphis_connection_reconnects_total"
+	publishLatencyMetric = "memphis_producer_publish_latency_seconds"
+	requestLatencyMetric = "memphis_request_latency_seconds"
+	metricsSubjectLabel  = "subject"
+)
+
+// ConnStats - the connection's traffic and latencies since it was created or since the last ResetStats.
+// Comparing the RTT, which only involves the network, with the publish and request latencies, which include
+// the broker's processing, tells whether slowness comes from the network or from the broker.
+type ConnStats struct {
+	// RTT - the round trip time of a ping to the server the connection is attached to, measured by Stats.
+	RTT        time.Duration
+	Reconnects uint64
+	InMsgs     uint64
+	OutMsgs    uint64
+	InBytes    uint64
+	OutBytes   uint64
+	// PublishLatency - seconds between publishing a message and receiving its acknowledgement, sync produce only.
+	PublishLatency HistogramSnapshot
+	// RequestLatency - seconds taken by the SDK's requests to the broker, e.g. creating producers and consumers.
+	RequestLatency HistogramSnapshot
+	// Since - when the stats started accumulating.
+	Since time.Time
+}
+
+// connStats - the latencies recorded by the connection and the nats statistics at the last reset.
+type connStats struct {
+	mu             sync.Mutex
+	publishLatency *Histogram
+	requestLatency *Histogram
+	baseline       nats.Statistics
+	since          time.Time
+}
+
+// histograms - the latency histograms, created on first use.
+func (s *connStats) histograms() (*Histogram, *Histogram) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.publishLatency == nil {
+		s.publishLatency = NewHistogram(DefaultLatencyBuckets)
+		s.requestLatency = NewHistogram(DefaultLatencyBuckets)
+	}
+	return s.publishLatency, s.requestLatency
+}
+
+// Stats - the connection's stats, the RTT is measured with a ping to the broker. When the broker can't be reached
+// the RTT is zero and the error is returned along with the rest of the stats. The RTT is also recorded into the
+// memphis_connection_rtt_seconds histogram of the connection's metrics.
+func (c *Conn) Stats() (ConnStats, error) {
+	publishLatency, requestLatency := c.stats.histograms()
+	c.stats.mu.Lock()
+	baseline, since := c.stats.baseline, c.stats.since
+	c.stats.mu.Unlock()
+
+	stats := ConnStats{
+		PublishLatency: publishLatency.Snapshot(),
+		RequestLatency: requestLatency.Snapshot(),
+		Since:          since,
+	}
+	if c.brokerConn == nil {
+		return stats, memphisError(errors.New("not connected"))
+	}
+	current := c.brokerConn.Stats()
+	stats.Reconnects = current.Reconnects - baseline.Reconnects
+	stats.InMsgs = current.InMsgs - baseline.InMsgs
+	stats.OutMsgs = current.OutMsgs - baseline.OutMsgs
+	stats.InBytes = current.InBytes - baseline.InBytes
+	stats.OutBytes = current.OutBytes - baseline.OutBytes
+
+	rtt, err := c.brokerConn.RTT()
+	if err != nil {
+		return stats, memphisError(err)
+	}
+	stats.RTT = rtt
+	c.observeHistogram(rttMetric, nil, rtt.Seconds())
+	return stats, nil
+}
+
+// ResetStats - clears the latencies and restarts the counters of Stats, the connection's metrics are not affected.
+func (c *Conn) ResetStats() {
+	publishLatency, requestLatency := c.stats.histograms()
+	publishLatency.Reset()
+	requestLatency.Reset()
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	if c.brokerConn != nil {
+		c.stats.baseline = c.brokerConn.Stats()
+	}
+	c.stats.since = c.clock().Now()
+}
+
+// observePublishLatency - records the time since a message was published to station until its acknowledgement.
+func (c *Conn) observePublishLatency(station string, publishedAt time.Time) {
+	latency := c.clock().Now().Sub(publishedAt).Seconds()
+	publishLatency, _ := c.stats.histograms()
+	publishLatency.Observe(latency)
+	c.observeHistogram(publishLatencyMetric, map[string]string{metricsStationLabel: station}, latency)
+}
+
+// observeRequestLatency - records the time a request to the broker on subject took.
+func (c *Conn) observeRequestLatency(subject string, startedAt time.Time) {
+	latency := c.clock().Now().Sub(startedAt).Seconds()
+	_, requestLatency := c.stats.histograms()
+	requestLatency.Observe(latency)
+	c.observeHistogram(requestLatencyMetric, map[string]string{metricsSubjectLabel: subject}, latency)
+}
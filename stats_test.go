@@ -0,0 +1,42 @@
+package memphis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnStats(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	metrics := NewInMemoryMetrics()
+	c := &Conn{opts: Options{Metrics: metrics, Clock: clock}}
+
+	c.observeRequestLatency("$memphis_producer_creations", clock.Now().Add(-20*time.Millisecond))
+	c.observePublishLatency("orders", clock.Now().Add(-5*time.Millisecond))
+	c.observePublishLatency("orders", clock.Now().Add(-15*time.Millisecond))
+
+	stats, err := c.Stats()
+	if err == nil {
+		t.Error("expected an error without a broker connection")
+	}
+	if stats.PublishLatency.Count != 2 || stats.RequestLatency.Count != 1 {
+		t.Fatalf("unexpected latencies %+v %+v", stats.PublishLatency, stats.RequestLatency)
+	}
+	if max := stats.PublishLatency.Max; max < 0.0149 || max > 0.0151 {
+		t.Errorf("expected a max publish latency of 15ms, got %v", max)
+	}
+	if s, ok := metrics.Histogram(publishLatencyMetric, map[string]string{metricsStationLabel: "orders"}); !ok || s.Count != 2 {
+		t.Errorf("expected the publish latencies in the metrics, got %+v", s)
+	}
+	if s, ok := metrics.Histogram(requestLatencyMetric, map[string]string{metricsSubjectLabel: "$memphis_producer_creations"}); !ok || s.Count != 1 {
+		t.Errorf("expected the request latency in the metrics, got %+v", s)
+	}
+
+	c.ResetStats()
+	stats, _ = c.Stats()
+	if stats.PublishLatency.Count != 0 || stats.RequestLatency.Count != 0 || !stats.Since.Equal(clock.Now()) {
+		t.Errorf("expected empty stats after reset, got %+v", stats)
+	}
+	if s, _ := metrics.Histogram(publishLatencyMetric, map[string]string{metricsStationLabel: "orders"}); s.Count != 2 {
+		t.Error("reset should not clear the metrics")
+	}
+}
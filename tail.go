@@ -0,0 +1,84 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+)
+
+// TailedMsg - a message received by Conn.TailStation.
+type TailedMsg struct {
+	Sequence uint64
+	Headers  map[string]string
+	Data     []byte
+	// Payload - the message decoded with the station's schema, see Msg.DataDeserialized, nil when DecodeErr is set.
+	Payload   any
+	DecodeErr error
+}
+
+// TailHandler - handles the messages of Conn.TailStation, one at a time in the order they are received.
+type TailHandler func(TailedMsg)
+
+// TailStation - streams the messages produced to the station from now on to handler, until ctx is done.
+// The messages are read by an ephemeral consumer, so tailing doesn't take messages away from the station's
+// consumer groups and leaves no state behind once it returns. opts are applied to the consumer, e.g. to
+// tail a single partition or start from an earlier sequence. Fetch errors are passed to the consumer's
+// error handler. TailStation blocks until ctx is done and returns the error of destroying the consumer.
+func (c *Conn) TailStation(ctx context.Context, stationName string, handler TailHandler, opts ...ConsumerOpt) error {
+	name, err := extendNameWithRandSuffix("tail")
+	if err != nil {
+		return memphisError(err)
+	}
+	consumerOpts := append([]ConsumerOpt{Ephemeral(), StartConsumeFromNow(), ConsumeModeOpt(ConsumeModePipelined)}, opts...)
+	consumerOpts = append(consumerOpts, func(o *ConsumerOpts) error {
+		// an explicit start position replaces tailing from now
+		if o.StartConsumeFromSequence > 1 || o.LastMessages > -1 {
+			o.StartConsumeFromNow = false
+		}
+		return nil
+	})
+	consumer, err := c.CreateConsumer(stationName, name, consumerOpts...)
+	if err != nil {
+		return err
+	}
+	err = consumer.Consume(func(msgs []*Msg, err error, _ context.Context) {
+		if err != nil {
+			consumer.callErrHandler(err)
+			return
+		}
+		for _, msg := range msgs {
+			if ctx.Err() != nil {
+				return
+			}
+			handler(newTailedMsg(msg))
+			msg.Ack()
+		}
+	})
+	if err != nil {
+		consumer.Destroy()
+		return err
+	}
+	<-ctx.Done()
+	return consumer.Destroy()
+}
+
+func newTailedMsg(msg *Msg) TailedMsg {
+	tailed := TailedMsg{Headers: msg.GetHeaders(), Data: msg.Data()}
+	tailed.Sequence, _ = msg.GetSequenceNumber()
+	tailed.Payload, tailed.DecodeErr = msg.DataDeserialized()
+	if tailed.DecodeErr != nil {
+		tailed.Payload = nil
+	}
+	return tailed
+}
@@ -0,0 +1,19 @@
+package memphis
+
+import (
+	"testing"
+)
+
+func TestNewTailedMsg(t *testing.T) {
+	msg := newTestMsg(`{"id":1}`, map[string]string{"type": "order.created", "$memphis_producedBy": "p"})
+	tailed := newTailedMsg(msg)
+	if string(tailed.Data) != `{"id":1}` || tailed.DecodeErr != nil {
+		t.Errorf("unexpected tailed message %+v", tailed)
+	}
+	if payload, ok := tailed.Payload.([]byte); !ok || string(payload) != `{"id":1}` {
+		t.Errorf("expected the raw payload without a connection, got %v", tailed.Payload)
+	}
+	if len(tailed.Headers) != 1 || tailed.Headers["type"] != "order.created" {
+		t.Errorf("expected only the application headers, got %v", tailed.Headers)
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateFormat - the encoding of exported station templates.
+type TemplateFormat int
+
+const (
+	TemplateJSON TemplateFormat = iota
+	TemplateYAML
+)
+
+// StationTemplate - a reusable station configuration. Register it once on the connection and create
+// stations from it with CreateStationFromTemplate, or share it between services as JSON or YAML.
+type StationTemplate struct {
+	RetentionType            RetentionType
+	RetentionVal             int
+	StorageType              StorageType
+	Replicas                 int
+	IdempotencyWindow        time.Duration
+	PartitionsNumber         int
+	SchemaName               string
+	SendPoisonMsgToDls       bool
+	SendSchemaFailedMsgToDls bool
+	TieredStorageEnabled     bool
+	DlsStation               string
+}
+
+// DefaultStationTemplate - returns a template holding the default station options.
+func DefaultStationTemplate() StationTemplate {
+	opts := GetStationDefaultOptions()
+	return StationTemplate{
+		RetentionType:            opts.RetentionType,
+		RetentionVal:             opts.RetentionVal,
+		StorageType:              opts.StorageType,
+		Replicas:                 opts.Replicas,
+		IdempotencyWindow:        opts.IdempotencyWindow,
+		PartitionsNumber:         opts.PartitionsNumber,
+		SchemaName:               opts.SchemaName,
+		SendPoisonMsgToDls:       opts.SendPoisonMsgToDls,
+		SendSchemaFailedMsgToDls: opts.SendSchemaFailedMsgToDls,
+		TieredStorageEnabled:     opts.TieredStorageEnabled,
+		DlsStation:               opts.DlsStation,
+	}
+}
+
+// StationTemplate.Opts - the station options described by the template.
+func (t StationTemplate) Opts() []StationOpt {
+	return []StationOpt{
+		RetentionTypeOpt(t.RetentionType),
+		RetentionVal(t.RetentionVal),
+		StorageTypeOpt(t.StorageType),
+		Replicas(t.Replicas),
+		IdempotencyWindow(t.IdempotencyWindow),
+		PartitionsNumber(t.PartitionsNumber),
+		SchemaName(t.SchemaName),
+		SendPoisonMsgToDls(t.SendPoisonMsgToDls),
+		SendSchemaFailedMsgToDls(t.SendSchemaFailedMsgToDls),
+		TieredStorageEnabled(t.TieredStorageEnabled),
+		DlsStation(t.DlsStation),
+	}
+}
+
+func (t StationTemplate) validate() error {
+	if _, err := t.RetentionType.MarshalText(); err != nil {
+		return err
+	}
+	if _, err := t.StorageType.MarshalText(); err != nil {
+		return err
+	}
+	if t.Replicas < 1 {
+		return errors.New("replicas has to be positive")
+	}
+	if t.PartitionsNumber < 1 {
+		return errors.New("partitions number has to be positive")
+	}
+	opts := GetStationDefaultOptions()
+	for _, opt := range t.Opts() {
+		if err := opt(&opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterStationTemplate - registers the template under name, replacing a template registered with the same name.
+func (c *Conn) RegisterStationTemplate(name string, template StationTemplate) error {
+	if name == "" {
+		return memphisError(errors.New("template name can not be empty"))
+	}
+	if err := template.validate(); err != nil {
+		return memphisError(fmt.Errorf("template %s: %w", name, err))
+	}
+	c.templatesMu.Lock()
+	defer c.templatesMu.Unlock()
+	if c.templates == nil {
+		c.templates = make(map[string]StationTemplate)
+	}
+	c.templates[name] = template
+	return nil
+}
+
+// GetStationTemplate - returns the template registered under name.
+func (c *Conn) GetStationTemplate(name string) (StationTemplate, bool) {
+	c.templatesMu.RLock()
+	defer c.templatesMu.RUnlock()
+	template, ok := c.templates[name]
+	return template, ok
+}
+
+// CreateStationFromTemplate - creates a station configured by the template registered under templateName,
+// opts are applied after the template's options so they override it.
+func (c *Conn) CreateStationFromTemplate(name, templateName string, opts ...StationOpt) (*Station, error) {
+	template, ok := c.GetStationTemplate(templateName)
+	if !ok {
+		return nil, memphisError(fmt.Errorf("station template %s is not registered", templateName))
+	}
+	return c.CreateStation(name, append(template.Opts(), opts...)...)
+}
+
+// ExportStationTemplates - encodes all the registered templates, keyed by name.
+func (c *Conn) ExportStationTemplates(format TemplateFormat) ([]byte, error) {
+	c.templatesMu.RLock()
+	templates := make(map[string]StationTemplate, len(c.templates))
+	for name, template := range c.templates {
+		templates[name] = template
+	}
+	c.templatesMu.RUnlock()
+	return MarshalStationTemplates(templates, format)
+}
+
+// ImportStationTemplates - decodes templates keyed by name and registers them, nothing is registered when
+// one of them is invalid.
+func (c *Conn) ImportStationTemplates(data []byte, format TemplateFormat) error {
+	templates, err := UnmarshalStationTemplates(data, format)
+	if err != nil {
+		return err
+	}
+	for name, template := range templates {
+		if name == "" {
+			return memphisError(errors.New("template name can not be empty"))
+		}
+		if err := template.validate(); err != nil {
+			return memphisError(fmt.Errorf("template %s: %w", name, err))
+		}
+	}
+	for name, template := range templates {
+		c.RegisterStationTemplate(name, template)
+	}
+	return nil
+}
+
+// stationTemplateDoc - the encoded form of a template, durations are written like time.Duration.String.
+type stationTemplateDoc struct {
+	RetentionType            RetentionType `json:"retention_type" yaml:"retention_type"`
+	RetentionValue           int           `json:"retention_value" yaml:"retention_value"`
+	StorageType              StorageType   `json:"storage_type" yaml:"storage_type"`
+	Replicas                 int           `json:"replicas" yaml:"replicas"`
+	IdempotencyWindow        string        `json:"idempotency_window" yaml:"idempotency_window"`
+	PartitionsNumber         int           `json:"partitions_number" yaml:"partitions_number"`
+	SchemaName               string        `json:"schema_name,omitempty" yaml:"schema_name,omitempty"`
+	SendPoisonMsgToDls       bool          `json:"send_poison_msg_to_dls" yaml:"send_poison_msg_to_dls"`
+	SendSchemaFailedMsgToDls bool          `json:"send_schema_failed_msg_to_dls" yaml:"send_schema_failed_msg_to_dls"`
+	TieredStorageEnabled     bool          `json:"tiered_storage_enabled" yaml:"tiered_storage_enabled"`
+	DlsStation               string        `json:"dls_station,omitempty" yaml:"dls_station,omitempty"`
+}
+
+// stationTemplateDoc.UnmarshalYAML - fields missing from the document keep their default value.
+func (doc *stationTemplateDoc) UnmarshalYAML(node *yaml.Node) error {
+	type plain stationTemplateDoc
+	decoded := plain(newStationTemplateDoc(DefaultStationTemplate()))
+	if err := node.Decode(&decoded); err != nil {
+		return err
+	}
+	*doc = stationTemplateDoc(decoded)
+	return nil
+}
+
+func newStationTemplateDoc(t StationTemplate) stationTemplateDoc {
+	return stationTemplateDoc{
+		RetentionType:            t.RetentionType,
+		RetentionValue:           t.RetentionVal,
+		StorageType:              t.StorageType,
+		Replicas:                 t.Replicas,
+		IdempotencyWindow:        t.IdempotencyWindow.String(),
+		PartitionsNumber:         t.PartitionsNumber,
+		SchemaName:               t.SchemaName,
+		SendPoisonMsgToDls:       t.SendPoisonMsgToDls,
+		SendSchemaFailedMsgToDls: t.SendSchemaFailedMsgToDls,
+		TieredStorageEnabled:     t.TieredStorageEnabled,
+		DlsStation:               t.DlsStation,
+	}
+}
+
+func (doc stationTemplateDoc) template() (StationTemplate, error) {
+	t := StationTemplate{
+		RetentionType:            doc.RetentionType,
+		RetentionVal:             doc.RetentionValue,
+		StorageType:              doc.StorageType,
+		Replicas:                 doc.Replicas,
+		PartitionsNumber:         doc.PartitionsNumber,
+		SchemaName:               doc.SchemaName,
+		SendPoisonMsgToDls:       doc.SendPoisonMsgToDls,
+		SendSchemaFailedMsgToDls: doc.SendSchemaFailedMsgToDls,
+		TieredStorageEnabled:     doc.TieredStorageEnabled,
+		DlsStation:               doc.DlsStation,
+	}
+	var err error
+	if t.IdempotencyWindow, err = time.ParseDuration(doc.IdempotencyWindow); err != nil {
+		return t, fmt.Errorf("idempotency window: %w", err)
+	}
+	return t, nil
+}
+
+// MarshalStationTemplates - encodes templates keyed by name as JSON or YAML.
+func MarshalStationTemplates(templates map[string]StationTemplate, format TemplateFormat) ([]byte, error) {
+	docs := make(map[string]stationTemplateDoc, len(templates))
+	for name, template := range templates {
+		docs[name] = newStationTemplateDoc(template)
+	}
+	var data []byte
+	var err error
+	switch format {
+	case TemplateJSON:
+		data, err = json.MarshalIndent(docs, "", "  ")
+	case TemplateYAML:
+		data, err = yaml.Marshal(docs)
+	default:
+		err = fmt.Errorf("unknown template format %d", int(format))
+	}
+	return data, memphisError(err)
+}
+
+// UnmarshalStationTemplates - decodes templates keyed by name from JSON or YAML, fields missing from a
+// template keep their default value.
+func UnmarshalStationTemplates(data []byte, format TemplateFormat) (map[string]StationTemplate, error) {
+	var decoders map[string]func(*stationTemplateDoc) error
+	switch format {
+	case TemplateJSON:
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, memphisError(err)
+		}
+		decoders = make(map[string]func(*stationTemplateDoc) error, len(raw))
+		for name, msg := range raw {
+			msg := msg
+			decoders[name] = func(doc *stationTemplateDoc) error { return json.Unmarshal(msg, doc) }
+		}
+	case TemplateYAML:
+		var raw map[string]yaml.Node
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, memphisError(err)
+		}
+		decoders = make(map[string]func(*stationTemplateDoc) error, len(raw))
+		for name, node := range raw {
+			node := node
+			decoders[name] = func(doc *stationTemplateDoc) error { return node.Decode(doc) }
+		}
+	default:
+		return nil, memphisError(fmt.Errorf("unknown template format %d", int(format)))
+	}
+
+	templates := make(map[string]StationTemplate, len(decoders))
+	for name, decode := range decoders {
+		doc := newStationTemplateDoc(DefaultStationTemplate())
+		if err := decode(&doc); err != nil {
+			return nil, memphisError(fmt.Errorf("template %s: %w", name, err))
+		}
+		template, err := doc.template()
+		if err != nil {
+			return nil, memphisError(fmt.Errorf("template %s: %w", name, err))
+		}
+		templates[name] = template
+	}
+	return templates, nil
+}
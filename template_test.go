@@ -0,0 +1,128 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStationTemplateOpts(t *testing.T) {
+	template := DefaultStationTemplate()
+	template.RetentionType = Messages
+	template.RetentionVal = 1000
+	template.StorageType = Memory
+	template.PartitionsNumber = 3
+	template.IdempotencyWindow = 48 * time.Hour
+
+	opts := GetStationDefaultOptions()
+	for _, opt := range template.Opts() {
+		if err := opt(&opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if opts.RetentionType != Messages || opts.RetentionVal != 1000 || opts.StorageType != Memory ||
+		opts.PartitionsNumber != 3 || opts.IdempotencyWindow != 48*time.Hour || opts.Replicas != 1 {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+}
+
+func TestStationTemplatesRoundTrip(t *testing.T) {
+	orders := DefaultStationTemplate()
+	orders.RetentionType = AckBased
+	orders.StorageType = Memory
+	orders.Replicas = 3
+	orders.SchemaName = "order"
+	orders.IdempotencyWindow = 24 * time.Hour
+	templates := map[string]StationTemplate{"orders": orders, "default": DefaultStationTemplate()}
+
+	for _, format := range []TemplateFormat{TemplateJSON, TemplateYAML} {
+		data, err := MarshalStationTemplates(templates, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "ack_based") || !strings.Contains(string(data), "24h0m0s") {
+			t.Fatalf("format %d: unexpected encoding %s", format, data)
+		}
+		decoded, err := UnmarshalStationTemplates(data, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, templates) {
+			t.Fatalf("format %d: decoded %+v, want %+v", format, decoded, templates)
+		}
+	}
+}
+
+func TestUnmarshalStationTemplatesDefaults(t *testing.T) {
+	data := []byte(`
+events:
+  retention_type: messages
+  retention_value: 500
+  partitions_number: 4
+`)
+	templates, err := UnmarshalStationTemplates(data, TemplateYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultStationTemplate()
+	want.RetentionType = Messages
+	want.RetentionVal = 500
+	want.PartitionsNumber = 4
+	if !reflect.DeepEqual(templates["events"], want) {
+		t.Fatalf("decoded %+v, want %+v", templates["events"], want)
+	}
+
+	if _, err := UnmarshalStationTemplates([]byte(`{"bad": {"storage_type": "tape"}}`), TemplateJSON); err == nil {
+		t.Fatalf("an unknown storage type was accepted")
+	}
+}
+
+func TestStationTemplateRegistry(t *testing.T) {
+	c := &Conn{}
+	invalid := DefaultStationTemplate()
+	invalid.Replicas = 0
+	if err := c.RegisterStationTemplate("invalid", invalid); err == nil {
+		t.Fatalf("a template without replicas was registered")
+	}
+	if err := c.RegisterStationTemplate("default", DefaultStationTemplate()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateStationFromTemplate("orders", "missing"); err == nil {
+		t.Fatalf("created a station from a missing template")
+	}
+
+	data, err := c.ExportStationTemplates(TemplateYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &Conn{}
+	if err := other.ImportStationTemplates(data, TemplateYAML); err != nil {
+		t.Fatal(err)
+	}
+	if template, ok := other.GetStationTemplate("default"); !ok || template != DefaultStationTemplate() {
+		t.Fatalf("imported %+v, %v", template, ok)
+	}
+
+	// an invalid template fails the whole import
+	err = other.ImportStationTemplates([]byte(`{"a": {}, "b": {"replicas": 0}}`), TemplateJSON)
+	if err == nil {
+		t.Fatalf("an invalid template was imported")
+	}
+	if _, ok := other.GetStationTemplate("a"); ok {
+		t.Fatalf("a template was registered from a failed import")
+	}
+}
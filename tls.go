@@ -0,0 +1,211 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+func (opts TLSOpts) isSet() bool {
+	return opts.TlsCert != "" || opts.TlsKey != "" || opts.CaFile != ""
+}
+
+func (opts TLSOpts) validate() error {
+	if opts.TlsCert == "" {
+		return errors.New("must provide a TLS cert file")
+	}
+	if opts.TlsKey == "" {
+		return errors.New("must provide a TLS key file")
+	}
+	if opts.CaFile == "" {
+		return errors.New("must provide a TLS ca file")
+	}
+	return nil
+}
+
+// loadTLSFiles - loads the client certificate and the ca pool from the configured files.
+func loadTLSFiles(opts TLSOpts) (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(opts.TlsCert, opts.TlsKey)
+	if err != nil {
+		return tls.Certificate{}, nil, errors.New("memphis: error loading client certificate: " + err.Error())
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, nil, errors.New("memphis: error parsing client certificate: " + err.Error())
+	}
+	pemData, err := os.ReadFile(opts.CaFile)
+	if err != nil {
+		return tls.Certificate{}, nil, errors.New("memphis: error loading ca file: " + err.Error())
+	}
+	certs := x509.NewCertPool()
+	certs.AppendCertsFromPEM(pemData)
+	return cert, certs, nil
+}
+
+// newStaticTLSConfig - tls config built once from the configured files.
+func newStaticTLSConfig(opts TLSOpts) (*tls.Config, error) {
+	cert, certs, err := loadTLSFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	TLSConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	TLSConfig.Certificates = []tls.Certificate{cert}
+	TLSConfig.RootCAs = certs
+	return TLSConfig, nil
+}
+
+// certReloader - watches the cert, key and ca files and reloads them when they change.
+// The reloaded files are picked up on the next tls handshake, i.e. when the connection reconnects,
+// the consumers and producers are kept across reconnects.
+type certReloader struct {
+	opts     TLSOpts
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+	modTimes []time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newCertReloader(opts TLSOpts) (*certReloader, error) {
+	r := &certReloader{opts: opts}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	return []string{r.opts.TlsCert, r.opts.TlsKey, r.opts.CaFile}
+}
+
+func (r *certReloader) currentModTimes() ([]time.Time, error) {
+	modTimes := make([]time.Time, 0, 3)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func (r *certReloader) reload() error {
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		return err
+	}
+	cert, roots, err := loadTLSFiles(r.opts)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.roots = roots
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) changed() bool {
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		// files are usually replaced non atomically during rotation, retry on the next tick
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		GetClientCertificate: r.getClientCertificate,
+		// the server chain is verified in verifyConnection against the current ca pool,
+		// since RootCAs can't be swapped on a config in use
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyConnection,
+	}
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("memphis: broker presented no certificate")
+	}
+	r.mu.RLock()
+	roots := r.roots
+	r.mu.RUnlock()
+	verifyOpts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		verifyOpts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(verifyOpts)
+	return err
+}
+
+func (r *certReloader) start(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.reload(); err != nil {
+					log.Printf("tls files reload error: %v\n", memphisError(err))
+				}
+			}
+		}
+	}()
+}
+
+func (r *certReloader) stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
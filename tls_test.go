@@ -0,0 +1,131 @@
+package memphis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue - returns a pem encoded leaf certificate and key signed by the ca.
+func (ca testCA) issue(t *testing.T, serial int64, dnsName string) ([]byte, []byte, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), cert
+}
+
+func writeTestFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	opts := TLSOpts{TlsCert: filepath.Join(dir, "cert.pem"), TlsKey: filepath.Join(dir, "key.pem"), CaFile: filepath.Join(dir, "ca.pem")}
+	ca := newTestCA(t)
+	certPem, keyPem, _ := ca.issue(t, 2, "client")
+	start := time.Now().Add(-time.Minute)
+	writeTestFile(t, opts.CaFile, ca.pem, start)
+	writeTestFile(t, opts.TlsCert, certPem, start)
+	writeTestFile(t, opts.TlsKey, keyPem, start)
+
+	r, err := newCertReloader(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := r.getClientCertificate(nil)
+	if r.changed() {
+		t.Fatal("files reported as changed before rotation")
+	}
+
+	_, _, serverCert := ca.issue(t, 3, "broker.local")
+	if err := r.verifyConnection(tls.ConnectionState{ServerName: "broker.local", PeerCertificates: []*x509.Certificate{serverCert}}); err != nil {
+		t.Fatalf("server cert signed by the ca was rejected: %v", err)
+	}
+	if err := r.verifyConnection(tls.ConnectionState{ServerName: "other.local", PeerCertificates: []*x509.Certificate{serverCert}}); err == nil {
+		t.Fatal("server cert with a mismatching name was accepted")
+	}
+
+	// rotate to a new ca and client cert
+	rotatedCA := newTestCA(t)
+	certPem, keyPem, _ = rotatedCA.issue(t, 4, "client")
+	writeTestFile(t, opts.CaFile, rotatedCA.pem, time.Now())
+	writeTestFile(t, opts.TlsCert, certPem, time.Now())
+	writeTestFile(t, opts.TlsKey, keyPem, time.Now())
+
+	r.start(10 * time.Millisecond)
+	defer r.stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		current, _ := r.getClientCertificate(nil)
+		if current != first {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rotated files were not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := r.verifyConnection(tls.ConnectionState{ServerName: "broker.local", PeerCertificates: []*x509.Certificate{serverCert}}); err == nil {
+		t.Fatal("server cert signed by the old ca was accepted after rotation")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tokenFetchTimeout       = 10 * time.Second
+	tokenRefreshMinInterval = 1 * time.Second
+	tokenRefreshMaxBackoff  = 30 * time.Second
+)
+
+// TokenProvider - supplies short lived tokens used to authenticate the broker connection.
+type TokenProvider interface {
+	// Token - fetches a fresh token and returns it together with its expiry time.
+	Token(ctx context.Context) (string, time.Time, error)
+}
+
+// tokenCache - keeps a token from a TokenProvider fresh in the background, the broker connection
+// reads it on every (re)connect so a reconnect always authenticates with a valid token.
+type tokenCache struct {
+	provider  TokenProvider
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func newTokenCache(provider TokenProvider) *tokenCache {
+	return &tokenCache{provider: provider}
+}
+
+func (tc *tokenCache) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, tokenFetchTimeout)
+	defer cancel()
+	token, expiresAt, err := tc.provider.Token(ctx)
+	if err != nil {
+		return memphisError(fmt.Errorf("failed fetching auth token: %w", err))
+	}
+	if token == "" {
+		return memphisError(errors.New("token provider returned an empty token"))
+	}
+	tc.mu.Lock()
+	tc.token = token
+	tc.expiresAt = expiresAt
+	tc.mu.Unlock()
+	return nil
+}
+
+// get - returns the cached token, fetching a new one first if it already expired.
+func (tc *tokenCache) get() string {
+	tc.mu.Lock()
+	expired := !tc.expiresAt.IsZero() && time.Now().After(tc.expiresAt)
+	tc.mu.Unlock()
+	if expired {
+		if err := tc.refresh(context.Background()); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.token
+}
+
+// nextRefresh - refreshes once 80% of the token lifetime has passed.
+func (tc *tokenCache) nextRefresh() time.Duration {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.expiresAt.IsZero() {
+		return 0
+	}
+	wait := time.Until(tc.expiresAt) * 4 / 5
+	if wait < tokenRefreshMinInterval {
+		wait = tokenRefreshMinInterval
+	}
+	return wait
+}
+
+func (tc *tokenCache) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	tc.cancel = cancel
+	tc.done = make(chan struct{})
+	wait := tc.nextRefresh()
+	if wait == 0 {
+		// tokens without an expiry never need a refresh
+		close(tc.done)
+		return
+	}
+
+	go func() {
+		defer close(tc.done)
+		backoff := tokenRefreshMinInterval
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			if err := tc.refresh(ctx); err != nil {
+				log.Printf("%v\n", err)
+				timer.Reset(backoff)
+				if backoff *= 2; backoff > tokenRefreshMaxBackoff {
+					backoff = tokenRefreshMaxBackoff
+				}
+				continue
+			}
+			backoff = tokenRefreshMinInterval
+			wait := tc.nextRefresh()
+			if wait == 0 {
+				return
+			}
+			timer.Reset(wait)
+		}
+	}()
+}
+
+func (tc *tokenCache) stop() {
+	if tc.cancel == nil {
+		return
+	}
+	tc.cancel()
+	<-tc.done
+}
+
+// ClientCredentialsProvider - TokenProvider implementing the OAuth2 client credentials flow.
+type ClientCredentialsProvider struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	HTTPClient   *http.Client
+}
+
+type clientCredentialsResp struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Token - requests an access token from the token endpoint.
+func (p *ClientCredentialsProvider) Token(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(p.Scopes) > 0 {
+		form.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	requestTime := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer res.Body.Close()
+
+	var cr clientCredentialsResp
+	if err := json.NewDecoder(res.Body).Decode(&cr); err != nil {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned status %d: %w", res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK || cr.Error != "" {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned status %d: %s %s", res.StatusCode, cr.Error, cr.ErrorDescription)
+	}
+
+	var expiresAt time.Time
+	if cr.ExpiresIn > 0 {
+		expiresAt = requestTime.Add(time.Duration(cr.ExpiresIn) * time.Second)
+	}
+	return cr.AccessToken, expiresAt, nil
+}
@@ -0,0 +1,56 @@
+package memphis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientCredentialsProvider(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || id != "client" || secret != "secret" || r.FormValue("scope") != "a b" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":2}`, n)
+	}))
+	defer srv.Close()
+
+	provider := &ClientCredentialsProvider{TokenURL: srv.URL, ClientID: "client", ClientSecret: "secret", Scopes: []string{"a", "b"}}
+	token, expiresAt, err := provider.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-1" || time.Until(expiresAt) > 2*time.Second || time.Until(expiresAt) <= 0 {
+		t.Fatalf("token=%q expiresAt=%v", token, expiresAt)
+	}
+
+	badProvider := &ClientCredentialsProvider{TokenURL: srv.URL, ClientID: "client", ClientSecret: "wrong"}
+	if _, _, err := badProvider.Token(context.Background()); err == nil {
+		t.Fatal("expected an error for rejected credentials")
+	}
+
+	tc := newTokenCache(provider)
+	if err := tc.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first := tc.get()
+	tc.start()
+	defer tc.stop()
+	// the 2s token is refreshed after 80% of its lifetime
+	deadline := time.Now().Add(3 * time.Second)
+	for tc.get() == first {
+		if time.Now().After(deadline) {
+			t.Fatal("token was not refreshed before expiry")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	forwardedFromStreamHeader   = "memphis-forwarded-from-stream"
+	forwardedFromSequenceHeader = "memphis-forwarded-from-sequence"
+	forwardedAtHeader           = "memphis-forwarded-at"
+	traceFetchBatch             = 500
+)
+
+// DeliveryState - how far a message got within a consumer group.
+type DeliveryState string
+
+const (
+	// DeliveryPending - the message was not delivered to the consumer group yet.
+	DeliveryPending DeliveryState = "pending"
+	// DeliveryDelivered - the message was delivered and is not covered by the group's ack floor, it is either
+	// waiting for an ack or was acked out of order.
+	DeliveryDelivered DeliveryState = "delivered"
+	// DeliveryAcked - the message was acked, or terminated, by the consumer group.
+	DeliveryAcked DeliveryState = "acked"
+)
+
+// GroupDelivery - the state of a traced message within a consumer group.
+type GroupDelivery struct {
+	ConsumerGroup string
+	State         DeliveryState
+	// AckedBy - for acked messages, the last time the group's ack floor moved, the message was acked by then.
+	AckedBy *time.Time
+	// LastDelivery - the last time the group was delivered any message.
+	LastDelivery *time.Time
+}
+
+// TraceHop - a copy of the traced message forwarded to a dead-letter or quarantine station.
+type TraceHop struct {
+	Station     string
+	Partition   int
+	Sequence    uint64
+	ForwardedBy string
+	ForwardedAt time.Time
+	Err         string
+	Deliveries  int
+}
+
+// MessageTrace - the journey of a message through the broker, see Conn.TraceMessage.
+type MessageTrace struct {
+	Station      string
+	Partition    int
+	Sequence     uint64
+	PublishedAt  time.Time
+	Producer     string
+	ConnectionId string
+	Headers      map[string]string
+	Deliveries   []GroupDelivery
+	Hops         []TraceHop
+}
+
+// TraceOpts - configuration options for tracing a message.
+type TraceOpts struct {
+	Partition          int
+	DeadLetterStations []string
+	RequestOpts        []RequestOpt
+}
+
+// TraceOpt - a function on the options for tracing a message.
+type TraceOpt func(*TraceOpts) error
+
+// TracePartition - the partition holding the message, required for stations with more than one partition
+// since every partition numbers its messages on its own.
+func TracePartition(partition int) TraceOpt {
+	return func(opts *TraceOpts) error {
+		if partition < 1 {
+			return errors.New("partition number has to be positive")
+		}
+		opts.Partition = partition
+		return nil
+	}
+}
+
+// TraceDeadLetterStations - the stations searched for forwarded copies of the message, e.g. the dead-letter
+// station of a RetryPolicy. Defaults to the station's default quarantine station.
+func TraceDeadLetterStations(stationNames ...string) TraceOpt {
+	return func(opts *TraceOpts) error {
+		opts.DeadLetterStations = stationNames
+		return nil
+	}
+}
+
+// TraceRequestOpts - request options, e.g. RequestTimeout or RequestContext, for the broker queries of the trace.
+func TraceRequestOpts(requestOpts ...RequestOpt) TraceOpt {
+	return func(opts *TraceOpts) error {
+		opts.RequestOpts = requestOpts
+		return nil
+	}
+}
+
+// TraceMessage - returns the journey of the message stored with sequence in the station, for "where did my
+// event go?" investigations: when it was published and by which producer, its state in every consumer group
+// and the copies forwarded to dead-letter and quarantine stations. The broker keeps no per message ack or nak
+// history, so the delivery state is derived from the consumer groups' positions.
+func (c *Conn) TraceMessage(stationName string, sequence uint64, opts ...TraceOpt) (*MessageTrace, error) {
+	traceOpts := TraceOpts{DeadLetterStations: []string{stationName + quarantineStationSuffix}}
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&traceOpts); err != nil {
+				return nil, memphisError(err)
+			}
+		}
+	}
+	requestOpts, err := getRequestOptions(traceOpts.RequestOpts...)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+
+	partition, err := c.tracedPartition(stationName, traceOpts.Partition, traceOpts.RequestOpts...)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	ctx, cancel := c.jetstreamContext(requestOpts)
+	defer cancel()
+	stream, err := c.js.Stream(ctx, partition.StreamName)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	raw, err := stream.GetMsg(ctx, sequence)
+	if err != nil {
+		return nil, memphisError(err)
+	}
+	trace := &MessageTrace{
+		Station:      stationName,
+		Partition:    partition.Number,
+		Sequence:     sequence,
+		PublishedAt:  raw.Time,
+		Producer:     raw.Header.Get("$memphis_producedBy"),
+		ConnectionId: raw.Header.Get("$memphis_connectionId"),
+		Headers:      userHeaders(raw.Header),
+	}
+
+	consumers := stream.ListConsumers(ctx)
+	for info := range consumers.Info() {
+		trace.Deliveries = append(trace.Deliveries, groupDelivery(info, sequence))
+	}
+	if err := consumers.Err(); err != nil {
+		return nil, memphisError(err)
+	}
+	sort.Slice(trace.Deliveries, func(i, j int) bool { return trace.Deliveries[i].ConsumerGroup < trace.Deliveries[j].ConsumerGroup })
+
+	for _, dlsStation := range traceOpts.DeadLetterStations {
+		hops, err := c.traceHops(ctx, dlsStation, partition.StreamName, sequence, traceOpts.RequestOpts...)
+		if err != nil {
+			return nil, memphisError(err)
+		}
+		trace.Hops = append(trace.Hops, hops...)
+	}
+	return trace, nil
+}
+
+// tracedPartition - the partition a traced message is looked up in.
+func (c *Conn) tracedPartition(stationName string, number int, options ...RequestOpt) (StationPartition, error) {
+	partitions, err := c.GetStationPartitions(stationName, options...)
+	if err != nil {
+		return StationPartition{}, err
+	}
+	if number == 0 {
+		if len(partitions) > 1 {
+			return StationPartition{}, errors.New("the station has more than one partition, use TracePartition")
+		}
+		return partitions[0], nil
+	}
+	for _, p := range partitions {
+		if p.Number == number {
+			return p, nil
+		}
+	}
+	return StationPartition{}, fmt.Errorf("station has no partition %d", number)
+}
+
+// traceHops - scans the headers of a dead-letter station for copies of the message, a missing station has none.
+func (c *Conn) traceHops(ctx context.Context, stationName, originStream string, sequence uint64, options ...RequestOpt) ([]TraceHop, error) {
+	partitions, err := c.GetStationPartitions(stationName, options...)
+	if errors.Is(err, errStationNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hops []TraceHop
+	for _, p := range partitions {
+		stream, err := c.js.Stream(ctx, p.StreamName)
+		if err != nil {
+			return nil, err
+		}
+		lastSeq := stream.CachedInfo().State.LastSeq
+		if lastSeq == 0 {
+			continue
+		}
+		cons, err := stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{HeadersOnly: true})
+		if err != nil {
+			return nil, err
+		}
+		for done := false; !done; {
+			batch, err := cons.Fetch(traceFetchBatch, jetstream.FetchMaxWait(time.Second))
+			if err != nil {
+				return nil, err
+			}
+			received := 0
+			for msg := range batch.Messages() {
+				received++
+				md, err := msg.Metadata()
+				if err != nil {
+					return nil, err
+				}
+				if hop, ok := traceHopOf(msg.Headers(), originStream, sequence); ok {
+					hop.Station, hop.Partition, hop.Sequence = stationName, p.Number, md.Sequence.Stream
+					hops = append(hops, hop)
+				}
+				done = done || md.Sequence.Stream >= lastSeq
+			}
+			if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+				return nil, err
+			}
+			done = done || received == 0
+		}
+	}
+	return hops, nil
+}
+
+// traceHopOf - the hop described by the headers of a forwarded message, if it is a copy of the given message.
+func traceHopOf(headers nats.Header, originStream string, sequence uint64) (TraceHop, bool) {
+	if headers.Get(forwardedFromStreamHeader) != originStream ||
+		headers.Get(forwardedFromSequenceHeader) != strconv.FormatUint(sequence, 10) {
+		return TraceHop{}, false
+	}
+	hop := TraceHop{ForwardedBy: headers.Get("$memphis_producedBy")}
+	hop.ForwardedAt, _ = time.Parse(time.RFC3339Nano, headers.Get(forwardedAtHeader))
+	hop.Err = headers.Get(quarantineErrorHeader)
+	hop.Deliveries, _ = strconv.Atoi(headers.Get(quarantineDeliveriesHeader))
+	if hop.Err == "" {
+		hop.Err = headers.Get(retryErrorHeader)
+		hop.Deliveries, _ = strconv.Atoi(headers.Get(retryAttemptHeader))
+	}
+	return hop, true
+}
+
+// groupDelivery - the state of the message at sequence within the consumer group of a JetStream consumer.
+func groupDelivery(info *jetstream.ConsumerInfo, sequence uint64) GroupDelivery {
+	delivery := GroupDelivery{
+		ConsumerGroup: strings.ReplaceAll(info.Name, delimReplacement, delimToReplace),
+		State:         DeliveryPending,
+		LastDelivery:  info.Delivered.Last,
+	}
+	switch {
+	case sequence <= info.AckFloor.Stream:
+		delivery.State = DeliveryAcked
+		delivery.AckedBy = info.AckFloor.Last
+	case sequence <= info.Delivered.Stream:
+		delivery.State = DeliveryDelivered
+	}
+	return delivery
+}
+
+func userHeaders(headers nats.Header) map[string]string {
+	hdrs := make(map[string]string, len(headers))
+	for key, values := range headers {
+		if strings.HasPrefix(key, "$memphis") || len(values) == 0 {
+			continue
+		}
+		hdrs[key] = values[0]
+	}
+	return hdrs
+}
+
+// forwardedHeaders - the headers recording where a forwarded message comes from, so TraceMessage can find it.
+func (m *Msg) forwardedHeaders() map[string]string {
+	hdrs := map[string]string{forwardedAtHeader: time.Now().UTC().Format(time.RFC3339Nano)}
+	if msg, ok := m.msg.(*nats.Msg); ok {
+		if md, err := msg.Metadata(); err == nil {
+			hdrs[forwardedFromStreamHeader] = md.Stream
+			hdrs[forwardedFromSequenceHeader] = strconv.FormatUint(md.Sequence.Stream, 10)
+		}
+	} else if jsMsg, ok := m.msg.(jetstream.Msg); ok {
+		if md, err := jsMsg.Metadata(); err == nil {
+			hdrs[forwardedFromStreamHeader] = md.Stream
+			hdrs[forwardedFromSequenceHeader] = strconv.FormatUint(md.Sequence.Stream, 10)
+		}
+	}
+	return hdrs
+}
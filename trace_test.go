@@ -0,0 +1,105 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestGroupDelivery(t *testing.T) {
+	ackedAt := time.Now()
+	info := &jetstream.ConsumerInfo{
+		Name:      "billing#workers",
+		Delivered: jetstream.SequenceInfo{Stream: 20},
+		AckFloor:  jetstream.SequenceInfo{Stream: 10, Last: &ackedAt},
+	}
+	tests := []struct {
+		sequence uint64
+		state    DeliveryState
+	}{
+		{10, DeliveryAcked},
+		{11, DeliveryDelivered},
+		{20, DeliveryDelivered},
+		{21, DeliveryPending},
+	}
+	for _, tt := range tests {
+		d := groupDelivery(info, tt.sequence)
+		if d.State != tt.state {
+			t.Errorf("sequence %d: state = %v, want %v", tt.sequence, d.State, tt.state)
+		}
+		if (d.AckedBy != nil) != (tt.state == DeliveryAcked) {
+			t.Errorf("sequence %d: AckedBy = %v", tt.sequence, d.AckedBy)
+		}
+		if d.ConsumerGroup != "billing.workers" {
+			t.Errorf("consumer group = %q", d.ConsumerGroup)
+		}
+	}
+}
+
+func TestTraceHopOf(t *testing.T) {
+	natsMsg := nats.NewMsg("orders$1.final")
+	natsMsg.Reply = "$JS.ACK.orders$1.workers.3.42.40.1700000000000000000.0"
+	natsMsg.Sub = &nats.Subscription{}
+	m := &Msg{msg: natsMsg}
+	hdrs := m.forwardedHeaders()
+	if hdrs[forwardedFromStreamHeader] != "orders$1" || hdrs[forwardedFromSequenceHeader] != "42" || hdrs[forwardedAtHeader] == "" {
+		t.Fatalf("unexpected forwarded headers %v", hdrs)
+	}
+
+	headers := nats.Header{}
+	headers.Set(forwardedFromStreamHeader, "orders$1")
+	headers.Set(forwardedFromSequenceHeader, "42")
+	headers.Set(forwardedAtHeader, hdrs[forwardedAtHeader])
+	headers.Set(quarantineErrorHeader, "bad payload")
+	headers.Set(quarantineDeliveriesHeader, "3")
+	headers.Set("$memphis_producedBy", "workers-quarantine")
+
+	hop, ok := traceHopOf(headers, "orders$1", 42)
+	if !ok {
+		t.Fatal("the forwarded copy was not recognized")
+	}
+	if hop.Err != "bad payload" || hop.Deliveries != 3 || hop.ForwardedBy != "workers-quarantine" || hop.ForwardedAt.IsZero() {
+		t.Errorf("unexpected hop %+v", hop)
+	}
+	if _, ok := traceHopOf(headers, "orders$1", 43); ok {
+		t.Error("a copy of another message was matched")
+	}
+	if _, ok := traceHopOf(headers, "orders$2", 42); ok {
+		t.Error("a copy from another partition was matched")
+	}
+
+	headers.Del(quarantineErrorHeader)
+	headers.Set(retryErrorHeader, "timeout")
+	headers.Set(retryAttemptHeader, "5")
+	if hop, _ := traceHopOf(headers, "orders$1", 42); hop.Err != "timeout" || hop.Deliveries != 5 {
+		t.Errorf("unexpected dead-letter hop %+v", hop)
+	}
+}
+
+func TestTracedPartition(t *testing.T) {
+	c := &Conn{stationPartitions: map[string]*PartitionsUpdate{"orders": {PartitionsList: []int{1, 2}}}}
+	if _, err := c.tracedPartition("orders", 0); err == nil {
+		t.Error("a partitioned station requires the partition")
+	}
+	if p, err := c.tracedPartition("orders", 2); err != nil || p.StreamName != "orders$2" {
+		t.Errorf("partition = %+v, err = %v", p, err)
+	}
+	if _, err := c.tracedPartition("orders", 3); err == nil {
+		t.Error("a missing partition should fail")
+	}
+}
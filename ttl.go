@@ -0,0 +1,81 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const expiresAtHeader = "$memphis_expiresAt"
+
+// MsgTTL - the message expires ttl after it is produced, regardless of the station's retention. Consumers ack
+// and skip expired messages instead of delivering them, so they are never handed to the application and
+// are removed along with the acked messages. Meant for ephemeral notifications sharing a station with durable data.
+func MsgTTL(ttl time.Duration) ProduceOpt {
+	return func(opts *ProduceOpts) error {
+		if ttl <= 0 {
+			return errors.New("message ttl has to be positive")
+		}
+		opts.TTL = ttl
+		return nil
+	}
+}
+
+// stampExpiry - adds the expiration time header of a message produced with MsgTTL.
+func (opts *ProduceOpts) stampExpiry(now time.Time) {
+	if opts.TTL <= 0 {
+		return
+	}
+	opts.MsgHeaders.MsgHeaders[expiresAtHeader] = []string{strconv.FormatInt(now.Add(opts.TTL).UnixNano(), 10)}
+}
+
+// Msg.ExpiresAt - the time the message expires at, false if it was produced without MsgTTL.
+func (m *Msg) ExpiresAt() (time.Time, bool) {
+	var headers nats.Header
+	if msg, ok := m.msg.(*nats.Msg); ok {
+		headers = msg.Header
+	} else if jsMsg, ok := m.msg.(jetstream.Msg); ok {
+		headers = jsMsg.Headers()
+	}
+	values := headers[expiresAtHeader]
+	if len(values) == 0 {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// expired - whether the message expired before it was received, DLS messages never expire so they can be inspected.
+func (m *Msg) expired() bool {
+	if m.dls || m.msg == nil {
+		return false
+	}
+	expiresAt, ok := m.ExpiresAt()
+	if !ok {
+		return false
+	}
+	receivedAt := m.receivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	return !receivedAt.Before(expiresAt)
+}
@@ -0,0 +1,46 @@
+package memphis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMsgTTL(t *testing.T) {
+	opts := getDefaultProduceOpts()
+	if err := MsgTTL(0)(&opts); err == nil {
+		t.Error("expected a non positive ttl to be rejected")
+	}
+	if err := MsgTTL(time.Minute)(&opts); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	opts.stampExpiry(now)
+	stamp := opts.MsgHeaders.MsgHeaders[expiresAtHeader]
+	if len(stamp) != 1 || stamp[0] != strconv.FormatInt(now.Add(time.Minute).UnixNano(), 10) {
+		t.Fatalf("unexpected expiry header %v", stamp)
+	}
+
+	live := newTestMsg("live", map[string]string{expiresAtHeader: stamp[0]})
+	live.receivedAt = now.Add(30 * time.Second)
+	expired := newTestMsg("expired", map[string]string{expiresAtHeader: stamp[0]})
+	expired.receivedAt = now.Add(2 * time.Minute)
+	durable := newTestMsg("durable", nil)
+	durable.receivedAt = now.Add(time.Hour)
+	dls := newTestMsg("dls", map[string]string{expiresAtHeader: stamp[0]})
+	dls.receivedAt = now.Add(2 * time.Minute)
+	dls.dls = true
+
+	if expiresAt, ok := live.ExpiresAt(); !ok || !expiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected expiration %v %v", expiresAt, ok)
+	}
+	if _, ok := durable.ExpiresAt(); ok {
+		t.Error("a message produced without ttl should not expire")
+	}
+
+	c := &Consumer{}
+	filtered := c.filterMsgs([]*Msg{live, expired, durable, dls}, nil)
+	if len(filtered) != 3 || filtered[0] != live || filtered[1] != durable || filtered[2] != dls {
+		t.Errorf("expected only the expired message to be skipped, got %v messages", len(filtered))
+	}
+}
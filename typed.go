@@ -0,0 +1,194 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec - encodes and decodes the payload of typed messages.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec - Codec encoding values as json.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// ProtoCodec - Codec encoding protobuf messages, New returns an empty message to decode into.
+type ProtoCodec[T proto.Message] struct {
+	New func() T
+}
+
+func (ProtoCodec[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (c ProtoCodec[T]) Decode(data []byte) (T, error) {
+	v := c.New()
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
+
+// TypedHandler - handles a single decoded message, the message is acked when it returns nil.
+// When it returns an error the message is handed to Msg.Fail, quarantining or retrying it according
+// to the consumer's options.
+type TypedHandler[T any] func(ctx context.Context, msg T) error
+
+// TypedMsgError - reported to the consumer's error handler when a message can't be decoded,
+// fails the station's schema or its handler returns an error.
+type TypedMsgError struct {
+	Msg *Msg
+	Err error
+}
+
+func (e *TypedMsgError) Error() string {
+	return "typed message: " + e.Err.Error()
+}
+
+func (e *TypedMsgError) Unwrap() error {
+	return e.Err
+}
+
+// TypedConsumer - consumes messages of type T, decoding, validating and acking them.
+type TypedConsumer[T any] struct {
+	consumer *Consumer
+	codec    Codec[T]
+}
+
+// NewTypedConsumer - wraps a consumer to hand decoded values of type T to the handler.
+func NewTypedConsumer[T any](c *Consumer, codec Codec[T]) *TypedConsumer[T] {
+	return &TypedConsumer[T]{consumer: c, codec: codec}
+}
+
+// TypedConsumer.Consume - like Consumer.Consume, calling handler for every message of the batch in order.
+// With DecodeConcurrency the messages of a batch are validated and decoded concurrently before they are handled.
+func (tc *TypedConsumer[T]) Consume(handler TypedHandler[T], opts ...ConsumingOpt) error {
+	consumingOpts := getDefaultConsumingOptions()
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt(&consumingOpts); err != nil {
+				return memphisError(err)
+			}
+		}
+	}
+	return tc.consumer.Consume(func(msgs []*Msg, err error, ctx context.Context) {
+		if err != nil {
+			tc.consumer.callErrHandler(err)
+		}
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		tc.handle(ctx, msgs, handler, consumingOpts.DecodeConcurrency)
+	}, append(opts, noDecodeConcurrency())...)
+}
+
+// TypedConsumer.Handle - decodes and handles already fetched messages, e.g. the result of Consumer.Fetch.
+// Messages which can't be decoded or fail the station's schema are left unacked so they end up in the
+// dead-letter station after MaxMsgDeliveries, all errors are reported to the consumer's error handler.
+func (tc *TypedConsumer[T]) Handle(ctx context.Context, msgs []*Msg, handler TypedHandler[T]) {
+	tc.handle(ctx, msgs, handler, 1)
+}
+
+// TypedConsumer.handle - decodes the messages on up to workers goroutines, then handles them in order.
+func (tc *TypedConsumer[T]) handle(ctx context.Context, msgs []*Msg, handler TypedHandler[T], workers int) {
+	values := make([]T, len(msgs))
+	errs := make([]error, len(msgs))
+	decodeConcurrently(len(msgs), workers, func(i int) {
+		values[i], errs[i] = tc.decode(msgs[i])
+	})
+	for i, msg := range msgs {
+		err := errs[i]
+		if err == nil {
+			err = tc.handleValue(ctx, msg, values[i], handler)
+		}
+		if err != nil {
+			tc.consumer.callErrHandler(&TypedMsgError{Msg: msg, Err: err})
+		}
+	}
+}
+
+// TypedConsumer.decode - the value of the message, validated against the station's schema.
+func (tc *TypedConsumer[T]) decode(msg *Msg) (T, error) {
+	if err := msg.validateSchema(); err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := tc.codec.Decode(msg.DataNoCopy())
+	if err != nil {
+		return v, fmt.Errorf("decode: %w", err)
+	}
+	return v, nil
+}
+
+func (tc *TypedConsumer[T]) handleValue(ctx context.Context, msg *Msg, v T, handler TypedHandler[T]) error {
+	if err := handler(ctx, v); err != nil {
+		if failErr := msg.Fail(err); failErr != nil {
+			return fmt.Errorf("%w (failure handling: %v)", err, failErr)
+		}
+		return err
+	}
+	return msg.Ack()
+}
+
+// TypedProducer - produces messages of type T.
+type TypedProducer[T any] struct {
+	producer *Producer
+	codec    Codec[T]
+}
+
+// NewTypedProducer - wraps a producer to encode values of type T, the encoded payload is validated
+// against the station's schema like any other produced message.
+func NewTypedProducer[T any](p *Producer, codec Codec[T]) *TypedProducer[T] {
+	return &TypedProducer[T]{producer: p, codec: codec}
+}
+
+// TypedProducer.Produce - encodes v and produces it.
+func (tp *TypedProducer[T]) Produce(v T, opts ...ProduceOpt) error {
+	data, err := tp.codec.Encode(v)
+	if err != nil {
+		return memphisError(fmt.Errorf("encode: %w", err))
+	}
+	return tp.producer.Produce(data, opts...)
+}
+
+// validateSchema - validates the message against the schema enforced on its station, if any.
+func (m *Msg) validateSchema() error {
+	if m.conn == nil || m.raw {
+		return nil
+	}
+	sd, err := m.schemaDetails()
+	if err != nil || sd.schemaType == "" {
+		return nil
+	}
+	if _, err := sd.validateMsg(m.DataNoCopy()); err != nil {
+		return memphisError(errors.New("schema validation has failed: " + err.Error()))
+	}
+	return nil
+}
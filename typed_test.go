@@ -0,0 +1,83 @@
+package memphis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type ackRecordingMsg struct {
+	jetstream.Msg
+	data  []byte
+	acked bool
+}
+
+func (m *ackRecordingMsg) Data() []byte         { return m.data }
+func (m *ackRecordingMsg) Headers() nats.Header { return nats.Header{} }
+func (m *ackRecordingMsg) Ack() error {
+	m.acked = true
+	return nil
+}
+
+type order struct {
+	ID    int    `json:"id"`
+	State string `json:"state"`
+}
+
+func TestTypedConsumerHandle(t *testing.T) {
+	var errs []error
+	c := &Consumer{errHandler: func(_ *Consumer, err error) { errs = append(errs, err) }}
+	tc := NewTypedConsumer[order](c, JSONCodec[order]{})
+
+	raw := []*ackRecordingMsg{
+		{data: []byte(`{"id":1,"state":"created"}`)},
+		{data: []byte(`not json`)},
+		{data: []byte(`{"id":2,"state":"failed"}`)},
+	}
+	msgs := make([]*Msg, len(raw))
+	for i, m := range raw {
+		msgs[i] = &Msg{msg: m}
+	}
+
+	handlerErr := errors.New("handler failed")
+	var handled []order
+	tc.Handle(context.Background(), msgs, func(_ context.Context, o order) error {
+		handled = append(handled, o)
+		if o.State == "failed" {
+			return handlerErr
+		}
+		return nil
+	})
+
+	if len(handled) != 2 || handled[0].ID != 1 || handled[1].ID != 2 {
+		t.Fatalf("unexpected handled orders %+v", handled)
+	}
+	if !raw[0].acked || raw[1].acked || raw[2].acked {
+		t.Fatalf("only successfully handled messages should be acked: %v %v %v", raw[0].acked, raw[1].acked, raw[2].acked)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 reported errors, got %v", errs)
+	}
+	var typedErr *TypedMsgError
+	if !errors.As(errs[0], &typedErr) || typedErr.Msg != msgs[1] {
+		t.Errorf("decode error should reference the undecodable message, got %v", errs[0])
+	}
+	if !errors.Is(errs[1], handlerErr) {
+		t.Errorf("expected the handler error to be reported, got %v", errs[1])
+	}
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	codec := JSONCodec[order]{}
+	data, err := codec.Encode(order{ID: 7, State: "shipped"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := codec.Decode(data)
+	if err != nil || o.ID != 7 || o.State != "shipped" {
+		t.Fatalf("round trip returned %+v, %v", o, err)
+	}
+}
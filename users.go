@@ -0,0 +1,357 @@
+// Copyright 2021-2022 The Memphis Authors
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.package server
+
+package memphis
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultManagementPort        = 9000
+	managementLoginPath          = "/api/usermgmt/login"
+	managementAddUserPath        = "/api/usermgmt/addUser"
+	managementRemoveUserPath     = "/api/usermgmt/removeUser"
+	managementChangePasswordPath = "/api/usermgmt/changePassword"
+	managementPermissionsPath    = "/api/usermgmt/setStationPermissions"
+	generatedPasswordLength      = 24
+)
+
+// ErrNotSupportedByBroker - the broker's management API doesn't offer the operation.
+var ErrNotSupportedByBroker = errors.New("not supported by the broker")
+
+// ManagementOpts - the broker's HTTP management API and the management user calling it.
+type ManagementOpts struct {
+	URL        string // defaults to http://<host>:9000
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+// ManagementOpt - a function on the options for the management API.
+type ManagementOpt func(*ManagementOpts) error
+
+// ManagementAPI - credentials of a management type user, required by the user management methods of the connection.
+func ManagementAPI(username, password string, opts ...ManagementOpt) Option {
+	return func(o *Options) error {
+		if username == "" || password == "" {
+			return errors.New("management username and password are required")
+		}
+		management := ManagementOpts{Username: username, Password: password}
+		for _, opt := range opts {
+			if opt != nil {
+				if err := opt(&management); err != nil {
+					return err
+				}
+			}
+		}
+		o.Management = management
+		return nil
+	}
+}
+
+// ManagementURL - the base url of the management API when it isn't served on the broker's host at port 9000.
+func ManagementURL(managementURL string) ManagementOpt {
+	return func(opts *ManagementOpts) error {
+		u, err := url.Parse(managementURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid management API url %q", managementURL)
+		}
+		opts.URL = strings.TrimSuffix(managementURL, "/")
+		return nil
+	}
+}
+
+// ManagementHTTPClient - the HTTP client calling the management API, defaults to a client with a 30 seconds timeout.
+func ManagementHTTPClient(client *http.Client) ManagementOpt {
+	return func(opts *ManagementOpts) error {
+		opts.HTTPClient = client
+		return nil
+	}
+}
+
+// UserType - the type of a broker user.
+type UserType string
+
+const (
+	ApplicationUser UserType = "application"
+	ManagementUser  UserType = "management"
+)
+
+// User - a broker user to create, a password is generated when Password is empty.
+type User struct {
+	Username    string
+	Password    string
+	Type        UserType // defaults to ApplicationUser
+	Description string
+}
+
+// StationPermissions - what a user may do on a station.
+type StationPermissions struct {
+	Read  bool
+	Write bool
+}
+
+// managementClient - calls the management API with a token of the management user, safe for concurrent use.
+type managementClient struct {
+	opts ManagementOpts
+	mu   sync.Mutex
+	jwt  string
+}
+
+type managementLoginReq struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type managementLoginResp struct {
+	Jwt string `json:"jwt"`
+}
+
+type managementAddUserReq struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	UserType    string `json:"user_type"`
+	Description string `json:"description,omitempty"`
+}
+
+type managementRemoveUserReq struct {
+	Username string `json:"username"`
+}
+
+type managementChangePasswordReq struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type managementPermissionsReq struct {
+	Username    string `json:"username"`
+	StationName string `json:"station_name"`
+	Read        bool   `json:"read"`
+	Write       bool   `json:"write"`
+}
+
+// Conn.management - the management API client of the connection.
+func (c *Conn) management() (*managementClient, error) {
+	c.managementMu.Lock()
+	defer c.managementMu.Unlock()
+	if c.managementClient != nil {
+		return c.managementClient, nil
+	}
+	opts := c.opts.Management
+	if opts.Username == "" {
+		return nil, errors.New("management credentials are not configured, connect with the ManagementAPI option")
+	}
+	if opts.URL == "" {
+		host := c.opts.Host
+		for _, prefix := range []string{"ws://", "wss://"} {
+			host = strings.TrimPrefix(host, prefix)
+		}
+		opts.URL = fmt.Sprintf("http://%s:%d", host, defaultManagementPort)
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: restGatewayTimeout}
+	}
+	c.managementClient = &managementClient{opts: opts}
+	return c.managementClient, nil
+}
+
+// managementCall - calls the management API within the request options' context and timeout.
+func (c *Conn) managementCall(method, path string, body any, out any, options []RequestOpt) error {
+	requestOpts, err := getRequestOptions(options...)
+	if err != nil {
+		return memphisError(err)
+	}
+	client, err := c.management()
+	if err != nil {
+		return memphisError(err)
+	}
+	ctx, cancel := context.WithTimeout(requestOpts.Context, c.operationTimeout(requestOpts, restGatewayTimeout))
+	defer cancel()
+	return memphisError(client.call(ctx, method, path, body, out))
+}
+
+// call - sends the request, logging in again once when the token was rejected.
+func (m *managementClient) call(ctx context.Context, method, path string, body any, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		jwt, err := m.token(ctx, attempt > 0)
+		if err != nil {
+			return err
+		}
+		status, resp, err := m.do(ctx, method, path, jwt, data)
+		if err != nil {
+			return err
+		}
+		switch {
+		case status == http.StatusUnauthorized && attempt == 0:
+			continue
+		case status == http.StatusNotFound || status == http.StatusMethodNotAllowed:
+			return fmt.Errorf("%s %s: %w", method, path, ErrNotSupportedByBroker)
+		case status != http.StatusOK:
+			return fmt.Errorf("management API returned status %d: %s", status, strings.TrimSpace(string(resp)))
+		}
+		if out == nil || len(resp) == 0 {
+			return nil
+		}
+		return json.Unmarshal(resp, out)
+	}
+	return errors.New("management API rejected the token")
+}
+
+func (m *managementClient) token(ctx context.Context, forceLogin bool) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jwt != "" && !forceLogin {
+		return m.jwt, nil
+	}
+	data, err := json.Marshal(managementLoginReq{Username: m.opts.Username, Password: m.opts.Password})
+	if err != nil {
+		return "", err
+	}
+	status, resp, err := m.do(ctx, http.MethodPost, managementLoginPath, "", data)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("management API login failed with status %d: %s", status, strings.TrimSpace(string(resp)))
+	}
+	var login managementLoginResp
+	if err := json.Unmarshal(resp, &login); err != nil {
+		return "", err
+	}
+	if login.Jwt == "" {
+		return "", errors.New("management API login failed: no token returned")
+	}
+	m.jwt = login.Jwt
+	return m.jwt, nil
+}
+
+func (m *managementClient) do(ctx context.Context, method, path, jwt string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, m.opts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
+	}
+	res, err := m.opts.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	resp, err := io.ReadAll(res.Body)
+	return res.StatusCode, resp, err
+}
+
+// CreateUser - creates a broker user and returns its password, the generated one when user.Password is empty.
+func (c *Conn) CreateUser(user User, options ...RequestOpt) (string, error) {
+	if err := validateName(user.Username, "User"); err != nil {
+		return "", memphisError(err)
+	}
+	if user.Type == "" {
+		user.Type = ApplicationUser
+	}
+	if user.Type != ApplicationUser && user.Type != ManagementUser {
+		return "", memphisError(fmt.Errorf("unknown user type %q", user.Type))
+	}
+	if user.Password == "" {
+		password, err := generatePassword()
+		if err != nil {
+			return "", memphisError(err)
+		}
+		user.Password = password
+	}
+	err := c.managementCall(http.MethodPost, managementAddUserPath, managementAddUserReq{
+		Username:    user.Username,
+		Password:    user.Password,
+		UserType:    string(user.Type),
+		Description: user.Description,
+	}, nil, options)
+	if err != nil {
+		return "", err
+	}
+	return user.Password, nil
+}
+
+// DeleteUser - removes a broker user, its connections are closed by the broker.
+func (c *Conn) DeleteUser(username string, options ...RequestOpt) error {
+	return c.managementCall(http.MethodDelete, managementRemoveUserPath, managementRemoveUserReq{Username: username}, nil, options)
+}
+
+// RotateUserPassword - replaces the user's password with a generated one and returns it. Connection tokens are
+// configured on the broker and can't be rotated through the API.
+func (c *Conn) RotateUserPassword(username string, options ...RequestOpt) (string, error) {
+	password, err := generatePassword()
+	if err != nil {
+		return "", memphisError(err)
+	}
+	err = c.managementCall(http.MethodPut, managementChangePasswordPath, managementChangePasswordReq{Username: username, Password: password}, nil, options)
+	if err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// SetStationPermissions - sets what the user may do on the station. Brokers without station level permissions,
+// like the open source broker, report ErrNotSupportedByBroker.
+func (c *Conn) SetStationPermissions(username, stationName string, permissions StationPermissions, options ...RequestOpt) error {
+	return c.managementCall(http.MethodPut, managementPermissionsPath, managementPermissionsReq{
+		Username:    username,
+		StationName: stationName,
+		Read:        permissions.Read,
+		Write:       permissions.Write,
+	}, nil, options)
+}
+
+// generatePassword - a random password holding lower and upper case letters, digits and symbols.
+func generatePassword() (string, error) {
+	classes := []string{"abcdefghijkmnopqrstuvwxyz", "ABCDEFGHJKLMNPQRSTUVWXYZ", "23456789", "!#%+-=@_"}
+	password := make([]byte, generatedPasswordLength)
+	for i := range password {
+		// the first characters cover every class, the rest are drawn from all of them
+		class := strings.Join(classes, "")
+		if i < len(classes) {
+			class = classes[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(class))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = class[n.Int64()]
+	}
+	// shuffle so the classes aren't at fixed positions
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
@@ -0,0 +1,129 @@
+package memphis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeManagementAPI struct {
+	mu        sync.Mutex
+	logins    int
+	valid     string
+	users     map[string]managementAddUserReq
+	passwords map[string]string
+}
+
+func (f *fakeManagementAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == managementLoginPath {
+		var req managementLoginReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username != "admin" || req.Password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.logins++
+		f.valid = fmt.Sprintf("jwt-%d", f.logins)
+		json.NewEncoder(w).Encode(managementLoginResp{Jwt: f.valid})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+f.valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.URL.Path == managementAddUserPath && r.Method == http.MethodPost:
+		var req managementAddUserReq
+		json.NewDecoder(r.Body).Decode(&req)
+		if _, ok := f.users[req.Username]; ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("user already exists"))
+			return
+		}
+		f.users[req.Username] = req
+		f.passwords[req.Username] = req.Password
+	case r.URL.Path == managementRemoveUserPath && r.Method == http.MethodDelete:
+		var req managementRemoveUserReq
+		json.NewDecoder(r.Body).Decode(&req)
+		delete(f.users, req.Username)
+	case r.URL.Path == managementChangePasswordPath && r.Method == http.MethodPut:
+		var req managementChangePasswordReq
+		json.NewDecoder(r.Body).Decode(&req)
+		f.passwords[req.Username] = req.Password
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestUserManagement(t *testing.T) {
+	api := &fakeManagementAPI{users: map[string]managementAddUserReq{}, passwords: map[string]string{}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var opts Options
+	if err := ManagementAPI("admin", "secret", ManagementURL(server.URL))(&opts); err != nil {
+		t.Fatal(err)
+	}
+	c := &Conn{opts: opts}
+
+	password, err := c.CreateUser(User{Username: "orders-svc", Description: "orders service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := api.users["orders-svc"]
+	if created.UserType != "application" || created.Password != password || len(password) != generatedPasswordLength {
+		t.Fatalf("created %+v with password %q", created, password)
+	}
+	if _, err := c.CreateUser(User{Username: "orders-svc"}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("err = %v", err)
+	}
+
+	// an expired token is replaced by logging in again
+	api.mu.Lock()
+	api.valid = "expired"
+	api.mu.Unlock()
+	rotated, err := c.RotateUserPassword("orders-svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == password || api.passwords["orders-svc"] != rotated || api.logins != 2 {
+		t.Fatalf("rotated to %q, stored %q after %d logins", rotated, api.passwords["orders-svc"], api.logins)
+	}
+
+	err = c.SetStationPermissions("orders-svc", "orders", StationPermissions{Read: true})
+	if !errors.Is(err, ErrNotSupportedByBroker) {
+		t.Fatalf("err = %v, want ErrNotSupportedByBroker", err)
+	}
+
+	if err := c.DeleteUser("orders-svc"); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.users) != 0 {
+		t.Fatalf("users left: %v", api.users)
+	}
+
+	if _, err := (&Conn{}).CreateUser(User{Username: "a"}); err == nil {
+		t.Fatalf("created a user without management credentials")
+	}
+	if _, err := c.CreateUser(User{Username: "a", Type: "admin"}); err == nil {
+		t.Fatalf("created a user of an unknown type")
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	password, err := generatePassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, class := range []string{"abcdefghijkmnopqrstuvwxyz", "ABCDEFGHJKLMNPQRSTUVWXYZ", "23456789", "!#%+-=@_"} {
+		if !strings.ContainsAny(password, class) {
+			t.Fatalf("password %q has none of %q", password, class)
+		}
+	}
+}
@@ -1,14 +1,56 @@
 package memphis
 
 import (
-	"errors"
 	"strings"
 )
 
+// memphisErr - keeps the wrapped error reachable through errors.Is/errors.As
+// while presenting memphis naming in the message.
+type memphisErr struct {
+	message string
+	err     error
+}
+
+func (e *memphisErr) Error() string {
+	return e.message
+}
+
+func (e *memphisErr) Unwrap() error {
+	return e.err
+}
+
 func memphisError(err error) error {
 	if err == nil {
 		return nil
 	}
 	message := strings.Replace(err.Error(), "nats", "memphis", -1)
-	return errors.New(message)
+	return &memphisErr{message: message, err: err}
+}
+
+// multiError - aggregates the errors of a multi step operation.
+type multiError []error
+
+func (m *multiError) add(err error) {
+	if err != nil {
+		*m = append(*m, err)
+	}
+}
+
+func (m multiError) err() error {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+func (m multiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m multiError) Unwrap() []error {
+	return m
 }